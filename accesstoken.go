@@ -0,0 +1,301 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Bereiche, auf die ein persönliches Zugriffstoken beschränkt werden kann
+const (
+	scopeTasksRead    = "tasks:read"
+	scopeTasksWrite   = "tasks:write"
+	scopeSharesManage = "shares:manage"
+)
+
+var accessTokenScopes = []string{scopeTasksRead, scopeTasksWrite, scopeSharesManage}
+
+// credentialUsageInterval ist der Abstand, in dem last_used_at von Zugriffstoken und App-Passwörtern höchstens aktualisiert wird,
+// damit nicht jede Anfrage eines Skripts bzw. Clients einen Schreibzugriff auf die Datenbank auslöst
+const credentialUsageInterval = time.Minute
+
+// accessTokenPrefix kennzeichnet persönliche Zugriffstoken, damit jwtMiddleware sie von einem JWT unterscheiden kann
+const accessTokenPrefix = "gtpat_"
+
+// sessionOnlyRoutes sind die Bereiche unter /api, in denen Anmeldedaten, geheime Adressen oder Administration verwaltet werden und die ein Zugriffstoken nicht erreicht
+var sessionOnlyRoutes = []string{"tokens", "apppasswords", "oidc", "totp", "account", "feeds", "inbound", "webhooks", "admin"}
+
+var errAccessTokenNotFound = errors.New("Zugriffstoken konnte nicht gefunden werden")
+
+// accessToken ist ein langlebiges Token für Skripte, das statt eines JWT im Header Authorization gesendet wird
+// gespeichert wird nur der SHA-256-Hash, das Token selbst wird ausschließlich beim Anlegen angezeigt
+type accessToken struct {
+	ID         int        `json:"id"`
+	Label      string     `json:"label"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt,omitempty"`
+}
+
+// AddAccessToken erzeugt ein neues persönliches Zugriffstoken für einen Benutzer
+//
+// Parameter:
+//   - name: Der Name des Benutzers
+//   - label: Die Bezeichnung des Tokens, z.B. der Name des Skripts
+//   - scopes: Die erlaubten Bereiche
+//
+// Rückgabewert:
+//   - token: Das angelegte Zugriffstoken ohne Geheimnis
+//   - secret: Das Zugriffstoken im Klartext
+//   - error: Ein Fehler, falls beim Anlegen ein Fehler auftritt; "nil", falls nicht
+func (s *sqlStore) AddAccessToken(name, label string, scopes []string) (token accessToken, secret string, err error) {
+	secret, err = newSecretToken()
+	if err != nil {
+		return accessToken{}, "", err
+	}
+	secret = accessTokenPrefix + secret
+
+	token = accessToken{Label: label, Scopes: scopes, CreatedAt: time.Now().Truncate(time.Second)}
+	query := `INSERT INTO access_tokens (user_id, label, token_hash, scopes, created_at) VALUES (` + userIDSQL + `,?,?,?,?) RETURNING id`
+	err = s.db.QueryRow(query, name, label, hashSecretToken(secret), strings.Join(scopes, ","), token.CreatedAt.Unix()).Scan(&token.ID)
+	if err != nil {
+		return accessToken{}, "", err
+	}
+	return token, secret, nil
+}
+
+// GetAccessTokensForUser lädt alle persönlichen Zugriffstoken eines Benutzers
+//
+// Parameter:
+//   - name: Der Name des Benutzers
+//
+// Rückgabewert:
+//   - tokens: Die Zugriffstoken ohne Geheimnis, die ältesten zuerst
+//   - error: Ein Fehler, falls bei der Abfrage ein Fehler auftritt; "nil", falls nicht
+func (s *sqlStore) GetAccessTokensForUser(name string) ([]accessToken, error) {
+	rows, err := s.db.Query(`SELECT id, label, scopes, created_at, last_used_at FROM access_tokens WHERE user_id = `+userIDSQL+` ORDER BY id`, name)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := make([]accessToken, 0)
+	for rows.Next() {
+		var token accessToken
+		var scopes string
+		var createdAt int64
+		var lastUsedAt *int64
+		err = rows.Scan(&token.ID, &token.Label, &scopes, &createdAt, &lastUsedAt)
+		if err != nil {
+			return nil, err
+		}
+		token.Scopes = strings.Split(scopes, ",")
+		token.CreatedAt = time.Unix(createdAt, 0)
+		token.LastUsedAt = unixTime(lastUsedAt)
+		tokens = append(tokens, token)
+	}
+	return tokens, rows.Err()
+}
+
+// DeleteAccessToken widerruft ein persönliches Zugriffstoken, Anfragen damit werden danach abgelehnt
+//
+// Parameter:
+//   - name: Der Name des Benutzers
+//   - id: Die ID des Zugriffstokens
+//
+// Rückgabewert:
+//   - error: errAccessTokenNotFound, falls das Token nicht dem Benutzer gehört; "nil", falls kein Fehler auftritt
+func (s *sqlStore) DeleteAccessToken(name string, id int) error {
+	result, err := s.db.Exec(`DELETE FROM access_tokens WHERE id = ? AND user_id = `+userIDSQL, id, name)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return errAccessTokenNotFound
+	}
+	return nil
+}
+
+// CheckAccessToken prüft ein persönliches Zugriffstoken und vermerkt bei Erfolg den Zeitpunkt der Verwendung,
+// sofern der gespeicherte älter als credentialUsageInterval ist
+//
+// Parameter:
+//   - secret: Das übermittelte Zugriffstoken
+//
+// Rückgabewert:
+//   - name: Der Name des Benutzers, dem das Token gehört
+//   - scopes: Die erlaubten Bereiche des Tokens
+//   - error: errAccessTokenNotFound, falls das Token unbekannt oder widerrufen ist; "nil", falls kein Fehler auftritt
+func (s *sqlStore) CheckAccessToken(secret string) (name string, scopes []string, err error) {
+	var id int
+	var joined string
+	var lastUsedAt *int64
+	err = s.db.QueryRow(`SELECT id, `+userNameSQL("user_id")+`, scopes, last_used_at FROM access_tokens WHERE token_hash = ?`,
+		hashSecretToken(secret)).Scan(&id, &name, &joined, &lastUsedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil, errAccessTokenNotFound
+	}
+	if err != nil {
+		return "", nil, err
+	}
+
+	now := time.Now()
+	if lastUsedAt == nil || *lastUsedAt < now.Add(-credentialUsageInterval).Unix() {
+		_, err = s.db.Exec(`UPDATE access_tokens SET last_used_at = ? WHERE id = ?`, now.Unix(), id)
+		if err != nil {
+			return "", nil, err
+		}
+	}
+	return name, strings.Split(joined, ","), nil
+}
+
+// requiredScope bestimmt den Bereich, den ein Zugriffstoken für eine Anfrage benötigt
+// lesende Anfragen benötigen tasks:read, das Teilen von Aufgaben shares:manage und alle übrigen Änderungen tasks:write
+// die Bereiche unter sessionOnlyRoutes können nur nach einer Anmeldung verwaltet werden, dafür wird "" zurückgegeben
+//
+// Parameter:
+//   - method: Die http-Methode der Anfrage
+//   - path: Der Pfad der Anfrage
+//
+// Rückgabewert:
+//   - string: Der benötigte Bereich; "", falls die Route mit einem Zugriffstoken nicht erreichbar ist
+func requiredScope(method, path string) string {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	if len(parts) >= 2 && slices.Contains(sessionOnlyRoutes, parts[1]) {
+		return ""
+	}
+	if method == fiber.MethodGet || method == fiber.MethodHead {
+		return scopeTasksRead
+	}
+	// /api/tasks/:id/:target gibt eine Aufgabe frei bzw. hebt die Freigabe auf
+	if len(parts) == 4 && parts[1] == "tasks" && (method == fiber.MethodPost || method == fiber.MethodDelete) {
+		return scopeSharesManage
+	}
+	return scopeTasksWrite
+}
+
+// authenticateAccessToken meldet eine Anfrage mit einem persönlichen Zugriffstoken an, sofern das Token den benötigten Bereich besitzt
+//
+// Parameter:
+//   - c: Ein Pointer auf ein Context-Objekt von fiber
+//   - secret: Das übermittelte Zugriffstoken
+//
+// Rückgabewert:
+//   - error: Ein Fehler, falls das Token ungültig ist oder der Bereich fehlt - wird an Client gesendet
+//     Bei Erfolg wird die nächste Methode auf dem Stack der aktuellen Route ausgeführt
+func (srv *server) authenticateAccessToken(c *fiber.Ctx, secret string) error {
+	name, scopes, err := srv.store.CheckAccessToken(secret)
+	if errors.Is(err, errAccessTokenNotFound) {
+		return c.Status(401).JSON(fiber.Map{"error": "Ungültiges Token"})
+	}
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(401).JSON(fiber.Map{"error": "Ungültiges Token"})
+	}
+
+	scope := requiredScope(c.Method(), c.Path())
+	if scope == "" {
+		return c.Status(403).JSON(fiber.Map{"error": "Diese Route ist mit einem Zugriffstoken nicht erreichbar"})
+	}
+	if !slices.Contains(scopes, scope) {
+		return c.Status(403).JSON(fiber.Map{"error": "Dem Zugriffstoken fehlt der Bereich " + scope})
+	}
+	c.Locals("name", name)
+	return c.Next()
+}
+
+// HandleGetAccessTokens sendet alle persönlichen Zugriffstoken des anfragenden Benutzers ohne Geheimnis
+//
+// Parameter:
+//   - c: Ein Pointer auf ein Context-Objekt von fiber
+//
+// Rückgabewert:
+//   - error: Ein Fehler, falls beim Laden ein Fehler auftritt - wird an Client gesendet
+func (srv *server) HandleGetAccessTokens(c *fiber.Ctx) error {
+	name := c.Locals("name").(string)
+
+	tokens, err := srv.store.GetAccessTokensForUser(name)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(400).JSON(fiber.Map{"error": "Zugriffstoken konnten nicht geladen werden"})
+	}
+	return c.Status(200).JSON(fiber.Map{"tokens": tokens})
+}
+
+// HandleAddAccessToken legt ein neues persönliches Zugriffstoken an, z.B. {"label": "Backup-Skript", "scopes": ["tasks:read"]}
+// das Token wird nur in dieser Antwort im Klartext gesendet
+//
+// Parameter:
+//   - c: Ein Pointer auf ein Context-Objekt von fiber
+//
+// Rückgabewert:
+//   - error: Ein Fehler, falls Bezeichnung oder Bereiche ungültig sind oder beim Anlegen ein Fehler auftritt - wird an Client gesendet
+func (srv *server) HandleAddAccessToken(c *fiber.Ctx) error {
+	name := c.Locals("name").(string)
+	type AccessTokenInput struct {
+		Label  string   `json:"label"`
+		Scopes []string `json:"scopes"`
+	}
+	var input AccessTokenInput
+	if err := c.BodyParser(&input); err != nil {
+		fmt.Println(err)
+		return c.Status(400).JSON(fiber.Map{"error": "Ungültige Eingabedaten"})
+	}
+	if strings.TrimSpace(input.Label) == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "Bezeichnung darf nicht leer sein"})
+	}
+	if len(input.Scopes) == 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "Mindestens ein Bereich muss angegeben werden"})
+	}
+	scopes := make([]string, 0, len(input.Scopes))
+	for _, scope := range input.Scopes {
+		if !slices.Contains(accessTokenScopes, scope) {
+			return c.Status(400).JSON(fiber.Map{"error": "Unbekannter Bereich: " + scope})
+		}
+		if !slices.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+
+	token, secret, err := srv.store.AddAccessToken(name, strings.TrimSpace(input.Label), scopes)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(400).JSON(fiber.Map{"error": "Zugriffstoken konnte nicht angelegt werden"})
+	}
+	return c.Status(201).JSON(fiber.Map{"token": token, "secret": secret})
+}
+
+// HandleDeleteAccessToken widerruft ein persönliches Zugriffstoken des anfragenden Benutzers
+//
+// Parameter:
+//   - c: Ein Pointer auf ein Context-Objekt von fiber
+//
+// Rückgabewert:
+//   - error: Ein Fehler, falls das Zugriffstoken nicht existiert - wird an Client gesendet
+func (srv *server) HandleDeleteAccessToken(c *fiber.Ctx) error {
+	name := c.Locals("name").(string)
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Ungültige Eingabedaten"})
+	}
+
+	err = srv.store.DeleteAccessToken(name, id)
+	if errors.Is(err, errAccessTokenNotFound) {
+		return c.Status(404).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(400).JSON(fiber.Map{"error": "Zugriffstoken konnte nicht widerrufen werden"})
+	}
+	return c.Status(200).JSON(fiber.Map{"msg": "Zugriffstoken erfolgreich widerrufen"})
+}
@@ -0,0 +1,566 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+var (
+	errUserExists     = errors.New("Dieser Benutzername ist bereits vergeben")
+	errSessionRevoked = errors.New("Die Sitzung ist nicht mehr gültig, bitte erneut anmelden")
+)
+
+// account ist ein Benutzer mit seiner stabilen ID, die sich anders als der Name bei einer Umbenennung nicht ändert
+// TokenVersion wird bei jeder Passwortänderung erhöht, wodurch alle zuvor ausgestellten JWT ungültig werden
+// Admin hängt am Benutzer und geht daher bei einer Umbenennung mit
+type account struct {
+	ID           int    `json:"id"`
+	Name         string `json:"name"`
+	Email        string `json:"email,omitempty"`
+	Admin        bool   `json:"admin"`
+	TokenVersion int    `json:"-"`
+}
+
+// accountDeletion beschreibt, welche Aufgaben beim Löschen eines Kontos übertragen bzw. entfernt wurden
+type accountDeletion struct {
+	// Transferred enthält die IDs der Aufgaben, die an den Zielbenutzer übertragen wurden
+	Transferred []int
+	// Removed enthält je gelöschter Aufgabe die Zielbenutzer, bei denen sie bisher angezeigt wurde
+	Removed map[int][]string
+}
+
+// accountColumns sind die Spalten, die scanAccount erwartet
+const accountColumns = `id, name, COALESCE(email, ''), is_admin, token_version`
+
+// scanAccount liest einen Benutzer aus einer Abfrage auf accountColumns
+//
+// Parameter:
+//   - row: Die Ergebniszeile der Abfrage
+//
+// Rückgabewert:
+//   - user: Der gelesene Benutzer; "nil", falls ein Fehler auftritt
+//   - error: errUserNotFound, falls der Benutzer nicht existiert; "nil", falls kein Fehler auftritt
+func scanAccount(row *sql.Row) (*account, error) {
+	var user account
+	err := row.Scan(&user.ID, &user.Name, &user.Email, &user.Admin, &user.TokenVersion)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// GetAccount lädt einen Benutzer über seinen Namen
+//
+// Parameter:
+//   - name: Der Name des Benutzers
+//
+// Rückgabewert:
+//   - user: Der Benutzer mit ID und Sitzungsversion; "nil", falls ein Fehler auftritt
+//   - error: errUserNotFound, falls der Benutzer nicht existiert; "nil", falls kein Fehler auftritt
+func (s *sqlStore) GetAccount(name string) (*account, error) {
+	return scanAccount(s.db.QueryRow(`SELECT `+accountColumns+` FROM users WHERE name = ?`, name))
+}
+
+// GetAccountByID lädt einen Benutzer über seine stabile ID
+//
+// Parameter:
+//   - id: Die ID des Benutzers
+//
+// Rückgabewert:
+//   - user: Der Benutzer mit seinem aktuellen Namen und seiner Sitzungsversion; "nil", falls ein Fehler auftritt
+//   - error: errUserNotFound, falls der Benutzer nicht existiert; "nil", falls kein Fehler auftritt
+func (s *sqlStore) GetAccountByID(id int) (*account, error) {
+	return scanAccount(s.db.QueryRow(`SELECT `+accountColumns+` FROM users WHERE id = ?`, id))
+}
+
+// ChangePassword setzt ein neues Passwort und erhöht die Sitzungsversion, sodass alle bisherigen JWT ungültig werden
+// Zugriffstoken und App-Passwörter werden in derselben Transaktion widerrufen, siehe revokeCredentials
+//
+// Parameter:
+//   - name: Der Name des Benutzers
+//   - password: Das neue Passwort
+//
+// Rückgabewert:
+//   - user: Der Benutzer mit der neuen Sitzungsversion; "nil", falls ein Fehler auftritt
+//   - error: errPasswordTooLong, falls das Passwort zu lang ist; errUserNotFound, falls der Benutzer nicht existiert; "nil", falls kein Fehler auftritt
+func (s *sqlStore) ChangePassword(name, password string) (*account, error) {
+	hash, err := hashPassword(password)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	query := `UPDATE users SET password = ?, token_version = token_version + 1 WHERE name = ? RETURNING ` + accountColumns
+	user, err := scanAccount(tx.QueryRow(query, hash, name))
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	err = revokeCredentials(tx, name)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	return user, nil
+}
+
+// revokeCredentials löscht innerhalb einer Transaktion alle Zugriffstoken und App-Passwörter eines Benutzers
+// nach einer Passwortänderung bzw. dem Zurücksetzen dürfen keine Zugangsdaten gültig bleiben, die ein Angreifer zuvor angelegt haben könnte
+//
+// Parameter:
+//   - tx: Die laufende Transaktion
+//   - name: Der Name des Benutzers
+//
+// Rückgabewert:
+//   - error: Ein Fehler, falls beim Löschen ein Fehler auftritt; "nil", falls nicht
+func revokeCredentials(tx *sqlTx, name string) error {
+	_, err := tx.Exec(`DELETE FROM access_tokens WHERE user_id = `+userIDSQL, name)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`DELETE FROM app_passwords WHERE user_id = `+userIDSQL, name)
+	return err
+}
+
+// RenameUser ändert den Namen eines Benutzers
+// alle Fremdschlüssel verweisen auf users(id), daher bleiben Daten, Sitzungen und Zugriffstoken ohne weitere Änderungen gültig
+//
+// Parameter:
+//   - name: Der bisherige Name des Benutzers
+//   - newName: Der neue Name
+//
+// Rückgabewert:
+//   - error: errUserExists, falls der neue Name bereits vergeben ist; errUserNotFound, falls der Benutzer nicht existiert; "nil", falls kein Fehler auftritt
+func (s *sqlStore) RenameUser(name, newName string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	var exists bool
+	err = tx.QueryRow(`SELECT EXISTS(SELECT 1 FROM users WHERE name = ?)`, newName).Scan(&exists)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if exists {
+		tx.Rollback()
+		return errUserExists
+	}
+
+	result, err := tx.Exec(`UPDATE users SET name = ? WHERE name = ?`, newName, name)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if affected == 0 {
+		tx.Rollback()
+		return errUserNotFound
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return nil
+}
+
+// DeleteUser löscht einen Benutzer mit allen seinen Daten, alle Verweise werden über ON DELETE CASCADE entfernt
+// ist transferTo angegeben, werden vorher die nicht gelöschten Aufgaben, die für transferTo freigegeben sind, in seine Standardkategorie verschoben;
+// seine bisherige Freigabe der Aufgabe entfällt, andere Freigaben bleiben erhalten. Aufgaben, die transferTo bisher nicht sehen konnte, werden gelöscht
+//
+// Parameter:
+//   - name: Der Name des Benutzers
+//   - transferTo: Der Name des Benutzers, der die für ihn freigegebenen Aufgaben übernimmt; "", falls alle Aufgaben gelöscht werden
+//
+// Rückgabewert:
+//   - deletion: Die übertragenen bzw. entfernten Aufgaben; "nil", falls ein Fehler auftritt
+//   - error: errUserNotFound, falls der Benutzer oder der Zielbenutzer nicht existiert; "nil", falls kein Fehler auftritt
+func (s *sqlStore) DeleteUser(name, transferTo string) (*accountDeletion, error) {
+	transferredQuery := `SELECT t.id FROM tasks t
+	LEFT JOIN task_order o ON o.task_id = t.id AND o.user_id = t.user_id AND o.view_key = ''
+	WHERE t.user_id = ` + userIDSQL + ` AND t.deleted_at IS NULL
+	AND EXISTS(SELECT 1 FROM sharing s WHERE s.task_id = t.id AND s.target_id = ` + userIDSQL + `)
+	ORDER BY o.rank_key IS NULL, o.rank_key, t.id`
+	transferQuery := `UPDATE tasks SET user_id = ` + userIDSQL + `, category_id = ?, trashed_category_id = NULL WHERE id = ?`
+	unshareQuery := `DELETE FROM sharing WHERE task_id = ? AND target_id = ` + userIDSQL
+	orderExistsQuery := `SELECT EXISTS(SELECT 1 FROM task_order WHERE user_id = ` + userIDSQL + ` AND task_id = ? AND view_key = '')`
+	orderQuery := `INSERT INTO task_order (user_id, task_id, rank_key) VALUES (` + userIDSQL + `,?,?)`
+	removedQuery := `SELECT id FROM tasks WHERE user_id = ` + userIDSQL + ` AND deleted_at IS NULL ORDER BY id`
+	sharesQuery := `SELECT s.task_id, u.name FROM sharing s INNER JOIN tasks t ON t.id = s.task_id INNER JOIN users u ON u.id = s.target_id
+	WHERE t.user_id = ` + userIDSQL + ` AND t.deleted_at IS NULL AND t.archived_at IS NULL ORDER BY s.task_id, u.name`
+
+	deletion := &accountDeletion{Transferred: []int{}, Removed: map[int][]string{}}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	if transferTo != "" {
+		var defaultID int
+		err = tx.QueryRow(`SELECT default_category_id FROM users WHERE name = ?`, transferTo).Scan(&defaultID)
+		if err != nil {
+			tx.Rollback()
+			if errors.Is(err, sql.ErrNoRows) {
+				return nil, errUserNotFound
+			}
+			return nil, err
+		}
+
+		deletion.Transferred, err = queryTaskIDs(tx, transferredQuery, name, transferTo)
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+
+		for _, taskID := range deletion.Transferred {
+			_, err = tx.Exec(transferQuery, transferTo, defaultID, taskID)
+			if err == nil {
+				_, err = tx.Exec(unshareQuery, taskID, transferTo)
+			}
+			if err != nil {
+				tx.Rollback()
+				return nil, err
+			}
+
+			var exists bool
+			err = tx.QueryRow(orderExistsQuery, transferTo, taskID).Scan(&exists)
+			if err == nil && !exists {
+				var rankKey string
+				rankKey, err = lastRankForUser(tx, transferTo)
+				if err == nil {
+					_, err = tx.Exec(orderQuery, transferTo, taskID, rankBetween(rankKey, ""))
+				}
+			}
+			if err == nil {
+				err = insertWebhookDeliveries(tx, webhookEvent{Type: webhookTaskUpdated, Actor: transferTo, TaskID: taskID})
+			}
+			if err != nil {
+				tx.Rollback()
+				return nil, err
+			}
+		}
+	}
+
+	// alle übrigen Aufgaben außerhalb des Papierkorbs werden mit dem Benutzer gelöscht
+	rows, err := tx.Query(sharesQuery, name)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	for rows.Next() {
+		var taskID int
+		var target string
+		err = rows.Scan(&taskID, &target)
+		if err != nil {
+			rows.Close()
+			tx.Rollback()
+			return nil, err
+		}
+		deletion.Removed[taskID] = append(deletion.Removed[taskID], target)
+	}
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	removed, err := queryTaskIDs(tx, removedQuery, name)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	for _, taskID := range removed {
+		err = insertWebhookDeliveries(tx, webhookEvent{Type: webhookTaskDeleted, Actor: name, TaskID: taskID})
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+
+	result, err := tx.Exec(`DELETE FROM users WHERE name = ?`, name)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if affected == 0 {
+		tx.Rollback()
+		return nil, errUserNotFound
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	return deletion, nil
+}
+
+// sessionUser prüft die Sitzung eines JWT gegen den gespeicherten Benutzer
+// Token ohne ID, von gelöschten Benutzern oder mit veralteter Sitzungsversion werden abgelehnt
+//
+// Parameter:
+//   - claims: Die Claims des bereits geprüften JWT
+//
+// Rückgabewert:
+//   - name: Der aktuelle Name des Benutzers; "", falls die Sitzung ungültig ist
+//   - error: errSessionRevoked, falls die Sitzung nicht mehr gültig ist; "nil", falls nicht
+func (srv *server) sessionUser(claims *Claims) (string, error) {
+	if claims.UserID == 0 {
+		return "", errSessionRevoked
+	}
+	user, err := srv.store.GetAccountByID(claims.UserID)
+	if errors.Is(err, errUserNotFound) || (err == nil && user.TokenVersion != claims.Version) {
+		return "", errSessionRevoked
+	}
+	if err != nil {
+		return "", err
+	}
+	return user.Name, nil
+}
+
+// renameClient trägt die WebSocket-Verbindung eines umbenannten Benutzers unter seinem neuen Namen ein
+//
+// Parameter:
+//   - name: Der bisherige Name des Benutzers
+//   - newName: Der neue Name
+func renameClient(name, newName string) {
+	mu.Lock()
+	defer mu.Unlock()
+	if conn, ok := clients[name]; ok {
+		delete(clients, name)
+		clients[newName] = conn
+	}
+}
+
+// closeClient trennt die WebSocket-Verbindung eines Benutzers, dessen Sitzungen widerrufen wurden oder dessen Konto gelöscht wurde
+//
+// Parameter:
+//   - name: Der Name des Benutzers
+func closeClient(name string) {
+	mu.Lock()
+	defer mu.Unlock()
+	if conn, ok := clients[name]; ok {
+		delete(clients, name)
+		conn.Close()
+	}
+}
+
+// confirmPassword prüft vor einer Änderung am Konto das aktuelle Passwort des Benutzers
+// Fehlversuche werden wie bei der Anmeldung protokolliert und gedrosselt
+//
+// Parameter:
+//   - c: Ein Pointer auf ein Context-Objekt von fiber
+//   - name: Der Name des angemeldeten Benutzers
+//   - password: Das eingegebene aktuelle Passwort
+//
+// Rückgabewert:
+//   - bool: "true", falls das Passwort abgelehnt und die Antwort bereits gesendet wurde
+//   - error: Der Fehler beim Senden der Antwort
+func (srv *server) confirmPassword(c *fiber.Ctx, name, password string) (bool, error) {
+	if throttled, err := srv.checkLoginThrottle(c, name); throttled {
+		return true, err
+	}
+	err := srv.store.CheckPassword(name, password)
+	if err != nil && !errors.Is(err, errBadCredentials) {
+		fmt.Println(err)
+		return true, c.Status(400).JSON(fiber.Map{"error": "Passwort konnte nicht geprüft werden"})
+	}
+	if err != nil {
+		srv.recordLoginFailure(c, name)
+		return true, c.Status(400).JSON(fiber.Map{"error": "Das Passwort ist nicht korrekt"})
+	}
+	return false, nil
+}
+
+// HandleGetAccount liefert die stabile ID, den aktuellen Namen und die E-Mail-Adresse des angemeldeten Benutzers
+//
+// Parameter:
+//   - c: Ein Pointer auf ein Context-Objekt von fiber
+//
+// Rückgabewert:
+//   - error: Ein Fehler, falls der Benutzer nicht geladen werden kann - wird an Client gesendet
+func (srv *server) HandleGetAccount(c *fiber.Ctx) error {
+	name := c.Locals("name").(string)
+	user, err := srv.store.GetAccount(name)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(400).JSON(fiber.Map{"error": "Konto konnte nicht geladen werden"})
+	}
+	return c.Status(200).JSON(user)
+}
+
+// HandleChangePassword ändert das Passwort des angemeldeten Benutzers, z.B. {"currentPassword": "...", "newPassword": "..."}
+// alle bisherigen Sitzungen, Zugriffstoken und App-Passwörter werden widerrufen, der Client erhält ein neues token und muss die WebSocket-Verbindung damit neu aufbauen
+//
+// Parameter:
+//   - c: Ein Pointer auf ein Context-Objekt von fiber
+//
+// Rückgabewert:
+//   - error: Ein Fehler, falls das aktuelle Passwort falsch ist oder beim Speichern ein Fehler auftritt - wird an Client gesendet
+func (srv *server) HandleChangePassword(c *fiber.Ctx) error {
+	name := c.Locals("name").(string)
+	type PasswordInput struct {
+		CurrentPassword string `json:"currentPassword"`
+		NewPassword     string `json:"newPassword"`
+	}
+	var input PasswordInput
+	if err := c.BodyParser(&input); err != nil {
+		fmt.Println(err)
+		return c.Status(400).JSON(fiber.Map{"error": "Ungültige Eingabedaten"})
+	}
+	if strings.TrimSpace(input.NewPassword) == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "Das neue Passwort darf nicht leer sein"})
+	}
+	if rejected, err := srv.confirmPassword(c, name, input.CurrentPassword); rejected {
+		return err
+	}
+
+	user, err := srv.store.ChangePassword(name, input.NewPassword)
+	if errors.Is(err, errPasswordTooLong) {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(400).JSON(fiber.Map{"error": "Passwort konnte nicht geändert werden"})
+	}
+	srv.clearLoginFailures(name)
+	closeClient(name)
+
+	token, err := generateJWT(user)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(400).JSON(fiber.Map{"error": "Passwort geändert, bitte erneut anmelden"})
+	}
+	return c.Status(200).JSON(fiber.Map{"msg": "Passwort erfolgreich geändert", "token": token})
+}
+
+// HandleRenameAccount ändert den Namen des angemeldeten Benutzers, z.B. {"name": "neuer-name"}
+// Aufgaben, Freigaben und Zugangsdaten werden übernommen; bestehende Sitzungen bleiben gültig, da sie an die ID gebunden sind
+//
+// Parameter:
+//   - c: Ein Pointer auf ein Context-Objekt von fiber
+//
+// Rückgabewert:
+//   - error: Ein Fehler, falls der Name leer oder vergeben ist - wird an Client gesendet
+func (srv *server) HandleRenameAccount(c *fiber.Ctx) error {
+	name := c.Locals("name").(string)
+	type RenameInput struct {
+		Name string `json:"name"`
+	}
+	var input RenameInput
+	if err := c.BodyParser(&input); err != nil {
+		fmt.Println(err)
+		return c.Status(400).JSON(fiber.Map{"error": "Ungültige Eingabedaten"})
+	}
+	newName := strings.TrimSpace(input.Name)
+	if newName == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "Der Benutzername darf nicht leer sein"})
+	}
+	if newName != name {
+		err := srv.store.RenameUser(name, newName)
+		if err != nil {
+			fmt.Println(err)
+			if errors.Is(err, errUserExists) {
+				return c.Status(409).JSON(fiber.Map{"error": err.Error()})
+			}
+			return c.Status(400).JSON(fiber.Map{"error": "Benutzer konnte nicht umbenannt werden"})
+		}
+		renameClient(name, newName)
+	}
+
+	user, err := srv.store.GetAccount(newName)
+	if err == nil {
+		var token string
+		token, err = generateJWT(user)
+		if err == nil {
+			return c.Status(200).JSON(fiber.Map{"msg": "Benutzer erfolgreich umbenannt", "name": user.Name, "token": token})
+		}
+	}
+	fmt.Println(err)
+	return c.Status(400).JSON(fiber.Map{"error": "Benutzer umbenannt, bitte erneut anmelden"})
+}
+
+// HandleDeleteAccount löscht das Konto des angemeldeten Benutzers, z.B. {"password": "...", "transferTo": "bob"}
+// ohne transferTo werden die eigenen Aufgaben gelöscht und bei allen Zielbenutzern entfernt, sonst übernimmt transferTo die für ihn freigegebenen Aufgaben
+//
+// Parameter:
+//   - c: Ein Pointer auf ein Context-Objekt von fiber
+//
+// Rückgabewert:
+//   - error: Ein Fehler, falls das Passwort falsch ist, der Zielbenutzer nicht existiert oder beim Löschen ein Fehler auftritt - wird an Client gesendet
+func (srv *server) HandleDeleteAccount(c *fiber.Ctx) error {
+	name := c.Locals("name").(string)
+	type DeleteInput struct {
+		Password   string `json:"password"`
+		TransferTo string `json:"transferTo"`
+	}
+	var input DeleteInput
+	if err := c.BodyParser(&input); err != nil {
+		fmt.Println(err)
+		return c.Status(400).JSON(fiber.Map{"error": "Ungültige Eingabedaten"})
+	}
+	transferTo := strings.TrimSpace(input.TransferTo)
+	if transferTo == name {
+		return c.Status(400).JSON(fiber.Map{"error": "Aufgaben können nicht an das eigene Konto übertragen werden"})
+	}
+	if rejected, err := srv.confirmPassword(c, name, input.Password); rejected {
+		return err
+	}
+
+	deletion, err := srv.store.DeleteUser(name, transferTo)
+	if err != nil {
+		fmt.Println(err)
+		if errors.Is(err, errUserNotFound) && transferTo != "" {
+			return c.Status(404).JSON(fiber.Map{"error": "Der Zielbenutzer existiert nicht"})
+		}
+		return c.Status(400).JSON(fiber.Map{"error": "Konto konnte nicht gelöscht werden"})
+	}
+	closeClient(name)
+	srv.clearLoginFailures(name)
+
+	for taskID, targets := range deletion.Removed {
+		notifyTaskRemoved(targets, taskID)
+	}
+	for _, taskID := range deletion.Transferred {
+		srv.refreshSmartListsForTask(taskID)
+		transferred, err := srv.store.GetTaskForUser(transferTo, taskID)
+		if err != nil {
+			fmt.Println(err)
+			continue
+		}
+		srv.notifySharedTaskChanged(*transferred, name)
+	}
+	srv.wakeWebhookDelivery()
+	return c.Status(200).JSON(fiber.Map{"msg": "Konto erfolgreich gelöscht", "transferred": len(deletion.Transferred)})
+}
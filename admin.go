@@ -0,0 +1,103 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+)
+
+// IsAdmin prüft, ob ein Benutzer Administrator ist
+// die Rechte werden am Benutzer gespeichert und gehen daher nicht auf einen später registrierten Benutzer mit demselben Namen über
+//
+// Parameter:
+//   - name: Der Name des Benutzers
+//
+// Rückgabewert:
+//   - admin: "true", falls der Benutzer Administrator ist
+//   - error: errUserNotFound, falls der Benutzer nicht existiert; "nil", falls kein Fehler auftritt
+func (s *sqlStore) IsAdmin(name string) (admin bool, err error) {
+	err = s.db.QueryRow(`SELECT is_admin FROM users WHERE name = ?`, name).Scan(&admin)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, errUserNotFound
+	}
+	return admin, err
+}
+
+// SetUserAdmin vergibt bzw. entzieht einem Benutzer die Rechte eines Administrators
+//
+// Parameter:
+//   - name: Der Name des Benutzers
+//   - admin: "true", falls der Benutzer Administrator werden soll; "false", falls ihm die Rechte entzogen werden
+//
+// Rückgabewert:
+//   - error: errUserNotFound, falls der Benutzer nicht existiert; "nil", falls kein Fehler auftritt
+func (s *sqlStore) SetUserAdmin(name string, admin bool) error {
+	result, err := s.db.Exec(`UPDATE users SET is_admin = ? WHERE name = ?`, admin, name)
+	if err != nil {
+		return err
+	}
+	count, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return errUserNotFound
+	}
+	return nil
+}
+
+// isAdmin prüft, ob ein Benutzer Administrator ist; Fehler beim Laden werden protokolliert und als "kein Administrator" gewertet
+//
+// Parameter:
+//   - name: Der Name des Benutzers
+//
+// Rückgabewert:
+//   - bool: "true", falls der Benutzer Administrator ist
+func (srv *server) isAdmin(name string) bool {
+	admin, err := srv.store.IsAdmin(name)
+	if err != nil {
+		fmt.Println(err)
+		return false
+	}
+	return admin
+}
+
+// runAdminCommand vergibt bzw. entzieht als Unterbefehl "go-todo admin [-revoke] <name>" die Rechte eines Administrators
+//
+// Parameter:
+//   - store: Der Speicher mit den Benutzern
+//   - args: Die Argumente nach dem Unterbefehl
+//
+// Rückgabewert:
+//   - int: Der Exit-Code; 0 bei Erfolg, 1, falls der Benutzer nicht existiert, und 2 bei Fehlern
+func runAdminCommand(store Store, args []string) int {
+	flags := flag.NewFlagSet("admin", flag.ContinueOnError)
+	revoke := flags.Bool("revoke", false, "dem Benutzer die Rechte eines Administrators entziehen")
+	err := flags.Parse(args)
+	if err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "Verwendung: go-todo admin [-revoke] <name>")
+		return 2
+	}
+	name := flags.Arg(0)
+
+	err = store.SetUserAdmin(name, !*revoke)
+	if errors.Is(err, errUserNotFound) {
+		fmt.Fprintf(os.Stderr, "Benutzer %q existiert nicht\n", name)
+		return 1
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Rechte konnten nicht geändert werden:", err)
+		return 2
+	}
+	if *revoke {
+		fmt.Printf("%q ist kein Administrator mehr\n", name)
+	} else {
+		fmt.Printf("%q ist jetzt Administrator\n", name)
+	}
+	return 0
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+var errAppPasswordNotFound = errors.New("App-Passwort konnte nicht gefunden werden")
+
+// appPassword ist ein Passwort für Clients, die sich nicht per JWT anmelden können (z.B. CalDAV)
+// gespeichert wird nur der SHA-256-Hash, das Passwort selbst wird ausschließlich beim Anlegen angezeigt
+type appPassword struct {
+	ID         int        `json:"id"`
+	Label      string     `json:"label"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt,omitempty"`
+}
+
+// hashSecretToken berechnet den gespeicherten Hash eines App-Passworts oder Zugriffstokens
+// ein einfacher Hash genügt, da die Geheimnisse zufällig erzeugt werden und nicht erraten werden können
+//
+// Parameter:
+//   - secret: Das App-Passwort bzw. Zugriffstoken
+//
+// Rückgabewert:
+//   - string: Der Hash als Hex-Zeichenkette
+func hashSecretToken(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// AddAppPassword erzeugt ein neues App-Passwort für einen Benutzer
+//
+// Parameter:
+//   - name: Der Name des Benutzers
+//   - label: Die Bezeichnung des Passworts, z.B. der Name des Geräts
+//
+// Rückgabewert:
+//   - password: Das angelegte App-Passwort ohne Geheimnis
+//   - secret: Das App-Passwort im Klartext
+//   - error: Ein Fehler, falls beim Anlegen ein Fehler auftritt; "nil", falls nicht
+func (s *sqlStore) AddAppPassword(name, label string) (password appPassword, secret string, err error) {
+	secret, err = newSecretToken()
+	if err != nil {
+		return appPassword{}, "", err
+	}
+
+	password = appPassword{Label: label, CreatedAt: time.Now().Truncate(time.Second)}
+	query := `INSERT INTO app_passwords (user_id, label, password_hash, created_at) VALUES (` + userIDSQL + `,?,?,?) RETURNING id`
+	err = s.db.QueryRow(query, name, label, hashSecretToken(secret), password.CreatedAt.Unix()).Scan(&password.ID)
+	if err != nil {
+		return appPassword{}, "", err
+	}
+	return password, secret, nil
+}
+
+// GetAppPasswordsForUser lädt alle App-Passwörter eines Benutzers
+//
+// Parameter:
+//   - name: Der Name des Benutzers
+//
+// Rückgabewert:
+//   - passwords: Die App-Passwörter ohne Geheimnis, die ältesten zuerst
+//   - error: Ein Fehler, falls bei der Abfrage ein Fehler auftritt; "nil", falls nicht
+func (s *sqlStore) GetAppPasswordsForUser(name string) ([]appPassword, error) {
+	rows, err := s.db.Query(`SELECT id, label, created_at, last_used_at FROM app_passwords WHERE user_id = `+userIDSQL+` ORDER BY id`, name)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	passwords := make([]appPassword, 0)
+	for rows.Next() {
+		var password appPassword
+		var createdAt int64
+		var lastUsedAt *int64
+		err = rows.Scan(&password.ID, &password.Label, &createdAt, &lastUsedAt)
+		if err != nil {
+			return nil, err
+		}
+		password.CreatedAt = time.Unix(createdAt, 0)
+		password.LastUsedAt = unixTime(lastUsedAt)
+		passwords = append(passwords, password)
+	}
+	return passwords, rows.Err()
+}
+
+// DeleteAppPassword widerruft ein App-Passwort, Clients können sich damit danach nicht mehr anmelden
+//
+// Parameter:
+//   - name: Der Name des Benutzers
+//   - id: Die ID des App-Passworts
+//
+// Rückgabewert:
+//   - error: errAppPasswordNotFound, falls das Passwort nicht dem Benutzer gehört; "nil", falls kein Fehler auftritt
+func (s *sqlStore) DeleteAppPassword(name string, id int) error {
+	result, err := s.db.Exec(`DELETE FROM app_passwords WHERE id = ? AND user_id = `+userIDSQL, id, name)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return errAppPasswordNotFound
+	}
+	return nil
+}
+
+// CheckAppPassword prüft ein App-Passwort und vermerkt bei Erfolg den Zeitpunkt der Verwendung,
+// sofern der gespeicherte älter als credentialUsageInterval ist
+//
+// Parameter:
+//   - name: Der Name des Benutzers
+//   - secret: Das übermittelte App-Passwort
+//
+// Rückgabewert:
+//   - bool: "true", falls das Passwort zum Benutzer gehört
+//   - error: Ein Fehler, falls bei der Abfrage ein Fehler auftritt; "nil", falls nicht
+func (s *sqlStore) CheckAppPassword(name, secret string) (bool, error) {
+	var id int
+	var lastUsedAt *int64
+	err := s.db.QueryRow(`SELECT id, last_used_at FROM app_passwords WHERE user_id = `+userIDSQL+` AND password_hash = ?`,
+		name, hashSecretToken(secret)).Scan(&id, &lastUsedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	now := time.Now()
+	if lastUsedAt == nil || *lastUsedAt < now.Add(-credentialUsageInterval).Unix() {
+		_, err = s.db.Exec(`UPDATE app_passwords SET last_used_at = ? WHERE id = ?`, now.Unix(), id)
+		if err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// HandleGetAppPasswords sendet alle App-Passwörter des anfragenden Benutzers ohne Geheimnis
+//
+// Parameter:
+//   - c: Ein Pointer auf ein Context-Objekt von fiber
+//
+// Rückgabewert:
+//   - error: Ein Fehler, falls beim Laden ein Fehler auftritt - wird an Client gesendet
+func (srv *server) HandleGetAppPasswords(c *fiber.Ctx) error {
+	name := c.Locals("name").(string)
+
+	passwords, err := srv.store.GetAppPasswordsForUser(name)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(400).JSON(fiber.Map{"error": "App-Passwörter konnten nicht geladen werden"})
+	}
+	return c.Status(200).JSON(fiber.Map{"appPasswords": passwords})
+}
+
+// HandleAddAppPassword legt ein neues App-Passwort an, z.B. {"label": "Telefon"}
+// das Passwort wird nur in dieser Antwort im Klartext gesendet
+//
+// Parameter:
+//   - c: Ein Pointer auf ein Context-Objekt von fiber
+//
+// Rückgabewert:
+//   - error: Ein Fehler, falls die Bezeichnung fehlt oder beim Anlegen ein Fehler auftritt - wird an Client gesendet
+func (srv *server) HandleAddAppPassword(c *fiber.Ctx) error {
+	name := c.Locals("name").(string)
+	type AppPasswordInput struct {
+		Label string `json:"label"`
+	}
+	var input AppPasswordInput
+	if err := c.BodyParser(&input); err != nil {
+		fmt.Println(err)
+		return c.Status(400).JSON(fiber.Map{"error": "Ungültige Eingabedaten"})
+	}
+	if strings.TrimSpace(input.Label) == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "Bezeichnung darf nicht leer sein"})
+	}
+
+	password, secret, err := srv.store.AddAppPassword(name, strings.TrimSpace(input.Label))
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(400).JSON(fiber.Map{"error": "App-Passwort konnte nicht angelegt werden"})
+	}
+	return c.Status(201).JSON(fiber.Map{"appPassword": password, "password": secret})
+}
+
+// HandleDeleteAppPassword widerruft ein App-Passwort des anfragenden Benutzers
+//
+// Parameter:
+//   - c: Ein Pointer auf ein Context-Objekt von fiber
+//
+// Rückgabewert:
+//   - error: Ein Fehler, falls das App-Passwort nicht existiert - wird an Client gesendet
+func (srv *server) HandleDeleteAppPassword(c *fiber.Ctx) error {
+	name := c.Locals("name").(string)
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Ungültige Eingabedaten"})
+	}
+
+	err = srv.store.DeleteAppPassword(name, id)
+	if errors.Is(err, errAppPasswordNotFound) {
+		return c.Status(404).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(400).JSON(fiber.Map{"error": "App-Passwort konnte nicht widerrufen werden"})
+	}
+	return c.Status(200).JSON(fiber.Map{"msg": "App-Passwort erfolgreich widerrufen"})
+}
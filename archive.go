@@ -0,0 +1,487 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// archiveTasks führt eine Transaktion in der Datenbank aus, um mehrere Aufgaben zu archivieren
+// archivierte Aufgaben werden bei allen Benutzern ausgeblendet, behalten aber ihren Rangschlüssel für eine spätere Wiederherstellung
+// der Aufrufer muss vorher sicherstellen, dass die Aufgaben aktiv sind und archiviert werden dürfen;
+// die Webhook-Zustellungen werden im Namen des Besitzers der jeweiligen Aufgabe angelegt
+//
+// Parameter:
+//   - taskIDs: Die IDs der Aufgaben, welche archiviert werden sollen
+//
+// Rückgabewert:
+//   - archived: Je archivierter Aufgabe die Zielbenutzer, bei denen sie ausgeblendet wurde
+//   - error: Ein Fehler, falls bei der Transaktion ein Fehler auftritt; "nil", falls nicht
+func (s *sqlStore) archiveTasks(taskIDs []int) (archived map[int][]string, err error) {
+	archiveQuery := `UPDATE tasks SET archived_at = ? WHERE id = ? AND archived_at IS NULL AND deleted_at IS NULL`
+	ownerQuery := `SELECT ` + userNameSQL("user_id") + ` FROM tasks WHERE id = ?`
+	targets := make(map[int][]string)
+
+	for _, taskID := range taskIDs {
+		shared, err := s.GetSharedUsersForTask(taskID)
+		if err != nil {
+			return nil, err
+		}
+		targets[taskID] = shared
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().Unix()
+	for _, taskID := range taskIDs {
+		_, err = tx.Exec(archiveQuery, now, taskID)
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+
+		var owner string
+		err = tx.QueryRow(ownerQuery, taskID).Scan(&owner)
+		if err == nil {
+			err = insertWebhookDeliveries(tx, webhookEvent{Type: webhookTaskUpdated, Actor: owner, TaskID: taskID, Action: "archived"})
+		}
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	return targets, nil
+}
+
+// ArchiveTask archiviert eine einzelne aktive Aufgabe eines Benutzers
+//
+// Parameter:
+//   - name: Der Name des Benutzers, welcher die Aufgabe archivieren möchte
+//   - taskID: Die ID der Aufgabe
+//
+// Rückgabewert:
+//   - archived: Die archivierte Aufgabe mit den Zielbenutzern, bei denen sie ausgeblendet wurde
+//   - error: errTaskNotFound, falls die Aufgabe nicht dem Benutzer gehört, gelöscht oder bereits archiviert ist; "nil", falls kein Fehler auftritt
+func (s *sqlStore) ArchiveTask(name string, taskID int) (archived map[int][]string, err error) {
+	existQuery := `SELECT EXISTS(SELECT 1 FROM tasks WHERE id = ? AND user_id = ` + userIDSQL + ` AND deleted_at IS NULL AND archived_at IS NULL)`
+	var exists bool
+
+	err = s.db.QueryRow(existQuery, taskID, name).Scan(&exists)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, errTaskNotFound
+	}
+	return s.archiveTasks([]int{taskID})
+}
+
+// ArchiveDoneTasks archiviert alle erledigten, aktiven Aufgaben eines Benutzers
+//
+// Parameter:
+//   - name: Der Name des Benutzers, dessen erledigte Aufgaben archiviert werden sollen
+//
+// Rückgabewert:
+//   - archived: Je archivierter Aufgabe die Zielbenutzer, bei denen sie ausgeblendet wurde
+//   - error: Ein Fehler, falls beim Archivieren ein Fehler auftritt; "nil", falls nicht
+func (s *sqlStore) ArchiveDoneTasks(name string) (archived map[int][]string, err error) {
+	query := `SELECT id FROM tasks WHERE user_id = ` + userIDSQL + ` AND isDone AND deleted_at IS NULL AND archived_at IS NULL`
+
+	taskIDs, err := queryTaskIDs(s.db, query, name)
+	if err != nil {
+		return nil, err
+	}
+	if len(taskIDs) == 0 {
+		return map[int][]string{}, nil
+	}
+	return s.archiveTasks(taskIDs)
+}
+
+// AutoArchiveDoneTasks archiviert für alle Benutzer mit aktivierter automatischer Archivierung die Aufgaben,
+// die seit mehr als der eingestellten Anzahl an Tagen erledigt sind
+//
+// Parameter:
+//   - now: Der Zeitpunkt, von dem aus die Anzahl der Tage berechnet wird
+//
+// Rückgabewert:
+//   - archived: Je archivierter Aufgabe die Zielbenutzer, bei denen sie ausgeblendet wurde
+//   - error: Ein Fehler, falls beim Archivieren ein Fehler auftritt; "nil", falls nicht
+func (s *sqlStore) AutoArchiveDoneTasks(now time.Time) (archived map[int][]string, err error) {
+	query := `SELECT t.id FROM tasks t
+	INNER JOIN users u ON u.id = t.user_id
+	WHERE u.auto_archive_days > 0 AND t.isDone AND t.done_at IS NOT NULL
+	AND t.done_at < CAST(? AS BIGINT) - u.auto_archive_days * 86400
+	AND t.deleted_at IS NULL AND t.archived_at IS NULL`
+
+	taskIDs, err := queryTaskIDs(s.db, query, now.Unix())
+	if err != nil {
+		return nil, err
+	}
+	if len(taskIDs) == 0 {
+		return map[int][]string{}, nil
+	}
+	return s.archiveTasks(taskIDs)
+}
+
+// queryTaskIDs führt eine Abfrage aus, welche ausschließlich IDs von Aufgaben liefert
+//
+// Parameter:
+//   - q: Die Datenbank oder eine laufende Transaktion
+//   - query: Die auszuführende Abfrage
+//   - args: Die Parameter der Abfrage
+//
+// Rückgabewert:
+//   - taskIDs: Die gefundenen IDs
+//   - error: Ein Fehler, falls bei der Abfrage ein Fehler auftritt; "nil", falls nicht
+func queryTaskIDs(q sqlQueryer, query string, args ...interface{}) ([]int, error) {
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	taskIDs := make([]int, 0)
+	for rows.Next() {
+		var taskID int
+		err = rows.Scan(&taskID)
+		if err != nil {
+			return nil, err
+		}
+		taskIDs = append(taskIDs, taskID)
+	}
+	return taskIDs, rows.Err()
+}
+
+// UnarchiveTask führt eine Transaktion in der Datenbank aus, um eine archivierte Aufgabe wiederherzustellen
+// die Aufgabe erhält ihre ursprüngliche Position in der Reihenfolge zurück
+//
+// Parameter:
+//   - name: Der Name des Benutzers, welcher die Aufgabe wiederherstellen möchte
+//   - taskID: Die ID der archivierten Aufgabe
+//
+// Rückgabewert:
+//   - error: errTaskNotFound, falls die Aufgabe nicht im Archiv des Besitzers liegt; "nil", falls kein Fehler auftritt
+func (s *sqlStore) UnarchiveTask(name string, taskID int) error {
+	existQuery := `SELECT EXISTS(SELECT 1 FROM tasks WHERE id = ? AND user_id = ` + userIDSQL + ` AND deleted_at IS NULL AND archived_at IS NOT NULL)`
+	unarchiveQuery := `UPDATE tasks SET archived_at = NULL WHERE id = ?`
+	var exists bool
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	err = tx.QueryRow(existQuery, taskID, name).Scan(&exists)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if !exists {
+		tx.Rollback()
+		return errTaskNotFound
+	}
+
+	_, err = tx.Exec(unarchiveQuery, taskID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = insertWebhookDeliveries(tx, webhookEvent{Type: webhookTaskUpdated, Actor: name, TaskID: taskID, Action: "unarchived"})
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return nil
+}
+
+// GetArchivedTasksForUser lädt alle archivierten Aufgaben, die einem Benutzer gehören bzw. für ihn freigegeben sind
+// optional kann nach einem Suchbegriff in Titel und Beschreibung gefiltert werden
+//
+// Parameter:
+//   - name: Der Name des Benutzers
+//   - search: Der Suchbegriff; "", falls alle archivierten Aufgaben geladen werden sollen
+//
+// Rückgabewert:
+//   - tasks: Die archivierten Aufgaben, zuletzt archivierte zuerst
+//   - error: Ein Fehler, falls beim Laden ein Fehler auftritt; "nil", falls nicht
+func (s *sqlStore) GetArchivedTasksForUser(name, search string) ([]task, error) {
+	query := `SELECT t.id, t.title, t.desc, t.isDone, ` + userNameSQL("t.user_id") + `, c.id, c.cat_name, c.color_header, c.color_body, ` + orderPositionSQL + `, t.archived_at
+	FROM tasks t
+	LEFT JOIN categories c ON t.category_id = c.id
+	LEFT JOIN task_order o ON t.id = o.task_id AND o.user_id = ` + userIDSQL + ` AND o.view_key = ''
+	WHERE t.archived_at IS NOT NULL AND t.deleted_at IS NULL
+	AND (t.user_id = ` + userIDSQL + ` OR EXISTS(SELECT 1 FROM sharing s WHERE s.task_id = t.id AND s.target_id = ` + userIDSQL + `))
+	AND (LOWER(t.title) LIKE LOWER(?) ESCAPE '\' OR LOWER(t.desc) LIKE LOWER(?) ESCAPE '\')
+	ORDER BY t.archived_at DESC, t.id DESC`
+
+	pattern := "%" + escapeLike(search) + "%"
+	rows, err := s.db.Query(query, name, name, name, pattern, pattern)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tasks := make([]task, 0)
+	for rows.Next() {
+		var task_id, cat_id, order int
+		var title, desc, cat_name, color_header, color_body, owner string
+		var isDone bool
+		var archivedAt int64
+
+		err = rows.Scan(&task_id, &title, &desc, &isDone, &owner, &cat_id, &cat_name, &color_header, &color_body, &order, &archivedAt)
+		if err != nil {
+			return nil, err
+		}
+		shared := []string{}
+		if owner == name {
+			shared, err = s.GetSharedUsersForTask(task_id)
+			if err != nil {
+				return nil, err
+			}
+		}
+		archivedTask := NewTask(task_id, title, desc, isDone, *NewCategory(cat_id, cat_name, color_header, color_body), owner, shared, order)
+		archivedTime := time.Unix(archivedAt, 0)
+		archivedTask.ArchivedAt = &archivedTime
+		tasks = append(tasks, *archivedTask)
+	}
+	return tasks, rows.Err()
+}
+
+// escapeLike maskiert die Platzhalter von LIKE, damit ein Suchbegriff wörtlich gesucht wird
+//
+// Parameter:
+//   - value: Der zu maskierende Suchbegriff
+//
+// Rückgabewert:
+//   - string: Der maskierte Suchbegriff zur Verwendung mit ESCAPE '\'
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(value)
+}
+
+// GetAutoArchiveDays lädt die Anzahl der Tage, nach denen erledigte Aufgaben eines Benutzers automatisch archiviert werden
+//
+// Parameter:
+//   - name: Der Name des Benutzers
+//
+// Rückgabewert:
+//   - days: Die Anzahl der Tage; 0, falls die automatische Archivierung deaktiviert ist
+//   - error: Ein Fehler, falls beim Laden ein Fehler auftritt; "nil", falls nicht
+func (s *sqlStore) GetAutoArchiveDays(name string) (days int, err error) {
+	err = s.db.QueryRow(`SELECT auto_archive_days FROM users WHERE name = ?`, name).Scan(&days)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	return days, err
+}
+
+// SetAutoArchiveDays legt fest, nach wie vielen Tagen erledigte Aufgaben eines Benutzers automatisch archiviert werden
+//
+// Parameter:
+//   - name: Der Name des Benutzers
+//   - days: Die Anzahl der Tage; 0 deaktiviert die automatische Archivierung
+//
+// Rückgabewert:
+//   - error: Ein Fehler, falls beim Speichern ein Fehler auftritt; "nil", falls nicht
+func (s *sqlStore) SetAutoArchiveDays(name string, days int) error {
+	_, err := s.db.Exec(`UPDATE users SET auto_archive_days = ? WHERE name = ?`, days, name)
+	return err
+}
+
+// notifyTasksArchived benachrichtigt nach dem Archivieren alle Zielbenutzer, dass die Aufgaben aus ihrer Liste entfernt wurden, und prüft die intelligenten Listen
+//
+// Parameter:
+//   - archived: Je archivierter Aufgabe die Zielbenutzer, bei denen sie ausgeblendet wurde
+func (srv *server) notifyTasksArchived(archived map[int][]string) {
+	for taskID, targets := range archived {
+		notifyTaskRemoved(targets, taskID)
+		srv.refreshSmartListsForTask(taskID)
+	}
+	srv.wakeWebhookDelivery()
+}
+
+// runAutoArchiver archiviert in regelmäßigen Abständen die erledigten Aufgaben aller Benutzer mit aktivierter automatischer Archivierung
+// läuft dauerhaft und sollte daher als Goroutine gestartet werden
+//
+// Parameter:
+//   - interval: Der Abstand zwischen zwei Durchläufen
+func (srv *server) runAutoArchiver(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		archived, err := srv.store.AutoArchiveDoneTasks(time.Now())
+		if err != nil {
+			log.Println("Erledigte Aufgaben konnten nicht archiviert werden:", err)
+		} else if len(archived) > 0 {
+			srv.notifyTasksArchived(archived)
+			log.Printf("%d erledigte Aufgaben automatisch archiviert", len(archived))
+		}
+		<-ticker.C
+	}
+}
+
+// HandleGetArchive lädt die archivierten Aufgaben des anfragenden Benutzers, optional gefiltert über den Query-Parameter "q"
+//
+// Parameter:
+//   - c: Ein Pointer auf ein Context-Objekt von fiber
+//
+// Rückgabewert:
+//   - error: Ein Fehler, falls beim Laden des Archivs ein Fehler auftritt - wird an Client gesendet
+//     Bei Erfolg werden die archivierten Aufgaben und die Einstellung zur automatischen Archivierung an den Client gesendet
+func (srv *server) HandleGetArchive(c *fiber.Ctx) error {
+	name := c.Locals("name").(string)
+
+	tasks, err := srv.store.GetArchivedTasksForUser(name, strings.TrimSpace(c.Query("q")))
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(400).JSON(fiber.Map{"error": "Archiv konnte nicht geladen werden"})
+	}
+	days, err := srv.store.GetAutoArchiveDays(name)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(400).JSON(fiber.Map{"error": "Archiv konnte nicht geladen werden"})
+	}
+	return c.Status(200).JSON(fiber.Map{"tasks": tasks, "autoArchiveDays": days})
+}
+
+// HandleArchiveTask nimmt die mitgeschickten Parameter des Clients entgegen und ruft ArchiveTask damit auf, um eine Aufgabe zu archivieren
+//
+// Parameter:
+//   - c: Ein Pointer auf ein Context-Objekt von fiber
+//
+// Rückgabewert:
+//   - error: Ein Fehler, falls beim Archivieren ein Fehler auftritt - wird an Client gesendet
+func (srv *server) HandleArchiveTask(c *fiber.Ctx) error {
+	name := c.Locals("name").(string)
+
+	i, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(400).JSON(fiber.Map{"error": "Ungültige Eingabedaten"})
+	}
+	archived, err := srv.store.ArchiveTask(name, i)
+	if err != nil {
+		fmt.Println(err)
+		if errors.Is(err, errTaskNotFound) {
+			return c.Status(404).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.Status(400).JSON(fiber.Map{"error": "Aufgabe konnte nicht archiviert werden"})
+	}
+	srv.notifyTasksArchived(archived)
+	return c.Status(200).JSON(fiber.Map{"msg": "Aufgabe erfolgreich archiviert"})
+}
+
+// HandleArchiveDoneTasks ruft ArchiveDoneTasks auf, um alle erledigten Aufgaben des anfragenden Benutzers zu archivieren
+//
+// Parameter:
+//   - c: Ein Pointer auf ein Context-Objekt von fiber
+//
+// Rückgabewert:
+//   - error: Ein Fehler, falls beim Archivieren ein Fehler auftritt - wird an Client gesendet
+//     Bei Erfolg werden die Anzahl der archivierten und die verbleibenden Aufgaben an den Client gesendet
+func (srv *server) HandleArchiveDoneTasks(c *fiber.Ctx) error {
+	name := c.Locals("name").(string)
+
+	archived, err := srv.store.ArchiveDoneTasks(name)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(400).JSON(fiber.Map{"error": "Erledigte Aufgaben konnten nicht archiviert werden"})
+	}
+	srv.notifyTasksArchived(archived)
+
+	tasks, err := srv.store.GetTasksForUser(name)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(400).JSON(fiber.Map{"error": "Aufgaben konnten nicht geladen werden"})
+	}
+	return c.Status(200).JSON(fiber.Map{"archived": len(archived), "tasks": tasks})
+}
+
+// HandleUnarchiveTask nimmt die mitgeschickten Parameter des Clients entgegen und ruft UnarchiveTask damit auf, um eine Aufgabe aus dem Archiv wiederherzustellen
+//
+// Parameter:
+//   - c: Ein Pointer auf ein Context-Objekt von fiber
+//
+// Rückgabewert:
+//   - error: Ein Fehler, falls bei der Wiederherstellung ein Fehler auftritt - wird an Client gesendet
+//     Bei Erfolg wird die wiederhergestellte Aufgabe an den Client gesendet
+func (srv *server) HandleUnarchiveTask(c *fiber.Ctx) error {
+	name := c.Locals("name").(string)
+
+	i, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(400).JSON(fiber.Map{"error": "Ungültige Eingabedaten"})
+	}
+	err = srv.store.UnarchiveTask(name, i)
+	if err != nil {
+		fmt.Println(err)
+		if errors.Is(err, errTaskNotFound) {
+			return c.Status(404).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.Status(400).JSON(fiber.Map{"error": "Aufgabe konnte nicht wiederhergestellt werden"})
+	}
+	srv.notifyTaskAdded(i)
+	srv.refreshSmartListsForTask(i)
+	srv.wakeWebhookDelivery()
+
+	restoredTask, err := srv.store.GetTaskForUser(name, i)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(400).JSON(fiber.Map{"error": "Aufgabe konnte nicht geladen werden"})
+	}
+	return c.Status(200).JSON(fiber.Map{"task": restoredTask})
+}
+
+// HandleUpdateArchiveSettings nimmt die mitgeschickten Parameter des Clients entgegen und ruft SetAutoArchiveDays damit auf
+//
+// Parameter:
+//   - c: Ein Pointer auf ein Context-Objekt von fiber
+//
+// Rückgabewert:
+//   - error: Ein Fehler, falls beim Speichern ein Fehler auftritt - wird an Client gesendet
+func (srv *server) HandleUpdateArchiveSettings(c *fiber.Ctx) error {
+	name := c.Locals("name").(string)
+	type SettingsInput struct {
+		AutoArchiveDays int `json:"autoArchiveDays"`
+	}
+
+	var input SettingsInput
+	if err := c.BodyParser(&input); err != nil {
+		fmt.Println(err)
+		return c.Status(400).JSON(fiber.Map{"error": "Ungültige Eingabedaten"})
+	}
+	if input.AutoArchiveDays < 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "Anzahl der Tage darf nicht negativ sein"})
+	}
+	err := srv.store.SetAutoArchiveDays(name, input.AutoArchiveDays)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(400).JSON(fiber.Map{"error": "Einstellung konnte nicht gespeichert werden"})
+	}
+	return c.Status(200).JSON(fiber.Map{"msg": "Einstellung erfolgreich gespeichert"})
+}
@@ -0,0 +1,387 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// snapshotLayout ist das Zeitformat im Dateinamen einer Sicherung, z.B. go-todo-20240618-153000.123456789.db
+// durch die Nanosekunden erhalten auch kurz aufeinander folgende Sicherungen verschiedene Namen
+const snapshotLayout = "20060102-150405.000000000"
+
+// legacySnapshotLayout ist das frühere Zeitformat mit sekundengenauen Namen, z.B. go-todo-20240618-153000.db
+const legacySnapshotLayout = "20060102-150405"
+
+var (
+	errBackupUnsupported = errors.New("Sicherungen werden nur für SQLite unterstützt, für PostgreSQL bitte pg_dump verwenden")
+	errInvalidSnapshot   = errors.New("Die Datei ist keine gültige Sicherung")
+)
+
+// snapshot beschreibt eine gespeicherte Sicherung der Datenbank
+type snapshot struct {
+	Name      string    `json:"name"`
+	Size      int64     `json:"size"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// snapshotName erstellt den Dateinamen einer Sicherung aus ihrem Zeitpunkt
+//
+// Parameter:
+//   - t: Der Zeitpunkt der Sicherung
+//
+// Rückgabewert:
+//   - string: Der Dateiname der Sicherung
+func snapshotName(t time.Time) string {
+	return "go-todo-" + t.UTC().Format(snapshotLayout) + ".db"
+}
+
+// snapshotTime liest den Zeitpunkt einer Sicherung aus ihrem Dateinamen
+//
+// Parameter:
+//   - name: Der Dateiname der Sicherung
+//
+// Rückgabewert:
+//   - time.Time: Der Zeitpunkt der Sicherung
+//   - bool: "true", falls der Dateiname zu einer Sicherung gehört
+func snapshotTime(name string) (time.Time, bool) {
+	if !strings.HasPrefix(name, "go-todo-") || !strings.HasSuffix(name, ".db") {
+		return time.Time{}, false
+	}
+	value := strings.TrimSuffix(strings.TrimPrefix(name, "go-todo-"), ".db")
+	t, err := time.Parse(snapshotLayout, value)
+	if err != nil {
+		t, err = time.Parse(legacySnapshotLayout, value)
+	}
+	return t, err == nil
+}
+
+// createSnapshot speichert eine konsistente Sicherung der Datenbank im angegebenen Verzeichnis
+// der Server kann währenddessen weiterlaufen, da die Sicherung von der Datenbank selbst erstellt wird
+// die Datei enthält alle Zugangsdaten und ist daher nur für den Besitzer lesbar; sie wird exklusiv angelegt, sodass keine Sicherung überschrieben wird
+//
+// Parameter:
+//   - store: Der zu sichernde Speicher
+//   - dir: Das Verzeichnis der Sicherungen, es wird bei Bedarf angelegt
+//   - now: Der Zeitpunkt der Sicherung
+//
+// Rückgabewert:
+//   - snapshot: Ein Pointer auf die erstellte Sicherung; "nil", falls ein Fehler auftritt
+//   - error: errBackupUnsupported, falls der Speicher keine Sicherungen unterstützt; ein Fehler, falls die Sicherung fehlschlägt; "nil", falls nicht
+func createSnapshot(store Store, dir string, now time.Time) (*snapshot, error) {
+	err := os.MkdirAll(dir, 0o700)
+	if err != nil {
+		return nil, err
+	}
+	name := snapshotName(now)
+	path := filepath.Join(dir, name)
+	// VACUUM INTO akzeptiert eine leere Datei und übernimmt deren Berechtigungen
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if errors.Is(err, os.ErrExist) {
+		return nil, fmt.Errorf("Sicherung %s existiert bereits", name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	file.Close()
+
+	err = store.Backup(path)
+	if err != nil {
+		os.Remove(path)
+		return nil, err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	return &snapshot{Name: name, Size: info.Size(), CreatedAt: now.UTC()}, nil
+}
+
+// listSnapshots liefert alle Sicherungen im angegebenen Verzeichnis, die neueste zuerst
+// andere Dateien im Verzeichnis werden ignoriert
+//
+// Parameter:
+//   - dir: Das Verzeichnis der Sicherungen
+//
+// Rückgabewert:
+//   - snapshots: Die gefundenen Sicherungen; eine leere Liste, falls das Verzeichnis nicht existiert
+//   - error: Ein Fehler, falls das Verzeichnis nicht gelesen werden konnte; "nil", falls nicht
+func listSnapshots(dir string) ([]snapshot, error) {
+	snapshots := make([]snapshot, 0)
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return snapshots, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		createdAt, ok := snapshotTime(entry.Name())
+		if !ok || entry.IsDir() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+		snapshots = append(snapshots, snapshot{Name: entry.Name(), Size: info.Size(), CreatedAt: createdAt})
+	}
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].CreatedAt.After(snapshots[j].CreatedAt)
+	})
+	return snapshots, nil
+}
+
+// pruneSnapshots löscht alle Sicherungen, die vor dem angegebenen Zeitpunkt erstellt wurden
+// die neueste Sicherung bleibt unabhängig von ihrem Alter immer erhalten
+//
+// Parameter:
+//   - dir: Das Verzeichnis der Sicherungen
+//   - before: Sicherungen vor diesem Zeitpunkt werden gelöscht
+//
+// Rückgabewert:
+//   - pruned: Die Anzahl der gelöschten Sicherungen
+//   - error: Ein Fehler, falls eine Sicherung nicht gelöscht werden konnte; "nil", falls nicht
+func pruneSnapshots(dir string, before time.Time) (pruned int, err error) {
+	snapshots, err := listSnapshots(dir)
+	if err != nil {
+		return 0, err
+	}
+	for i, s := range snapshots {
+		if i == 0 || !s.CreatedAt.Before(before) {
+			continue
+		}
+		err = os.Remove(filepath.Join(dir, s.Name))
+		if err != nil {
+			return pruned, err
+		}
+		pruned++
+	}
+	return pruned, nil
+}
+
+// runBackupScheduler erstellt in regelmäßigen Abständen eine Sicherung und löscht Sicherungen, deren Aufbewahrungsdauer abgelaufen ist
+// läuft dauerhaft und sollte daher als Goroutine gestartet werden
+//
+// Parameter:
+//   - dir: Das Verzeichnis der Sicherungen
+//   - interval: Der Abstand zwischen zwei Sicherungen
+//   - retention: Die Dauer, für die Sicherungen aufbewahrt werden
+func (srv *server) runBackupScheduler(dir string, interval, retention time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		<-ticker.C
+		now := time.Now()
+		created, err := createSnapshot(srv.store, dir, now)
+		if err != nil {
+			log.Println("Sicherung konnte nicht erstellt werden:", err)
+			continue
+		}
+		log.Printf("Sicherung %s erstellt", created.Name)
+
+		pruned, err := pruneSnapshots(dir, now.Add(-retention))
+		if err != nil {
+			log.Println("Alte Sicherungen konnten nicht gelöscht werden:", err)
+		} else if pruned > 0 {
+			log.Printf("%d alte Sicherungen gelöscht", pruned)
+		}
+	}
+}
+
+// validateSnapshot prüft, ob eine Datei eine unbeschädigte SQLite-Datenbank dieser Anwendung ist
+// die Schemaversion darf nicht neuer als die dieser Version sein, ältere Sicherungen werden beim nächsten Start migriert
+//
+// Parameter:
+//   - path: Der Pfad der Sicherung
+//
+// Rückgabewert:
+//   - version: Die Schemaversion der Sicherung
+//   - error: errInvalidSnapshot bzw. ein Fehler mit genauerer Beschreibung, falls die Sicherung nicht verwendet werden kann; "nil", falls nicht
+func validateSnapshot(path string) (version int, err error) {
+	_, err = os.Stat(path)
+	if err != nil {
+		return 0, err
+	}
+	db, err := sql.Open("sqlite", "file:"+path+"?mode=ro")
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+
+	var integrity string
+	err = db.QueryRow(`PRAGMA integrity_check`).Scan(&integrity)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", errInvalidSnapshot, err)
+	}
+	if integrity != "ok" {
+		return 0, fmt.Errorf("%w: %s", errInvalidSnapshot, integrity)
+	}
+
+	err = db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_version`).Scan(&version)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", errInvalidSnapshot, err)
+	}
+	if version > len(sqliteMigrations) {
+		return version, fmt.Errorf("Die Sicherung hat die Schemaversion %d, diese Version unterstützt höchstens %d", version, len(sqliteMigrations))
+	}
+	return version, nil
+}
+
+// restoreSnapshot ersetzt die Datenbankdatei durch eine zuvor geprüfte Sicherung
+// die Sicherung wird zunächst neben die Datenbank kopiert und erst danach umbenannt, die bisherige Datenbank bleibt als <datei>.bak erhalten
+// der Server darf währenddessen nicht laufen
+//
+// Parameter:
+//   - snapshotPath: Der Pfad der Sicherung
+//   - dbPath: Der Pfad der zu ersetzenden Datenbank
+//
+// Rückgabewert:
+//   - error: Ein Fehler, falls die Sicherung ungültig ist oder nicht kopiert werden konnte; "nil", falls nicht
+func restoreSnapshot(snapshotPath, dbPath string) error {
+	_, err := validateSnapshot(snapshotPath)
+	if err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(snapshotPath)
+	if err != nil {
+		return err
+	}
+	tmpPath := dbPath + ".restore"
+	err = os.WriteFile(tmpPath, data, 0o600)
+	if err != nil {
+		return err
+	}
+	// die Kopie wird erneut geprüft, bevor sie die Datenbank ersetzt
+	_, err = validateSnapshot(tmpPath)
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	for _, suffix := range []string{"", "-journal", "-wal", "-shm"} {
+		err = os.Rename(dbPath+suffix, dbPath+".bak"+suffix)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			os.Remove(tmpPath)
+			return err
+		}
+	}
+	return os.Rename(tmpPath, dbPath)
+}
+
+// runBackupCommand erstellt als Unterbefehl "go-todo backup [-dir backups]" eine Sicherung, während der Server weiterlaufen kann
+//
+// Parameter:
+//   - store: Der zu sichernde Speicher
+//   - args: Die Argumente nach dem Unterbefehl
+//
+// Rückgabewert:
+//   - int: Der Exit-Code; 0, falls die Sicherung erstellt wurde, 2 bei Fehlern
+func runBackupCommand(store Store, args []string) int {
+	flags := flag.NewFlagSet("backup", flag.ContinueOnError)
+	dir := flags.String("dir", backupDir, "Verzeichnis der Sicherungen")
+	err := flags.Parse(args)
+	if err != nil {
+		return 2
+	}
+
+	created, err := createSnapshot(store, *dir, time.Now())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Sicherung fehlgeschlagen:", err)
+		return 2
+	}
+	fmt.Printf("Sicherung %s erstellt (%d Bytes)\n", filepath.Join(*dir, created.Name), created.Size)
+	return 0
+}
+
+// runRestoreCommand stellt als Unterbefehl "go-todo restore <sicherung>" die Datenbank aus einer Sicherung wieder her
+// der Befehl öffnet die Datenbank nicht selbst und darf nur bei gestopptem Server ausgeführt werden
+//
+// Parameter:
+//   - dbURL: Die Adresse bzw. der Pfad der Datenbank, siehe GO_TODO_DATABASE_URL
+//   - args: Die Argumente nach dem Unterbefehl
+//
+// Rückgabewert:
+//   - int: Der Exit-Code; 0, falls die Datenbank wiederhergestellt wurde, 2 bei Fehlern
+func runRestoreCommand(dbURL string, args []string) int {
+	flags := flag.NewFlagSet("restore", flag.ContinueOnError)
+	err := flags.Parse(args)
+	if err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "Verwendung: go-todo restore <sicherung>")
+		return 2
+	}
+	if isPostgresURL(dbURL) {
+		fmt.Fprintln(os.Stderr, errBackupUnsupported)
+		return 2
+	}
+
+	err = restoreSnapshot(flags.Arg(0), dbURL)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Wiederherstellung fehlgeschlagen:", err)
+		return 2
+	}
+	fmt.Printf("Datenbank aus %s wiederhergestellt, die bisherige Datenbank liegt unter %s.bak\n", flags.Arg(0), dbURL)
+	return 0
+}
+
+// HandleBackup erstellt für einen Administrator eine Sicherung im Verzeichnis GO_TODO_BACKUP_DIR
+//
+// Parameter:
+//   - c: Ein Pointer auf ein Context-Objekt von fiber
+//
+// Rückgabewert:
+//   - error: Ein Fehler, falls die Sicherung fehlschlägt - wird an Client gesendet
+//     Bei Erfolg wird die erstellte Sicherung an den Client gesendet
+func (srv *server) HandleBackup(c *fiber.Ctx) error {
+	name := c.Locals("name").(string)
+
+	if !srv.isAdmin(name) {
+		return c.Status(403).JSON(fiber.Map{"error": errForbidden.Error()})
+	}
+	created, err := createSnapshot(srv.store, backupDir, time.Now())
+	if err != nil {
+		fmt.Println(err)
+		if errors.Is(err, errBackupUnsupported) {
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.Status(400).JSON(fiber.Map{"error": "Sicherung konnte nicht erstellt werden"})
+	}
+	return c.Status(201).JSON(created)
+}
+
+// HandleGetBackups listet für einen Administrator alle Sicherungen im Verzeichnis GO_TODO_BACKUP_DIR auf
+//
+// Parameter:
+//   - c: Ein Pointer auf ein Context-Objekt von fiber
+//
+// Rückgabewert:
+//   - error: Ein Fehler, falls das Verzeichnis nicht gelesen werden konnte - wird an Client gesendet
+//     Bei Erfolg werden die Sicherungen an den Client gesendet, die neueste zuerst
+func (srv *server) HandleGetBackups(c *fiber.Ctx) error {
+	name := c.Locals("name").(string)
+
+	if !srv.isAdmin(name) {
+		return c.Status(403).JSON(fiber.Map{"error": errForbidden.Error()})
+	}
+	snapshots, err := listSnapshots(backupDir)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(400).JSON(fiber.Map{"error": "Sicherungen konnten nicht geladen werden"})
+	}
+	return c.Status(200).JSON(fiber.Map{"backups": snapshots})
+}
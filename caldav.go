@@ -0,0 +1,1254 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Namensräume der WebDAV- und CalDAV-Eigenschaften
+const (
+	davNS            = "DAV:"
+	calDAVNS         = "urn:ietf:params:xml:ns:caldav"
+	calendarServerNS = "http://calendarserver.org/ns/"
+	appleICalNS      = "http://apple.com/ns/ical/"
+)
+
+// davPrefix ist der Pfad, unter dem der CalDAV-Server erreichbar ist
+const davPrefix = "/dav"
+
+// davSyncTokenPrefix ist der Anfang aller Sync-Tokens, es folgt die Nummer der letzten Änderung in task_changes
+const davSyncTokenPrefix = "urn:x-go-todo:sync:"
+
+var (
+	errInvalidCalendarObject = errors.New("Die Datei enthält kein gültiges VTODO")
+	errDAVNotFound           = errors.New("Ressource konnte nicht gefunden werden")
+)
+
+// calendarCollection ist eine Kategorie, wie sie als CalDAV-Kalender erscheint
+// syncToken ist die Nummer der letzten Änderung an den Aufgaben der Kategorie, siehe task_changes
+type calendarCollection struct {
+	Category  category
+	SyncToken int64
+}
+
+// calendarObjectQuery lädt die aktiven eigenen Aufgaben einer Kategorie, erwartet als Parameter die ID der Kategorie und den Namen des Benutzers
+var calendarObjectQuery = `SELECT t.id, t.title, COALESCE(t."desc", ''), t.isDone, t.priority, ` + userNameSQL("t.user_id") + `, COALESCE(t.ical_uid, ''),
+	COALESCE(t.caldav_name, CAST(t.id AS TEXT)), t.created_at, t.due_at, t.done_at
+	FROM tasks t
+	WHERE t.category_id = ? AND t.user_id = ` + userIDSQL + ` AND t.deleted_at IS NULL AND t.archived_at IS NULL`
+
+// scanCalendarObject liest eine Zeile aus calendarObjectQuery
+//
+// Parameter:
+//   - scan: Die Scan-Funktion der Zeile, z.B. rows.Scan
+//
+// Rückgabewert:
+//   - t: Die gelesene Aufgabe
+//   - error: Ein Fehler, falls die Zeile nicht gelesen werden kann; "nil", falls nicht
+func scanCalendarObject(scan func(dest ...interface{}) error) (calendarTask, error) {
+	var t calendarTask
+	var createdAt, dueAt, doneAt *int64
+	err := scan(&t.ID, &t.Title, &t.Desc, &t.IsDone, &t.Priority, &t.Owner, &t.UID, &t.Href, &createdAt, &dueAt, &doneAt)
+	if err != nil {
+		return calendarTask{}, err
+	}
+	t.CreatedAt = unixTime(createdAt)
+	t.DueAt = unixTime(dueAt)
+	t.DoneAt = unixTime(doneAt)
+	return t, nil
+}
+
+// GetCalendarCollections lädt alle Kategorien eines Benutzers mit dem aktuellen Sync-Token
+//
+// Parameter:
+//   - name: Der Name des Benutzers
+//
+// Rückgabewert:
+//   - collections: Die Kategorien als Kalender
+//   - error: Ein Fehler, falls bei der Abfrage ein Fehler auftritt; "nil", falls nicht
+func (s *sqlStore) GetCalendarCollections(name string) ([]calendarCollection, error) {
+	tokenQuery := `SELECT category_id, MAX(seq) FROM task_changes
+	WHERE category_id IN (SELECT id FROM categories WHERE user_id = ` + userIDSQL + `) GROUP BY category_id`
+
+	categories, err := s.GetCategoriesForUser(name)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Query(tokenQuery, name)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := make(map[int]int64)
+	for rows.Next() {
+		var catID int
+		var seq int64
+		err = rows.Scan(&catID, &seq)
+		if err != nil {
+			return nil, err
+		}
+		tokens[catID] = seq
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	collections := make([]calendarCollection, 0, len(categories))
+	for _, cat := range categories {
+		collections = append(collections, calendarCollection{Category: cat, SyncToken: tokens[cat.ID]})
+	}
+	return collections, nil
+}
+
+// GetCalendarCollection lädt eine Kategorie eines Benutzers mit dem aktuellen Sync-Token
+//
+// Parameter:
+//   - name: Der Name des Benutzers
+//   - catID: Die ID der Kategorie
+//
+// Rückgabewert:
+//   - collection: Ein Pointer auf die Kategorie als Kalender; "nil", falls ein Fehler auftritt
+//   - error: errCategoryNotFound, falls die Kategorie nicht dem Benutzer gehört; "nil", falls kein Fehler auftritt
+func (s *sqlStore) GetCalendarCollection(name string, catID int) (*calendarCollection, error) {
+	query := `SELECT c.cat_name, c.color_header, c.color_body, COALESCE((SELECT MAX(seq) FROM task_changes WHERE category_id = c.id), 0)
+	FROM categories c WHERE c.id = ? AND c.user_id = ` + userIDSQL + ` AND c.deleted_at IS NULL`
+
+	collection := calendarCollection{Category: category{ID: catID}}
+	err := s.db.QueryRow(query, catID, name).Scan(&collection.Category.Cat_name, &collection.Category.Color_header,
+		&collection.Category.Color_body, &collection.SyncToken)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errCategoryNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &collection, nil
+}
+
+// GetCalendarObjects lädt die aktiven eigenen Aufgaben einer Kategorie in der Reihenfolge der Kategorie
+// für den Benutzer freigegebene Aufgaben erscheinen nicht, da sie in einer Kategorie ihres Besitzers liegen
+//
+// Parameter:
+//   - name: Der Name des Benutzers
+//   - catID: Die ID der Kategorie
+//
+// Rückgabewert:
+//   - tasks: Die Aufgaben der Kategorie
+//   - error: errCategoryNotFound, falls die Kategorie nicht dem Benutzer gehört; "nil", falls kein Fehler auftritt
+func (s *sqlStore) GetCalendarObjects(name string, catID int) ([]calendarTask, error) {
+	taskIDs, err := s.getViewTaskIDs(s.db, name, categoryView(catID))
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Query(calendarObjectQuery, catID, name)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	objects := make(map[int]calendarTask)
+	for rows.Next() {
+		t, err := scanCalendarObject(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		objects[t.ID] = t
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	tasks := make([]calendarTask, 0, len(objects))
+	for _, taskID := range taskIDs {
+		if t, ok := objects[taskID]; ok {
+			tasks = append(tasks, t)
+		}
+	}
+	return tasks, nil
+}
+
+// GetCalendarObject lädt eine aktive eigene Aufgabe über ihren Ressourcennamen innerhalb einer Kategorie
+//
+// Parameter:
+//   - name: Der Name des Benutzers
+//   - catID: Die ID der Kategorie
+//   - href: Der Name der Ressource ohne .ics
+//
+// Rückgabewert:
+//   - t: Ein Pointer auf die Aufgabe; "nil", falls ein Fehler auftritt
+//   - error: errTaskNotFound, falls es die Ressource nicht gibt; "nil", falls kein Fehler auftritt
+func (s *sqlStore) GetCalendarObject(name string, catID int, href string) (*calendarTask, error) {
+	query := calendarObjectQuery + ` AND COALESCE(t.caldav_name, CAST(t.id AS TEXT)) = ? ORDER BY t.id LIMIT 1`
+
+	t, err := scanCalendarObject(s.db.QueryRow(query, catID, name, href).Scan)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errTaskNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// GetCalendarChanges ermittelt die Ressourcen einer Kategorie, die sich seit einem Sync-Token geändert haben
+//
+// Parameter:
+//   - catID: Die ID der Kategorie
+//   - since: Die Nummer der letzten dem Client bekannten Änderung
+//
+// Rückgabewert:
+//   - hrefs: Die Namen der geänderten, neuen oder entfernten Ressourcen ohne .ics
+//   - error: Ein Fehler, falls bei der Abfrage ein Fehler auftritt; "nil", falls nicht
+func (s *sqlStore) GetCalendarChanges(catID int, since int64) ([]string, error) {
+	rows, err := s.db.Query(`SELECT DISTINCT href_name FROM task_changes WHERE category_id = ? AND seq > ? ORDER BY href_name`, catID, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	hrefs := make([]string, 0)
+	for rows.Next() {
+		var href string
+		err = rows.Scan(&href)
+		if err != nil {
+			return nil, err
+		}
+		hrefs = append(hrefs, href)
+	}
+	return hrefs, rows.Err()
+}
+
+// PutCalendarObject führt eine Transaktion in der Datenbank aus, um eine über CalDAV gesendete Aufgabe zu speichern
+// existiert die Ressource bereits, werden Titel, Beschreibung, Status, Priorität, Fälligkeit und UID übernommen,
+// sonst wird eine neue Aufgabe am Ende der Gesamtliste angelegt
+//
+// Parameter:
+//   - name: Der Name des Benutzers
+//   - catID: Die ID der Kategorie
+//   - t: Die Aufgabe inklusive Ressourcenname
+//
+// Rückgabewert:
+//   - taskID: Die ID der gespeicherten Aufgabe
+//   - created: "true", falls die Aufgabe neu angelegt wurde
+//   - error: errCategoryNotFound, falls die Kategorie nicht dem Benutzer gehört; "nil", falls kein Fehler auftritt
+func (s *sqlStore) PutCalendarObject(name string, catID int, t calendarTask) (taskID int, created bool, err error) {
+	categoryQuery := `SELECT EXISTS(SELECT 1 FROM categories WHERE id = ? AND user_id = ` + userIDSQL + ` AND deleted_at IS NULL)`
+	existingQuery := `SELECT id, COALESCE(isDone, FALSE) FROM tasks WHERE category_id = ? AND user_id = ` + userIDSQL + ` AND deleted_at IS NULL AND archived_at IS NULL
+	AND COALESCE(caldav_name, CAST(id AS TEXT)) = ? ORDER BY id LIMIT 1`
+	updateQuery := `UPDATE tasks SET title = ?, "desc" = ?, isDone = ?, done_at = CASE WHEN ? THEN COALESCE(?, done_at, ?) END,
+	priority = ?, due_at = ?, ical_uid = NULLIF(?, '') WHERE id = ?`
+	insertQuery := `INSERT INTO tasks (title, "desc", isDone, done_at, category_id, user_id, priority, created_at, due_at, caldav_name, ical_uid)
+	VALUES (?,?,?,?,?,` + userIDSQL + `,?,?,?,?,NULLIF(?, '')) RETURNING id`
+	orderQuery := `INSERT INTO task_order (user_id, task_id, rank_key) VALUES (` + userIDSQL + `,?,?)`
+	now := time.Now().Unix()
+	var exists, wasDone bool
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, false, err
+	}
+
+	err = tx.QueryRow(categoryQuery, catID, name).Scan(&exists)
+	if err != nil {
+		tx.Rollback()
+		return 0, false, err
+	}
+	if !exists {
+		tx.Rollback()
+		return 0, false, errCategoryNotFound
+	}
+
+	err = tx.QueryRow(existingQuery, catID, name, t.Href).Scan(&taskID, &wasDone)
+	if err == nil {
+		_, err = tx.Exec(updateQuery, t.Title, t.Desc, t.IsDone, t.IsDone, unixSeconds(t.DoneAt), now, t.Priority, unixSeconds(t.DueAt), t.UID, taskID)
+		if err != nil {
+			tx.Rollback()
+			return 0, false, err
+		}
+	} else if errors.Is(err, sql.ErrNoRows) {
+		var doneAt interface{}
+		if t.IsDone {
+			doneAt = now
+			if t.DoneAt != nil {
+				doneAt = t.DoneAt.Unix()
+			}
+		}
+		err = tx.QueryRow(insertQuery, t.Title, t.Desc, t.IsDone, doneAt, catID, name, t.Priority, now, unixSeconds(t.DueAt), t.Href, t.UID).Scan(&taskID)
+		if err != nil {
+			tx.Rollback()
+			return 0, false, err
+		}
+
+		rankKey, err := lastRankForUser(tx, name)
+		if err != nil {
+			tx.Rollback()
+			return 0, false, err
+		}
+		_, err = tx.Exec(orderQuery, name, taskID, rankBetween(rankKey, ""))
+		if err != nil {
+			tx.Rollback()
+			return 0, false, err
+		}
+		created = true
+	} else {
+		tx.Rollback()
+		return 0, false, err
+	}
+
+	event := webhookEvent{Type: webhookTaskUpdated, Actor: name, TaskID: taskID}
+	if created {
+		event.Type = webhookTaskCreated
+	}
+	err = insertWebhookDeliveries(tx, event)
+	if err == nil && t.IsDone && !wasDone {
+		err = insertWebhookDeliveries(tx, webhookEvent{Type: webhookTaskCompleted, Actor: name, TaskID: taskID})
+	}
+	if err != nil {
+		tx.Rollback()
+		return 0, false, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		tx.Rollback()
+		return 0, false, err
+	}
+	return taskID, created, nil
+}
+
+// icsUnescape hebt die Maskierung eines Textfelds nach RFC 5545 auf
+//
+// Parameter:
+//   - value: Der maskierte Text
+//
+// Rückgabewert:
+//   - string: Der Text
+func icsUnescape(value string) string {
+	return strings.NewReplacer(`\\`, `\`, `\;`, ";", `\,`, ",", `\n`, "\n", `\N`, "\n").Replace(value)
+}
+
+// parseICSTime liest einen Zeitpunkt bzw. ein Datum nach RFC 5545
+// Zeitpunkte ohne Zeitzone werden als lokale Zeit gelesen
+//
+// Parameter:
+//   - value: Der Wert, z.B. 20240601, 20240601T120000 oder 20240601T120000Z
+//
+// Rückgabewert:
+//   - *time.Time: Der Zeitpunkt; "nil", falls der Wert ungültig ist
+func parseICSTime(value string) *time.Time {
+	layouts := []string{"20060102T150405Z", "20060102T150405", "20060102"}
+	for _, layout := range layouts {
+		loc := time.Local
+		if strings.HasSuffix(layout, "Z") {
+			loc = time.UTC
+		}
+		parsed, err := time.ParseInLocation(layout, value, loc)
+		if err == nil {
+			return &parsed
+		}
+	}
+	return nil
+}
+
+// parseVTODO liest das erste VTODO einer iCalendar-Datei
+// übernommen werden SUMMARY, DESCRIPTION, STATUS, COMPLETED, DUE, PRIORITY und UID; die Fälligkeit wird auf den Tag gekürzt
+//
+// Parameter:
+//   - data: Die iCalendar-Datei
+//
+// Rückgabewert:
+//   - t: Die gelesene Aufgabe ohne ID und Ressourcenname
+//   - error: errInvalidCalendarObject, falls die Datei kein VTODO enthält; "nil", falls nicht
+func parseVTODO(data []byte) (calendarTask, error) {
+	text := strings.ReplaceAll(string(data), "\r\n", "\n")
+	text = strings.ReplaceAll(strings.ReplaceAll(text, "\n ", ""), "\n\t", "")
+
+	var t calendarTask
+	inTodo, found := false, false
+	for _, line := range strings.Split(text, "\n") {
+		// der Wert beginnt nach dem ersten Doppelpunkt außerhalb von Anführungszeichen der Parameter
+		quoted, split := false, -1
+		for i, r := range line {
+			if r == '"' {
+				quoted = !quoted
+			} else if r == ':' && !quoted {
+				split = i
+				break
+			}
+		}
+		if split < 0 {
+			continue
+		}
+		property, _, _ := strings.Cut(line[:split], ";")
+		property = strings.ToUpper(property)
+		value := line[split+1:]
+
+		if property == "BEGIN" && strings.EqualFold(value, "VTODO") && !found {
+			inTodo, found = true, true
+			continue
+		}
+		if property == "END" && strings.EqualFold(value, "VTODO") {
+			inTodo = false
+			continue
+		}
+		if !inTodo {
+			continue
+		}
+
+		switch property {
+		case "SUMMARY":
+			t.Title = strings.TrimSpace(icsUnescape(value))
+		case "DESCRIPTION":
+			t.Desc = icsUnescape(value)
+		case "STATUS":
+			t.IsDone = strings.EqualFold(value, "COMPLETED")
+		case "COMPLETED":
+			t.DoneAt = parseICSTime(value)
+		case "DUE":
+			if due := parseICSTime(value); due != nil {
+				local := due.Local()
+				day := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, time.Local)
+				t.DueAt = &day
+			}
+		case "PRIORITY":
+			priority, err := strconv.Atoi(strings.TrimSpace(value))
+			if err == nil && priority >= 1 && priority <= 9 {
+				t.Priority = string(rune('A' + priority - 1))
+			}
+		case "UID":
+			t.UID = icsUnescape(value)
+		}
+	}
+	if !found {
+		return calendarTask{}, errInvalidCalendarObject
+	}
+	if !t.IsDone {
+		t.DoneAt = nil
+	}
+	return t, nil
+}
+
+// renderCalendarObject schreibt eine Aufgabe als eigene iCalendar-Datei mit einem VTODO
+// DTSTAMP ist der Zeitpunkt der Erstellung, damit sich die Datei und damit das ETag nur bei Änderungen an der Aufgabe ändert
+//
+// Parameter:
+//   - t: Die Aufgabe
+//
+// Rückgabewert:
+//   - data: Die iCalendar-Datei
+//   - etag: Das ETag der Datei inklusive Anführungszeichen
+func renderCalendarObject(t calendarTask) (data []byte, etag string) {
+	var buf bytes.Buffer
+	iw := icsWriter{w: &buf}
+	stamp := time.Unix(0, 0)
+	if t.CreatedAt != nil {
+		stamp = *t.CreatedAt
+	}
+
+	iw.line("BEGIN:VCALENDAR")
+	iw.line("VERSION:2.0")
+	iw.line("PRODID:-//go-todo//go-todo//DE")
+	writeTodo(iw, t, stamp.UTC().Format("20060102T150405Z"))
+	iw.line("END:VCALENDAR")
+
+	sum := sha256.Sum256(buf.Bytes())
+	return buf.Bytes(), `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// davRequest ist der ausgewertete Body einer PROPFIND- bzw. REPORT-Anfrage
+type davRequest struct {
+	Root       xml.Name
+	AllProp    bool
+	Props      []xml.Name
+	Hrefs      []string
+	SyncToken  string
+	Components []string
+}
+
+// parseDAVRequest liest den Body einer PROPFIND- bzw. REPORT-Anfrage, ein leerer Body entspricht allprop
+//
+// Parameter:
+//   - body: Der Body der Anfrage
+//
+// Rückgabewert:
+//   - req: Ein Pointer auf die gelesene Anfrage; "nil", falls ein Fehler auftritt
+//   - error: Ein Fehler, falls der Body kein gültiges XML ist; "nil", falls nicht
+func parseDAVRequest(body []byte) (*davRequest, error) {
+	req := &davRequest{}
+	if len(bytes.TrimSpace(body)) == 0 {
+		req.Root = xml.Name{Space: davNS, Local: "propfind"}
+		req.AllProp = true
+		return req, nil
+	}
+
+	dec := xml.NewDecoder(bytes.NewReader(body))
+	var stack []xml.Name
+	for {
+		token, err := dec.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch token := token.(type) {
+		case xml.StartElement:
+			if len(stack) == 0 {
+				req.Root = token.Name
+			}
+			// die abgefragten Eigenschaften stehen direkt im prop-Element unterhalb der Wurzel
+			if len(stack) == 2 && stack[1] == (xml.Name{Space: davNS, Local: "prop"}) {
+				req.Props = append(req.Props, token.Name)
+			}
+
+			switch token.Name {
+			case xml.Name{Space: davNS, Local: "allprop"}:
+				req.AllProp = true
+			case xml.Name{Space: calDAVNS, Local: "comp-filter"}:
+				for _, attr := range token.Attr {
+					if attr.Name.Local == "name" {
+						req.Components = append(req.Components, strings.ToUpper(attr.Value))
+					}
+				}
+			case xml.Name{Space: davNS, Local: "href"}, xml.Name{Space: davNS, Local: "sync-token"}:
+				var value string
+				err = dec.DecodeElement(&value, &token)
+				if err != nil {
+					return nil, err
+				}
+				if token.Name.Local == "href" {
+					req.Hrefs = append(req.Hrefs, strings.TrimSpace(value))
+				} else {
+					req.SyncToken = strings.TrimSpace(value)
+				}
+				continue
+			}
+			stack = append(stack, token.Name)
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		}
+	}
+	if req.Root.Local == "" {
+		return nil, errors.New("Leeres XML-Dokument")
+	}
+	return req, nil
+}
+
+// davPrefixes ordnet den bekannten Namensräumen die Präfixe in den Antworten zu
+var davPrefixes = map[string]string{davNS: "d", calDAVNS: "cal", calendarServerNS: "cs", appleICalNS: "ic"}
+
+// davElement schreibt ein XML-Element für eine Eigenschaft
+//
+// Parameter:
+//   - sb: Das Ziel des Elements
+//   - name: Der Name der Eigenschaft
+//   - inner: Der bereits maskierte Inhalt des Elements
+func davElement(sb *strings.Builder, name xml.Name, inner string) {
+	var local bytes.Buffer
+	xml.EscapeText(&local, []byte(name.Local))
+	tag := local.String()
+	open := tag
+	if prefix, ok := davPrefixes[name.Space]; ok {
+		tag = prefix + ":" + tag
+		open = tag
+	} else {
+		var space bytes.Buffer
+		xml.EscapeText(&space, []byte(name.Space))
+		tag = "x:" + tag
+		open = tag + ` xmlns:x="` + space.String() + `"`
+	}
+	if inner == "" {
+		sb.WriteString("<" + open + "/>")
+		return
+	}
+	sb.WriteString("<" + open + ">" + inner + "</" + tag + ">")
+}
+
+// davText maskiert einen Text für den Inhalt eines XML-Elements
+//
+// Parameter:
+//   - value: Der Text
+//
+// Rückgabewert:
+//   - string: Der maskierte Text
+func davText(value string) string {
+	var buf bytes.Buffer
+	xml.EscapeText(&buf, []byte(value))
+	return buf.String()
+}
+
+// davHref schreibt einen Pfad als href-Element
+//
+// Parameter:
+//   - path: Der Pfad
+//
+// Rückgabewert:
+//   - string: Das href-Element
+func davHref(path string) string {
+	return "<d:href>" + davText(path) + "</d:href>"
+}
+
+// davResponse ist eine Ressource in einer Multistatus-Antwort
+// status ist nur gesetzt, falls die Ressource nicht existiert, z.B. bei entfernten Aufgaben in sync-collection
+type davResponse struct {
+	Href   string
+	Props  map[xml.Name]string
+	Status int
+}
+
+// writeMultistatus schreibt eine Multistatus-Antwort nach RFC 4918
+// abgefragte Eigenschaften, die eine Ressource nicht besitzt, werden mit 404 gemeldet; bei allprop fehlt calendar-data
+//
+// Parameter:
+//   - req: Die ausgewertete Anfrage
+//   - responses: Die Ressourcen der Antwort
+//   - syncToken: Das neue Sync-Token für sync-collection; "", falls keines gesendet wird
+//
+// Rückgabewert:
+//   - []byte: Die Antwort als XML
+func writeMultistatus(req *davRequest, responses []davResponse, syncToken string) []byte {
+	var sb strings.Builder
+	sb.WriteString(xml.Header)
+	sb.WriteString(`<d:multistatus xmlns:d="DAV:" xmlns:cal="` + calDAVNS + `" xmlns:cs="` + calendarServerNS + `" xmlns:ic="` + appleICalNS + `">`)
+	for _, response := range responses {
+		sb.WriteString("<d:response>" + davHref(response.Href))
+		if response.Status != 0 {
+			sb.WriteString("<d:status>HTTP/1.1 " + strconv.Itoa(response.Status) + " " + http.StatusText(response.Status) + "</d:status></d:response>")
+			continue
+		}
+
+		names := req.Props
+		if req.AllProp {
+			names = make([]xml.Name, 0, len(response.Props))
+			for name := range response.Props {
+				if name != (xml.Name{Space: calDAVNS, Local: "calendar-data"}) {
+					names = append(names, name)
+				}
+			}
+			sort.Slice(names, func(i, j int) bool {
+				return names[i].Space+names[i].Local < names[j].Space+names[j].Local
+			})
+		}
+
+		var found, missing strings.Builder
+		for _, name := range names {
+			if inner, ok := response.Props[name]; ok {
+				davElement(&found, name, inner)
+			} else {
+				davElement(&missing, name, "")
+			}
+		}
+		if found.Len() > 0 {
+			sb.WriteString("<d:propstat><d:prop>" + found.String() + "</d:prop><d:status>HTTP/1.1 200 OK</d:status></d:propstat>")
+		}
+		if missing.Len() > 0 {
+			sb.WriteString("<d:propstat><d:prop>" + missing.String() + "</d:prop><d:status>HTTP/1.1 404 Not Found</d:status></d:propstat>")
+		}
+		sb.WriteString("</d:response>")
+	}
+	if syncToken != "" {
+		sb.WriteString("<d:sync-token>" + davText(syncToken) + "</d:sync-token>")
+	}
+	sb.WriteString("</d:multistatus>")
+	return []byte(sb.String())
+}
+
+// davPrincipalPath liefert den Pfad des Principals eines Benutzers, über den Clients seine Kalender finden
+//
+// Parameter:
+//   - name: Der Name des Benutzers
+//
+// Rückgabewert:
+//   - string: Der Pfad
+func davPrincipalPath(name string) string {
+	return davPrefix + "/principals/" + url.PathEscape(name) + "/"
+}
+
+// davHomePath liefert den Pfad, unter dem die Kalender eines Benutzers liegen
+//
+// Parameter:
+//   - name: Der Name des Benutzers
+//
+// Rückgabewert:
+//   - string: Der Pfad
+func davHomePath(name string) string {
+	return davPrefix + "/calendars/" + url.PathEscape(name) + "/"
+}
+
+// davCollectionPath liefert den Pfad einer Kategorie als Kalender
+//
+// Parameter:
+//   - name: Der Name des Benutzers
+//   - catID: Die ID der Kategorie
+//
+// Rückgabewert:
+//   - string: Der Pfad
+func davCollectionPath(name string, catID int) string {
+	return davHomePath(name) + strconv.Itoa(catID) + "/"
+}
+
+// davObjectPath liefert den Pfad einer Aufgabe innerhalb eines Kalenders
+//
+// Parameter:
+//   - name: Der Name des Benutzers
+//   - catID: Die ID der Kategorie
+//   - href: Der Name der Ressource ohne .ics
+//
+// Rückgabewert:
+//   - string: Der Pfad
+func davObjectPath(name string, catID int, href string) string {
+	return davCollectionPath(name, catID) + url.PathEscape(href) + ".ics"
+}
+
+// davResource ist die Ressource, auf die sich eine CalDAV-Anfrage bezieht
+// kind ist "root", "principal", "home", "collection" oder "object"
+type davResource struct {
+	Kind  string
+	CatID int
+	Href  string
+}
+
+// parseDAVPath ermittelt die Ressource zu einem Pfad unterhalb von davPrefix
+//
+// Parameter:
+//   - path: Der Pfad der Anfrage
+//   - name: Der Name des angemeldeten Benutzers
+//
+// Rückgabewert:
+//   - res: Die Ressource
+//   - error: errForbidden, falls der Pfad einem anderen Benutzer gehört; errDAVNotFound bei unbekannten Pfaden; "nil", falls kein Fehler auftritt
+func parseDAVPath(path, name string) (davResource, error) {
+	if parsed, err := url.Parse(path); err == nil && parsed.Path != "" {
+		path = parsed.Path
+	}
+	rest := strings.Trim(strings.TrimPrefix(path, davPrefix), "/")
+	if rest == "" {
+		return davResource{Kind: "root"}, nil
+	}
+
+	parts := strings.Split(rest, "/")
+	for i, part := range parts {
+		unescaped, err := url.PathUnescape(part)
+		if err != nil {
+			return davResource{}, errDAVNotFound
+		}
+		parts[i] = unescaped
+	}
+	if len(parts) < 2 || (parts[0] != "principals" && parts[0] != "calendars") {
+		return davResource{}, errDAVNotFound
+	}
+	if parts[1] != name {
+		return davResource{}, errForbidden
+	}
+
+	switch {
+	case parts[0] == "principals" && len(parts) == 2:
+		return davResource{Kind: "principal"}, nil
+	case parts[0] == "calendars" && len(parts) == 2:
+		return davResource{Kind: "home"}, nil
+	case parts[0] == "calendars" && (len(parts) == 3 || len(parts) == 4):
+		catID, err := strconv.Atoi(parts[2])
+		if err != nil {
+			return davResource{}, errDAVNotFound
+		}
+		if len(parts) == 3 {
+			return davResource{Kind: "collection", CatID: catID}, nil
+		}
+		href, ok := strings.CutSuffix(parts[3], ".ics")
+		if !ok || href == "" {
+			return davResource{}, errDAVNotFound
+		}
+		return davResource{Kind: "object", CatID: catID, Href: href}, nil
+	}
+	return davResource{}, errDAVNotFound
+}
+
+// davUserProps liefert die Eigenschaften, die alle Ressourcen außerhalb der Kalender gemeinsam haben
+//
+// Parameter:
+//   - name: Der Name des angemeldeten Benutzers
+//   - resourceType: Der Inhalt von resourcetype
+//
+// Rückgabewert:
+//   - map[xml.Name]string: Die Eigenschaften mit ihrem maskierten Inhalt
+func davUserProps(name, resourceType string) map[xml.Name]string {
+	return map[xml.Name]string{
+		{Space: davNS, Local: "resourcetype"}:           resourceType,
+		{Space: davNS, Local: "displayname"}:            davText(name),
+		{Space: davNS, Local: "current-user-principal"}: davHref(davPrincipalPath(name)),
+		{Space: davNS, Local: "principal-URL"}:          davHref(davPrincipalPath(name)),
+		{Space: calDAVNS, Local: "calendar-home-set"}:   davHref(davHomePath(name)),
+	}
+}
+
+// davCollectionProps liefert die Eigenschaften einer Kategorie als Kalender
+//
+// Parameter:
+//   - name: Der Name des angemeldeten Benutzers
+//   - collection: Die Kategorie
+//
+// Rückgabewert:
+//   - map[xml.Name]string: Die Eigenschaften mit ihrem maskierten Inhalt
+func davCollectionProps(name string, collection calendarCollection) map[xml.Name]string {
+	syncToken := davSyncTokenPrefix + strconv.FormatInt(collection.SyncToken, 10)
+	color := collection.Category.Color_header
+	if color != "" && !strings.HasPrefix(color, "#") {
+		color = "#" + color
+	}
+
+	props := map[xml.Name]string{
+		{Space: davNS, Local: "resourcetype"}:                        "<d:collection/><cal:calendar/>",
+		{Space: davNS, Local: "displayname"}:                         davText(collection.Category.Cat_name),
+		{Space: davNS, Local: "current-user-principal"}:              davHref(davPrincipalPath(name)),
+		{Space: davNS, Local: "owner"}:                               davHref(davPrincipalPath(name)),
+		{Space: davNS, Local: "sync-token"}:                          davText(syncToken),
+		{Space: calendarServerNS, Local: "getctag"}:                  davText(syncToken),
+		{Space: calDAVNS, Local: "supported-calendar-component-set"}: `<cal:comp name="VTODO"/>`,
+		{Space: davNS, Local: "current-user-privilege-set"}:          "<d:privilege><d:read/></d:privilege><d:privilege><d:write/></d:privilege>",
+		{Space: davNS, Local: "supported-report-set"}: "<d:supported-report><d:report><cal:calendar-query/></d:report></d:supported-report>" +
+			"<d:supported-report><d:report><cal:calendar-multiget/></d:report></d:supported-report>" +
+			"<d:supported-report><d:report><d:sync-collection/></d:report></d:supported-report>",
+	}
+	if color != "" {
+		props[xml.Name{Space: appleICalNS, Local: "calendar-color"}] = davText(color)
+	}
+	return props
+}
+
+// davObjectProps liefert die Eigenschaften einer Aufgabe als Kalenderobjekt
+//
+// Parameter:
+//   - t: Die Aufgabe
+//
+// Rückgabewert:
+//   - map[xml.Name]string: Die Eigenschaften mit ihrem maskierten Inhalt
+func davObjectProps(t calendarTask) map[xml.Name]string {
+	data, etag := renderCalendarObject(t)
+	return map[xml.Name]string{
+		{Space: davNS, Local: "resourcetype"}:     "",
+		{Space: davNS, Local: "getetag"}:          davText(etag),
+		{Space: davNS, Local: "getcontenttype"}:   "text/calendar; charset=utf-8; component=VTODO",
+		{Space: davNS, Local: "getcontentlength"}: strconv.Itoa(len(data)),
+		{Space: calDAVNS, Local: "calendar-data"}: davText(string(data)),
+	}
+}
+
+// davAuthenticate prüft die Basic-Anmeldung einer CalDAV-Anfrage mit einem App-Passwort
+//
+// Parameter:
+//   - c: Ein Pointer auf ein Context-Objekt von fiber
+//
+// Rückgabewert:
+//   - string: Der Name des angemeldeten Benutzers; "", falls die Anmeldung fehlt oder ungültig ist
+func (srv *server) davAuthenticate(c *fiber.Ctx) string {
+	encoded, ok := strings.CutPrefix(c.Get(fiber.HeaderAuthorization), "Basic ")
+	if !ok {
+		return ""
+	}
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return ""
+	}
+	name, secret, ok := strings.Cut(string(decoded), ":")
+	if !ok || name == "" || secret == "" {
+		return ""
+	}
+
+	valid, err := srv.store.CheckAppPassword(name, secret)
+	if err != nil {
+		fmt.Println(err)
+		return ""
+	}
+	if !valid {
+		return ""
+	}
+	return name
+}
+
+// HandleCalDAV beantwortet alle Anfragen an den CalDAV-Server unterhalb von /dav
+// jede Kategorie des Benutzers ist ein Kalender mit ihren aktiven Aufgaben als VTODO unter /dav/calendars/<name>/<id>/
+// Clients melden sich per Basic-Auth mit dem Namen des Benutzers und einem App-Passwort an, da sie kein JWT verwenden können
+//
+// Parameter:
+//   - c: Ein Pointer auf ein Context-Objekt von fiber
+//
+// Rückgabewert:
+//   - error: Ein Fehler, falls die Anfrage nicht beantwortet werden kann - wird an Client gesendet
+func (srv *server) HandleCalDAV(c *fiber.Ctx) error {
+	c.Set("DAV", "1, 3, calendar-access")
+	if c.Method() == fiber.MethodOptions {
+		c.Set(fiber.HeaderAllow, "OPTIONS, GET, HEAD, PUT, DELETE, PROPFIND, REPORT")
+		return c.SendStatus(200)
+	}
+
+	name := srv.davAuthenticate(c)
+	if name == "" {
+		c.Set(fiber.HeaderWWWAuthenticate, `Basic realm="go-todo", charset="UTF-8"`)
+		return c.Status(401).JSON(fiber.Map{"error": "Anmeldung mit einem App-Passwort erforderlich"})
+	}
+
+	res, err := parseDAVPath(c.Path(), name)
+	if errors.Is(err, errForbidden) {
+		return c.Status(403).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	switch c.Method() {
+	case "PROPFIND":
+		return srv.davPropfind(c, name, res)
+	case "REPORT":
+		return srv.davReport(c, name, res)
+	case fiber.MethodGet, fiber.MethodHead:
+		return srv.davGet(c, name, res)
+	case fiber.MethodPut:
+		return srv.davPut(c, name, res)
+	case fiber.MethodDelete:
+		return srv.davDelete(c, name, res)
+	}
+	return c.Status(405).JSON(fiber.Map{"error": "Methode wird nicht unterstützt"})
+}
+
+// sendMultistatus sendet eine Multistatus-Antwort
+//
+// Parameter:
+//   - c: Ein Pointer auf ein Context-Objekt von fiber
+//   - req: Die ausgewertete Anfrage
+//   - responses: Die Ressourcen der Antwort
+//   - syncToken: Das neue Sync-Token; "", falls keines gesendet wird
+//
+// Rückgabewert:
+//   - error: Ein Fehler, falls beim Senden ein Fehler auftritt
+func sendMultistatus(c *fiber.Ctx, req *davRequest, responses []davResponse, syncToken string) error {
+	c.Set(fiber.HeaderContentType, "application/xml; charset=utf-8")
+	return c.Status(207).Send(writeMultistatus(req, responses, syncToken))
+}
+
+// davStoreError sendet die Antwort zu einem Fehler beim Laden einer Kategorie oder Aufgabe
+//
+// Parameter:
+//   - c: Ein Pointer auf ein Context-Objekt von fiber
+//   - err: Der aufgetretene Fehler
+//
+// Rückgabewert:
+//   - error: Ein Fehler, falls beim Senden ein Fehler auftritt
+func davStoreError(c *fiber.Ctx, err error) error {
+	if errors.Is(err, errCategoryNotFound) || errors.Is(err, errTaskNotFound) {
+		return c.Status(404).JSON(fiber.Map{"error": err.Error()})
+	}
+	fmt.Println(err)
+	return c.Status(400).JSON(fiber.Map{"error": "Kalender konnte nicht geladen werden"})
+}
+
+// davPropfind beantwortet eine PROPFIND-Anfrage; mit Depth 1 werden zusätzlich die Kalender bzw. Aufgaben einer Sammlung gesendet
+//
+// Parameter:
+//   - c: Ein Pointer auf ein Context-Objekt von fiber
+//   - name: Der Name des angemeldeten Benutzers
+//   - res: Die angefragte Ressource
+//
+// Rückgabewert:
+//   - error: Ein Fehler, falls die Ressource nicht existiert oder beim Laden ein Fehler auftritt - wird an Client gesendet
+func (srv *server) davPropfind(c *fiber.Ctx, name string, res davResource) error {
+	req, err := parseDAVRequest(c.Body())
+	if err != nil || req.Root != (xml.Name{Space: davNS, Local: "propfind"}) {
+		return c.Status(400).JSON(fiber.Map{"error": "Ungültige Eingabedaten"})
+	}
+	children := c.Get("Depth", "infinity") != "0"
+
+	var responses []davResponse
+	switch res.Kind {
+	case "root":
+		responses = append(responses, davResponse{Href: davPrefix + "/", Props: davUserProps(name, "<d:collection/>")})
+	case "principal":
+		responses = append(responses, davResponse{Href: davPrincipalPath(name), Props: davUserProps(name, "<d:principal/>")})
+	case "home":
+		responses = append(responses, davResponse{Href: davHomePath(name), Props: davUserProps(name, "<d:collection/>")})
+		if children {
+			collections, err := srv.store.GetCalendarCollections(name)
+			if err != nil {
+				return davStoreError(c, err)
+			}
+			for _, collection := range collections {
+				responses = append(responses, davResponse{Href: davCollectionPath(name, collection.Category.ID), Props: davCollectionProps(name, collection)})
+			}
+		}
+	case "collection":
+		collection, err := srv.store.GetCalendarCollection(name, res.CatID)
+		if err != nil {
+			return davStoreError(c, err)
+		}
+		responses = append(responses, davResponse{Href: davCollectionPath(name, res.CatID), Props: davCollectionProps(name, *collection)})
+		if children {
+			objects, err := srv.store.GetCalendarObjects(name, res.CatID)
+			if err != nil {
+				return davStoreError(c, err)
+			}
+			for _, t := range objects {
+				responses = append(responses, davResponse{Href: davObjectPath(name, res.CatID, t.Href), Props: davObjectProps(t)})
+			}
+		}
+	case "object":
+		t, err := srv.store.GetCalendarObject(name, res.CatID, res.Href)
+		if err != nil {
+			return davStoreError(c, err)
+		}
+		responses = append(responses, davResponse{Href: davObjectPath(name, res.CatID, t.Href), Props: davObjectProps(*t)})
+	}
+	return sendMultistatus(c, req, responses, "")
+}
+
+// davReport beantwortet die Berichte calendar-query, calendar-multiget und sync-collection für einen Kalender
+// calendar-query liefert alle Aufgaben, sofern nicht ausschließlich andere Komponenten als VTODO gefiltert werden
+//
+// Parameter:
+//   - c: Ein Pointer auf ein Context-Objekt von fiber
+//   - name: Der Name des angemeldeten Benutzers
+//   - res: Die angefragte Ressource
+//
+// Rückgabewert:
+//   - error: Ein Fehler, falls der Bericht nicht unterstützt wird, das Sync-Token ungültig ist oder beim Laden ein Fehler auftritt - wird an Client gesendet
+func (srv *server) davReport(c *fiber.Ctx, name string, res davResource) error {
+	req, err := parseDAVRequest(c.Body())
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Ungültige Eingabedaten"})
+	}
+	if res.Kind != "collection" {
+		return c.Status(403).JSON(fiber.Map{"error": "Berichte werden nur für Kalender unterstützt"})
+	}
+
+	collection, err := srv.store.GetCalendarCollection(name, res.CatID)
+	if err != nil {
+		return davStoreError(c, err)
+	}
+	objects, err := srv.store.GetCalendarObjects(name, res.CatID)
+	if err != nil {
+		return davStoreError(c, err)
+	}
+	byHref := make(map[string]calendarTask, len(objects))
+	for _, t := range objects {
+		byHref[t.Href] = t
+	}
+
+	responses := make([]davResponse, 0)
+	switch req.Root {
+	case xml.Name{Space: calDAVNS, Local: "calendar-query"}:
+		if len(req.Components) > 1 && !containsString(req.Components, "VTODO") {
+			break
+		}
+		for _, t := range objects {
+			responses = append(responses, davResponse{Href: davObjectPath(name, res.CatID, t.Href), Props: davObjectProps(t)})
+		}
+	case xml.Name{Space: calDAVNS, Local: "calendar-multiget"}:
+		for _, href := range req.Hrefs {
+			target, err := parseDAVPath(href, name)
+			t, ok := byHref[target.Href]
+			if err != nil || target.Kind != "object" || target.CatID != res.CatID || !ok {
+				responses = append(responses, davResponse{Href: href, Status: 404})
+				continue
+			}
+			responses = append(responses, davResponse{Href: href, Props: davObjectProps(t)})
+		}
+	case xml.Name{Space: davNS, Local: "sync-collection"}:
+		var since int64
+		if req.SyncToken != "" {
+			seq, ok := strings.CutPrefix(req.SyncToken, davSyncTokenPrefix)
+			since, err = strconv.ParseInt(seq, 10, 64)
+			if !ok || err != nil || since < 0 || since > collection.SyncToken {
+				c.Set(fiber.HeaderContentType, "application/xml; charset=utf-8")
+				return c.Status(403).SendString(xml.Header + `<d:error xmlns:d="DAV:"><d:valid-sync-token/></d:error>`)
+			}
+		}
+
+		if since == 0 {
+			for _, t := range objects {
+				responses = append(responses, davResponse{Href: davObjectPath(name, res.CatID, t.Href), Props: davObjectProps(t)})
+			}
+		} else {
+			hrefs, err := srv.store.GetCalendarChanges(res.CatID, since)
+			if err != nil {
+				return davStoreError(c, err)
+			}
+			for _, href := range hrefs {
+				if t, ok := byHref[href]; ok {
+					responses = append(responses, davResponse{Href: davObjectPath(name, res.CatID, href), Props: davObjectProps(t)})
+				} else {
+					responses = append(responses, davResponse{Href: davObjectPath(name, res.CatID, href), Status: 404})
+				}
+			}
+		}
+		return sendMultistatus(c, req, responses, davSyncTokenPrefix+strconv.FormatInt(collection.SyncToken, 10))
+	default:
+		return c.Status(403).JSON(fiber.Map{"error": "Bericht wird nicht unterstützt"})
+	}
+	return sendMultistatus(c, req, responses, "")
+}
+
+// davGet sendet eine Aufgabe als iCalendar-Datei
+//
+// Parameter:
+//   - c: Ein Pointer auf ein Context-Objekt von fiber
+//   - name: Der Name des angemeldeten Benutzers
+//   - res: Die angefragte Ressource
+//
+// Rückgabewert:
+//   - error: Ein Fehler, falls die Aufgabe nicht existiert - wird an Client gesendet
+func (srv *server) davGet(c *fiber.Ctx, name string, res davResource) error {
+	if res.Kind != "object" {
+		return c.Status(405).JSON(fiber.Map{"error": "Methode wird nicht unterstützt"})
+	}
+	t, err := srv.store.GetCalendarObject(name, res.CatID, res.Href)
+	if err != nil {
+		return davStoreError(c, err)
+	}
+
+	data, etag := renderCalendarObject(*t)
+	c.Set(fiber.HeaderETag, etag)
+	c.Set(fiber.HeaderContentType, "text/calendar; charset=utf-8")
+	return c.Status(200).Send(data)
+}
+
+// davPrecondition prüft die Header If-Match und If-None-Match gegen den aktuellen Stand einer Aufgabe
+//
+// Parameter:
+//   - c: Ein Pointer auf ein Context-Objekt von fiber
+//   - existing: Ein Pointer auf die gespeicherte Aufgabe; "nil", falls die Ressource noch nicht existiert
+//
+// Rückgabewert:
+//   - bool: "true", falls die Anfrage ausgeführt werden darf
+func davPrecondition(c *fiber.Ctx, existing *calendarTask) bool {
+	ifMatch := c.Get(fiber.HeaderIfMatch)
+	ifNoneMatch := c.Get(fiber.HeaderIfNoneMatch)
+	if ifNoneMatch == "*" && existing != nil {
+		return false
+	}
+	if ifMatch == "" {
+		return true
+	}
+	if existing == nil {
+		return false
+	}
+	_, etag := renderCalendarObject(*existing)
+	return ifMatch == "*" || ifMatch == etag
+}
+
+// davPut speichert eine von einem Client gesendete Aufgabe; Freigaben und intelligente Listen werden wie bei Änderungen über die API aktualisiert
+//
+// Parameter:
+//   - c: Ein Pointer auf ein Context-Objekt von fiber
+//   - name: Der Name des angemeldeten Benutzers
+//   - res: Die angefragte Ressource
+//
+// Rückgabewert:
+//   - error: Ein Fehler, falls die Datei ungültig ist, das ETag nicht passt oder beim Speichern ein Fehler auftritt - wird an Client gesendet
+func (srv *server) davPut(c *fiber.Ctx, name string, res davResource) error {
+	if res.Kind != "object" {
+		return c.Status(405).JSON(fiber.Map{"error": "Methode wird nicht unterstützt"})
+	}
+	t, err := parseVTODO(c.Body())
+	if err != nil {
+		return c.Status(403).JSON(fiber.Map{"error": err.Error()})
+	}
+	if t.Title == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "Titel darf nicht leer sein"})
+	}
+	t.Href = res.Href
+
+	existing, err := srv.store.GetCalendarObject(name, res.CatID, res.Href)
+	if err != nil && !errors.Is(err, errTaskNotFound) {
+		return davStoreError(c, err)
+	}
+	if !davPrecondition(c, existing) {
+		return c.Status(412).JSON(fiber.Map{"error": "Die Aufgabe wurde zwischenzeitlich geändert"})
+	}
+
+	taskID, created, err := srv.store.PutCalendarObject(name, res.CatID, t)
+	if err != nil {
+		fmt.Println(err)
+		if errors.Is(err, errCategoryNotFound) {
+			return c.Status(404).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.Status(400).JSON(fiber.Map{"error": "Aufgabe konnte nicht gespeichert werden"})
+	}
+
+	srv.refreshSmartListsForTask(taskID)
+	srv.wakeWebhookDelivery()
+	if !created {
+		changedTask, err := srv.store.GetTaskForUser(name, taskID)
+		if err != nil {
+			fmt.Println(err)
+		} else if len(changedTask.Shared) > 0 {
+			srv.notifySharedTaskChanged(*changedTask, name)
+		}
+	}
+	if created {
+		return c.SendStatus(201)
+	}
+	return c.SendStatus(204)
+}
+
+// davDelete verschiebt eine Aufgabe in den Papierkorb, wie beim Löschen über die API
+//
+// Parameter:
+//   - c: Ein Pointer auf ein Context-Objekt von fiber
+//   - name: Der Name des angemeldeten Benutzers
+//   - res: Die angefragte Ressource
+//
+// Rückgabewert:
+//   - error: Ein Fehler, falls die Aufgabe nicht existiert, das ETag nicht passt oder beim Löschen ein Fehler auftritt - wird an Client gesendet
+func (srv *server) davDelete(c *fiber.Ctx, name string, res davResource) error {
+	if res.Kind != "object" {
+		return c.Status(405).JSON(fiber.Map{"error": "Methode wird nicht unterstützt"})
+	}
+	existing, err := srv.store.GetCalendarObject(name, res.CatID, res.Href)
+	if err != nil {
+		return davStoreError(c, err)
+	}
+	if !davPrecondition(c, existing) {
+		return c.Status(412).JSON(fiber.Map{"error": "Die Aufgabe wurde zwischenzeitlich geändert"})
+	}
+
+	removedFrom, err := srv.store.DeleteTask(name, existing.ID)
+	if err != nil {
+		fmt.Println(err)
+		if errors.Is(err, errTaskNotFound) {
+			return c.Status(404).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.Status(400).JSON(fiber.Map{"error": "Fehler beim Löschen aufgetreten"})
+	}
+	notifyTaskRemoved(removedFrom, existing.ID)
+	srv.refreshSmartListsForTask(existing.ID)
+	srv.wakeWebhookDelivery()
+	return c.SendStatus(204)
+}
+
+// HandleWellKnownCalDAV leitet Clients, die den Server über /.well-known/caldav suchen, zum CalDAV-Server weiter
+//
+// Parameter:
+//   - c: Ein Pointer auf ein Context-Objekt von fiber
+//
+// Rückgabewert:
+//   - error: Ein Fehler, falls beim Senden ein Fehler auftritt
+func (srv *server) HandleWellKnownCalDAV(c *fiber.Ctx) error {
+	return c.Redirect(davPrefix+"/", 301)
+}
@@ -0,0 +1,584 @@
+package main
+
+import (
+	"bufio"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+var errFeedNotFound = errors.New("Kalender-Abonnement konnte nicht gefunden werden")
+
+// calendarFeed ist eine geheime Adresse, über die Kalender-Apps die fälligen Aufgaben eines Benutzers abonnieren können
+// view schränkt den Kalender auf eine Ansicht ein, siehe globalView, categoryView und smartListView
+type calendarFeed struct {
+	Token     string    `json:"token"`
+	User      string    `json:"-"`
+	View      string    `json:"view"`
+	CreatedAt time.Time `json:"createdAt"`
+	URL       string    `json:"url,omitempty"`
+}
+
+// calendarTask ist eine Aufgabe, wie sie in einem Kalender erscheint
+// uid ist die von einem CalDAV-Client vergebene UID; "", falls die Aufgabe nicht über CalDAV angelegt wurde
+// href ist der Name der Ressource innerhalb der CalDAV-Sammlung ohne .ics
+type calendarTask struct {
+	ID        int
+	Title     string
+	Desc      string
+	IsDone    bool
+	Priority  string
+	Category  string
+	Owner     string
+	UID       string
+	Href      string
+	CreatedAt *time.Time
+	DueAt     *time.Time
+	DoneAt    *time.Time
+}
+
+// todoUID liefert die UID des VTODO einer Aufgabe
+//
+// Rückgabewert:
+//   - string: Die gespeicherte UID bzw. eine aus der ID der Aufgabe gebildete
+func (t calendarTask) todoUID() string {
+	if t.UID != "" {
+		return t.UID
+	}
+	return "todo-" + strconv.Itoa(t.ID) + "@go-todo"
+}
+
+// newSecretToken erzeugt ein zufälliges Token, z.B. für die Adresse eines Kalender-Abonnements oder ein App-Passwort
+//
+// Rückgabewert:
+//   - string: Das Token als Hex-Zeichenkette
+//   - error: Ein Fehler, falls keine Zufallszahlen erzeugt werden konnten; "nil", falls nicht
+func newSecretToken() (string, error) {
+	b := make([]byte, 24)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// AddCalendarFeed legt eine neue geheime Adresse für die fälligen Aufgaben einer Ansicht an
+//
+// Parameter:
+//   - name: Der Name des Benutzers
+//   - view: Der Schlüssel der Ansicht
+//
+// Rückgabewert:
+//   - feed: Das angelegte Abonnement
+//   - error: errCategoryNotFound, errSmartListNotFound bzw. errInvalidView, falls die Ansicht nicht dem Benutzer gehört; "nil", falls kein Fehler auftritt
+func (s *sqlStore) AddCalendarFeed(name, view string) (calendarFeed, error) {
+	_, err := s.getViewTaskIDs(s.db, name, view)
+	if err != nil {
+		return calendarFeed{}, err
+	}
+
+	token, err := newSecretToken()
+	if err != nil {
+		return calendarFeed{}, err
+	}
+	feed := calendarFeed{Token: token, User: name, View: view, CreatedAt: time.Now().Truncate(time.Second)}
+	_, err = s.db.Exec(`INSERT INTO calendar_feeds (token, user_id, view_key, created_at) VALUES (?,`+userIDSQL+`,?,?)`, token, name, view, feed.CreatedAt.Unix())
+	if err != nil {
+		return calendarFeed{}, err
+	}
+	return feed, nil
+}
+
+// GetCalendarFeedsForUser lädt alle Kalender-Abonnements eines Benutzers
+//
+// Parameter:
+//   - name: Der Name des Benutzers
+//
+// Rückgabewert:
+//   - feeds: Die Abonnements, die ältesten zuerst
+//   - error: Ein Fehler, falls bei der Abfrage ein Fehler auftritt; "nil", falls nicht
+func (s *sqlStore) GetCalendarFeedsForUser(name string) ([]calendarFeed, error) {
+	rows, err := s.db.Query(`SELECT token, view_key, created_at FROM calendar_feeds WHERE user_id = `+userIDSQL+` ORDER BY created_at, token`, name)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	feeds := make([]calendarFeed, 0)
+	for rows.Next() {
+		feed := calendarFeed{User: name}
+		var createdAt int64
+		err = rows.Scan(&feed.Token, &feed.View, &createdAt)
+		if err != nil {
+			return nil, err
+		}
+		feed.CreatedAt = time.Unix(createdAt, 0)
+		feeds = append(feeds, feed)
+	}
+	return feeds, rows.Err()
+}
+
+// GetCalendarFeed lädt das Kalender-Abonnement zu einem Token
+//
+// Parameter:
+//   - token: Das Token aus der Adresse des Abonnements
+//
+// Rückgabewert:
+//   - feed: Ein Pointer auf das Abonnement; "nil", falls ein Fehler auftritt
+//   - error: errFeedNotFound, falls das Token unbekannt oder widerrufen ist; "nil", falls kein Fehler auftritt
+func (s *sqlStore) GetCalendarFeed(token string) (*calendarFeed, error) {
+	feed := calendarFeed{Token: token}
+	var createdAt int64
+	err := s.db.QueryRow(`SELECT `+userNameSQL("user_id")+`, view_key, created_at FROM calendar_feeds WHERE token = ?`, token).Scan(&feed.User, &feed.View, &createdAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errFeedNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	feed.CreatedAt = time.Unix(createdAt, 0)
+	return &feed, nil
+}
+
+// DeleteCalendarFeed widerruft ein Kalender-Abonnement, die Adresse liefert danach keine Aufgaben mehr
+//
+// Parameter:
+//   - name: Der Name des Benutzers
+//   - token: Das Token des Abonnements
+//
+// Rückgabewert:
+//   - error: errFeedNotFound, falls das Abonnement nicht dem Benutzer gehört; "nil", falls kein Fehler auftritt
+func (s *sqlStore) DeleteCalendarFeed(name, token string) error {
+	result, err := s.db.Exec(`DELETE FROM calendar_feeds WHERE token = ? AND user_id = `+userIDSQL, token, name)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return errFeedNotFound
+	}
+	return nil
+}
+
+// GetDueTasksForView lädt die aktiven Aufgaben einer Ansicht, die ein Fälligkeitsdatum haben, inklusive der für den Benutzer freigegebenen
+//
+// Parameter:
+//   - name: Der Name des Benutzers
+//   - view: Der Schlüssel der Ansicht
+//
+// Rückgabewert:
+//   - tasks: Die Aufgaben in der Reihenfolge der Ansicht
+//   - error: Ein Fehler, falls die Ansicht nicht geladen werden kann; "nil", falls nicht
+func (s *sqlStore) GetDueTasksForView(name, view string) ([]calendarTask, error) {
+	query := `SELECT t.id, t.title, COALESCE(t.desc, ''), t.isDone, t.priority, c.cat_name, ` + userNameSQL("t.user_id") + `, COALESCE(t.ical_uid, ''), t.due_at, t.done_at
+	FROM tasks t
+	INNER JOIN categories c ON t.category_id = c.id
+	WHERE t.due_at IS NOT NULL AND t.deleted_at IS NULL AND t.archived_at IS NULL
+	AND (t.user_id = ` + userIDSQL + ` OR EXISTS(SELECT 1 FROM sharing s WHERE s.task_id = t.id AND s.target_id = ` + userIDSQL + `))`
+
+	taskIDs, err := s.getViewTaskIDs(s.db, name, view)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Query(query, name, name)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	dueTasks := make(map[int]calendarTask)
+	for rows.Next() {
+		var t calendarTask
+		var dueAt int64
+		var doneAt *int64
+		err = rows.Scan(&t.ID, &t.Title, &t.Desc, &t.IsDone, &t.Priority, &t.Category, &t.Owner, &t.UID, &dueAt, &doneAt)
+		if err != nil {
+			return nil, err
+		}
+		t.DueAt = unixTime(&dueAt)
+		t.DoneAt = unixTime(doneAt)
+		dueTasks[t.ID] = t
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	tasks := make([]calendarTask, 0)
+	for _, taskID := range taskIDs {
+		if t, ok := dueTasks[taskID]; ok {
+			tasks = append(tasks, t)
+		}
+	}
+	return tasks, nil
+}
+
+// SetTaskDue führt eine Transaktion in der Datenbank aus, um das Fälligkeitsdatum einer Aufgabe zu setzen oder zu entfernen, nur der Besitzer darf es ändern
+//
+// Parameter:
+//   - name: Der Name des Benutzers
+//   - taskID: Die ID der Aufgabe
+//   - due: Ein Pointer auf das Fälligkeitsdatum; "nil", um es zu entfernen
+//
+// Rückgabewert:
+//   - error: errTaskNotFound, falls die Aufgabe nicht dem Benutzer gehört; "nil", falls kein Fehler auftritt
+func (s *sqlStore) SetTaskDue(name string, taskID int, due *time.Time) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.Exec(`UPDATE tasks SET due_at = ? WHERE id = ? AND user_id = `+userIDSQL+` AND deleted_at IS NULL`, unixSeconds(due), taskID, name)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if affected == 0 {
+		tx.Rollback()
+		return errTaskNotFound
+	}
+
+	err = insertWebhookDeliveries(tx, webhookEvent{Type: webhookTaskUpdated, Actor: name, TaskID: taskID})
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return nil
+}
+
+// icsEscape maskiert einen Text für ein Feld nach RFC 5545
+//
+// Parameter:
+//   - value: Der Text
+//
+// Rückgabewert:
+//   - string: Der maskierte Text
+func icsEscape(value string) string {
+	value = strings.ReplaceAll(value, "\r\n", "\n")
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\n", `\n`, "\r", `\n`).Replace(value)
+}
+
+// icsPriority wandelt die Priorität A-Z aus todo.txt in die Priorität 1-9 nach RFC 5545 um
+//
+// Parameter:
+//   - priority: Die Priorität der Aufgabe; "", falls keine gesetzt ist
+//
+// Rückgabewert:
+//   - int: Die Priorität, A entspricht 1 und ab I wird 9 verwendet; 0, falls keine gesetzt ist
+func icsPriority(priority string) int {
+	if priority == "" {
+		return 0
+	}
+	return min(int(priority[0]-'A')+1, 9)
+}
+
+// icsWriter schreibt die Zeilen eines Kalenders mit CRLF und faltet Zeilen, die länger als 75 Bytes sind
+type icsWriter struct {
+	w io.Writer
+}
+
+// line schreibt eine Zeile des Kalenders
+//
+// Parameter:
+//   - format: Das Format der Zeile, siehe fmt.Sprintf
+//   - args: Die Werte für das Format
+func (iw icsWriter) line(format string, args ...interface{}) {
+	line := fmt.Sprintf(format, args...)
+	// Folgezeilen beginnen mit einem Leerzeichen, das mitgezählt wird
+	limit := 75
+	for len(line) > limit {
+		cut := limit
+		for !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+		io.WriteString(iw.w, line[:cut]+"\r\n ")
+		line = line[cut:]
+		limit = 74
+	}
+	io.WriteString(iw.w, line+"\r\n")
+}
+
+// writeTaskProperties schreibt die gemeinsamen Eigenschaften eines VEVENT bzw. VTODO
+//
+// Parameter:
+//   - iw: Das Ziel der Zeilen
+//   - t: Die Aufgabe
+//   - uid: Die UID des Eintrags
+//   - stamp: Der Zeitstempel für DTSTAMP
+func writeTaskProperties(iw icsWriter, t calendarTask, uid, stamp string) {
+	iw.line("UID:%s", icsEscape(uid))
+	iw.line("DTSTAMP:%s", stamp)
+	iw.line("SUMMARY:%s", icsEscape(t.Title))
+	if t.Desc != "" {
+		iw.line("DESCRIPTION:%s", icsEscape(t.Desc))
+	}
+	if t.Category != "" {
+		iw.line("CATEGORIES:%s", icsEscape(t.Category))
+	}
+	if priority := icsPriority(t.Priority); priority > 0 {
+		iw.line("PRIORITY:%d", priority)
+	}
+}
+
+// writeTodo schreibt eine Aufgabe als VTODO mit Status, Erledigungszeitpunkt und ggf. Fälligkeit
+//
+// Parameter:
+//   - iw: Das Ziel der Zeilen
+//   - t: Die Aufgabe
+//   - stamp: Der Zeitstempel für DTSTAMP
+func writeTodo(iw icsWriter, t calendarTask, stamp string) {
+	iw.line("BEGIN:VTODO")
+	writeTaskProperties(iw, t, t.todoUID(), stamp)
+	if t.CreatedAt != nil {
+		iw.line("CREATED:%s", t.CreatedAt.UTC().Format("20060102T150405Z"))
+	}
+	if t.DueAt != nil {
+		iw.line("DUE;VALUE=DATE:%s", t.DueAt.Local().Format("20060102"))
+	}
+	if t.IsDone {
+		iw.line("STATUS:COMPLETED")
+		if t.DoneAt != nil {
+			iw.line("COMPLETED:%s", t.DoneAt.UTC().Format("20060102T150405Z"))
+		}
+	} else {
+		iw.line("STATUS:NEEDS-ACTION")
+	}
+	iw.line("END:VTODO")
+}
+
+// writeCalendar schreibt die fälligen Aufgaben als Kalender nach RFC 5545
+// offene Aufgaben erscheinen als ganztägiges VEVENT am Tag der Fälligkeit, alle Aufgaben als VTODO mit Fälligkeit und Status
+//
+// Parameter:
+//   - w: Das Ziel des Kalenders
+//   - calName: Der angezeigte Name des Kalenders
+//   - tasks: Die fälligen Aufgaben
+//   - events: "true", falls VEVENT-Einträge geschrieben werden sollen
+//   - todos: "true", falls VTODO-Einträge geschrieben werden sollen
+//   - now: Der Zeitpunkt der Erstellung
+func writeCalendar(w io.Writer, calName string, tasks []calendarTask, events, todos bool, now time.Time) {
+	iw := icsWriter{w: w}
+	stamp := now.UTC().Format("20060102T150405Z")
+
+	iw.line("BEGIN:VCALENDAR")
+	iw.line("VERSION:2.0")
+	iw.line("PRODID:-//go-todo//go-todo//DE")
+	iw.line("CALSCALE:GREGORIAN")
+	iw.line("METHOD:PUBLISH")
+	iw.line("X-WR-CALNAME:%s", icsEscape(calName))
+	for _, t := range tasks {
+		if events && !t.IsDone {
+			due := t.DueAt.Local()
+			iw.line("BEGIN:VEVENT")
+			writeTaskProperties(iw, t, "event-"+strconv.Itoa(t.ID)+"@go-todo", stamp)
+			iw.line("DTSTART;VALUE=DATE:%s", due.Format("20060102"))
+			iw.line("DTEND;VALUE=DATE:%s", due.AddDate(0, 0, 1).Format("20060102"))
+			iw.line("TRANSP:TRANSPARENT")
+			iw.line("END:VEVENT")
+		}
+		if todos {
+			writeTodo(iw, t, stamp)
+		}
+	}
+	iw.line("END:VCALENDAR")
+}
+
+// feedURL liefert die vollständige Adresse eines Kalender-Abonnements
+//
+// Parameter:
+//   - c: Ein Pointer auf ein Context-Objekt von fiber
+//   - token: Das Token des Abonnements
+//
+// Rückgabewert:
+//   - string: Die Adresse, die in der Kalender-App eingetragen wird
+func feedURL(c *fiber.Ctx, token string) string {
+	return c.BaseURL() + "/feeds/" + token + ".ics"
+}
+
+// HandleGetCalendarFeeds sendet alle Kalender-Abonnements des anfragenden Benutzers
+//
+// Parameter:
+//   - c: Ein Pointer auf ein Context-Objekt von fiber
+//
+// Rückgabewert:
+//   - error: Ein Fehler, falls beim Laden ein Fehler auftritt - wird an Client gesendet
+func (srv *server) HandleGetCalendarFeeds(c *fiber.Ctx) error {
+	name := c.Locals("name").(string)
+
+	feeds, err := srv.store.GetCalendarFeedsForUser(name)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(400).JSON(fiber.Map{"error": "Abonnements konnten nicht geladen werden"})
+	}
+	for i := range feeds {
+		feeds[i].URL = feedURL(c, feeds[i].Token)
+	}
+	return c.Status(200).JSON(fiber.Map{"feeds": feeds})
+}
+
+// HandleAddCalendarFeed legt eine neue geheime Adresse für ein Kalender-Abonnement an
+// der Body kann mit {"view": "category:3"} den Kalender auf eine Kategorie bzw. intelligente Liste einschränken
+//
+// Parameter:
+//   - c: Ein Pointer auf ein Context-Objekt von fiber
+//
+// Rückgabewert:
+//   - error: Ein Fehler, falls die Ansicht ungültig ist oder beim Anlegen ein Fehler auftritt - wird an Client gesendet
+//     Bei Erfolg wird das Abonnement inklusive Adresse an den Client gesendet
+func (srv *server) HandleAddCalendarFeed(c *fiber.Ctx) error {
+	name := c.Locals("name").(string)
+	type FeedInput struct {
+		View string `json:"view"`
+	}
+	var input FeedInput
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&input); err != nil {
+			fmt.Println(err)
+			return c.Status(400).JSON(fiber.Map{"error": "Ungültige Eingabedaten"})
+		}
+	}
+
+	feed, err := srv.store.AddCalendarFeed(name, input.View)
+	if err != nil {
+		fmt.Println(err)
+		if errors.Is(err, errCategoryNotFound) || errors.Is(err, errSmartListNotFound) {
+			return c.Status(404).JSON(fiber.Map{"error": err.Error()})
+		}
+		if errors.Is(err, errInvalidView) {
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.Status(400).JSON(fiber.Map{"error": "Abonnement konnte nicht angelegt werden"})
+	}
+	feed.URL = feedURL(c, feed.Token)
+	return c.Status(201).JSON(feed)
+}
+
+// HandleDeleteCalendarFeed widerruft ein Kalender-Abonnement des anfragenden Benutzers
+//
+// Parameter:
+//   - c: Ein Pointer auf ein Context-Objekt von fiber
+//
+// Rückgabewert:
+//   - error: Ein Fehler, falls das Abonnement nicht existiert - wird an Client gesendet
+func (srv *server) HandleDeleteCalendarFeed(c *fiber.Ctx) error {
+	name := c.Locals("name").(string)
+
+	err := srv.store.DeleteCalendarFeed(name, c.Params("token"))
+	if errors.Is(err, errFeedNotFound) {
+		return c.Status(404).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(400).JSON(fiber.Map{"error": "Abonnement konnte nicht widerrufen werden"})
+	}
+	return c.Status(200).JSON(fiber.Map{"msg": "Abonnement erfolgreich widerrufen"})
+}
+
+// HandleCalendarFeed sendet die fälligen Aufgaben eines Abonnements als iCalendar-Datei
+// die Route ist nicht durch ein JWT geschützt, das geheime Token in der Adresse dient als Zugangsberechtigung
+// über den Parameter components wird gewählt, ob event (Standard), todo oder both ausgeliefert wird
+//
+// Parameter:
+//   - c: Ein Pointer auf ein Context-Objekt von fiber
+//
+// Rückgabewert:
+//   - error: Ein Fehler, falls das Token unbekannt ist oder beim Laden ein Fehler auftritt - wird an Client gesendet
+func (srv *server) HandleCalendarFeed(c *fiber.Ctx) error {
+	token := strings.TrimSuffix(c.Params("token"), ".ics")
+	components := c.Query("components", "event")
+	if components != "event" && components != "todo" && components != "both" {
+		return c.Status(400).JSON(fiber.Map{"error": "Unbekannte Komponenten, erlaubt sind event, todo und both"})
+	}
+
+	feed, err := srv.store.GetCalendarFeed(token)
+	if errors.Is(err, errFeedNotFound) {
+		return c.Status(404).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(400).JSON(fiber.Map{"error": "Kalender konnte nicht geladen werden"})
+	}
+
+	tasks, err := srv.store.GetDueTasksForView(feed.User, feed.View)
+	if errors.Is(err, errCategoryNotFound) || errors.Is(err, errSmartListNotFound) {
+		return c.Status(404).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(400).JSON(fiber.Map{"error": "Kalender konnte nicht geladen werden"})
+	}
+
+	calName := "go-todo (" + feed.User + ")"
+	c.Set(fiber.HeaderContentType, "text/calendar; charset=utf-8")
+	c.Status(200).Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		writeCalendar(w, calName, tasks, components != "todo", components != "event", time.Now())
+		w.Flush()
+	})
+	return nil
+}
+
+// HandleSetTaskDue setzt das Fälligkeitsdatum einer Aufgabe, z.B. {"due": "2024-06-01"}; eine leere Angabe entfernt es
+//
+// Parameter:
+//   - c: Ein Pointer auf ein Context-Objekt von fiber
+//
+// Rückgabewert:
+//   - error: Ein Fehler, falls das Datum ungültig ist oder die Aufgabe nicht dem Benutzer gehört - wird an Client gesendet
+func (srv *server) HandleSetTaskDue(c *fiber.Ctx) error {
+	name := c.Locals("name").(string)
+	type DueInput struct {
+		Due string `json:"due"`
+	}
+	var input DueInput
+	if err := c.BodyParser(&input); err != nil {
+		fmt.Println(err)
+		return c.Status(400).JSON(fiber.Map{"error": "Ungültige Eingabedaten"})
+	}
+	taskID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Ungültige Eingabedaten"})
+	}
+
+	var due *time.Time
+	if input.Due != "" {
+		due = parseTodoTxtDate(input.Due)
+		if due == nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Ungültiges Datum, erwartet wird JJJJ-MM-TT"})
+		}
+	}
+
+	err = srv.store.SetTaskDue(name, taskID, due)
+	if errors.Is(err, errTaskNotFound) {
+		return c.Status(404).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(400).JSON(fiber.Map{"error": "Fälligkeitsdatum konnte nicht geändert werden"})
+	}
+	srv.refreshSmartListsForTask(taskID)
+	srv.wakeWebhookDelivery()
+	return c.Status(200).JSON(fiber.Map{"msg": "Fälligkeitsdatum erfolgreich geändert"})
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// exportVersion ist die Version des JSON-Exports, sie wird erhöht, sobald sich das Format inkompatibel ändert
+const exportVersion = 1
+
+// exportTask ist eine Aufgabe im Export, die Kategorie wird über ihre ID innerhalb des Exports referenziert
+type exportTask struct {
+	ID         int        `json:"id"`
+	Title      string     `json:"title"`
+	Desc       string     `json:"desc"`
+	IsDone     bool       `json:"isDone"`
+	Category   int        `json:"category"`
+	Shared     []string   `json:"shared"`
+	ArchivedAt *time.Time `json:"archivedAt,omitempty"`
+}
+
+// userExport enthält alle Daten eines Benutzers, die IDs gelten nur innerhalb des Exports und werden beim Import neu vergeben
+// order enthält je Ansicht (siehe globalView, categoryView und smartListView) die IDs der Aufgaben in angezeigter Reihenfolge
+type userExport struct {
+	Version         int              `json:"version"`
+	ExportedAt      time.Time        `json:"exportedAt"`
+	User            string           `json:"user"`
+	AutoArchiveDays int              `json:"autoArchiveDays"`
+	Categories      []category       `json:"categories"`
+	Tasks           []exportTask     `json:"tasks"`
+	SmartLists      []smartList      `json:"smartLists"`
+	Order           map[string][]int `json:"order"`
+}
+
+// exportUser sammelt alle Daten eines Benutzers für den Export
+// exportiert werden nur eigene Aufgaben inklusive der archivierten; für ihn freigegebene Aufgaben gehören ihrem Besitzer
+//
+// Parameter:
+//   - name: Der Name des Benutzers
+//
+// Rückgabewert:
+//   - export: Ein Pointer auf die gesammelten Daten; "nil", falls ein Fehler auftritt
+//   - error: Ein Fehler, falls beim Laden ein Fehler auftritt; "nil", falls nicht
+func (srv *server) exportUser(name string) (*userExport, error) {
+	export := &userExport{Version: exportVersion, ExportedAt: time.Now().UTC().Truncate(time.Second), User: name, Order: map[string][]int{}}
+
+	days, err := srv.store.GetAutoArchiveDays(name)
+	if err != nil {
+		return nil, err
+	}
+	export.AutoArchiveDays = days
+
+	export.Categories, err = srv.store.GetCategoriesForUser(name)
+	if err != nil {
+		return nil, err
+	}
+	export.SmartLists, err = srv.store.GetSmartListsForUser(name)
+	if err != nil {
+		return nil, err
+	}
+
+	activeTasks, err := srv.store.GetTasksForUser(name)
+	if err != nil {
+		return nil, err
+	}
+	archivedTasks, err := srv.store.GetArchivedTasksForUser(name, "")
+	if err != nil {
+		return nil, err
+	}
+	owned := make(map[int]bool)
+	export.Tasks = make([]exportTask, 0, len(activeTasks)+len(archivedTasks))
+	for _, t := range append(activeTasks, archivedTasks...) {
+		if t.Owner != name {
+			continue
+		}
+		owned[t.ID] = true
+		export.Tasks = append(export.Tasks, exportTask{ID: t.ID, Title: t.Title, Desc: t.Desc, IsDone: t.IsDone, Category: t.Category.ID, Shared: t.Shared, ArchivedAt: t.ArchivedAt})
+	}
+
+	views := []string{globalView}
+	for _, cat := range export.Categories {
+		views = append(views, categoryView(cat.ID))
+	}
+	for _, list := range export.SmartLists {
+		views = append(views, smartListView(list.ID))
+	}
+	for _, view := range views {
+		viewTasks, err := srv.store.GetTasksForView(name, view)
+		if err != nil {
+			return nil, err
+		}
+		taskIDs := make([]int, 0, len(viewTasks))
+		for _, t := range viewTasks {
+			if owned[t.ID] {
+				taskIDs = append(taskIDs, t.ID)
+			}
+		}
+		export.Order[view] = taskIDs
+	}
+	return export, nil
+}
+
+// exportCategoryNames ordnet den IDs der Kategorien eines Exports ihre Namen zu
+//
+// Parameter:
+//   - export: Der Export
+//
+// Rückgabewert:
+//   - map[int]string: Die Namen der Kategorien je ID
+func exportCategoryNames(export *userExport) map[int]string {
+	names := make(map[int]string, len(export.Categories))
+	for _, cat := range export.Categories {
+		names[cat.ID] = cat.Cat_name
+	}
+	return names
+}
+
+// exportPositions liefert die Position jeder Aufgabe in der Gesamtliste, archivierte Aufgaben stehen am Ende
+//
+// Parameter:
+//   - export: Der Export
+//
+// Rückgabewert:
+//   - map[int]int: Die Position je ID der Aufgabe, beginnend bei 1
+func exportPositions(export *userExport) map[int]int {
+	positions := make(map[int]int, len(export.Tasks))
+	for i, taskID := range export.Order[globalView] {
+		positions[taskID] = i + 1
+	}
+	next := len(positions)
+	for _, t := range export.Tasks {
+		if _, ok := positions[t.ID]; !ok {
+			next++
+			positions[t.ID] = next
+		}
+	}
+	return positions
+}
+
+// exportCSV schreibt die Aufgaben eines Exports als CSV mit einer Zeile je Aufgabe in der Reihenfolge der Gesamtliste
+// Zielbenutzer von Freigaben werden durch ";" getrennt
+//
+// Parameter:
+//   - export: Der Export
+//
+// Rückgabewert:
+//   - []byte: Die CSV-Datei inklusive Kopfzeile
+//   - error: Ein Fehler, falls beim Schreiben ein Fehler auftritt; "nil", falls nicht
+func exportCSV(export *userExport) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	categoryNames := exportCategoryNames(export)
+	positions := exportPositions(export)
+
+	tasks := make([]exportTask, len(export.Tasks))
+	for _, t := range export.Tasks {
+		tasks[positions[t.ID]-1] = t
+	}
+
+	w.Write([]string{"id", "position", "title", "desc", "done", "category", "archived", "shared"})
+	for _, t := range tasks {
+		archived := ""
+		if t.ArchivedAt != nil {
+			archived = t.ArchivedAt.Format(time.RFC3339)
+		}
+		w.Write([]string{strconv.Itoa(t.ID), strconv.Itoa(positions[t.ID]), t.Title, t.Desc, strconv.FormatBool(t.IsDone),
+			categoryNames[t.Category], archived, strings.Join(t.Shared, ";")})
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+// exportMarkdown schreibt einen Export als Markdown mit einem Abschnitt je Kategorie und einer Checkliste der Aufgaben
+// archivierte Aufgaben stehen in einem eigenen Abschnitt am Ende
+//
+// Parameter:
+//   - export: Der Export
+//
+// Rückgabewert:
+//   - []byte: Die Markdown-Datei
+func exportMarkdown(export *userExport) []byte {
+	var sb strings.Builder
+	positions := exportPositions(export)
+	tasks := make([]exportTask, len(export.Tasks))
+	for _, t := range export.Tasks {
+		tasks[positions[t.ID]-1] = t
+	}
+
+	writeTask := func(t exportTask) {
+		check := " "
+		if t.IsDone {
+			check = "x"
+		}
+		fmt.Fprintf(&sb, "- [%s] %s\n", check, t.Title)
+		for _, line := range strings.Split(t.Desc, "\n") {
+			if strings.TrimSpace(line) != "" {
+				fmt.Fprintf(&sb, "  %s\n", line)
+			}
+		}
+		if len(t.Shared) > 0 {
+			fmt.Fprintf(&sb, "  _Geteilt mit: %s_\n", strings.Join(t.Shared, ", "))
+		}
+	}
+
+	fmt.Fprintf(&sb, "# Aufgaben von %s\n\nExportiert am %s\n", export.User, export.ExportedAt.Format("02.01.2006 15:04"))
+	for _, cat := range export.Categories {
+		fmt.Fprintf(&sb, "\n## %s\n\n", cat.Cat_name)
+		for _, t := range tasks {
+			if t.Category == cat.ID && t.ArchivedAt == nil {
+				writeTask(t)
+			}
+		}
+	}
+
+	archivedHeader := false
+	for _, t := range tasks {
+		if t.ArchivedAt == nil {
+			continue
+		}
+		if !archivedHeader {
+			sb.WriteString("\n## Archiv\n\n")
+			archivedHeader = true
+		}
+		writeTask(t)
+	}
+
+	if len(export.SmartLists) > 0 {
+		sb.WriteString("\n## Intelligente Listen\n\n")
+		for _, list := range export.SmartLists {
+			fmt.Fprintf(&sb, "- %s: `%s`\n", list.List_name, list.Query)
+		}
+	}
+	return []byte(sb.String())
+}
+
+// HandleExport exportiert alle Daten des anfragenden Benutzers als Datei
+// das Format wird über den Parameter format gewählt: json (Standard, für den Import geeignet), csv oder md
+//
+// Parameter:
+//   - c: Ein Pointer auf ein Context-Objekt von fiber
+//
+// Rückgabewert:
+//   - error: Ein Fehler, falls beim Export ein Fehler auftritt oder das Format unbekannt ist - wird an Client gesendet
+//     Bei Erfolg wird der Export als Anhang an den Client gesendet
+func (srv *server) HandleExport(c *fiber.Ctx) error {
+	name := c.Locals("name").(string)
+	format := c.Query("format", "json")
+
+	if format != "json" && format != "csv" && format != "md" {
+		return c.Status(400).JSON(fiber.Map{"error": "Unbekanntes Format, erlaubt sind json, csv und md"})
+	}
+
+	export, err := srv.exportUser(name)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(400).JSON(fiber.Map{"error": "Export konnte nicht erstellt werden"})
+	}
+
+	c.Attachment("go-todo-" + name + "-" + export.ExportedAt.Format("20060102") + "." + format)
+	switch format {
+	case "csv":
+		data, err := exportCSV(export)
+		if err != nil {
+			fmt.Println(err)
+			return c.Status(400).JSON(fiber.Map{"error": "Export konnte nicht erstellt werden"})
+		}
+		c.Type("csv", "utf-8")
+		return c.Status(200).Send(data)
+	case "md":
+		c.Type("md", "utf-8")
+		return c.Status(200).Send(exportMarkdown(export))
+	}
+	return c.Status(200).JSON(export)
+}
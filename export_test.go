@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// comparableExport beschreibt einen Export ohne IDs und Zeitpunkte, die beim Import neu vergeben werden
+type comparableExport struct {
+	Categories map[string][2]string
+	Tasks      map[string]exportTask
+	SmartLists map[string]string
+	Order      map[string][]string
+}
+
+// compareExport ersetzt in einem Export alle IDs durch Namen bzw. Titel
+func compareExport(export *userExport) comparableExport {
+	categoryNames := exportCategoryNames(export)
+	titles := make(map[int]string)
+	result := comparableExport{Categories: map[string][2]string{}, Tasks: map[string]exportTask{}, SmartLists: map[string]string{}, Order: map[string][]string{}}
+	for _, cat := range export.Categories {
+		result.Categories[cat.Cat_name] = [2]string{cat.Color_header, cat.Color_body}
+	}
+	for _, t := range export.Tasks {
+		titles[t.ID] = t.Title
+		key := t.Title + " (" + categoryNames[t.Category] + ")"
+		t.ID, t.Category = 0, 0
+		if t.ArchivedAt != nil {
+			t.ArchivedAt = &time.Time{}
+		}
+		result.Tasks[key] = t
+	}
+	views := map[string]string{globalView: "Gesamtliste"}
+	for _, cat := range export.Categories {
+		views[categoryView(cat.ID)] = "Kategorie " + cat.Cat_name
+	}
+	for _, list := range export.SmartLists {
+		result.SmartLists[list.List_name] = list.Query
+		views[smartListView(list.ID)] = "Liste " + list.List_name
+	}
+	for view, taskIDs := range export.Order {
+		ordered := []string{}
+		for _, taskID := range taskIDs {
+			ordered = append(ordered, titles[taskID])
+		}
+		result.Order[views[view]] = ordered
+	}
+	return result
+}
+
+func TestExportImportRoundTrip(t *testing.T) {
+	forEachDialect(t, func(t *testing.T, store *sqlStore) {
+		srv := newServer(store)
+		addUsers(t, store, "alice", "bob", "carol")
+		catID, err := store.AddCategory("Einkauf", "#111", "#222", "alice")
+		if err != nil {
+			t.Fatal(err)
+		}
+		milk := addTask(t, store, "alice", "Milch kaufen", catID)
+		bread := addTask(t, store, "alice", "Brot kaufen", catID)
+		tax := addTask(t, store, "alice", "Steuer machen", 0)
+		old := addTask(t, store, "alice", "Altes kaufen", catID)
+		if _, err := store.UpdateTask("alice", task{ID: tax, Title: "Steuer machen", Desc: "bis Juli", IsDone: true, Owner: "alice"}); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.ShareTask("alice", milk, "bob"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := store.ArchiveTask("alice", old); err != nil {
+			t.Fatal(err)
+		}
+		listID, err := store.AddSmartList("alice", smartList{List_name: "Kaufen", Query: "kaufen", Color_header: "#333", Color_body: "#444"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		// jede Ansicht erhält eine eigene Reihenfolge
+		for _, move := range []struct {
+			view             string
+			taskID, anchorID int
+		}{{globalView, tax, milk}, {categoryView(catID), bread, milk}, {smartListView(listID), bread, milk}} {
+			if err := store.MoveTask("alice", move.view, move.taskID, move.anchorID, true); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		exported, err := srv.exportUser("alice")
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := json.Marshal(exported)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := parseImport("", body, csvMapping{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		report, err := store.ImportData("carol", data, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if report.Tasks != 4 || report.Shares != 1 || len(report.Duplicates) != 0 {
+			t.Fatalf("Bericht des Imports: %+v", report)
+		}
+
+		imported, err := srv.exportUser("carol")
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, got := compareExport(exported), compareExport(imported)
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("Import des Exports:\n%+v\nerwartet:\n%+v", got, want)
+		}
+	})
+}
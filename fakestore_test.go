@@ -0,0 +1,385 @@
+package main
+
+import (
+	"errors"
+	"slices"
+	"sync"
+	"time"
+)
+
+// fakeStore ist ein Store im Arbeitsspeicher für die Tests der Handler
+// er bildet Benutzer, Aufgaben, Kategorien, Freigaben und die Reihenfolge nach; alle übrigen Methoden
+// fallen auf das eingebettete, leere Store-Interface zurück und lösen einen Panic aus, falls ein Handler sie unerwartet aufruft
+type fakeStore struct {
+	Store
+
+	mu             sync.Mutex
+	users          map[string]*fakeUser
+	tasks          map[int]*fakeTask
+	categories     map[int]*fakeCategory
+	order          map[string][]int
+	loginFailures  map[string]int
+	nextUserID     int
+	nextTaskID     int
+	nextCategoryID int
+}
+
+// fakeUser ist ein Benutzer im fakeStore
+type fakeUser struct {
+	account         account
+	password        string
+	defaultCategory int
+}
+
+// fakeTask ist eine Aufgabe im fakeStore, die Kategorie wird erst beim Laden aufgelöst
+type fakeTask struct {
+	task       task
+	categoryID int
+	deleted    bool
+}
+
+// fakeCategory ist eine Kategorie im fakeStore
+type fakeCategory struct {
+	category category
+	owner    string
+}
+
+// newFakeStore erstellt einen leeren fakeStore
+func newFakeStore() *fakeStore {
+	return &fakeStore{
+		users:         map[string]*fakeUser{},
+		tasks:         map[int]*fakeTask{},
+		categories:    map[int]*fakeCategory{},
+		order:         map[string][]int{},
+		loginFailures: map[string]int{},
+	}
+}
+
+// AddUser legt einen Benutzer mit seiner Standardkategorie an
+func (s *fakeStore) AddUser(name, password string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.users[name]; ok {
+		return errors.New("Benutzer existiert bereits")
+	}
+	s.nextUserID++
+	s.nextCategoryID++
+	s.categories[s.nextCategoryID] = &fakeCategory{
+		category: category{ID: s.nextCategoryID, Cat_name: "default", Color_header: "#00a4ba", Color_body: "#00ceea"},
+		owner:    name,
+	}
+	s.users[name] = &fakeUser{account: account{ID: s.nextUserID, Name: name}, password: password, defaultCategory: s.nextCategoryID}
+	return nil
+}
+
+// CheckPassword vergleicht das Passwort eines Benutzers, der Fake speichert es im Klartext
+func (s *fakeStore) CheckPassword(name, password string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	user, ok := s.users[name]
+	if !ok {
+		return errUserNotFound
+	}
+	if password == "" || user.password != password {
+		return errBadCredentials
+	}
+	return nil
+}
+
+// GetAccount liefert das Konto eines Benutzers anhand seines Namens
+func (s *fakeStore) GetAccount(name string) (*account, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	user, ok := s.users[name]
+	if !ok {
+		return nil, errUserNotFound
+	}
+	loaded := user.account
+	return &loaded, nil
+}
+
+// GetAccountByID liefert das Konto eines Benutzers anhand seiner ID
+func (s *fakeStore) GetAccountByID(id int) (*account, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, user := range s.users {
+		if user.account.ID == id {
+			loaded := user.account
+			return &loaded, nil
+		}
+	}
+	return nil, errUserNotFound
+}
+
+// AddTask legt eine Aufgabe an; eine fremde oder gelöschte Kategorie wird wie im sqlStore durch die Standardkategorie ersetzt
+func (s *fakeStore) AddTask(name string, title string, desc string, category category) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	user, ok := s.users[name]
+	if !ok {
+		return 0, errUserNotFound
+	}
+	categoryID := user.defaultCategory
+	if cat, ok := s.categories[category.ID]; ok && cat.owner == name && cat.category.DeletedAt == nil {
+		categoryID = category.ID
+	}
+	s.nextTaskID++
+	s.tasks[s.nextTaskID] = &fakeTask{task: task{ID: s.nextTaskID, Title: title, Desc: desc, Owner: name, Shared: []string{}}, categoryID: categoryID}
+	s.order[name] = append(s.order[name], s.nextTaskID)
+	return s.nextTaskID, nil
+}
+
+// DeleteTask verschiebt eine eigene Aufgabe in den Papierkorb und liefert die Zielbenutzer ihrer Freigaben
+func (s *fakeStore) DeleteTask(name string, taskID int) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.tasks[taskID]
+	if !ok || t.deleted || t.task.Owner != name {
+		return nil, errTaskNotFound
+	}
+	t.deleted = true
+	return slices.Clone(t.task.Shared), nil
+}
+
+// UpdateTask ändert eine Aufgabe und meldet, ob sie freigegeben ist
+func (s *fakeStore) UpdateTask(name string, changedTask task) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.tasks[changedTask.ID]
+	if !ok || t.deleted {
+		return false, errTaskNotFound
+	}
+	// wie im sqlStore ändern Zielbenutzer nur den Status, andere Felder ändert nur der Besitzer
+	if changedTask.Owner == name && t.task.Owner == name {
+		t.task.Title = changedTask.Title
+		t.task.Desc = changedTask.Desc
+		t.categoryID = s.users[name].defaultCategory
+		if cat, ok := s.categories[changedTask.Category.ID]; ok && cat.owner == name && cat.category.DeletedAt == nil {
+			t.categoryID = changedTask.Category.ID
+		}
+		t.task.IsDone = changedTask.IsDone
+	} else if changedTask.Owner != name && slices.Contains(t.task.Shared, name) {
+		t.task.IsDone = changedTask.IsDone
+	} else {
+		return false, errTaskNotFound
+	}
+	return len(t.task.Shared) > 0, nil
+}
+
+// GetTasksForUser liefert die eigenen und freigegebenen Aufgaben eines Benutzers in seiner Reihenfolge
+func (s *fakeStore) GetTasksForUser(name string) ([]task, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	loadedTasks := []task{}
+	for _, taskID := range s.order[name] {
+		if loaded, ok := s.taskForUser(name, taskID); ok {
+			loaded.Order = len(loadedTasks)
+			loadedTasks = append(loadedTasks, *loaded)
+		}
+	}
+	return loadedTasks, nil
+}
+
+// GetTaskForUser liefert eine Aufgabe so, wie sie der Benutzer sieht
+func (s *fakeStore) GetTaskForUser(name string, taskID int) (*task, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	loaded, ok := s.taskForUser(name, taskID)
+	if !ok {
+		return nil, errTaskNotFound
+	}
+	loaded.Order = slices.Index(s.order[name], taskID)
+	return loaded, nil
+}
+
+// taskForUser lädt eine Aufgabe so, wie sie für den Benutzer angezeigt wird; der Aufrufer hält s.mu
+func (s *fakeStore) taskForUser(name string, taskID int) (*task, bool) {
+	t, ok := s.tasks[taskID]
+	if !ok || t.deleted || (t.task.Owner != name && !slices.Contains(t.task.Shared, name)) {
+		return nil, false
+	}
+	loaded := t.task
+	loaded.Category = s.categories[t.categoryID].category
+	loaded.Shared = []string{}
+	if name == t.task.Owner {
+		loaded.Shared = slices.Clone(t.task.Shared)
+	}
+	return &loaded, true
+}
+
+// GetSharedUsersForTask liefert die Zielbenutzer einer Aufgabe
+func (s *fakeStore) GetSharedUsersForTask(taskID int) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	shared := []string{}
+	if t, ok := s.tasks[taskID]; ok {
+		shared = append(shared, t.task.Shared...)
+	}
+	return shared, nil
+}
+
+// AddCategory legt eine Kategorie an
+func (s *fakeStore) AddCategory(catName, colorHeader, colorBody, name string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextCategoryID++
+	s.categories[s.nextCategoryID] = &fakeCategory{
+		category: category{ID: s.nextCategoryID, Cat_name: catName, Color_header: colorHeader, Color_body: colorBody},
+		owner:    name,
+	}
+	return s.nextCategoryID, nil
+}
+
+// UpdateCategory ändert Name und Farben einer eigenen Kategorie
+func (s *fakeStore) UpdateCategory(name string, catID int, catName, colorHeader, colorBody string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if cat, ok := s.categories[catID]; ok && cat.owner == name {
+		cat.category.Cat_name = catName
+		cat.category.Color_header = colorHeader
+		cat.category.Color_body = colorBody
+	}
+	return nil
+}
+
+// DeleteCategory verschiebt eine Kategorie in den Papierkorb und ordnet ihre Aufgaben der Standardkategorie zu
+func (s *fakeStore) DeleteCategory(name string, catID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	user := s.users[name]
+	if user != nil && user.defaultCategory == catID {
+		return errDefaultCategory
+	}
+	cat, ok := s.categories[catID]
+	if !ok || cat.owner != name || cat.category.DeletedAt != nil {
+		return errCategoryNotFound
+	}
+	deletedAt := time.Now()
+	cat.category.DeletedAt = &deletedAt
+	for _, t := range s.tasks {
+		if t.categoryID == catID && t.task.Owner == name {
+			t.categoryID = user.defaultCategory
+		}
+	}
+	return nil
+}
+
+// GetCategoriesForUser liefert die Kategorien eines Benutzers außerhalb des Papierkorbs
+func (s *fakeStore) GetCategoriesForUser(name string) ([]category, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	loadedCategories := []category{}
+	for id := 1; id <= s.nextCategoryID; id++ {
+		cat, ok := s.categories[id]
+		if !ok || cat.owner != name || cat.category.DeletedAt != nil {
+			continue
+		}
+		loaded := cat.category
+		loaded.IsDefault = s.users[name].defaultCategory == id
+		loadedCategories = append(loadedCategories, loaded)
+	}
+	return loadedCategories, nil
+}
+
+// GetTaskIDsForCategory liefert die IDs aller Aufgaben einer Kategorie
+func (s *fakeStore) GetTaskIDsForCategory(catID int) ([]int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	taskIDs := []int{}
+	for id, t := range s.tasks {
+		if t.categoryID == catID {
+			taskIDs = append(taskIDs, id)
+		}
+	}
+	return taskIDs, nil
+}
+
+// ShareTask gibt eine eigene Aufgabe für einen Zielbenutzer frei und hängt sie an dessen Reihenfolge an
+func (s *fakeStore) ShareTask(name string, taskID int, target string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.tasks[taskID]
+	if !ok || t.deleted || t.task.Owner != name {
+		return errForbidden
+	}
+	if _, ok := s.users[target]; !ok {
+		return errUserNotFound
+	}
+	if slices.Contains(t.task.Shared, target) {
+		return errors.New("Task bereits für diesen Benutzer freigegeben")
+	}
+	t.task.Shared = append(t.task.Shared, target)
+	s.order[target] = append(s.order[target], taskID)
+	return nil
+}
+
+// RemoveSharingForUser beendet eine Freigabe; erlaubt ist das dem Besitzer und dem Zielbenutzer selbst
+func (s *fakeStore) RemoveSharingForUser(name string, taskID int, target string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.tasks[taskID]
+	if !ok {
+		return "", errTaskNotFound
+	}
+	if name != t.task.Owner && name != target {
+		return "", errForbidden
+	}
+	index := slices.Index(t.task.Shared, target)
+	if index < 0 {
+		return "", errTaskNotFound
+	}
+	t.task.Shared = slices.Delete(t.task.Shared, index, index+1)
+	s.order[target] = slices.DeleteFunc(s.order[target], func(id int) bool { return id == taskID })
+	return t.task.Owner, nil
+}
+
+// UpdateOrder tauscht zwei Aufgaben in der Reihenfolge eines Benutzers
+func (s *fakeStore) UpdateOrder(name string, taskIDUp, taskIDDown int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	up := slices.Index(s.order[name], taskIDUp)
+	down := slices.Index(s.order[name], taskIDDown)
+	if up < 0 || down < 0 {
+		return errTaskNotFound
+	}
+	s.order[name][up], s.order[name][down] = taskIDDown, taskIDUp
+	return nil
+}
+
+// die folgenden Methoden werden von den Handlern nebenbei aufgerufen; der fakeStore kennt weder Zwei-Faktor-Authentifizierung noch intelligente Listen
+
+// GetTOTP meldet, dass kein Benutzer die Zwei-Faktor-Authentifizierung eingerichtet hat
+func (s *fakeStore) GetTOTP(name string) (*totpState, error) {
+	return nil, errTOTPNotEnrolled
+}
+
+// GetSmartListsForUser liefert keine intelligenten Listen
+func (s *fakeStore) GetSmartListsForUser(name string) ([]smartList, error) {
+	return []smartList{}, nil
+}
+
+// GetSmartListsForTask liefert keine Mitgliedschaften in intelligenten Listen
+func (s *fakeStore) GetSmartListsForTask(taskID int) ([]smartListMembership, error) {
+	return nil, nil
+}
+
+// GetLoginBlock meldet keine Sperre, der fakeStore zählt Fehlversuche nur für die Tests
+func (s *fakeStore) GetLoginBlock(name, ip string) (time.Time, error) {
+	return time.Time{}, nil
+}
+
+// RecordLoginFailure zählt einen Fehlversuch für den Benutzer
+func (s *fakeStore) RecordLoginFailure(name, ip string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.loginFailures[name]++
+	return nil
+}
+
+// ClearLoginFailures setzt die Fehlversuche des Benutzers zurück
+func (s *fakeStore) ClearLoginFailures(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.loginFailures, name)
+	return nil
+}
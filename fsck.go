@@ -0,0 +1,349 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// fsckIssue beschreibt eine Verletzung der Konsistenzregeln für task_order oder sharing
+type fsckIssue struct {
+	Check    string `json:"check"`
+	UserName string `json:"user"`
+	View     string `json:"view,omitempty"`
+	TaskID   int    `json:"taskId"`
+}
+
+// fsckReport fasst das Ergebnis einer Konsistenzprüfung zusammen
+type fsckReport struct {
+	Issues   []fsckIssue `json:"issues"`
+	Repaired bool        `json:"repaired"`
+}
+
+// fsckCheck ist eine einzelne Konsistenzregel
+// detect liefert je Verletzung Benutzer, Ansicht und Aufgabe; repair behebt alle gefundenen Verletzungen innerhalb der Transaktion
+type fsckCheck struct {
+	name   string
+	detect string
+	repair func(tx *sqlTx, issues []fsckIssue) error
+}
+
+// fsckChecks enthält alle Konsistenzregeln in der Reihenfolge, in der sie geprüft und repariert werden
+// Freigaben werden zuerst bereinigt, da davon abhängt, welche Einträge in task_order gültig sind
+var fsckChecks = []fsckCheck{
+	{
+		name: "sharing_missing_user",
+		detect: `SELECT '#' || CAST(s.target_id AS TEXT), '', s.task_id FROM sharing s
+		LEFT JOIN users u ON u.id = s.target_id
+		WHERE u.id IS NULL`,
+		repair: deleteOrphanedSharing,
+	},
+	{
+		name: "sharing_missing_task",
+		detect: `SELECT u.name, '', s.task_id FROM sharing s
+		INNER JOIN users u ON u.id = s.target_id
+		WHERE NOT EXISTS(SELECT 1 FROM tasks t WHERE t.id = s.task_id)`,
+		repair: deleteSharingIssues,
+	},
+	{
+		name: "sharing_with_owner",
+		detect: `SELECT u.name, '', s.task_id FROM sharing s
+		INNER JOIN users u ON u.id = s.target_id
+		INNER JOIN tasks t ON t.id = s.task_id WHERE t.user_id = s.target_id`,
+		repair: deleteSharingIssues,
+	},
+	{
+		name: "order_missing_task",
+		detect: `SELECT u.name, o.view_key, o.task_id FROM task_order o
+		INNER JOIN users u ON u.id = o.user_id
+		WHERE NOT EXISTS(SELECT 1 FROM tasks t WHERE t.id = o.task_id)`,
+		repair: deleteOrderIssues,
+	},
+	{
+		name: "order_without_access",
+		detect: `SELECT u.name, o.view_key, o.task_id FROM task_order o
+		INNER JOIN users u ON u.id = o.user_id
+		INNER JOIN tasks t ON t.id = o.task_id
+		WHERE t.user_id != o.user_id
+		AND NOT EXISTS(SELECT 1 FROM sharing s WHERE s.task_id = o.task_id AND s.target_id = o.user_id)`,
+		repair: deleteOrderIssues,
+	},
+	{
+		name: "order_stale_view",
+		detect: `SELECT u.name, o.view_key, o.task_id FROM task_order o
+		INNER JOIN users u ON u.id = o.user_id
+		WHERE o.view_key != ''
+		AND NOT EXISTS(SELECT 1 FROM categories c WHERE 'category:' || c.id = o.view_key AND c.user_id = o.user_id)
+		AND NOT EXISTS(SELECT 1 FROM smart_lists l WHERE 'smartlist:' || l.id = o.view_key AND l.user_id = o.user_id)`,
+		repair: deleteOrderIssues,
+	},
+	{
+		name: "order_invalid_rank",
+		detect: `SELECT u.name, o.view_key, o.task_id FROM task_order o
+		INNER JOIN users u ON u.id = o.user_id
+		WHERE COALESCE(o.rank_key, '') = '' OR RTRIM(o.rank_key, '0123456789abcdefghijklmnopqrstuvwxyz') != '' OR o.rank_key LIKE '%0'`,
+		repair: rebalanceOrderIssues,
+	},
+	{
+		name: "order_duplicate_rank",
+		detect: `SELECT u.name, o.view_key, o.task_id FROM task_order o
+		INNER JOIN users u ON u.id = o.user_id
+		WHERE EXISTS(SELECT 1 FROM task_order d WHERE d.user_id = o.user_id AND d.view_key = o.view_key
+			AND d.rank_key = o.rank_key AND d.task_id != o.task_id)`,
+		repair: rebalanceOrderIssues,
+	},
+	{
+		name: "order_missing",
+		detect: `SELECT u.name, '', a.task_id FROM (
+			SELECT user_id, id AS task_id FROM tasks
+			UNION SELECT target_id, task_id FROM sharing
+		) a
+		INNER JOIN users u ON u.id = a.user_id
+		WHERE NOT EXISTS(SELECT 1 FROM task_order o WHERE o.user_id = a.user_id AND o.view_key = '' AND o.task_id = a.task_id)`,
+		repair: insertOrderIssues,
+	},
+}
+
+// deleteSharingIssues entfernt die Freigaben der gefundenen Verletzungen
+//
+// Parameter:
+//   - tx: Die laufende Transaktion
+//   - issues: Die gefundenen Verletzungen
+//
+// Rückgabewert:
+//   - error: Ein Fehler, falls bei der Transaktion ein Fehler auftritt; "nil", falls nicht
+func deleteSharingIssues(tx *sqlTx, issues []fsckIssue) error {
+	for _, issue := range issues {
+		_, err := tx.Exec(`DELETE FROM sharing WHERE target_id = `+userIDSQL+` AND task_id = ?`, issue.UserName, issue.TaskID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteOrphanedSharing entfernt die Freigaben der gefundenen Aufgaben, deren Zielbenutzer nicht existiert
+// der Benutzer lässt sich nicht über seinen Namen ermitteln, daher wird die Freigabe über die fehlende ID gefunden
+//
+// Parameter:
+//   - tx: Die laufende Transaktion
+//   - issues: Die gefundenen Verletzungen
+//
+// Rückgabewert:
+//   - error: Ein Fehler, falls bei der Transaktion ein Fehler auftritt; "nil", falls nicht
+func deleteOrphanedSharing(tx *sqlTx, issues []fsckIssue) error {
+	for _, issue := range issues {
+		_, err := tx.Exec(`DELETE FROM sharing WHERE task_id = ? AND NOT EXISTS(SELECT 1 FROM users u WHERE u.id = sharing.target_id)`, issue.TaskID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteOrderIssues entfernt die Einträge in task_order der gefundenen Verletzungen
+//
+// Parameter:
+//   - tx: Die laufende Transaktion
+//   - issues: Die gefundenen Verletzungen
+//
+// Rückgabewert:
+//   - error: Ein Fehler, falls bei der Transaktion ein Fehler auftritt; "nil", falls nicht
+func deleteOrderIssues(tx *sqlTx, issues []fsckIssue) error {
+	for _, issue := range issues {
+		_, err := tx.Exec(`DELETE FROM task_order WHERE user_id = `+userIDSQL+` AND view_key = ? AND task_id = ?`, issue.UserName, issue.View, issue.TaskID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rebalanceOrderIssues verteilt die Rangschlüssel aller Ansichten neu, in denen Verletzungen gefunden wurden
+//
+// Parameter:
+//   - tx: Die laufende Transaktion
+//   - issues: Die gefundenen Verletzungen
+//
+// Rückgabewert:
+//   - error: Ein Fehler, falls bei der Transaktion ein Fehler auftritt; "nil", falls nicht
+func rebalanceOrderIssues(tx *sqlTx, issues []fsckIssue) error {
+	done := make(map[[2]string]bool)
+	for _, issue := range issues {
+		key := [2]string{issue.UserName, issue.View}
+		if done[key] {
+			continue
+		}
+		done[key] = true
+		err := rebalanceViewRanks(tx, issue.UserName, issue.View)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// insertOrderIssues legt für Aufgaben ohne Position in der Gesamtliste einen Rangschlüssel am Ende der Liste an
+//
+// Parameter:
+//   - tx: Die laufende Transaktion
+//   - issues: Die gefundenen Verletzungen
+//
+// Rückgabewert:
+//   - error: Ein Fehler, falls bei der Transaktion ein Fehler auftritt; "nil", falls nicht
+func insertOrderIssues(tx *sqlTx, issues []fsckIssue) error {
+	for _, issue := range issues {
+		lastRank, err := lastRankForUser(tx, issue.UserName)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(`INSERT INTO task_order (user_id, view_key, task_id, rank_key) VALUES (`+userIDSQL+`,'',?,?)`,
+			issue.UserName, issue.TaskID, rankBetween(lastRank, ""))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Fsck prüft alle Konsistenzregeln in einer einzigen Transaktion und behebt die Verletzungen auf Wunsch
+// ohne Reparatur wird die Transaktion zurückgerollt, die Datenbank bleibt also unverändert
+//
+// Parameter:
+//   - repair: "true", falls die gefundenen Verletzungen behoben werden sollen
+//
+// Rückgabewert:
+//   - report: Die gefundenen Verletzungen und ob sie behoben wurden
+//   - error: Ein Fehler, falls bei der Transaktion ein Fehler auftritt; "nil", falls nicht
+func (s *sqlStore) Fsck(repair bool) (*fsckReport, error) {
+	report := &fsckReport{Issues: make([]fsckIssue, 0)}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, check := range fsckChecks {
+		issues, err := detectFsckIssues(tx, check)
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		report.Issues = append(report.Issues, issues...)
+		if !repair || len(issues) == 0 {
+			continue
+		}
+		err = check.repair(tx, issues)
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+
+	if !repair {
+		tx.Rollback()
+		return report, nil
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	report.Repaired = true
+	return report, nil
+}
+
+// detectFsckIssues führt die Abfrage einer Konsistenzregel aus
+//
+// Parameter:
+//   - tx: Die laufende Transaktion
+//   - check: Die zu prüfende Regel
+//
+// Rückgabewert:
+//   - issues: Die gefundenen Verletzungen
+//   - error: Ein Fehler, falls bei der Abfrage ein Fehler auftritt; "nil", falls nicht
+func detectFsckIssues(tx *sqlTx, check fsckCheck) ([]fsckIssue, error) {
+	rows, err := tx.Query(check.detect)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	issues := make([]fsckIssue, 0)
+	for rows.Next() {
+		issue := fsckIssue{Check: check.name}
+		err = rows.Scan(&issue.UserName, &issue.View, &issue.TaskID)
+		if err != nil {
+			return nil, err
+		}
+		issues = append(issues, issue)
+	}
+	return issues, rows.Err()
+}
+
+// runFsckCommand führt die Konsistenzprüfung als Unterbefehl "go-todo fsck [-repair]" aus und gibt das Ergebnis auf der Konsole aus
+//
+// Parameter:
+//   - store: Der zu prüfende Speicher
+//   - args: Die Argumente nach dem Unterbefehl
+//
+// Rückgabewert:
+//   - int: Der Exit-Code; 0, falls keine Verletzungen bestehen bzw. alle behoben wurden, 1 bei Verletzungen und 2 bei Fehlern
+func runFsckCommand(store Store, args []string) int {
+	flags := flag.NewFlagSet("fsck", flag.ContinueOnError)
+	repair := flags.Bool("repair", false, "gefundene Verletzungen in einer Transaktion beheben")
+	err := flags.Parse(args)
+	if err != nil {
+		return 2
+	}
+
+	report, err := store.Fsck(*repair)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Konsistenzprüfung fehlgeschlagen:", err)
+		return 2
+	}
+
+	for _, issue := range report.Issues {
+		if issue.View != "" {
+			fmt.Printf("%s: Benutzer %q, Ansicht %q, Aufgabe %d\n", issue.Check, issue.UserName, issue.View, issue.TaskID)
+		} else {
+			fmt.Printf("%s: Benutzer %q, Aufgabe %d\n", issue.Check, issue.UserName, issue.TaskID)
+		}
+	}
+	switch {
+	case len(report.Issues) == 0:
+		fmt.Println("Keine Verletzungen gefunden")
+	case report.Repaired:
+		fmt.Printf("%d Verletzungen behoben\n", len(report.Issues))
+	default:
+		fmt.Printf("%d Verletzungen gefunden, mit -repair beheben\n", len(report.Issues))
+		return 1
+	}
+	return 0
+}
+
+// HandleFsck führt die Konsistenzprüfung für einen Administrator aus
+// bei GET werden die Verletzungen nur gemeldet, bei POST werden sie zusätzlich behoben
+//
+// Parameter:
+//   - c: Ein Pointer auf ein Context-Objekt von fiber
+//
+// Rückgabewert:
+//   - error: Ein Fehler, falls bei der Prüfung ein Fehler auftritt - wird an Client gesendet
+//     Bei Erfolg wird das Ergebnis der Prüfung an den Client gesendet
+func (srv *server) HandleFsck(c *fiber.Ctx) error {
+	name := c.Locals("name").(string)
+
+	if !srv.isAdmin(name) {
+		return c.Status(403).JSON(fiber.Map{"error": errForbidden.Error()})
+	}
+	report, err := srv.store.Fsck(c.Method() == fiber.MethodPost)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(400).JSON(fiber.Map{"error": "Konsistenzprüfung fehlgeschlagen"})
+	}
+	return c.Status(200).JSON(report)
+}
@@ -0,0 +1,848 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+var (
+	errUnknownImportFormat = errors.New("Unbekanntes Format, erlaubt sind json, csv, todotxt, todoist und trello")
+	errEmptyImport         = errors.New("Keine Datei übermittelt")
+)
+
+// importTask ist eine Aufgabe, wie sie aus einer Importdatei gelesen wurde
+// key identifiziert die Aufgabe innerhalb der Datei, damit die Reihenfolge der Ansichten übernommen werden kann; "", falls nicht benötigt
+// eine leere Kategorie steht für die Standardkategorie des importierenden Benutzers
+type importTask struct {
+	Key       string
+	Title     string
+	Desc      string
+	IsDone    bool
+	Category  string
+	Archived  bool
+	Shared    []string
+	Priority  string
+	Tags      []string
+	CreatedAt *time.Time
+	DoneAt    *time.Time
+	DueAt     *time.Time
+}
+
+// importCategory ist eine Kategorie aus einer Importdatei, leere Farben werden durch die Farben der Standardkategorie ersetzt
+type importCategory struct {
+	Name        string
+	ColorHeader string
+	ColorBody   string
+}
+
+// importData enthält den Inhalt einer Importdatei unabhängig von ihrem Format
+// die Aufgaben stehen in der Reihenfolge der Gesamtliste, categoryOrder und smartListOrder enthalten je Name die Schlüssel der Aufgaben
+type importData struct {
+	Categories     []importCategory
+	Tasks          []importTask
+	SmartLists     []smartList
+	CategoryOrder  map[string][]string
+	SmartListOrder map[string][]string
+}
+
+// importReport fasst zusammen, was ein Import angelegt hat bzw. bei einem Probelauf anlegen würde
+type importReport struct {
+	DryRun     bool     `json:"dryRun"`
+	Tasks      int      `json:"tasks"`
+	Categories []string `json:"categories"`
+	SmartLists []string `json:"smartLists"`
+	Shares     int      `json:"shares"`
+	Duplicates []string `json:"duplicates"`
+	Skipped    []string `json:"skipped"`
+	TaskIDs    []int    `json:"-"`
+	SharedIDs  []int    `json:"-"`
+}
+
+// csvMapping legt fest, aus welchen Spalten einer CSV-Datei die Felder einer Aufgabe gelesen werden
+// die Namen werden ohne Beachtung der Groß- und Kleinschreibung mit der Kopfzeile verglichen, title ist als einzige Spalte Pflicht
+type csvMapping struct {
+	Title     string
+	Desc      string
+	Done      string
+	Category  string
+	Archived  string
+	Delimiter rune
+}
+
+// importBool wertet einen Wahrheitswert aus einer Importdatei aus, z.B. "true", "1", "x" oder "ja"
+//
+// Parameter:
+//   - value: Der gelesene Wert
+//
+// Rückgabewert:
+//   - bool: "true", falls der Wert als wahr gilt
+func importBool(value string) bool {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "true", "1", "x", "yes", "y", "ja", "j", "done", "erledigt":
+		return true
+	}
+	return false
+}
+
+// importArchived wertet die Spalte für die Archivierung aus, die entweder einen Wahrheitswert oder wie im CSV-Export den Zeitpunkt der Archivierung enthält
+//
+// Parameter:
+//   - value: Der gelesene Wert
+//
+// Rückgabewert:
+//   - bool: "true", falls die Aufgabe archiviert werden soll
+func importArchived(value string) bool {
+	_, err := time.Parse(time.RFC3339, strings.TrimSpace(value))
+	return err == nil || importBool(value)
+}
+
+// parseImport liest eine Importdatei im angegebenen Format
+// ohne Angabe eines Formats wird bei JSON-Dateien anhand des Inhalts zwischen eigenem Export, Todoist und Trello unterschieden
+//
+// Parameter:
+//   - format: Das Format der Datei; "", falls es erkannt werden soll
+//   - body: Der Inhalt der Datei
+//   - mapping: Die Zuordnung der Spalten für CSV-Dateien
+//
+// Rückgabewert:
+//   - data: Ein Pointer auf den gelesenen Inhalt; "nil", falls ein Fehler auftritt
+//   - error: errUnknownImportFormat bzw. ein Fehler, falls die Datei nicht gelesen werden konnte; "nil", falls nicht
+func parseImport(format string, body []byte, mapping csvMapping) (*importData, error) {
+	if format == "" && len(bytes.TrimSpace(body)) > 0 && bytes.TrimSpace(body)[0] == '{' {
+		format = detectJSONImport(body)
+	}
+	switch format {
+	case "json":
+		return parseExportImport(body)
+	case "csv":
+		return parseCSVImport(body, mapping)
+	case "todotxt":
+		return parseTodoTxtImport(body)
+	case "todoist":
+		return parseTodoistImport(body)
+	case "trello":
+		return parseTrelloImport(body)
+	}
+	return nil, errUnknownImportFormat
+}
+
+// detectJSONImport erkennt anhand der vorhandenen Felder, aus welcher Anwendung eine JSON-Datei stammt
+//
+// Parameter:
+//   - body: Der Inhalt der Datei
+//
+// Rückgabewert:
+//   - string: json, todoist oder trello; "", falls das Format nicht erkannt wurde
+func detectJSONImport(body []byte) string {
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(body, &fields) != nil {
+		return ""
+	}
+	_, hasVersion := fields["version"]
+	_, hasCards := fields["cards"]
+	_, hasItems := fields["items"]
+	_, hasProjects := fields["projects"]
+	switch {
+	case hasVersion:
+		return "json"
+	case hasCards:
+		return "trello"
+	case hasItems || hasProjects:
+		return "todoist"
+	}
+	return ""
+}
+
+// parseExportImport liest einen JSON-Export dieser Anwendung, siehe userExport
+// die Standardkategorie des Exports wird der Standardkategorie des importierenden Benutzers zugeordnet
+//
+// Parameter:
+//   - body: Der Inhalt der Datei
+//
+// Rückgabewert:
+//   - data: Ein Pointer auf den gelesenen Inhalt; "nil", falls ein Fehler auftritt
+//   - error: Ein Fehler, falls die Datei ungültig ist oder eine nicht unterstützte Version hat; "nil", falls nicht
+func parseExportImport(body []byte) (*importData, error) {
+	var export userExport
+	err := json.Unmarshal(body, &export)
+	if err != nil {
+		return nil, fmt.Errorf("Ungültiger Export: %w", err)
+	}
+	if export.Version < 1 || export.Version > exportVersion {
+		return nil, fmt.Errorf("Nicht unterstützte Exportversion %d", export.Version)
+	}
+
+	data := &importData{CategoryOrder: map[string][]string{}, SmartListOrder: map[string][]string{}, SmartLists: export.SmartLists}
+	categoryNames := make(map[int]string)
+	for _, cat := range export.Categories {
+		if cat.IsDefault {
+			continue
+		}
+		categoryNames[cat.ID] = cat.Cat_name
+		data.Categories = append(data.Categories, importCategory{Name: cat.Cat_name, ColorHeader: cat.Color_header, ColorBody: cat.Color_body})
+	}
+
+	positions := exportPositions(&export)
+	tasks := append([]exportTask(nil), export.Tasks...)
+	sort.SliceStable(tasks, func(i, j int) bool {
+		return positions[tasks[i].ID] < positions[tasks[j].ID]
+	})
+	for _, t := range tasks {
+		data.Tasks = append(data.Tasks, importTask{Key: strconv.Itoa(t.ID), Title: t.Title, Desc: t.Desc, IsDone: t.IsDone,
+			Category: categoryNames[t.Category], Archived: t.ArchivedAt != nil, Shared: t.Shared})
+	}
+
+	keys := func(taskIDs []int) []string {
+		result := make([]string, 0, len(taskIDs))
+		for _, taskID := range taskIDs {
+			result = append(result, strconv.Itoa(taskID))
+		}
+		return result
+	}
+	for catID, catName := range categoryNames {
+		data.CategoryOrder[catName] = keys(export.Order[categoryView(catID)])
+	}
+	for _, list := range export.SmartLists {
+		data.SmartListOrder[list.List_name] = keys(export.Order[smartListView(list.ID)])
+	}
+	return data, nil
+}
+
+// parseCSVImport liest eine CSV-Datei mit Kopfzeile und einer Aufgabe je Zeile
+//
+// Parameter:
+//   - body: Der Inhalt der Datei
+//   - mapping: Die Zuordnung der Spalten
+//
+// Rückgabewert:
+//   - data: Ein Pointer auf den gelesenen Inhalt; "nil", falls ein Fehler auftritt
+//   - error: Ein Fehler, falls die Datei ungültig ist oder die Spalte für den Titel fehlt; "nil", falls nicht
+func parseCSVImport(body []byte, mapping csvMapping) (*importData, error) {
+	r := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(body, []byte("\ufeff"))))
+	if mapping.Delimiter != 0 {
+		r.Comma = mapping.Delimiter
+	}
+	r.FieldsPerRecord = -1
+
+	header, err := r.Read()
+	if err != nil {
+		return nil, fmt.Errorf("Ungültige CSV-Datei: %w", err)
+	}
+	columns := make(map[string]int)
+	for i, column := range header {
+		columns[strings.ToLower(strings.TrimSpace(column))] = i
+	}
+	column := func(name string) int {
+		if i, ok := columns[strings.ToLower(name)]; ok && name != "" {
+			return i
+		}
+		return -1
+	}
+	titleColumn, descColumn, doneColumn := column(mapping.Title), column(mapping.Desc), column(mapping.Done)
+	categoryColumn, archivedColumn := column(mapping.Category), column(mapping.Archived)
+	if titleColumn < 0 {
+		return nil, fmt.Errorf("Die CSV-Datei enthält keine Spalte %q für den Titel", mapping.Title)
+	}
+
+	data := &importData{}
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Ungültige CSV-Datei: %w", err)
+		}
+		value := func(i int) string {
+			if i < 0 || i >= len(record) {
+				return ""
+			}
+			return strings.TrimSpace(record[i])
+		}
+		data.Tasks = append(data.Tasks, importTask{Title: value(titleColumn), Desc: value(descColumn), IsDone: importBool(value(doneColumn)),
+			Category: value(categoryColumn), Archived: importArchived(value(archivedColumn))})
+	}
+	return data, nil
+}
+
+// parseTodoTxtImport liest eine Datei im Format todo.txt mit einer Aufgabe je Zeile, siehe parseTodoTxtLine
+// die Erweiterung id: wird ignoriert, sodass alle Zeilen als neue Aufgaben angelegt werden
+//
+// Parameter:
+//   - body: Der Inhalt der Datei
+//
+// Rückgabewert:
+//   - data: Ein Pointer auf den gelesenen Inhalt
+//   - error: Immer "nil", da jede Zeile als Aufgabe gelesen werden kann
+func parseTodoTxtImport(body []byte) (*importData, error) {
+	data := &importData{}
+	for _, line := range strings.Split(string(body), "\n") {
+		t, ok := parseTodoTxtLine(line)
+		if !ok {
+			continue
+		}
+		data.Tasks = append(data.Tasks, importTask{Title: t.Title, IsDone: t.IsDone, Category: t.Category, Priority: t.Priority,
+			Tags: t.Tags, CreatedAt: t.CreatedAt, DoneAt: t.DoneAt, DueAt: t.DueAt})
+	}
+	return data, nil
+}
+
+// flexibleID ist eine ID, die je nach Version der Quelle als Zahl oder als Zeichenkette exportiert wird
+type flexibleID string
+
+// UnmarshalJSON liest eine ID als Zahl oder Zeichenkette
+//
+// Parameter:
+//   - b: Der JSON-Wert
+//
+// Rückgabewert:
+//   - error: Ein Fehler, falls der Wert weder Zahl noch Zeichenkette ist; "nil", falls nicht
+func (id *flexibleID) UnmarshalJSON(b []byte) error {
+	var s string
+	if json.Unmarshal(b, &s) == nil {
+		*id = flexibleID(s)
+		return nil
+	}
+	var n json.Number
+	err := json.Unmarshal(b, &n)
+	if err != nil {
+		return err
+	}
+	*id = flexibleID(n.String())
+	return nil
+}
+
+// parseTodoistImport liest einen JSON-Export von Todoist (Sync- bzw. REST-API), Projekte werden zu Kategorien
+//
+// Parameter:
+//   - body: Der Inhalt der Datei
+//
+// Rückgabewert:
+//   - data: Ein Pointer auf den gelesenen Inhalt; "nil", falls ein Fehler auftritt
+//   - error: Ein Fehler, falls die Datei ungültig ist; "nil", falls nicht
+func parseTodoistImport(body []byte) (*importData, error) {
+	type todoistItem struct {
+		Content     string     `json:"content"`
+		Description string     `json:"description"`
+		ProjectID   flexibleID `json:"project_id"`
+		Checked     bool       `json:"checked"`
+		IsCompleted bool       `json:"is_completed"`
+		IsDeleted   bool       `json:"is_deleted"`
+		ChildOrder  int        `json:"child_order"`
+		Order       int        `json:"order"`
+	}
+	var export struct {
+		Projects []struct {
+			ID         flexibleID `json:"id"`
+			Name       string     `json:"name"`
+			IsArchived bool       `json:"is_archived"`
+		} `json:"projects"`
+		Items []todoistItem `json:"items"`
+		Tasks []todoistItem `json:"tasks"`
+	}
+	err := json.Unmarshal(body, &export)
+	if err != nil {
+		return nil, fmt.Errorf("Ungültiger Todoist-Export: %w", err)
+	}
+
+	data := &importData{}
+	projects := make(map[flexibleID]int)
+	for i, project := range export.Projects {
+		projects[project.ID] = i
+		data.Categories = append(data.Categories, importCategory{Name: project.Name})
+	}
+	items := append(export.Items, export.Tasks...)
+	sort.SliceStable(items, func(i, j int) bool {
+		pi, pj := projects[items[i].ProjectID], projects[items[j].ProjectID]
+		if pi != pj {
+			return pi < pj
+		}
+		return items[i].ChildOrder+items[i].Order < items[j].ChildOrder+items[j].Order
+	})
+	for _, item := range items {
+		if item.IsDeleted {
+			continue
+		}
+		t := importTask{Title: item.Content, Desc: item.Description, IsDone: item.Checked || item.IsCompleted}
+		if i, ok := projects[item.ProjectID]; ok {
+			t.Category = export.Projects[i].Name
+			t.Archived = export.Projects[i].IsArchived
+		}
+		data.Tasks = append(data.Tasks, t)
+	}
+	return data, nil
+}
+
+// parseTrelloImport liest den JSON-Export eines Trello-Boards, Listen werden zu Kategorien und Karten zu Aufgaben
+// geschlossene Karten und Karten in geschlossenen Listen werden archiviert, Karten mit erledigtem Fälligkeitsdatum gelten als erledigt
+//
+// Parameter:
+//   - body: Der Inhalt der Datei
+//
+// Rückgabewert:
+//   - data: Ein Pointer auf den gelesenen Inhalt; "nil", falls ein Fehler auftritt
+//   - error: Ein Fehler, falls die Datei ungültig ist; "nil", falls nicht
+func parseTrelloImport(body []byte) (*importData, error) {
+	var board struct {
+		Lists []struct {
+			ID     string  `json:"id"`
+			Name   string  `json:"name"`
+			Closed bool    `json:"closed"`
+			Pos    float64 `json:"pos"`
+		} `json:"lists"`
+		Cards []struct {
+			Name        string  `json:"name"`
+			Desc        string  `json:"desc"`
+			IDList      string  `json:"idList"`
+			Closed      bool    `json:"closed"`
+			DueComplete bool    `json:"dueComplete"`
+			Pos         float64 `json:"pos"`
+		} `json:"cards"`
+	}
+	err := json.Unmarshal(body, &board)
+	if err != nil {
+		return nil, fmt.Errorf("Ungültiger Trello-Export: %w", err)
+	}
+
+	sort.SliceStable(board.Lists, func(i, j int) bool { return board.Lists[i].Pos < board.Lists[j].Pos })
+	data := &importData{}
+	lists := make(map[string]int)
+	for i, list := range board.Lists {
+		lists[list.ID] = i
+		data.Categories = append(data.Categories, importCategory{Name: list.Name})
+	}
+	cards := board.Cards
+	sort.SliceStable(cards, func(i, j int) bool {
+		li, lj := lists[cards[i].IDList], lists[cards[j].IDList]
+		if li != lj {
+			return li < lj
+		}
+		return cards[i].Pos < cards[j].Pos
+	})
+	for _, card := range cards {
+		t := importTask{Title: card.Name, Desc: card.Desc, IsDone: card.DueComplete, Archived: card.Closed}
+		if i, ok := lists[card.IDList]; ok {
+			t.Category = board.Lists[i].Name
+			t.Archived = t.Archived || board.Lists[i].Closed
+		}
+		data.Tasks = append(data.Tasks, t)
+	}
+	return data, nil
+}
+
+// ImportData legt den Inhalt einer Importdatei für einen Benutzer in einer einzigen Transaktion an
+// Kategorien werden anhand ihres Namens zugeordnet und bei Bedarf angelegt; Aufgaben, die mit gleichem Titel bereits in derselben Kategorie existieren, werden als Duplikat übersprungen
+// Freigaben werden nur für vorhandene Benutzer übernommen, die Reihenfolge von Ansichten nur für neu angelegte Kategorien und Listen
+// bei einem Probelauf wird die Transaktion am Ende zurückgerollt, sodass der Bericht genau dem späteren Import entspricht
+// für neue Kategorien, Aufgaben und Freigaben werden wie bei einzelnen Änderungen Webhook-Zustellungen angelegt
+//
+// Parameter:
+//   - name: Der Name des importierenden Benutzers
+//   - data: Der gelesene Inhalt der Importdatei
+//   - dryRun: "true", falls nichts gespeichert werden soll
+//
+// Rückgabewert:
+//   - report: Ein Pointer auf die Zusammenfassung des Imports; "nil", falls ein Fehler auftritt
+//   - error: Ein Fehler, falls bei der Transaktion ein Fehler auftritt; "nil", falls nicht
+func (s *sqlStore) ImportData(name string, data *importData, dryRun bool) (*importReport, error) {
+	taskQuery := `SELECT title, category_id FROM tasks WHERE user_id = ` + userIDSQL + ` AND deleted_at IS NULL`
+	listQuery := `SELECT list_name FROM smart_lists WHERE user_id = ` + userIDSQL
+	insertCategory := `INSERT INTO categories (cat_name, color_header, color_body, user_id) VALUES (?,?,?,` + userIDSQL + `) RETURNING id`
+	insertTask := `INSERT INTO tasks (title, "desc", isDone, category_id, user_id, done_at, archived_at, priority, created_at, due_at)
+	VALUES (?,?,?,?,` + userIDSQL + `,?,?,?,?,?) RETURNING id`
+	insertOrder := `INSERT INTO task_order (user_id, task_id, rank_key) VALUES (` + userIDSQL + `,?,?)`
+	insertShare := `INSERT INTO sharing (task_id, target_id) VALUES (?,` + userIDSQL + `)`
+	insertList := `INSERT INTO smart_lists (list_name, query, color_header, color_body, user_id) VALUES (?,?,?,?,` + userIDSQL + `) RETURNING id`
+	report := &importReport{DryRun: dryRun, Categories: []string{}, SmartLists: []string{}, Duplicates: []string{}, Skipped: []string{}, TaskIDs: []int{}, SharedIDs: []int{}}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	categoryIDs, defaultID, err := categoryIDsForUser(tx, name)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	existingTasks := make(map[string]bool)
+	taskKey := func(title string, catID int) string {
+		return strings.ToLower(strings.TrimSpace(title)) + "\x00" + strconv.Itoa(catID)
+	}
+	rows, err := tx.Query(taskQuery, name)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	for rows.Next() {
+		var title string
+		var catID int
+		err = rows.Scan(&title, &catID)
+		if err != nil {
+			rows.Close()
+			tx.Rollback()
+			return nil, err
+		}
+		existingTasks[taskKey(title, catID)] = true
+	}
+	rows.Close()
+
+	newCategories := make(map[int]bool)
+	ensureCategory := func(cat importCategory) (int, error) {
+		catName := strings.TrimSpace(cat.Name)
+		if catName == "" {
+			return defaultID, nil
+		}
+		if catID, ok := categoryIDs[strings.ToLower(catName)]; ok {
+			return catID, nil
+		}
+		colorHeader, colorBody := cat.ColorHeader, cat.ColorBody
+		if colorHeader == "" || colorBody == "" {
+			colorHeader, colorBody = "#00a4ba", "#00ceea"
+		}
+		var catID int
+		err := tx.QueryRow(insertCategory, catName, colorHeader, colorBody, name).Scan(&catID)
+		if err != nil {
+			return 0, err
+		}
+		err = insertWebhookDeliveries(tx, webhookEvent{Type: webhookCategoryChanged, Actor: name, CategoryID: catID, Action: "created"})
+		if err != nil {
+			return 0, err
+		}
+		categoryIDs[strings.ToLower(catName)] = catID
+		newCategories[catID] = true
+		report.Categories = append(report.Categories, catName)
+		return catID, nil
+	}
+	for _, cat := range data.Categories {
+		_, err = ensureCategory(cat)
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+
+	rankKey, err := lastRankForUser(tx, name)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	now := time.Now().Unix()
+	taskIDs := make(map[string]int)
+	for _, t := range data.Tasks {
+		title := strings.TrimSpace(t.Title)
+		if title == "" {
+			report.Skipped = append(report.Skipped, "Aufgabe ohne Titel")
+			continue
+		}
+		catID, err := ensureCategory(importCategory{Name: t.Category})
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		if existingTasks[taskKey(title, catID)] {
+			report.Duplicates = append(report.Duplicates, title)
+			continue
+		}
+		existingTasks[taskKey(title, catID)] = true
+
+		var doneAt, archivedAt interface{}
+		if t.IsDone {
+			doneAt = now
+			if t.DoneAt != nil {
+				doneAt = t.DoneAt.Unix()
+			}
+		}
+		if t.Archived {
+			archivedAt = now
+		}
+		createdAt := now
+		if t.CreatedAt != nil {
+			createdAt = t.CreatedAt.Unix()
+		}
+		var taskID int
+		err = tx.QueryRow(insertTask, title, t.Desc, t.IsDone, catID, name, doneAt, archivedAt, t.Priority, createdAt, unixSeconds(t.DueAt)).Scan(&taskID)
+		if err == nil {
+			rankKey = rankBetween(rankKey, "")
+			_, err = tx.Exec(insertOrder, name, taskID, rankKey)
+		}
+		if err == nil {
+			err = setTaskTags(tx, taskID, t.Tags)
+		}
+		if err == nil {
+			err = insertWebhookDeliveries(tx, webhookEvent{Type: webhookTaskCreated, Actor: name, TaskID: taskID})
+		}
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		if t.Key != "" {
+			taskIDs[t.Key] = taskID
+		}
+		report.TaskIDs = append(report.TaskIDs, taskID)
+
+		shared := false
+		for _, target := range t.Shared {
+			var exists bool
+			err = tx.QueryRow(`SELECT EXISTS(SELECT 1 FROM users WHERE name = ?)`, target).Scan(&exists)
+			if err != nil {
+				tx.Rollback()
+				return nil, err
+			}
+			if !exists || target == name {
+				report.Skipped = append(report.Skipped, fmt.Sprintf("Freigabe von %q für unbekannten Benutzer %q", title, target))
+				continue
+			}
+			_, err = tx.Exec(insertShare, taskID, target)
+			if err == nil {
+				var targetRank string
+				targetRank, err = lastRankForUser(tx, target)
+				if err == nil {
+					_, err = tx.Exec(insertOrder, target, taskID, rankBetween(targetRank, ""))
+				}
+			}
+			if err == nil {
+				err = insertWebhookDeliveries(tx, webhookEvent{Type: webhookTaskShared, Actor: name, TaskID: taskID, Target: target})
+			}
+			if err != nil {
+				tx.Rollback()
+				return nil, err
+			}
+			report.Shares++
+			shared = true
+		}
+		if shared && !t.Archived {
+			report.SharedIDs = append(report.SharedIDs, taskID)
+		}
+	}
+	report.Tasks = len(report.TaskIDs)
+
+	viewTaskIDs := func(keys []string) []int {
+		result := make([]int, 0, len(keys))
+		for _, key := range keys {
+			if taskID, ok := taskIDs[key]; ok {
+				result = append(result, taskID)
+			}
+		}
+		return result
+	}
+	for catName, keys := range data.CategoryOrder {
+		catID, ok := categoryIDs[strings.ToLower(strings.TrimSpace(catName))]
+		if !ok || !newCategories[catID] || len(keys) == 0 {
+			continue
+		}
+		err = materializeViewRanks(tx, name, categoryView(catID), viewTaskIDs(keys))
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+
+	listNames := make(map[string]bool)
+	existingLists, err := queryTxStrings(tx, listQuery, name)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	for _, listName := range existingLists {
+		listNames[strings.ToLower(listName)] = true
+	}
+	newLists := make([]smartList, 0)
+	for _, list := range data.SmartLists {
+		if strings.TrimSpace(list.List_name) == "" || strings.TrimSpace(list.Query) == "" {
+			report.Skipped = append(report.Skipped, "Intelligente Liste ohne Namen oder Suchanfrage")
+			continue
+		}
+		if listNames[strings.ToLower(list.List_name)] {
+			report.Duplicates = append(report.Duplicates, list.List_name)
+			continue
+		}
+		listNames[strings.ToLower(list.List_name)] = true
+		err = tx.QueryRow(insertList, list.List_name, list.Query, list.Color_header, list.Color_body, name).Scan(&list.ID)
+		if err == nil && len(data.SmartListOrder[list.List_name]) > 0 {
+			err = materializeViewRanks(tx, name, smartListView(list.ID), viewTaskIDs(data.SmartListOrder[list.List_name]))
+		}
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		newLists = append(newLists, list)
+		report.SmartLists = append(report.SmartLists, list.List_name)
+	}
+
+	if dryRun {
+		tx.Rollback()
+		return report, nil
+	}
+	err = tx.Commit()
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	// die Mitglieder der neuen Listen werden wie bei AddSmartList erst nach dem Speichern ermittelt
+	for _, list := range newLists {
+		err = s.syncSmartListMembers(name, list.ID, list.Query)
+		if err != nil {
+			fmt.Println(err)
+		}
+	}
+	return report, nil
+}
+
+// categoryIDsForUser lädt innerhalb einer Transaktion die aktiven Kategorien eines Benutzers und seine Standardkategorie
+//
+// Parameter:
+//   - tx: Die laufende Transaktion
+//   - name: Der Name des Benutzers
+//
+// Rückgabewert:
+//   - categoryIDs: Die IDs der Kategorien je Name in Kleinbuchstaben
+//   - defaultID: Die ID der Standardkategorie
+//   - error: Ein Fehler, falls bei der Abfrage ein Fehler auftritt; "nil", falls nicht
+func categoryIDsForUser(tx *sqlTx, name string) (categoryIDs map[string]int, defaultID int, err error) {
+	err = tx.QueryRow(`SELECT default_category_id FROM users WHERE name = ?`, name).Scan(&defaultID)
+	if err != nil {
+		return nil, 0, err
+	}
+	rows, err := tx.Query(`SELECT id, cat_name FROM categories WHERE user_id = `+userIDSQL+` AND deleted_at IS NULL`, name)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	categoryIDs = make(map[string]int)
+	for rows.Next() {
+		var catID int
+		var catName string
+		err = rows.Scan(&catID, &catName)
+		if err != nil {
+			return nil, 0, err
+		}
+		categoryIDs[strings.ToLower(catName)] = catID
+	}
+	return categoryIDs, defaultID, rows.Err()
+}
+
+// readUploadedFile liest eine hochgeladene Datei, die entweder als Body oder als Feld file eines Formulars übermittelt wurde
+//
+// Parameter:
+//   - c: Ein Pointer auf ein Context-Objekt von fiber
+//
+// Rückgabewert:
+//   - []byte: Der Inhalt der Datei
+//   - error: errEmptyImport, falls keine Datei übermittelt wurde; ein Fehler, falls sie nicht gelesen werden konnte; "nil", falls nicht
+func readUploadedFile(c *fiber.Ctx) ([]byte, error) {
+	body := c.Body()
+	file, err := c.FormFile("file")
+	if err == nil {
+		f, err := file.Open()
+		if err != nil {
+			fmt.Println(err)
+			return nil, errors.New("Datei konnte nicht gelesen werden")
+		}
+		defer f.Close()
+		body, err = io.ReadAll(f)
+		if err != nil {
+			fmt.Println(err)
+			return nil, errors.New("Datei konnte nicht gelesen werden")
+		}
+	}
+	if len(bytes.TrimSpace(body)) == 0 {
+		return nil, errEmptyImport
+	}
+	return body, nil
+}
+
+// queryTxStrings führt innerhalb einer Transaktion eine Abfrage aus, die eine einzelne Spalte mit Zeichenketten liefert
+//
+// Parameter:
+//   - tx: Die laufende Transaktion
+//   - query: Die Abfrage
+//   - args: Die Parameter der Abfrage
+//
+// Rückgabewert:
+//   - values: Die gelesenen Werte
+//   - error: Ein Fehler, falls bei der Abfrage ein Fehler auftritt; "nil", falls nicht
+func queryTxStrings(tx *sqlTx, query string, args ...interface{}) ([]string, error) {
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	values := make([]string, 0)
+	for rows.Next() {
+		var value string
+		err = rows.Scan(&value)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, rows.Err()
+}
+
+// HandleImport importiert eine Datei für den anfragenden Benutzer
+// die Datei wird als Body oder als Feld file eines Formulars übermittelt, das Format über den Parameter format (json, csv, todotxt, todoist, trello)
+// bei CSV-Dateien legen die Parameter title, desc, done, category, archived und delimiter die Zuordnung der Spalten fest
+// mit dryRun=true wird nur berichtet, was angelegt würde
+//
+// Parameter:
+//   - c: Ein Pointer auf ein Context-Objekt von fiber
+//
+// Rückgabewert:
+//   - error: Ein Fehler, falls die Datei nicht gelesen oder importiert werden konnte - wird an Client gesendet
+//     Bei Erfolg wird die Zusammenfassung des Imports an den Client gesendet
+func (srv *server) HandleImport(c *fiber.Ctx) error {
+	name := c.Locals("name").(string)
+	dryRun := c.QueryBool("dryRun", false)
+	body, err := readUploadedFile(c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	mapping := csvMapping{
+		Title:    c.Query("title", "title"),
+		Desc:     c.Query("desc", "desc"),
+		Done:     c.Query("done", "done"),
+		Category: c.Query("category", "category"),
+		Archived: c.Query("archived", "archived"),
+	}
+	if delimiter := []rune(c.Query("delimiter")); len(delimiter) == 1 {
+		mapping.Delimiter = delimiter[0]
+	}
+	data, err := parseImport(c.Query("format"), body, mapping)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	report, err := srv.store.ImportData(name, data, dryRun)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(400).JSON(fiber.Map{"error": "Import fehlgeschlagen"})
+	}
+	if dryRun {
+		return c.Status(200).JSON(report)
+	}
+
+	for _, taskID := range report.TaskIDs {
+		srv.refreshSmartListsForTask(taskID)
+	}
+	for _, taskID := range report.SharedIDs {
+		srv.notifyTaskAdded(taskID)
+	}
+	srv.wakeWebhookDelivery()
+	return c.Status(201).JSON(report)
+}
@@ -0,0 +1,429 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+var errInboundHookNotFound = errors.New("Eingangsadresse konnte nicht gefunden werden")
+
+// inboundHook ist eine geheime Adresse, über die andere Systeme ohne Anmeldung Aufgaben für einen Benutzer anlegen können
+// category ist die Kategorie neuer Aufgaben; "nil", falls die Standardkategorie des Benutzers verwendet wird
+type inboundHook struct {
+	Token      string    `json:"token"`
+	User       string    `json:"-"`
+	CategoryID *int      `json:"category,omitempty"`
+	CreatedAt  time.Time `json:"createdAt"`
+	URL        string    `json:"url,omitempty"`
+}
+
+// inboundInput ist eine eingehende Aufgabe als JSON oder Formular
+// category ist der Name einer Kategorie des Benutzers, due ein Datum im Format JJJJ-MM-TT
+type inboundInput struct {
+	Title    string `json:"title" form:"title"`
+	Desc     string `json:"desc" form:"desc"`
+	Due      string `json:"due" form:"due"`
+	Category string `json:"category" form:"category"`
+}
+
+// AddInboundHook legt eine neue geheime Adresse für eingehende Aufgaben an
+//
+// Parameter:
+//   - name: Der Name des Benutzers
+//   - catID: Die ID der Kategorie neuer Aufgaben; 0 für die Standardkategorie
+//
+// Rückgabewert:
+//   - hook: Die angelegte Adresse
+//   - error: errCategoryNotFound, falls die Kategorie nicht dem Benutzer gehört; "nil", falls kein Fehler auftritt
+func (s *sqlStore) AddInboundHook(name string, catID int) (inboundHook, error) {
+	hook := inboundHook{User: name, CreatedAt: time.Now().Truncate(time.Second)}
+	if catID != 0 {
+		var exists bool
+		err := s.db.QueryRow(`SELECT EXISTS(SELECT 1 FROM categories WHERE id = ? AND user_id = `+userIDSQL+` AND deleted_at IS NULL)`, catID, name).Scan(&exists)
+		if err != nil {
+			return inboundHook{}, err
+		}
+		if !exists {
+			return inboundHook{}, errCategoryNotFound
+		}
+		hook.CategoryID = &catID
+	}
+
+	token, err := newSecretToken()
+	if err != nil {
+		return inboundHook{}, err
+	}
+	hook.Token = token
+	_, err = s.db.Exec(`INSERT INTO inbound_hooks (token, user_id, category_id, created_at) VALUES (?,`+userIDSQL+`,?,?)`, token, name, hook.CategoryID, hook.CreatedAt.Unix())
+	if err != nil {
+		return inboundHook{}, err
+	}
+	return hook, nil
+}
+
+// GetInboundHooksForUser lädt alle Eingangsadressen eines Benutzers
+//
+// Parameter:
+//   - name: Der Name des Benutzers
+//
+// Rückgabewert:
+//   - hooks: Die Eingangsadressen, die ältesten zuerst
+//   - error: Ein Fehler, falls bei der Abfrage ein Fehler auftritt; "nil", falls nicht
+func (s *sqlStore) GetInboundHooksForUser(name string) ([]inboundHook, error) {
+	rows, err := s.db.Query(`SELECT token, category_id, created_at FROM inbound_hooks WHERE user_id = `+userIDSQL+` ORDER BY created_at, token`, name)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	hooks := make([]inboundHook, 0)
+	for rows.Next() {
+		hook := inboundHook{User: name}
+		var createdAt int64
+		err = rows.Scan(&hook.Token, &hook.CategoryID, &createdAt)
+		if err != nil {
+			return nil, err
+		}
+		hook.CreatedAt = time.Unix(createdAt, 0)
+		hooks = append(hooks, hook)
+	}
+	return hooks, rows.Err()
+}
+
+// GetInboundHook lädt die Eingangsadresse zu einem Token
+//
+// Parameter:
+//   - token: Das Token aus der Adresse
+//
+// Rückgabewert:
+//   - hook: Ein Pointer auf die Eingangsadresse; "nil", falls ein Fehler auftritt
+//   - error: errInboundHookNotFound, falls das Token unbekannt oder widerrufen ist; "nil", falls kein Fehler auftritt
+func (s *sqlStore) GetInboundHook(token string) (*inboundHook, error) {
+	hook := inboundHook{Token: token}
+	var createdAt int64
+	err := s.db.QueryRow(`SELECT `+userNameSQL("user_id")+`, category_id, created_at FROM inbound_hooks WHERE token = ?`, token).Scan(&hook.User, &hook.CategoryID, &createdAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errInboundHookNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	hook.CreatedAt = time.Unix(createdAt, 0)
+	return &hook, nil
+}
+
+// DeleteInboundHook widerruft eine Eingangsadresse, danach werden über sie keine Aufgaben mehr angelegt
+//
+// Parameter:
+//   - name: Der Name des Benutzers
+//   - token: Das Token der Eingangsadresse
+//
+// Rückgabewert:
+//   - error: errInboundHookNotFound, falls die Adresse nicht dem Benutzer gehört; "nil", falls kein Fehler auftritt
+func (s *sqlStore) DeleteInboundHook(name, token string) error {
+	result, err := s.db.Exec(`DELETE FROM inbound_hooks WHERE token = ? AND user_id = `+userIDSQL, token, name)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return errInboundHookNotFound
+	}
+	return nil
+}
+
+// emailText liest den Text eines Teils einer E-Mail und dekodiert dabei base64 bzw. quoted-printable
+// bei multipart wird der erste Teil mit text/plain verwendet, Zeichensätze außer UTF-8 werden nur für ISO-8859-1 umgewandelt
+//
+// Parameter:
+//   - contentType: Der Header Content-Type des Teils
+//   - encoding: Der Header Content-Transfer-Encoding des Teils
+//   - r: Der Inhalt des Teils
+//
+// Rückgabewert:
+//   - string: Der Text; "", falls der Teil keinen Text enthält
+//   - error: Ein Fehler, falls der Teil nicht gelesen werden kann; "nil", falls nicht
+func emailText(contentType, encoding string, r io.Reader) (string, error) {
+	mediaType, params := "text/plain", map[string]string{}
+	if contentType != "" {
+		var err error
+		mediaType, params, err = mime.ParseMediaType(contentType)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		mr := multipart.NewReader(r, params["boundary"])
+		for {
+			part, err := mr.NextPart()
+			if errors.Is(err, io.EOF) {
+				return "", nil
+			}
+			if err != nil {
+				return "", err
+			}
+			text, err := emailText(part.Header.Get("Content-Type"), part.Header.Get("Content-Transfer-Encoding"), part)
+			if err != nil {
+				return "", err
+			}
+			if strings.TrimSpace(text) != "" {
+				return text, nil
+			}
+		}
+	}
+	if mediaType != "text/plain" {
+		return "", nil
+	}
+
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "base64":
+		r = base64.NewDecoder(base64.StdEncoding, r)
+	case "quoted-printable":
+		r = quotedprintable.NewReader(r)
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return "", err
+	}
+
+	switch strings.ToLower(params["charset"]) {
+	case "iso-8859-1", "latin1", "iso-8859-15":
+		runes := make([]rune, len(data))
+		for i, b := range data {
+			runes[i] = rune(b)
+		}
+		return string(runes), nil
+	}
+	return string(data), nil
+}
+
+// parseInboundEmail liest eine E-Mail nach RFC 5322, der Betreff wird zum Titel und der Text zur Beschreibung
+// fehlt der Betreff, wird die erste Zeile des Textes als Titel verwendet
+//
+// Parameter:
+//   - data: Die vollständige E-Mail inklusive Header
+//
+// Rückgabewert:
+//   - input: Die eingehende Aufgabe
+//   - error: Ein Fehler, falls die E-Mail nicht gelesen werden kann; "nil", falls nicht
+func parseInboundEmail(data []byte) (inboundInput, error) {
+	msg, err := mail.ReadMessage(bytes.NewReader(data))
+	if err != nil {
+		return inboundInput{}, err
+	}
+
+	subject := msg.Header.Get("Subject")
+	if decoded, err := new(mime.WordDecoder).DecodeHeader(subject); err == nil {
+		subject = decoded
+	}
+	body, err := emailText(msg.Header.Get("Content-Type"), msg.Header.Get("Content-Transfer-Encoding"), msg.Body)
+	if err != nil {
+		return inboundInput{}, err
+	}
+	body = strings.TrimSpace(strings.ReplaceAll(body, "\r\n", "\n"))
+
+	input := inboundInput{Title: strings.TrimSpace(subject), Desc: body}
+	if input.Title == "" {
+		input.Title, input.Desc, _ = strings.Cut(body, "\n")
+		input.Desc = strings.TrimSpace(input.Desc)
+	}
+	return input, nil
+}
+
+// addInboundTask legt eine eingehende Aufgabe für den Besitzer einer Eingangsadresse an
+// eine angegebene Kategorie wird über ihren Namen gesucht, ist sie unbekannt, wird die Kategorie der Adresse verwendet
+//
+// Parameter:
+//   - hook: Die Eingangsadresse
+//   - input: Die eingehende Aufgabe
+//
+// Rückgabewert:
+//   - taskID: Die ID der angelegten Aufgabe
+//   - error: Ein Fehler mit einer Beschreibung für den Client, falls die Eingabe ungültig ist oder beim Anlegen ein Fehler auftritt
+func (srv *server) addInboundTask(hook *inboundHook, input inboundInput) (int, error) {
+	title := strings.TrimSpace(input.Title)
+	if title == "" {
+		return 0, errors.New("Titel darf nicht leer sein")
+	}
+	var due *time.Time
+	if input.Due != "" {
+		due = parseTodoTxtDate(input.Due)
+		if due == nil {
+			return 0, errors.New("Ungültiges Datum, erwartet wird JJJJ-MM-TT")
+		}
+	}
+
+	var cat category
+	if hook.CategoryID != nil {
+		cat.ID = *hook.CategoryID
+	}
+	if input.Category != "" {
+		categories, err := srv.store.GetCategoriesForUser(hook.User)
+		if err != nil {
+			fmt.Println(err)
+			return 0, errors.New("Aufgabe konnte nicht erstellt werden")
+		}
+		for _, c := range categories {
+			if strings.EqualFold(c.Cat_name, strings.TrimSpace(input.Category)) {
+				cat = c
+				break
+			}
+		}
+	}
+
+	taskID, err := srv.store.AddTask(hook.User, title, input.Desc, cat)
+	if err != nil {
+		fmt.Println(err)
+		return 0, errors.New("Aufgabe konnte nicht erstellt werden")
+	}
+	if due != nil {
+		err = srv.store.SetTaskDue(hook.User, taskID, due)
+		if err != nil {
+			fmt.Println(err)
+		}
+	}
+	srv.refreshSmartListsForTask(taskID)
+	srv.wakeWebhookDelivery()
+	return taskID, nil
+}
+
+// inboundURL liefert die vollständige Adresse einer Eingangsadresse
+//
+// Parameter:
+//   - c: Ein Pointer auf ein Context-Objekt von fiber
+//   - token: Das Token der Eingangsadresse
+//
+// Rückgabewert:
+//   - string: Die Adresse, an die andere Systeme Aufgaben senden
+func inboundURL(c *fiber.Ctx, token string) string {
+	return c.BaseURL() + "/inbound/" + token
+}
+
+// HandleGetInboundHooks sendet alle Eingangsadressen des anfragenden Benutzers
+//
+// Parameter:
+//   - c: Ein Pointer auf ein Context-Objekt von fiber
+//
+// Rückgabewert:
+//   - error: Ein Fehler, falls beim Laden ein Fehler auftritt - wird an Client gesendet
+func (srv *server) HandleGetInboundHooks(c *fiber.Ctx) error {
+	name := c.Locals("name").(string)
+
+	hooks, err := srv.store.GetInboundHooksForUser(name)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(400).JSON(fiber.Map{"error": "Eingangsadressen konnten nicht geladen werden"})
+	}
+	for i := range hooks {
+		hooks[i].URL = inboundURL(c, hooks[i].Token)
+	}
+	return c.Status(200).JSON(fiber.Map{"inbound": hooks})
+}
+
+// HandleAddInboundHook legt eine neue Eingangsadresse an, mit {"category": 3} landen neue Aufgaben in dieser Kategorie
+//
+// Parameter:
+//   - c: Ein Pointer auf ein Context-Objekt von fiber
+//
+// Rückgabewert:
+//   - error: Ein Fehler, falls die Kategorie ungültig ist oder beim Anlegen ein Fehler auftritt - wird an Client gesendet
+//     Bei Erfolg wird die Eingangsadresse inklusive Adresse an den Client gesendet
+func (srv *server) HandleAddInboundHook(c *fiber.Ctx) error {
+	name := c.Locals("name").(string)
+	type InboundHookInput struct {
+		Category int `json:"category"`
+	}
+	var input InboundHookInput
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&input); err != nil {
+			fmt.Println(err)
+			return c.Status(400).JSON(fiber.Map{"error": "Ungültige Eingabedaten"})
+		}
+	}
+
+	hook, err := srv.store.AddInboundHook(name, input.Category)
+	if errors.Is(err, errCategoryNotFound) {
+		return c.Status(404).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(400).JSON(fiber.Map{"error": "Eingangsadresse konnte nicht angelegt werden"})
+	}
+	hook.URL = inboundURL(c, hook.Token)
+	return c.Status(201).JSON(hook)
+}
+
+// HandleDeleteInboundHook widerruft eine Eingangsadresse des anfragenden Benutzers
+//
+// Parameter:
+//   - c: Ein Pointer auf ein Context-Objekt von fiber
+//
+// Rückgabewert:
+//   - error: Ein Fehler, falls die Eingangsadresse nicht existiert - wird an Client gesendet
+func (srv *server) HandleDeleteInboundHook(c *fiber.Ctx) error {
+	name := c.Locals("name").(string)
+
+	err := srv.store.DeleteInboundHook(name, c.Params("token"))
+	if errors.Is(err, errInboundHookNotFound) {
+		return c.Status(404).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(400).JSON(fiber.Map{"error": "Eingangsadresse konnte nicht widerrufen werden"})
+	}
+	return c.Status(200).JSON(fiber.Map{"msg": "Eingangsadresse erfolgreich widerrufen"})
+}
+
+// HandleInbound legt eine Aufgabe über eine Eingangsadresse an
+// die Route ist nicht durch ein JWT geschützt, das geheime Token in der Adresse dient als Zugangsberechtigung
+// akzeptiert werden JSON, Formulare und mit Content-Type message/rfc822 bzw. ?format=email eine vollständige E-Mail
+//
+// Parameter:
+//   - c: Ein Pointer auf ein Context-Objekt von fiber
+//
+// Rückgabewert:
+//   - error: Ein Fehler, falls das Token unbekannt oder die Eingabe ungültig ist - wird an Client gesendet
+//     Bei Erfolg wird die ID der neuen Aufgabe an den Client gesendet
+func (srv *server) HandleInbound(c *fiber.Ctx) error {
+	hook, err := srv.store.GetInboundHook(c.Params("token"))
+	if errors.Is(err, errInboundHookNotFound) {
+		return c.Status(404).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(400).JSON(fiber.Map{"error": "Aufgabe konnte nicht erstellt werden"})
+	}
+
+	var input inboundInput
+	if strings.HasPrefix(c.Get(fiber.HeaderContentType), "message/rfc822") || c.Query("format") == "email" {
+		input, err = parseInboundEmail(c.Body())
+	} else {
+		err = c.BodyParser(&input)
+	}
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(400).JSON(fiber.Map{"error": "Ungültige Eingabedaten"})
+	}
+
+	taskID, err := srv.addInboundTask(hook, input)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(201).JSON(fiber.Map{"id": taskID})
+}
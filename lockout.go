@@ -0,0 +1,344 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Regeln für die Drosselung fehlgeschlagener Anmeldungen
+// nach den freien Fehlversuchen verdoppelt sich die Wartezeit mit jedem weiteren Fehlversuch, höchstens bis loginLockout
+// ab loginLockoutThreshold Fehlversuchen wird ein Benutzer für loginLockout gesperrt
+// Fehlversuche verfallen, wenn seit dem letzten loginFailureWindow vergangen ist
+const (
+	loginFreeFailuresUser = 3
+	loginFreeFailuresIP   = 10
+	loginLockoutThreshold = 10
+	loginFailureWindow    = time.Hour
+	loginFailureRetention = 30 * 24 * time.Hour
+)
+
+// Arten der Drosselung in login_throttles
+const (
+	loginThrottleUser = "user"
+	loginThrottleIP   = "ip"
+)
+
+var errLoginLockNotFound = errors.New("Konto ist nicht gesperrt")
+
+// loginFailure ist ein protokollierter Fehlversuch bei der Anmeldung
+type loginFailure struct {
+	ID        int       `json:"id"`
+	User      string    `json:"user"`
+	IP        string    `json:"ip"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// loginLock ist die aktuelle Drosselung eines Benutzers bzw. einer IP-Adresse
+type loginLock struct {
+	Kind          string     `json:"kind"`
+	Subject       string     `json:"subject"`
+	Failures      int        `json:"failures"`
+	BlockedUntil  *time.Time `json:"blockedUntil,omitempty"`
+	LastFailureAt time.Time  `json:"lastFailureAt"`
+}
+
+// loginBackoff berechnet, wie lange nach einem Fehlversuch keine weitere Anmeldung angenommen wird
+//
+// Parameter:
+//   - kind: Die Art der Drosselung, loginThrottleUser oder loginThrottleIP
+//   - failures: Die Anzahl der Fehlversuche einschließlich des aktuellen
+//
+// Rückgabewert:
+//   - time.Duration: Die Wartezeit; 0, falls sofort ein weiterer Versuch erlaubt ist
+func loginBackoff(kind string, failures int) time.Duration {
+	free := loginFreeFailuresIP
+	if kind == loginThrottleUser {
+		if failures >= loginLockoutThreshold {
+			return loginLockout
+		}
+		free = loginFreeFailuresUser
+	}
+	if failures < free {
+		return 0
+	}
+	exponent := failures - free
+	if exponent > 30 {
+		return loginLockout
+	}
+	return min(time.Second<<exponent, loginLockout)
+}
+
+// GetLoginBlock ermittelt, bis wann ein Benutzer oder eine IP-Adresse gedrosselt ist
+//
+// Parameter:
+//   - name: Der Name des Benutzers
+//   - ip: Die IP-Adresse des Clients
+//
+// Rückgabewert:
+//   - time.Time: Der späteste Zeitpunkt, bis zu dem keine Anmeldung angenommen wird; der Nullwert, falls keine Drosselung besteht
+//   - error: Ein Fehler, falls bei der Abfrage ein Fehler auftritt; "nil", falls nicht
+func (s *sqlStore) GetLoginBlock(name, ip string) (time.Time, error) {
+	var blockedUntil *int64
+	err := s.db.QueryRow(`SELECT MAX(blocked_until) FROM login_throttles WHERE (kind = ? AND subject = ?) OR (kind = ? AND subject = ?)`,
+		loginThrottleUser, name, loginThrottleIP, ip).Scan(&blockedUntil)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if blockedUntil == nil {
+		return time.Time{}, nil
+	}
+	return time.Unix(*blockedUntil, 0), nil
+}
+
+// RecordLoginFailure protokolliert einen Fehlversuch und erhöht die Drosselung für Benutzer und IP-Adresse
+// Einträge im Protokoll, die älter als loginFailureRetention sind, werden dabei gelöscht, ebenso verfallene Drosselungen ohne laufende Sperre
+//
+// Parameter:
+//   - name: Der angegebene Name des Benutzers, der nicht existieren muss
+//   - ip: Die IP-Adresse des Clients
+//
+// Rückgabewert:
+//   - error: Ein Fehler, falls bei der Transaktion ein Fehler auftritt; "nil", falls nicht
+func (s *sqlStore) RecordLoginFailure(name, ip string) error {
+	now := time.Now()
+	tx, err := s.db.Begin()
+	if err != nil {
+		fmt.Println(err)
+		return err
+	}
+
+	_, err = tx.Exec(`INSERT INTO login_failures (user_name, ip, created_at) VALUES (?,?,?)`, name, ip, now.Unix())
+	if err == nil {
+		_, err = tx.Exec(`DELETE FROM login_failures WHERE created_at < ?`, now.Add(-loginFailureRetention).Unix())
+	}
+	if err == nil {
+		_, err = tx.Exec(`DELETE FROM login_throttles WHERE updated_at < ? AND blocked_until <= ?`, now.Add(-loginFailureWindow).Unix(), now.Unix())
+	}
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	for _, throttle := range [][2]string{{loginThrottleUser, name}, {loginThrottleIP, ip}} {
+		kind, subject := throttle[0], throttle[1]
+		var failures int
+		err = tx.QueryRow(`INSERT INTO login_throttles (kind, subject, failures, blocked_until, updated_at) VALUES (?,?,1,0,?)
+			ON CONFLICT (kind, subject) DO UPDATE SET
+				failures = CASE WHEN login_throttles.updated_at < ? THEN 1 ELSE login_throttles.failures + 1 END,
+				updated_at = excluded.updated_at
+			RETURNING failures`, kind, subject, now.Unix(), now.Add(-loginFailureWindow).Unix()).Scan(&failures)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		var blockedUntil int64
+		if backoff := loginBackoff(kind, failures); backoff > 0 {
+			// auf volle Sekunden aufrunden, damit die Wartezeit nicht zu früh endet
+			blockedUntil = (now.Add(backoff).UnixNano() + int64(time.Second) - 1) / int64(time.Second)
+		}
+		_, err = tx.Exec(`UPDATE login_throttles SET blocked_until = ? WHERE kind = ? AND subject = ?`, blockedUntil, kind, subject)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		tx.Rollback()
+		fmt.Println(err)
+		return err
+	}
+	return nil
+}
+
+// ClearLoginFailures hebt die Drosselung eines Benutzers nach einer erfolgreichen Anmeldung oder durch einen Administrator auf
+// die Drosselung der IP-Adresse bleibt bestehen, damit ein eigenes Konto nicht zum Zurücksetzen verwendet werden kann
+//
+// Parameter:
+//   - name: Der Name des Benutzers
+//
+// Rückgabewert:
+//   - error: errLoginLockNotFound, falls keine Drosselung bestand; "nil", falls kein Fehler auftritt
+func (s *sqlStore) ClearLoginFailures(name string) error {
+	result, err := s.db.Exec(`DELETE FROM login_throttles WHERE kind = ? AND subject = ?`, loginThrottleUser, name)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return errLoginLockNotFound
+	}
+	return nil
+}
+
+// GetLoginLocks lädt alle Benutzer und IP-Adressen mit noch nicht verfallenen Fehlversuchen
+//
+// Rückgabewert:
+//   - locks: Die Drosselungen, die mit den meisten Fehlversuchen zuerst
+//   - error: Ein Fehler, falls bei der Abfrage ein Fehler auftritt; "nil", falls nicht
+func (s *sqlStore) GetLoginLocks() ([]loginLock, error) {
+	now := time.Now()
+	rows, err := s.db.Query(`SELECT kind, subject, failures, blocked_until, updated_at FROM login_throttles
+		WHERE updated_at >= ? OR blocked_until > ? ORDER BY failures DESC, kind, subject`,
+		now.Add(-loginFailureWindow).Unix(), now.Unix())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	locks := make([]loginLock, 0)
+	for rows.Next() {
+		var lock loginLock
+		var blockedUntil, updatedAt int64
+		err = rows.Scan(&lock.Kind, &lock.Subject, &lock.Failures, &blockedUntil, &updatedAt)
+		if err != nil {
+			return nil, err
+		}
+		if blockedUntil > now.Unix() {
+			lock.BlockedUntil = unixTime(&blockedUntil)
+		}
+		lock.LastFailureAt = time.Unix(updatedAt, 0)
+		locks = append(locks, lock)
+	}
+	return locks, rows.Err()
+}
+
+// GetLoginFailures lädt die letzten 100 protokollierten Fehlversuche, optional für einen Benutzer
+//
+// Parameter:
+//   - name: Der Name des Benutzers; "" für alle Benutzer
+//
+// Rückgabewert:
+//   - failures: Die Fehlversuche, die neuesten zuerst
+//   - error: Ein Fehler, falls bei der Abfrage ein Fehler auftritt; "nil", falls nicht
+func (s *sqlStore) GetLoginFailures(name string) ([]loginFailure, error) {
+	rows, err := s.db.Query(`SELECT id, user_name, ip, created_at FROM login_failures WHERE ? = '' OR user_name = ? ORDER BY id DESC LIMIT 100`, name, name)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	failures := make([]loginFailure, 0)
+	for rows.Next() {
+		var failure loginFailure
+		var createdAt int64
+		err = rows.Scan(&failure.ID, &failure.User, &failure.IP, &createdAt)
+		if err != nil {
+			return nil, err
+		}
+		failure.CreatedAt = time.Unix(createdAt, 0)
+		failures = append(failures, failure)
+	}
+	return failures, rows.Err()
+}
+
+// checkLoginThrottle lehnt eine Anmeldung mit 429 und Retry-After ab, solange Benutzer oder IP-Adresse gedrosselt sind
+// das Passwort wird dabei nicht geprüft, sodass auch ein korrektes Passwort erst nach Ablauf der Wartezeit angenommen wird
+//
+// Parameter:
+//   - c: Ein Pointer auf ein Context-Objekt von fiber
+//   - name: Der angegebene Name des Benutzers
+//
+// Rückgabewert:
+//   - bool: "true", falls die Anmeldung abgelehnt und die Antwort bereits gesendet wurde
+//   - error: Der Fehler beim Senden der Antwort
+func (srv *server) checkLoginThrottle(c *fiber.Ctx, name string) (bool, error) {
+	blockedUntil, err := srv.store.GetLoginBlock(name, c.IP())
+	if err != nil {
+		fmt.Println(err)
+		return false, nil
+	}
+	wait := time.Until(blockedUntil)
+	if wait <= 0 {
+		return false, nil
+	}
+	seconds := int(math.Ceil(wait.Seconds()))
+	c.Set(fiber.HeaderRetryAfter, strconv.Itoa(seconds))
+	return true, c.Status(429).JSON(fiber.Map{
+		"error":      fmt.Sprintf("Zu viele fehlgeschlagene Anmeldungen, bitte in %d Sekunden erneut versuchen", seconds),
+		"retryAfter": seconds,
+	})
+}
+
+// recordLoginFailure protokolliert einen Fehlversuch, Fehler werden nur ausgegeben
+//
+// Parameter:
+//   - c: Ein Pointer auf ein Context-Objekt von fiber
+//   - name: Der angegebene Name des Benutzers
+func (srv *server) recordLoginFailure(c *fiber.Ctx, name string) {
+	err := srv.store.RecordLoginFailure(name, c.IP())
+	if err != nil {
+		fmt.Println(err)
+	}
+}
+
+// clearLoginFailures hebt nach einer erfolgreichen Anmeldung die Drosselung des Benutzers auf, Fehler werden nur ausgegeben
+//
+// Parameter:
+//   - name: Der Name des Benutzers
+func (srv *server) clearLoginFailures(name string) {
+	err := srv.store.ClearLoginFailures(name)
+	if err != nil && !errors.Is(err, errLoginLockNotFound) {
+		fmt.Println(err)
+	}
+}
+
+// HandleGetLoginLocks sendet einem Administrator die aktuellen Drosselungen und die letzten Fehlversuche
+// mit ?user= werden nur die Fehlversuche dieses Benutzers gesendet
+//
+// Parameter:
+//   - c: Ein Pointer auf ein Context-Objekt von fiber
+//
+// Rückgabewert:
+//   - error: Ein Fehler, falls der Benutzer kein Administrator ist oder beim Laden ein Fehler auftritt - wird an Client gesendet
+func (srv *server) HandleGetLoginLocks(c *fiber.Ctx) error {
+	name := c.Locals("name").(string)
+	if !srv.isAdmin(name) {
+		return c.Status(403).JSON(fiber.Map{"error": errForbidden.Error()})
+	}
+
+	locks, err := srv.store.GetLoginLocks()
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(400).JSON(fiber.Map{"error": "Sperren konnten nicht geladen werden"})
+	}
+	failures, err := srv.store.GetLoginFailures(c.Query("user"))
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(400).JSON(fiber.Map{"error": "Fehlversuche konnten nicht geladen werden"})
+	}
+	return c.Status(200).JSON(fiber.Map{"locks": locks, "failures": failures})
+}
+
+// HandleUnlockUser hebt als Administrator die Sperre eines Benutzers auf
+//
+// Parameter:
+//   - c: Ein Pointer auf ein Context-Objekt von fiber
+//
+// Rückgabewert:
+//   - error: Ein Fehler, falls der Benutzer kein Administrator ist oder das Konto nicht gesperrt ist - wird an Client gesendet
+func (srv *server) HandleUnlockUser(c *fiber.Ctx) error {
+	name := c.Locals("name").(string)
+	if !srv.isAdmin(name) {
+		return c.Status(403).JSON(fiber.Map{"error": errForbidden.Error()})
+	}
+
+	err := srv.store.ClearLoginFailures(c.Params("name"))
+	if errors.Is(err, errLoginLockNotFound) {
+		return c.Status(404).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(400).JSON(fiber.Map{"error": "Sperre konnte nicht aufgehoben werden"})
+	}
+	return c.Status(200).JSON(fiber.Map{"msg": "Sperre erfolgreich aufgehoben"})
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// mailConfig enthält die Einstellungen des SMTP-Relays aus den Umgebungsvariablen GO_TODO_SMTP_*
+type mailConfig struct {
+	addr     string
+	username string
+	password string
+	from     string
+}
+
+// mailer versendet E-Mails über ein SMTP-Relay, z.B. einen lokalen Mailserver oder einen Testserver wie Mailpit
+// bietet der Server STARTTLS an, wird die Verbindung verschlüsselt; angemeldet wird nur, falls ein Benutzername gesetzt ist
+type mailer struct {
+	config mailConfig
+}
+
+// newMailer erstellt einen neuen mailer
+//
+// Parameter:
+//   - config: Die Einstellungen des SMTP-Relays
+//
+// Rückgabewert:
+//   - m: Ein Pointer auf den neu erstellten mailer
+func newMailer(config mailConfig) *mailer {
+	return &mailer{config: config}
+}
+
+// send versendet eine E-Mail im Klartext, der Betreff wird nach RFC 2047 und der Text als quoted-printable kodiert
+//
+// Parameter:
+//   - to: Die Adresse des Empfängers
+//   - subject: Der Betreff
+//   - body: Der Text der E-Mail, Zeilen werden mit "\n" getrennt
+//
+// Rückgabewert:
+//   - error: Ein Fehler, falls eine Adresse ungültig ist oder der Server die E-Mail ablehnt; "nil", falls nicht
+func (m *mailer) send(to, subject, body string) error {
+	from, err := mail.ParseAddress(m.config.from)
+	if err != nil {
+		return fmt.Errorf("ungültiger Absender %q: %w", m.config.from, err)
+	}
+	recipient, err := mail.ParseAddress(to)
+	if err != nil {
+		return fmt.Errorf("ungültiger Empfänger %q: %w", to, err)
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", from.String())
+	fmt.Fprintf(&msg, "To: %s\r\n", recipient.String())
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&msg, "Message-ID: %s\r\n", messageID(from.Address))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	msg.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+	qp := quotedprintable.NewWriter(&msg)
+	_, err = qp.Write([]byte(body))
+	if err == nil {
+		err = qp.Close()
+	}
+	if err != nil {
+		return err
+	}
+
+	var auth smtp.Auth
+	if m.config.username != "" {
+		host, _, err := net.SplitHostPort(m.config.addr)
+		if err != nil {
+			return err
+		}
+		auth = smtp.PlainAuth("", m.config.username, m.config.password, host)
+	}
+	return smtp.SendMail(m.config.addr, auth, from.Address, []string{recipient.Address}, msg.Bytes())
+}
+
+// messageID erzeugt eine zufällige Message-ID unter der Domain des Absenders
+//
+// Parameter:
+//   - from: Die Adresse des Absenders
+//
+// Rückgabewert:
+//   - string: Die Message-ID in spitzen Klammern
+func messageID(from string) string {
+	domain := "localhost"
+	if at := strings.LastIndex(from, "@"); at >= 0 {
+		domain = from[at+1:]
+	}
+	random := make([]byte, 12)
+	rand.Read(random)
+	return fmt.Sprintf("<%s@%s>", hex.EncodeToString(random), domain)
+}
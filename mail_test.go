@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bufio"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"strings"
+	"testing"
+	"time"
+)
+
+// capturedMail ist eine E-Mail, die der Testserver aus newSMTPCapture angenommen hat
+type capturedMail struct {
+	auth string
+	from string
+	to   []string
+	data string
+}
+
+// newSMTPCapture startet einen minimalen SMTP-Server auf einer freien lokalen Adresse, der alle E-Mails annimmt und weitergibt
+// der Server bietet AUTH PLAIN an, aber kein STARTTLS; net/smtp erlaubt die Anmeldung daher nur, weil er an 127.0.0.1 lauscht
+func newSMTPCapture(t *testing.T) (addr string, mails <-chan capturedMail) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	captured := make(chan capturedMail, 10)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveSMTPCapture(conn, captured)
+		}
+	}()
+	return listener.Addr().String(), captured
+}
+
+// serveSMTPCapture führt die SMTP-Sitzung einer Verbindung für newSMTPCapture
+func serveSMTPCapture(conn net.Conn, captured chan<- capturedMail) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+	r := bufio.NewReader(conn)
+	reply := func(line string) { io.WriteString(conn, line+"\r\n") }
+
+	var current capturedMail
+	reply("220 localhost ESMTP capture")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		command := strings.ToUpper(line)
+		switch {
+		case strings.HasPrefix(command, "EHLO"):
+			reply("250-localhost")
+			reply("250 AUTH PLAIN")
+		case strings.HasPrefix(command, "AUTH PLAIN "):
+			credentials, _ := base64.StdEncoding.DecodeString(line[len("AUTH PLAIN "):])
+			current.auth = string(credentials)
+			reply("235 2.7.0 Authentication successful")
+		case strings.HasPrefix(command, "MAIL FROM:"):
+			current.from = strings.Trim(line[len("MAIL FROM:"):], "<>")
+			reply("250 OK")
+		case strings.HasPrefix(command, "RCPT TO:"):
+			current.to = append(current.to, strings.Trim(line[len("RCPT TO:"):], "<>"))
+			reply("250 OK")
+		case command == "DATA":
+			reply("354 End data with <CR><LF>.<CR><LF>")
+			var data strings.Builder
+			for {
+				dataLine, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if dataLine == ".\r\n" {
+					break
+				}
+				data.WriteString(strings.TrimPrefix(dataLine, "."))
+			}
+			current.data = data.String()
+			captured <- current
+			current = capturedMail{}
+			reply("250 OK")
+		case command == "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			reply("250 OK")
+		}
+	}
+}
+
+// receiveMail wartet auf die nächste E-Mail des Testservers und liest Betreff und dekodierten Text mit \n als Zeilenende
+func receiveMail(t *testing.T, mails <-chan capturedMail) (capturedMail, *mail.Message, string, string) {
+	t.Helper()
+	var captured capturedMail
+	select {
+	case captured = <-mails:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Keine E-Mail empfangen")
+	}
+	msg, err := mail.ReadMessage(strings.NewReader(captured.data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(quotedprintable.NewReader(msg.Body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return captured, msg, subject, strings.ReplaceAll(string(body), "\r\n", "\n")
+}
+
+func TestMailerSend(t *testing.T) {
+	addr, mails := newSMTPCapture(t)
+	m := newMailer(mailConfig{addr: addr, from: "Go Todo <noreply@example.com>"})
+
+	body := "Grüße aus dem Test\n" + strings.Repeat("lange Zeile ", 20) + "\n"
+	err := m.send("alice@example.com", "Passwort zurücksetzen", body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	captured, msg, subject, decoded := receiveMail(t, mails)
+	if captured.from != "noreply@example.com" || len(captured.to) != 1 || captured.to[0] != "alice@example.com" {
+		t.Fatalf("Umschlag %q an %v, erwartet noreply@example.com an alice@example.com", captured.from, captured.to)
+	}
+	if captured.auth != "" {
+		t.Fatalf("Anmeldung ohne Benutzername: %q", captured.auth)
+	}
+	if subject != "Passwort zurücksetzen" {
+		t.Fatalf("Betreff %q", subject)
+	}
+	if decoded != body {
+		t.Fatalf("Text %q, erwartet %q", decoded, body)
+	}
+	if !strings.HasSuffix(msg.Header.Get("Message-ID"), "@example.com>") {
+		t.Fatalf("Message-ID %q gehört nicht zur Domain des Absenders", msg.Header.Get("Message-ID"))
+	}
+	for _, line := range strings.Split(captured.data, "\r\n") {
+		if len(line) > 78 {
+			t.Fatalf("Zeile mit %d Zeichen ist länger als nach RFC 5322 empfohlen", len(line))
+		}
+	}
+}
+
+func TestMailerSendWithAuth(t *testing.T) {
+	addr, mails := newSMTPCapture(t)
+	m := newMailer(mailConfig{addr: addr, username: "relay", password: "secret", from: "go-todo@localhost"})
+
+	err := m.send("bob@example.com", "Test", "Hallo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	captured, _, _, _ := receiveMail(t, mails)
+	if captured.auth != "\x00relay\x00secret" {
+		t.Fatalf("Anmeldung %q, erwartet relay/secret", captured.auth)
+	}
+}
+
+func TestMailerRejectsInvalidAddresses(t *testing.T) {
+	addr, _ := newSMTPCapture(t)
+
+	if err := newMailer(mailConfig{addr: addr, from: "kein absender"}).send("alice@example.com", "Test", "Hallo"); err == nil {
+		t.Fatal("Ungültiger Absender wurde akzeptiert")
+	}
+	if err := newMailer(mailConfig{addr: addr, from: "go-todo@localhost"}).send("alice@example.com\r\nBcc: eve@example.com", "Test", "Hallo"); err == nil {
+		t.Fatal("Empfänger mit Zeilenumbruch wurde akzeptiert")
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"os"
 	"strconv"
 	"strings"
 	"sync"
@@ -20,41 +21,79 @@ import (
 )
 
 type task struct {
-	ID       int      `json:"id"`
-	Title    string   `json:"title"`
-	Desc     string   `json:"desc"`
-	IsDone   bool     `json:"isDone"`
-	Category category `json:"category"`
-	Owner    string   `json:"owner"`
-	Shared   []string `json:"shared"`
-	Order    int      `json:"order"`
+	ID         int        `json:"id"`
+	Title      string     `json:"title"`
+	Desc       string     `json:"desc"`
+	IsDone     bool       `json:"isDone"`
+	Category   category   `json:"category"`
+	Owner      string     `json:"owner"`
+	Shared     []string   `json:"shared"`
+	Order      int        `json:"order"`
+	DeletedAt  *time.Time `json:"deletedAt,omitempty"`
+	ArchivedAt *time.Time `json:"archivedAt,omitempty"`
 }
 
 type category struct {
-	ID           int    `json:"id"`
-	Cat_name     string `json:"cat_name"`
-	Color_header string `json:"color_header"`
-	Color_body   string `json:"color_body"`
+	ID           int        `json:"id"`
+	Cat_name     string     `json:"cat_name"`
+	Color_header string     `json:"color_header"`
+	Color_body   string     `json:"color_body"`
+	DeletedAt    *time.Time `json:"deletedAt,omitempty"`
+	IsDefault    bool       `json:"isDefault,omitempty"`
 }
 
+// Claims enthält den Benutzer eines JWT; die Sitzung gilt nur, solange UserID und Version zum gespeicherten Benutzer passen
 type Claims struct {
-	Name string `json:"name"`
+	Name    string `json:"name"`
+	UserID  int    `json:"uid,omitempty"`
+	Version int    `json:"ver,omitempty"`
 	jwt.RegisteredClaims
 }
 
 var jwtSecret = []byte("3F6C8DC3EEBB3987C95E87E15D629") // Key der Einfachheit halber hier statisch eingebettet
 
+var (
+	errTaskNotFound     = errors.New("Aufgabe konnte nicht gefunden werden")
+	errCategoryNotFound = errors.New("Kategorie konnte nicht gefunden werden")
+	errForbidden        = errors.New("Keine Berechtigung für diese Aktion")
+	errDefaultCategory  = errors.New("Die Standardkategorie kann nicht gelöscht werden")
+	errUserNotFound     = errors.New("Benutzer konnte nicht gefunden werden")
+	errBadCredentials   = errors.New("Die Anmeldedaten sind nicht korrekt")
+)
+
+// userIDSQL ermittelt die ID eines Benutzers über seinen Namen, alle Fremdschlüssel auf Benutzer verweisen auf users(id)
+// erwartet als Parameter den Namen des Benutzers
+const userIDSQL = `(SELECT id FROM users WHERE name = ?)`
+
+// userNameSQL liefert den Namen des Benutzers, auf den eine Spalte mit seiner ID verweist
+//
+// Parameter:
+//   - column: Die Spalte mit der ID des Benutzers, z.B. t.user_id
+//
+// Rückgabewert:
+//   - string: Die Unterabfrage, die den Namen liefert
+func userNameSQL(column string) string {
+	return `(SELECT name FROM users WHERE id = ` + column + `)`
+}
+
+// ownCategorySQL wählt die angegebene Kategorie, sofern sie dem Benutzer gehört und nicht gelöscht ist, sonst seine Standardkategorie
+// erwartet als Parameter die ID der Kategorie und zweimal den Namen des Benutzers
+const ownCategorySQL = `COALESCE((SELECT id FROM categories WHERE id = ? AND user_id = ` + userIDSQL + ` AND deleted_at IS NULL),
+	(SELECT default_category_id FROM users WHERE name = ?))`
+
 // generateJWT erstellt ein Token für den anfragenden Benutzer
 //
 // Parameter:
-//   - user: Der Name des anfragenden Benutzers
+//   - user: Der anfragende Benutzer mit seiner ID und der aktuellen Sitzungsversion
 //
 // Rückgabewert:
 //   - tokenString: Der erstellte und signierte String des token; "", falls ein Fehler auftritt
 //   - error: Ein Fehler, falls die Erstellung des Token nicht funktioniert hat; "nil", falls kein Fehler auftritt
-func generateJWT(name string) (string, error) {
+func generateJWT(user *account) (string, error) {
 	claims := &Claims{
-		Name: name,
+		Name:    user.Name,
+		UserID:  user.ID,
+		Version: user.TokenVersion,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour * 1)),
 		},
@@ -70,11 +109,13 @@ func generateJWT(name string) (string, error) {
 }
 
 // jwtMiddleware prüft vor dem Aufruf jeder der geschützten http-Routen, ob der anfragende Benutzer ein gültiges Token besitzt
+// der Name des Benutzers wird über die ID im JWT geladen, sodass ein Token nach einer Umbenennung gültig bleibt
+// akzeptiert werden ein JWT aus HandleLogInUser und persönliche Zugriffstoken, deren Bereiche die Route erlauben
 // falls nicht, wird der Zugriff diese Route verweigert
 //
 // Rückgabewert:
 //   - c.Next: Eine Funktion, welche die nächste Methode auf dem Stack der aktuellen Route ausführt
-func jwtMiddleware() fiber.Handler {
+func (srv *server) jwtMiddleware() fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		tokenString := c.Get("Authorization")
 		if tokenString == "" {
@@ -86,6 +127,10 @@ func jwtMiddleware() fiber.Handler {
 		}
 		tokenString = strings.Replace(tokenString, "Bearer ", "", 1)
 
+		if strings.HasPrefix(tokenString, accessTokenPrefix) {
+			return srv.authenticateAccessToken(c, tokenString)
+		}
+
 		claims := &Claims{}
 
 		token, err := jwt.ParseWithClaims(tokenString, claims, func(t *jwt.Token) (interface{}, error) {
@@ -97,7 +142,11 @@ func jwtMiddleware() fiber.Handler {
 		}
 
 		if claims, ok := token.Claims.(*Claims); ok && token.Valid {
-			c.Locals("name", claims.Name)
+			name, err := srv.sessionUser(claims)
+			if err != nil {
+				return c.Status(401).JSON(fiber.Map{"error": "Ungültiges Token", "details": err.Error()})
+			}
+			c.Locals("name", name)
 		} else {
 			return c.Status(401).JSON(fiber.Map{"error": "Unauthorized"})
 		}
@@ -140,91 +189,64 @@ func NewCategory(catID int, catName, colorHeader, colorBody string) *category {
 	return &newCategory
 }
 
-// initTables initialisiert die Tabellen der Datenbank, falls diese noch nicht existieren
-func initTables() {
-	usersTable := `CREATE TABLE IF NOT EXISTS users (
-		name TEXT PRIMARY KEY,
-		password TEXT NOT NULL
-	);`
-
-	categoriesTable := `CREATE TABLE IF NOT EXISTS categories (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		cat_name TEXT NOT NULL,
-		color_header TEXT,
-		color_body TEXT,
-		user_name TEXT,
-		FOREIGN KEY (user_name) REFERENCES users(name)
-	);`
-
-	tasksTable := `CREATE TABLE IF NOT EXISTS tasks (
-        id INTEGER PRIMARY KEY AUTOINCREMENT,
-        title TEXT NOT NULL,
-        desc TEXT,
-		isDone BOOL,
-		category_id INTEGER,
-        user_name TEXT,
-		FOREIGN KEY (category_id) REFERENCES categories(id),
-        FOREIGN KEY (user_name) REFERENCES users(name)
-    );`
-
-	sharedTable := `CREATE TABLE IF NOT EXISTS sharing (
-	task_id INTEGER,
-	target_name TEXT,
-	PRIMARY KEY(target_name, task_id),
-	FOREIGN KEY (target_name) REFERENCES users(name),
-	FOREIGN KEY (task_id) REFERENCES tasks(id)
-	)`
-
-	orderTable := `CREATE TABLE IF NOT EXISTS task_order (
-	user_name TEXT,
-	task_id INTEGER,
-	order_id INTEGER,
-	PRIMARY KEY(user_name, task_id),
-	FOREIGN KEY (user_name) REFERENCES users(name),
-	FOREIGN KEY (task_id) REFERENCES tasks(id)
-	)`
-
-	_, err := db.Exec(usersTable)
-	if err != nil {
-		log.Fatal(err)
-	}
-	_, err = db.Exec(categoriesTable)
-	if err != nil {
-		log.Fatal(err)
-	}
-	_, err = db.Exec(tasksTable)
+// AddUser fügt eine neuen Benutzer mit angegebenem Benutznamen und Passwort in die Datenbank ein
+// für jeden neuen Benutzer wird außerdem die Standardkategorie "default" angelegt und am Benutzer hinterlegt
+//
+// Parameter:
+//   - name: Der Name des neuen Benutzers (jeder Benutzername kann nur einmal vergeben werden)
+//   - password: Das festgelegte Passwort für diesen Benutzer
+//
+// Rückgabewert:
+//   - error: Ein Fehler, falls der Benutzer bereits existiert oder ein Fehler beim Anlegen der Standardkategorie auftritt
+//     Git "nil" zurück, wenn die Operation erfolgreich ausgeführt wurde
+func (s *sqlStore) AddUser(name, password string) error {
+	tx, err := s.db.Begin()
 	if err != nil {
-		log.Fatal(err)
+		fmt.Println(err)
+		return err
 	}
-	_, err = db.Exec(sharedTable)
+
+	err = insertUser(tx, name, password)
 	if err != nil {
-		log.Fatal(err)
+		tx.Rollback()
+		return err
 	}
-	_, err = db.Exec(orderTable)
+
+	err = tx.Commit()
 	if err != nil {
-		log.Fatal(err)
+		tx.Rollback()
+		fmt.Println(err)
+		return err
 	}
+	return nil
 }
 
-// addNewUser fügt eine neuen Benutzer mit angegebenem Benutznamen und Passwort in die Datenbank ein
-// für jeden neuen Benutzer wird außerdem die Standardkategorie "default" angelegt
+// insertUser legt innerhalb einer Transaktion einen neuen Benutzer mit seiner Standardkategorie "default" an
 //
 // Parameter:
-//   - name: Der Name des neuen Benutzers (jeder Benutzername kann nur einmal vergeben werden)
-//   - password: Das festgelegte Passwort für diesen Benutzer
+//   - tx: Die laufende Transaktion
+//   - name: Der Name des neuen Benutzers
+//   - password: Das festgelegte Passwort für diesen Benutzer, gespeichert wird nur sein Hash
 //
 // Rückgabewert:
-//   - error: Ein Fehler, falls der Benutzer bereits existiert oder ein Fehler beim Anlegen der Standardkategorie auftritt
-//     Git "nil" zurück, wenn die Operation erfolgreich ausgeführt wurde
-func addNewUser(name, password string) error {
+//   - error: errPasswordTooLong, falls das Passwort zu lang ist; ein Fehler, falls der Benutzer bereits existiert oder ein Fehler beim Anlegen der Standardkategorie auftritt; "nil", falls nicht
+func insertUser(tx *sqlTx, name, password string) error {
+	hash, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
 	query := `INSERT INTO users (name, password) VALUES (?,?)`
-	_, err := db.Exec(query, name, password)
+	_, err = tx.Exec(query, name, hash)
 	if err != nil {
 		fmt.Println(err)
 		return errors.New("Benutzer existiert bereits")
 	}
-	query = `INSERT INTO categories (cat_name, color_header, color_body, user_name) VALUES (?,?,?,?)`
-	_, err = db.Exec(query, "default", "#00a4ba", "#00ceea", name)
+	query = `INSERT INTO categories (cat_name, color_header, color_body, user_id) VALUES (?,?,?,` + userIDSQL + `) RETURNING id`
+	var categoryID int
+	err = tx.QueryRow(query, "default", "#00a4ba", "#00ceea", name).Scan(&categoryID)
+	if err == nil {
+		_, err = tx.Exec(`UPDATE users SET default_category_id = ? WHERE name = ?`, categoryID, name)
+	}
 	if err != nil {
 		fmt.Println(err)
 		return errors.New("Kategorie default konnte nicht angelegt werden")
@@ -244,193 +266,183 @@ func addNewUser(name, password string) error {
 //   - tasks: Die für diesen Benutzer bereits vorhandenen Aufgaben, falls der Login erfolgreich war; "nil", falls Login nicht erfolgreich oder Fehler beim Laden
 //   - categories: Die für diesen Benutzer bereits angelegten Kategorien, falls der Login erfolgreich war; "nil", falls nicht erfolgreich oder Fehler beim Laden
 //   - error: Ein Fehler, falls der Login nicht erfolgreich war oder beim Laden der Aufgaben bzw. Kategorien ein Fehler aufgetreten ist; "nil", falls kein Fehler auftritt
-func loginUser(inputName, inputPassword string) (token string, tasks []task, categories []category, err error) {
-	query := `SELECT name, password FROM users WHERE name=?`
-	user, err := db.Query(query, inputName)
+func (srv *server) loginUser(inputName, inputPassword string) (token string, tasks []task, categories []category, err error) {
+	err = srv.store.CheckPassword(inputName, inputPassword)
+	if errors.Is(err, errUserNotFound) {
+		return "", nil, nil, errBadCredentials
+	}
 	if err != nil {
 		return "", nil, nil, err
 	}
-	defer user.Close()
 
-	for user.Next() {
-		var name, password string
-		err = user.Scan(&name, &password)
-		if err == nil && password == inputPassword {
-			token, err := generateJWT(name)
-			if err != nil {
-				return "", nil, nil, err
-			}
-			tasks := getTasksForUser(name)
-			if tasks == nil {
-				return "", nil, nil, errors.New("Fehler beim Laden der Tasks")
-			}
-			categories := getCategoriesForUser(name)
-			if categories == nil {
-				return "", nil, nil, errors.New("Fehler beim Laden der Kategorien")
-			}
-			return token, tasks, categories, nil
-		}
+	enabled, err := srv.totpEnabled(inputName)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	if enabled {
+		return "", nil, nil, errTOTPRequired
 	}
+	return srv.startSession(inputName)
+}
 
-	return "", nil, nil, errors.New("Die Anmeldedaten sind nicht korrekt")
+// startSession erstellt nach einer erfolgreichen Anmeldung ein neues token und lädt die Aufgaben und Kategorien des Benutzers
+//
+// Parameter:
+//   - name: Der Name des angemeldeten Benutzers
+//
+// Rückgabewert:
+//   - token: Das für diesen Benutzer generierte token; "", falls ein Fehler auftritt
+//   - tasks: Die für diesen Benutzer vorhandenen Aufgaben; "nil", falls ein Fehler auftritt
+//   - categories: Die für diesen Benutzer angelegten Kategorien; "nil", falls ein Fehler auftritt
+//   - error: Ein Fehler, falls beim Laden ein Fehler auftritt; "nil", falls nicht
+func (srv *server) startSession(name string) (token string, tasks []task, categories []category, err error) {
+	user, err := srv.store.GetAccount(name)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	token, err = generateJWT(user)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	tasks, err = srv.store.GetTasksForUser(name)
+	if err != nil {
+		fmt.Println(err)
+		return "", nil, nil, errors.New("Fehler beim Laden der Tasks")
+	}
+	categories, err = srv.store.GetCategoriesForUser(name)
+	if err != nil {
+		fmt.Println(err)
+		return "", nil, nil, errors.New("Fehler beim Laden der Kategorien")
+	}
+	return token, tasks, categories, nil
 }
 
-// addTask führt eine Transaktion in der Datenbank aus, um eine neue Aufgabe mit Titel, Beschreibung und Kategorie hinzuzufügen
-// Außerdem wird für die Aufgabe eine neue Nummer in der Tabelle task_order zur Speicherung der Reihenfolge der Aufgaben angelegt. Initial wird eine neue Aufgabe ganz zuletzt angezeigt
+// AddTask führt eine Transaktion in der Datenbank aus, um eine neue Aufgabe mit Titel, Beschreibung und Kategorie hinzuzufügen
+// Außerdem wird für die Aufgabe ein neuer Rangschlüssel in der Tabelle task_order zur Speicherung der Reihenfolge der Aufgaben angelegt. Initial wird eine neue Aufgabe ganz zuletzt angezeigt
 //
 // Parameter:
 //   - name: Der Name des Benutzers, welcher eine neue Aufgabe erstellen möchte
 //   - title: Der Titel der neuen Aufgabe
 //	 - desc: Die Beschreibung der neuen Aufgabe
-//	 - category: Die Kategorie, welcher die neue Aufgabe zugeteilt wird
+//	 - category: Die Kategorie, welcher die neue Aufgabe zugeteilt wird; gehört sie nicht dem Benutzer, wird seine Standardkategorie verwendet
 //
 // Rückgabewert:
 //   - addedTaskID: Gibt die von der Datenbank erstellte ID der neuen Aufgabe zurück
 //	 Gibt 0 zurück, wenn bei der Erstellung ein Fehler aufgetreten ist
+//   - error: Ein Fehler, falls bei der Transaktion ein Fehler auftritt; "nil", falls nicht
 
-func addTask(name string, title string, desc string, category category, order int) int {
-	taskQuery := `INSERT INTO tasks (title, desc, isDone, category_id, user_name) VALUES (?,?,?,?,?)`
-	orderQuery := `INSERT INTO task_order (user_name, task_id, order_id) VALUES (?,?,?)`
+func (s *sqlStore) AddTask(name string, title string, desc string, category category) (int, error) {
+	taskQuery := `INSERT INTO tasks (title, "desc", isDone, category_id, user_id, created_at) VALUES (?,?,?,` + ownCategorySQL + `,` + userIDSQL + `,?) RETURNING id`
+	orderQuery := `INSERT INTO task_order (user_id, task_id, rank_key) VALUES (` + userIDSQL + `,?,?)`
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		tx.Rollback()
+		fmt.Println(err)
+		return 0, err
+	}
 
-	tx, err := db.Begin()
+	var addedTaskID int
+	err = tx.QueryRow(taskQuery, title, desc, false, category.ID, name, name, name, time.Now().Unix()).Scan(&addedTaskID)
 	if err != nil {
 		tx.Rollback()
 		fmt.Println(err)
-		return 0
+		return 0, err
 	}
 
-	newTask, err := tx.Exec(taskQuery, title, desc, false, category.ID, name)
+	rankKey, err := lastRankForUser(tx, name)
 	if err != nil {
 		tx.Rollback()
 		fmt.Println(err)
-		return 0
+		return 0, err
 	}
-	addedTaskID, _ := newTask.LastInsertId()
 
-	_, err = tx.Exec(orderQuery, name, addedTaskID, order)
+	_, err = tx.Exec(orderQuery, name, addedTaskID, rankBetween(rankKey, ""))
 	if err != nil {
 		tx.Rollback()
 		fmt.Println(err)
-		return 0
+		return 0, err
+	}
+
+	err = insertWebhookDeliveries(tx, webhookEvent{Type: webhookTaskCreated, Actor: name, TaskID: addedTaskID})
+	if err != nil {
+		tx.Rollback()
+		fmt.Println(err)
+		return 0, err
 	}
 
 	err = tx.Commit()
 	if err != nil {
 		tx.Rollback()
 		fmt.Println(err)
-		return 0
+		return 0, err
 	}
 
-	return int(addedTaskID)
+	return int(addedTaskID), nil
 }
 
-// deleteTask führt eine Transaktion in der Datenbank aus, um eine gewünschte Aufgabe zu löschen
-// dazu wird außerdem geprüft, ob die Aufgabe mit anderen Benutzern geteilt wird und diese benachrichtigt werden müssen
-// weiterhin muss ggf die Reihenfolge der Tasks angepasst werden, damit keine Lücken entstehen
+// DeleteTask führt eine Transaktion in der Datenbank aus, um eine gewünschte Aufgabe in den Papierkorb zu verschieben
+// die Aufgabe wird dabei nur als gelöscht markiert, Freigaben und Einträge in task_order bleiben für eine spätere Wiederherstellung erhalten
 //
 // Parameter:
 //   - name: Der Name des Benutzers, der eine Aufgabe löschen möchte
-//   - taskID: Die Kategorie, welcher die neue Aufgabe zugeteilt wird
+//   - taskID: Die ID der Aufgabe, die gelöscht werden soll
 //
 // Rückgabewert:
+//   - removedFrom: Die Zielbenutzer, bei denen die Aufgabe bisher angezeigt wurde und die benachrichtigt werden müssen
 //   - error: Gibt einen Fehler zurück, wenn im Löschvorgang ein Fehler auftritt
-//     Gibt "nil" zurück, wenn bei der Erstellung kein Fehler aufgetreten ist
-func deleteTask(name string, taskID int) error {
-	existQuery := `SELECT EXISTS(SELECT 1 FROM sharing WHERE task_id = ?)`
-	sharingQuery := `DELETE FROM sharing WHERE task_id = ?`
-	taskQuery := `DELETE FROM tasks WHERE id = ? AND user_name = ?`
-	removeOrderQuery := `DELETE FROM task_order WHERE task_id = ? AND user_name = ?`
-	getOrderQuery := `SELECT order_id FROM task_order WHERE task_id = ?`
-	updateOrderQuery := `UPDATE task_order SET order_id = order_id - 1 WHERE user_name = ? AND order_id > ?`
-	var exists bool
-	var taskOrder int
-
-	tx, err := db.Begin()
+//     errTaskNotFound, falls die Aufgabe nicht existiert, bereits gelöscht ist oder nicht dem Benutzer gehört
+//     Gibt "nil" zurück, wenn beim Löschen kein Fehler aufgetreten ist
+func (s *sqlStore) DeleteTask(name string, taskID int) (removedFrom []string, err error) {
+	activeQuery := `SELECT archived_at IS NULL FROM tasks WHERE id = ? AND user_id = ` + userIDSQL + ` AND deleted_at IS NULL`
+	taskQuery := `UPDATE tasks SET deleted_at = ? WHERE id = ?`
+	var active bool
+
+	targets, err := s.GetSharedUsersForTask(taskID)
 	if err != nil {
-		tx.Rollback()
-		return err
+		return nil, err
 	}
 
-	err = tx.QueryRow(getOrderQuery, taskID).Scan(&taskOrder)
+	tx, err := s.db.Begin()
 	if err != nil {
-		tx.Rollback()
-		fmt.Println(err)
-		return err
+		return nil, err
 	}
 
-	err = tx.QueryRow(existQuery, taskID).Scan(&exists)
+	err = tx.QueryRow(activeQuery, taskID, name).Scan(&active)
 	if err != nil {
 		tx.Rollback()
-		return err
-	}
-
-	if exists {
-		targetQuery := `SELECT target_name FROM sharing WHERE task_id = ?`
-		targetRows, err := tx.Query(targetQuery, taskID)
-		if err != nil {
-			tx.Rollback()
-			fmt.Println(err)
-			return err
-		}
-		defer targetRows.Close()
-
-		var targetName string
-		for targetRows.Next() {
-			err = targetRows.Scan(&targetName)
-			if err != nil {
-				fmt.Println(err)
-				continue
-			}
-			message, err := json.Marshal(taskID)
-			if err != nil {
-				tx.Rollback()
-				fmt.Println(err)
-				return err
-			}
-			mu.Lock()
-			if conn, ok := clients[targetName]; ok {
-				if err := conn.WriteMessage(websocket.TextMessage, message); err != nil {
-					tx.Rollback()
-					fmt.Println(err)
-					return err
-				}
-			}
-			mu.Unlock()
-		}
-		_, err = tx.Exec(sharingQuery, taskID)
-		if err != nil {
-			tx.Rollback()
-			return err
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errTaskNotFound
 		}
-
-	}
-	_, err = tx.Exec(taskQuery, taskID, name)
-	if err != nil {
-		tx.Rollback()
-		return err
+		return nil, err
 	}
 
-	_, err = tx.Exec(removeOrderQuery, taskID, name)
+	_, err = tx.Exec(taskQuery, time.Now().Unix(), taskID)
 	if err != nil {
 		tx.Rollback()
-		return err
+		return nil, err
 	}
 
-	_, err = tx.Exec(updateOrderQuery, name, taskOrder)
+	err = insertWebhookDeliveries(tx, webhookEvent{Type: webhookTaskDeleted, Actor: name, TaskID: taskID})
 	if err != nil {
 		tx.Rollback()
-		return err
+		return nil, err
 	}
 
 	err = tx.Commit()
 	if err != nil {
 		tx.Rollback()
-		return err
+		return nil, err
 	}
-	return nil
+
+	// archivierte Aufgaben wurden bei den Zielbenutzern bereits entfernt
+	if !active {
+		return []string{}, nil
+	}
+	return targets, nil
 }
 
-// updateTask führt eine Transaktion in der Datenbank aus, um eine gewünschte Aufgabe zu aktualisieren
+// UpdateTask führt eine Transaktion in der Datenbank aus, um eine gewünschte Aufgabe zu aktualisieren
 // dazu wird außerdem geprüft, ob die Aufgabe mit anderen Benutzern geteilt wird und diese benachrichtigt werden müssen
 //
 // Parameter:
@@ -438,63 +450,92 @@ func deleteTask(name string, taskID int) error {
 //   - changedTask: Die Aufgabe, mit den aktualisierten Attributen
 //
 // Rückgabewert:
+//   - shared: "true", falls die Aufgabe mit anderen Benutzern geteilt ist
 //   - error: Gibt einen Fehler zurück, wenn bei der Aktualisierung ein Fehler auftritt
+//     errTaskNotFound, falls die Aufgabe nicht existiert, gelöscht ist oder dem Benutzer weder gehört noch für ihn freigegeben ist
 //     Gibt "nil" zurück, wenn bei der Erstellung kein Fehler aufgetreten ist
-func updateTask(name string, changedTask task) error {
+func (s *sqlStore) UpdateTask(name string, changedTask task) (shared bool, err error) {
 	var changeQuery string
+	doneQuery := `SELECT COALESCE(isDone, FALSE) FROM tasks WHERE id = ?`
 	existQuery := `SELECT EXISTS(SELECT 1 FROM sharing WHERE task_id = ?)`
-	var exists bool
+	var wasDone, exists bool
+	var result sql.Result
 
-	tx, err := db.Begin()
+	tx, err := s.db.Begin()
 	if err != nil {
 		tx.Rollback()
 		fmt.Println(err)
-		return err
+		return false, err
+	}
+
+	err = tx.QueryRow(doneQuery, changedTask.ID).Scan(&wasDone)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		tx.Rollback()
+		fmt.Println(err)
+		return false, err
 	}
 
 	if changedTask.Owner == name {
-		changeQuery = `UPDATE tasks SET title = ?, desc = ?, isDone = ?, category_id = ? WHERE id = ? AND user_name = ?`
-		_, err = tx.Exec(changeQuery, changedTask.Title, changedTask.Desc, changedTask.IsDone, changedTask.Category.ID, changedTask.ID, changedTask.Owner)
+		changeQuery = `UPDATE tasks SET title = ?, "desc" = ?, isDone = ?, done_at = CASE WHEN ? THEN COALESCE(done_at, ?) END, category_id = ` + ownCategorySQL + `, trashed_category_id = NULL
+		WHERE id = ? AND user_id = ` + userIDSQL + ` AND deleted_at IS NULL`
+		result, err = tx.Exec(changeQuery, changedTask.Title, changedTask.Desc, changedTask.IsDone, changedTask.IsDone, time.Now().Unix(),
+			changedTask.Category.ID, name, name, changedTask.ID, changedTask.Owner)
 		if err != nil {
 			tx.Rollback()
 			fmt.Println(err)
-			return err
+			return false, err
 		}
 	} else {
-		changeQuery = `UPDATE tasks SET isDone = ? WHERE id = ?`
-		_, err = tx.Exec(changeQuery, changedTask.IsDone, changedTask.ID)
+		changeQuery = `UPDATE tasks SET isDone = ?, done_at = CASE WHEN ? THEN COALESCE(done_at, ?) END WHERE id = ? AND deleted_at IS NULL
+		AND EXISTS(SELECT 1 FROM sharing WHERE sharing.task_id = tasks.id AND sharing.target_id = ` + userIDSQL + `)`
+		result, err = tx.Exec(changeQuery, changedTask.IsDone, changedTask.IsDone, time.Now().Unix(), changedTask.ID, name)
 		if err != nil {
 			tx.Rollback()
 			fmt.Println(err)
-			return err
+			return false, err
 		}
 	}
 
+	// wurde keine Zeile geändert, gehört die Aufgabe dem Benutzer nicht, ist nicht für ihn freigegeben oder gelöscht
+	affected, err := result.RowsAffected()
+	if err != nil {
+		tx.Rollback()
+		fmt.Println(err)
+		return false, err
+	}
+	if affected == 0 {
+		tx.Rollback()
+		return false, errTaskNotFound
+	}
+
+	err = insertWebhookDeliveries(tx, webhookEvent{Type: webhookTaskUpdated, Actor: name, TaskID: changedTask.ID})
+	if err == nil && changedTask.IsDone && !wasDone {
+		err = insertWebhookDeliveries(tx, webhookEvent{Type: webhookTaskCompleted, Actor: name, TaskID: changedTask.ID})
+	}
+	if err != nil {
+		tx.Rollback()
+		fmt.Println(err)
+		return false, err
+	}
+
 	err = tx.QueryRow(existQuery, changedTask.ID).Scan(&exists)
 	if err != nil {
 		tx.Rollback()
 		fmt.Println(err)
-		return err
+		return false, err
 	}
 
 	err = tx.Commit()
 	if err != nil {
 		tx.Rollback()
 		fmt.Println(err)
-		return err
+		return false, err
 	}
 
-	if exists {
-		err = updateSharedTask(changedTask, name)
-		if err != nil {
-			fmt.Println(err)
-			return err
-		}
-	}
-	return nil
+	return exists, nil
 }
 
-// updateCategory aktualisiert eine gewünschte Kategorie
+// UpdateCategory aktualisiert eine gewünschte Kategorie
 //
 // Parameter:
 //   - name: Der Benutzer, welcher eine Kategorie ändert
@@ -506,19 +547,44 @@ func updateTask(name string, changedTask task) error {
 // Rückgabewert:
 //   - error: Gibt einen Fehler zurück, wenn bei der Aktualisierung ein Fehler auftritt
 //     Gibt "nil" zurück, wenn bei der Erstellung kein Fehler aufgetreten ist
-func updateCategory(name string, catID int, catName, colorHeader, colorBody string) error {
-	query := `UPDATE categories SET cat_name = ?, color_header = ?, color_body = ? WHERE id = ? AND user_name = ?`
-	_, err := db.Exec(query, catName, colorHeader, colorBody, catID, name)
+func (s *sqlStore) UpdateCategory(name string, catID int, catName, colorHeader, colorBody string) error {
+	query := `UPDATE categories SET cat_name = ?, color_header = ?, color_body = ? WHERE id = ? AND user_id = ` + userIDSQL
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		fmt.Println(err)
+		return err
+	}
+
+	result, err := tx.Exec(query, catName, colorHeader, colorBody, catID, name)
+	if err != nil {
+		tx.Rollback()
+		fmt.Println(err)
+		return err
+	}
+
+	if affected, _ := result.RowsAffected(); affected > 0 {
+		err = insertWebhookDeliveries(tx, webhookEvent{Type: webhookCategoryChanged, Actor: name, CategoryID: catID, Action: "updated"})
+		if err != nil {
+			tx.Rollback()
+			fmt.Println(err)
+			return err
+		}
+	}
+
+	err = tx.Commit()
 	if err != nil {
+		tx.Rollback()
 		fmt.Println(err)
 		return err
 	}
 	return nil
 }
 
-// getTasksForUser gibt alle Aufgaben zurück, die einem Benutzer gehören bzw. die für ihn freigegeben sind
+// GetTasksForUser gibt alle Aufgaben zurück, die einem Benutzer gehören bzw. die für ihn freigegeben sind
+// gelöschte und archivierte Aufgaben werden nicht berücksichtigt
 // dabei wird gleichzeitig die Kategorie jeder Aufgabe abgerufen und die dazugehörigen Attribute mitgegeben
-// die Aufgabe werden nach ihrer gespeicherten Reihenfolge geordnet
+// die Aufgabe werden nach ihrem gespeicherten Rangschlüssel geordnet, order entspricht der Position in der Liste
 // ist der Benutzer gleichzeitig der Besitzer einer Aufgabe, werden weiterhin alle Benutzer mitgegeben, mit denen er die Aufgabe geteilt hat
 //
 // Parameter:
@@ -526,50 +592,53 @@ func updateCategory(name string, catID int, catName, colorHeader, colorBody stri
 //
 // Rückgabewert:
 //   - loadedTasks: Alle Aufgaben, die dem Benutzer zugeordnet werden; "nil", falls ein Fehler auftritt
-func getTasksForUser(name string) []task {
-	query := `SELECT t.id, t.title, t.desc, t.isDone, t.user_name, c.id AS category_id, c.cat_name, c.color_header, c.color_body, o.order_id 
+//   - error: Ein Fehler, falls beim Laden ein Fehler auftritt; "nil", falls nicht
+func (s *sqlStore) GetTasksForUser(name string) ([]task, error) {
+	query := `SELECT t.id, t.title, t.desc, t.isDone, ` + userNameSQL("t.user_id") + `, c.id AS category_id, c.cat_name, c.color_header, c.color_body, o.rank_key
 	FROM tasks t
 	LEFT JOIN categories c ON t.category_id = c.id
-	LEFT JOIN task_order o ON t.id = o.task_id AND o.user_name = ?
-	WHERE t.user_name = ?
+	LEFT JOIN task_order o ON t.id = o.task_id AND o.user_id = ` + userIDSQL + ` AND o.view_key = ''
+	WHERE t.user_id = ` + userIDSQL + ` AND t.deleted_at IS NULL AND t.archived_at IS NULL
 
 	UNION
 
-	SELECT t.id, t.title, t.desc, t.isDone, t.user_name, c.id AS category_id, c.cat_name, c.color_header, c.color_body, o.order_id 
+	SELECT t.id, t.title, t.desc, t.isDone, ` + userNameSQL("t.user_id") + `, c.id AS category_id, c.cat_name, c.color_header, c.color_body, o.rank_key
 	FROM tasks t
 	LEFT JOIN categories c ON t.category_id = c.id
-	LEFT JOIN task_order o ON t.id = o.task_id AND o.user_name = ?
+	LEFT JOIN task_order o ON t.id = o.task_id AND o.user_id = ` + userIDSQL + ` AND o.view_key = ''
 	INNER JOIN sharing s ON t.id = s.task_id
-	WHERE s.target_name = ?
+	WHERE s.target_id = ` + userIDSQL + ` AND t.deleted_at IS NULL AND t.archived_at IS NULL
 	
-	ORDER BY o.order_id;`
+	ORDER BY rank_key;`
 
-	rows, err := db.Query(query, name, name, name, name)
+	rows, err := s.db.Query(query, name, name, name, name)
 	if err != nil {
 		fmt.Println(err)
-		return nil
+		return nil, err
 	}
 	defer rows.Close()
 
 	loadedTasks := []task{}
 	for rows.Next() {
-		var shared *[]string
-		var task_id, cat_id, order int
+		var shared []string
+		var task_id, cat_id int
 		var title, desc, cat_name, color_header, color_body, owner string
 		var isDone bool
+		var rankKey sql.NullString
 
-		err := rows.Scan(&task_id, &title, &desc, &isDone, &owner, &cat_id, &cat_name, &color_header, &color_body, &order)
+		err := rows.Scan(&task_id, &title, &desc, &isDone, &owner, &cat_id, &cat_name, &color_header, &color_body, &rankKey)
 		if err != nil {
 			fmt.Println(err)
-			return nil
+			return nil, err
 		}
+		order := len(loadedTasks)
 		if name == owner {
-			shared, err = getSharedUsersForTask(task_id)
+			shared, err = s.GetSharedUsersForTask(task_id)
 			if err != nil {
 				fmt.Println(err)
-				return nil
+				return nil, err
 			}
-			loadedTasks = append(loadedTasks, *NewTask(task_id, title, desc, isDone, *NewCategory(cat_id, cat_name, color_header, color_body), owner, *shared, order))
+			loadedTasks = append(loadedTasks, *NewTask(task_id, title, desc, isDone, *NewCategory(cat_id, cat_name, color_header, color_body), owner, shared, order))
 		} else {
 			loadedTasks = append(loadedTasks, *NewTask(task_id, title, desc, isDone, *NewCategory(cat_id, cat_name, color_header, color_body), owner, []string{}, order))
 		}
@@ -578,25 +647,91 @@ func getTasksForUser(name string) []task {
 
 	if err := rows.Err(); err != nil {
 		fmt.Println(err)
-		return nil
+		return nil, err
+	}
+
+	return loadedTasks, nil
+}
+
+// GetTaskForUser lädt eine einzelne Aufgabe so, wie sie für einen bestimmten Benutzer angezeigt wird
+// ist der Benutzer der Besitzer der Aufgabe, werden alle Benutzer mitgegeben, mit denen die Aufgabe geteilt ist
+//
+// Parameter:
+//   - name: Der Benutzer, für welchen die Aufgabe geladen werden soll
+//   - taskID: Die ID der Aufgabe
+//
+// Rückgabewert:
+//   - loadedTask: Ein Pointer auf die geladene Aufgabe; "nil", falls ein Fehler auftritt
+//   - error: errTaskNotFound, falls der Benutzer keinen Zugriff auf die Aufgabe hat; "nil", falls kein Fehler auftritt
+func (s *sqlStore) GetTaskForUser(name string, taskID int) (*task, error) {
+	return loadTaskForUser(s.db, name, taskID)
+}
+
+// loadTaskForUser lädt eine Aufgabe wie GetTaskForUser, wahlweise innerhalb einer Transaktion
+//
+// Parameter:
+//   - q: Die Datenbank oder die laufende Transaktion
+//   - name: Der Benutzer, für welchen die Aufgabe geladen werden soll
+//   - taskID: Die ID der Aufgabe
+//
+// Rückgabewert:
+//   - loadedTask: Ein Pointer auf die geladene Aufgabe; "nil", falls ein Fehler auftritt
+//   - error: errTaskNotFound, falls der Benutzer keinen Zugriff auf die Aufgabe hat; "nil", falls kein Fehler auftritt
+func loadTaskForUser(q sqlQueryer, name string, taskID int) (*task, error) {
+	query := `SELECT t.id, t.title, t.desc, t.isDone, ` + userNameSQL("t.user_id") + `, c.id AS category_id, c.cat_name, c.color_header, c.color_body, ` + orderPositionSQL + `
+	FROM tasks t
+	LEFT JOIN categories c ON t.category_id = c.id
+	LEFT JOIN task_order o ON t.id = o.task_id AND o.user_id = ` + userIDSQL + ` AND o.view_key = ''
+	WHERE t.id = ? AND t.deleted_at IS NULL AND (t.user_id = ` + userIDSQL + ` OR EXISTS(SELECT 1 FROM sharing s WHERE s.task_id = t.id AND s.target_id = ` + userIDSQL + `))`
+
+	var task_id, cat_id, order int
+	var title, desc, cat_name, color_header, color_body, owner string
+	var isDone bool
+
+	err := q.QueryRow(query, name, taskID, name, name).Scan(&task_id, &title, &desc, &isDone, &owner, &cat_id, &cat_name, &color_header, &color_body, &order)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errTaskNotFound
+		}
+		return nil, err
 	}
 
-	return loadedTasks
+	shared := []string{}
+	if name == owner {
+		shared, err = loadSharedUsersForTask(q, task_id)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return NewTask(task_id, title, desc, isDone, *NewCategory(cat_id, cat_name, color_header, color_body), owner, shared, order), nil
 }
 
-// getSharedUsersForTask bestimmt für eine geteilte Aufgabe alle Benutzer, für welche die Aufgabe freigegeben wurde
+// GetSharedUsersForTask bestimmt für eine geteilte Aufgabe alle Benutzer, für welche die Aufgabe freigegeben wurde
 //
 // Parameter:
 //   - taskID: Die ID der Aufgabe, für die nach den Benutzern gesucht werden soll
 //
 // Rückgabewert:
-//   - &shared: Ein Pointer auf die gefundenen Benutzer, für die die Aufgabe freigegeben ist; "nil", falls ein Fehler aufgetreten ist
+//   - shared: Die gefundenen Benutzer, für die die Aufgabe freigegeben ist; "nil", falls ein Fehler aufgetreten ist
 //   - error: Ein Fehler, falls bei der Ermittlung der Benutzer ein Fehler aufgetreten ist; "nil", falls nicht
-func getSharedUsersForTask(taskID int) (*[]string, error) {
-	sharedQuery := `SELECT target_name FROM sharing WHERE task_id = ?`
+func (s *sqlStore) GetSharedUsersForTask(taskID int) ([]string, error) {
+	return loadSharedUsersForTask(s.db, taskID)
+}
+
+// loadSharedUsersForTask bestimmt die Zielbenutzer einer Aufgabe wie GetSharedUsersForTask, wahlweise innerhalb einer Transaktion
+//
+// Parameter:
+//   - q: Die Datenbank oder die laufende Transaktion
+//   - taskID: Die ID der Aufgabe, für die nach den Benutzern gesucht werden soll
+//
+// Rückgabewert:
+//   - shared: Die gefundenen Benutzer, für die die Aufgabe freigegeben ist; "nil", falls ein Fehler aufgetreten ist
+//   - error: Ein Fehler, falls bei der Ermittlung der Benutzer ein Fehler aufgetreten ist; "nil", falls nicht
+func loadSharedUsersForTask(q sqlQueryer, taskID int) ([]string, error) {
+	sharedQuery := `SELECT u.name FROM sharing s INNER JOIN users u ON u.id = s.target_id WHERE s.task_id = ?`
 	shared := make([]string, 0)
 
-	sharedRows, err := db.Query(sharedQuery, taskID)
+	sharedRows, err := q.Query(sharedQuery, taskID)
 	if err != nil {
 		fmt.Println(err)
 		return nil, err
@@ -613,54 +748,47 @@ func getSharedUsersForTask(taskID int) (*[]string, error) {
 		}
 		shared = append(shared, targetName)
 	}
-	return &shared, nil
+	return shared, nil
 }
 
-// shareTask führt eine Transaktion in der Datenbank aus, wobei eine Aufgabe für einen bestimmten Benutzer freigegeben und dieser darüber benachrichtigt wird, indem die Aufgabe übermittelt wird
-// dabei wird zunächst geprüft, ob der Zielbenutzer existiert
+// ShareTask führt eine Transaktion in der Datenbank aus, wobei eine Aufgabe für einen bestimmten Benutzer freigegeben wird
+// dabei wird zunächst geprüft, ob die Aufgabe dem Benutzer gehört und nicht gelöscht ist und ob der Zielbenutzer existiert
 // weiterhin wird die freigegebene Aufgabe in die Reihenfolgetabelle des Zielbenutzers eingetragen
 //
 // Parameter:
-//   - sharedTask: Die Aufgabe, welche freigegeben werden soll
+//   - name: Der Name des Benutzers, der die Aufgabe freigeben möchte
+//   - taskID: Die ID der Aufgabe, welche freigegeben werden soll
 //   - target: Der Benutzername der Zielperson
 //
 // Rückgabewert:
 //   - error: Ein Fehler, falls bei der Freigabe ein Fehler aufgetreten ist; "nil", falls nicht
-func shareTask(sharedTask task, target string) error {
+//     errForbidden, falls die Aufgabe nicht existiert oder dem Benutzer nicht gehört; errUserNotFound, falls der Zielbenutzer nicht existiert
+func (s *sqlStore) ShareTask(name string, taskID int, target string) error {
+	ownerQuery := `SELECT EXISTS(SELECT 1 FROM tasks t WHERE t.id = ? AND t.user_id = ` + userIDSQL + ` AND t.deleted_at IS NULL)`
 	existQuery := `SELECT EXISTS(SELECT 1 FROM users WHERE name = ?)`
-	shareQuery := `INSERT INTO sharing (task_id, target_name) VALUES (?,?)`
-	orderQuery := `INSERT INTO task_order (user_name, task_id, order_id) VALUES (?,?,?)`
-	totalTaskQuery := `SELECT COUNT(*) AS total_tasks
-	FROM (
-		SELECT id
-		FROM tasks
-		WHERE user_name = ?
-
-		UNION
-
-		SELECT t.id
-		FROM tasks t
-		INNER JOIN sharing s ON t.id = s.task_id
-		WHERE s.target_name = ?
-	) AS combined_tasks;`
+	shareQuery := `INSERT INTO sharing (task_id, target_id) VALUES (?,` + userIDSQL + `)`
+	orderQuery := `INSERT INTO task_order (user_id, task_id, rank_key) VALUES (` + userIDSQL + `,?,?)`
 
-	var exists bool
-	var totalTasks int
+	var owned, exists bool
 
-	tx, err := db.Begin()
+	tx, err := s.db.Begin()
 	if err != nil {
-		tx.Rollback()
 		fmt.Println(err)
 		return err
 	}
 
-	err = tx.QueryRow(totalTaskQuery, target, target).Scan(&totalTasks)
+	err = tx.QueryRow(ownerQuery, taskID, name).Scan(&owned)
 	if err != nil {
 		tx.Rollback()
 		fmt.Println(err)
 		return err
 	}
 
+	if !owned {
+		tx.Rollback()
+		return errForbidden
+	}
+
 	err = tx.QueryRow(existQuery, target).Scan(&exists)
 	if err != nil {
 		tx.Rollback()
@@ -670,116 +798,182 @@ func shareTask(sharedTask task, target string) error {
 
 	if !exists {
 		tx.Rollback()
-		return errors.New("Benutzer konnte nicht gefunden werden")
+		return errUserNotFound
 	}
 
-	_, err = tx.Exec(shareQuery, sharedTask.ID, target)
+	_, err = tx.Exec(shareQuery, taskID, target)
 	if err != nil {
 		tx.Rollback()
 		fmt.Println(err)
 		return errors.New("Task bereits für diesen Benutzer freigegeben")
 	}
-	sharedTask.Order = totalTasks + 1
-	_, err = tx.Exec(orderQuery, target, sharedTask.ID, sharedTask.Order)
+	rankKey, err := lastRankForUser(tx, target)
 	if err != nil {
 		tx.Rollback()
 		fmt.Println(err)
 		return err
 	}
-
-	err = tx.Commit()
+	_, err = tx.Exec(orderQuery, target, taskID, rankBetween(rankKey, ""))
 	if err != nil {
 		tx.Rollback()
 		fmt.Println(err)
 		return err
 	}
-	message, err := json.Marshal(sharedTask)
+
+	err = insertWebhookDeliveries(tx, webhookEvent{Type: webhookTaskShared, Actor: name, TaskID: taskID, Target: target})
 	if err != nil {
+		tx.Rollback()
 		fmt.Println(err)
 		return err
 	}
-	mu.Lock()
-	if conn, ok := clients[target]; ok {
-		if err := conn.WriteMessage(websocket.TextMessage, message); err != nil {
-			fmt.Println(err)
-			return err
-		}
+
+	err = tx.Commit()
+	if err != nil {
+		tx.Rollback()
+		fmt.Println(err)
+		return err
 	}
-	mu.Unlock()
 	return nil
 }
 
-// removeSharingForUser führt eine Transaktion in der Datenbank aus, welche die Freigabe einer Aufgabe für einen bestimmten Benutzer aufhebt und diesen darüber benachrichtigt
-// dabei wird die Reihenfolge der Aufgaben für den betroffenen Benutzer angepasst
+// RemoveSharingForUser führt eine Transaktion in der Datenbank aus, welche die Freigabe einer Aufgabe für einen bestimmten Benutzer aufhebt
+// der Besitzer einer Aufgabe darf jede Freigabe beenden, ein Zielbenutzer nur seine eigene (Verlassen der Freigabe)
+// dabei wird die Aufgabe aus der Reihenfolge des betroffenen Benutzers entfernt
 //
 // Parameter:
+//   - name: Der Name des Benutzers, der die Freigabe beenden möchte
 //   - taskID: Die ID der Aufgabe, für die die Freigabe aufgehoben werden soll
 //   - target: Der Benutzername der Zielperson
 //
 // Rückgabewert:
+//   - owner: Der Besitzer der Aufgabe
 //   - error: Ein Fehler, falls bei der Aufhebung der Freigabe ein Fehler aufgetreten ist; "nil", falls nicht
-func removeSharingForUser(taskID int, target string) error {
-	removeShareQuery := `DELETE FROM sharing WHERE task_id = ? AND target_name = ?`
-	getOrderQuery := `SELECT order_id FROM task_order WHERE task_id = ?`
-	removeOrderQuery := `DELETE FROM task_order WHERE task_id = ? AND user_name = ?`
-	updateOrderQuery := `UPDATE task_order SET order_id = order_id - 1 WHERE user_name = ? AND order_id > ?`
-	var taskOrder int
+//     errTaskNotFound, falls Aufgabe oder Freigabe nicht existieren; errForbidden, falls der Benutzer nicht berechtigt ist
+func (s *sqlStore) RemoveSharingForUser(name string, taskID int, target string) (owner string, err error) {
+	ownerQuery := `SELECT ` + userNameSQL("user_id") + ` FROM tasks WHERE id = ?`
+	existQuery := `SELECT EXISTS(SELECT 1 FROM sharing WHERE task_id = ? AND target_id = ` + userIDSQL + `)`
+	removeShareQuery := `DELETE FROM sharing WHERE task_id = ? AND target_id = ` + userIDSQL
+	removeOrderQuery := `DELETE FROM task_order WHERE task_id = ? AND user_id = ` + userIDSQL
+	var exists bool
 
-	tx, err := db.Begin()
+	tx, err := s.db.Begin()
 	if err != nil {
-		tx.Rollback()
 		fmt.Println(err)
-		return err
+		return "", err
 	}
 
-	err = tx.QueryRow(getOrderQuery, taskID).Scan(&taskOrder)
+	err = tx.QueryRow(ownerQuery, taskID).Scan(&owner)
 	if err != nil {
 		tx.Rollback()
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", errTaskNotFound
+		}
 		fmt.Println(err)
-		return err
+		return "", err
 	}
 
-	_, err = tx.Exec(removeShareQuery, taskID, target)
+	if name != owner && name != target {
+		tx.Rollback()
+		return "", errForbidden
+	}
+
+	err = tx.QueryRow(existQuery, taskID, target).Scan(&exists)
 	if err != nil {
 		tx.Rollback()
 		fmt.Println(err)
-		return err
+		return "", err
 	}
 
-	_, err = tx.Exec(removeOrderQuery, taskID, target)
+	if !exists {
+		tx.Rollback()
+		return "", errTaskNotFound
+	}
+
+	_, err = tx.Exec(removeShareQuery, taskID, target)
 	if err != nil {
 		tx.Rollback()
-		return err
+		fmt.Println(err)
+		return "", err
 	}
 
-	_, err = tx.Exec(updateOrderQuery, target, taskOrder)
+	_, err = tx.Exec(removeOrderQuery, taskID, target)
 	if err != nil {
 		tx.Rollback()
-		return err
+		return "", err
 	}
+
 	err = tx.Commit()
 	if err != nil {
 		tx.Rollback()
 		fmt.Println(err)
-		return err
+		return "", err
 	}
-	message, err := json.Marshal(taskID)
+
+	return owner, nil
+}
+
+// notifyUser sendet eine Nachricht per WebSocket an einen Benutzer, falls dieser aktuell verbunden ist
+//
+// Parameter:
+//   - target: Der Name des Benutzers, welcher benachrichtigt werden soll
+//   - payload: Der Inhalt der Nachricht, welcher als JSON übermittelt wird (z.B. eine Aufgabe oder die ID einer entfernten Aufgabe)
+//
+// Rückgabewert:
+//   - error: Ein Fehler, falls die Nachricht nicht erstellt oder gesendet werden konnte; "nil", falls nicht
+func notifyUser(target string, payload interface{}) error {
+	message, err := json.Marshal(payload)
 	if err != nil {
-		fmt.Println(err)
 		return err
 	}
 	mu.Lock()
+	defer mu.Unlock()
 	if conn, ok := clients[target]; ok {
-		if err := conn.WriteMessage(websocket.TextMessage, message); err != nil {
+		return conn.WriteMessage(websocket.TextMessage, message)
+	}
+	return nil
+}
+
+// notifyTaskRemoved benachrichtigt alle übergebenen Zielbenutzer, dass eine Aufgabe aus ihrer Liste entfernt wurde
+// Fehler beim Senden werden nur protokolliert, da die Änderung in der Datenbank bereits abgeschlossen ist
+//
+// Parameter:
+//   - targets: Die Namen der Benutzer, die benachrichtigt werden sollen
+//   - taskID: Die ID der entfernten Aufgabe
+func notifyTaskRemoved(targets []string, taskID int) {
+	for _, target := range targets {
+		err := notifyUser(target, taskID)
+		if err != nil {
+			fmt.Println(err)
+		}
+	}
+}
+
+// notifyTaskAdded übermittelt eine (wieder) sichtbare Aufgabe an alle Zielbenutzer, mit denen sie geteilt ist
+// jeder Zielbenutzer erhält die Aufgabe so, wie sie für ihn geladen wird
+// Fehler beim Senden werden nur protokolliert, da die Änderung in der Datenbank bereits abgeschlossen ist
+//
+// Parameter:
+//   - taskID: Die ID der Aufgabe
+func (srv *server) notifyTaskAdded(taskID int) {
+	targets, err := srv.store.GetSharedUsersForTask(taskID)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	for _, target := range targets {
+		addedTask, err := srv.store.GetTaskForUser(target, taskID)
+		if err != nil {
+			fmt.Println(err)
+			continue
+		}
+		err = notifyUser(target, addedTask)
+		if err != nil {
 			fmt.Println(err)
-			return err
 		}
 	}
-	mu.Unlock()
-	return nil
 }
 
-// updateSharedTask benachrichtigt alle Benutzer über die Änderung einer für sie freigegebenen Aufgabe
+// notifySharedTaskChanged benachrichtigt alle Benutzer über die Änderung einer für sie freigegebenen Aufgabe
 // sorgt dafür, dass die Kommunikation auch von einem Benutzer zum Besitzer der Aufgabe funktioniert
 //
 // Parameter:
@@ -788,53 +982,27 @@ func removeSharingForUser(taskID int, target string) error {
 //
 // Rückgabewert:
 //   - error: Ein Fehler, falls bei der Benachrichtigung ein Fehler aufgetreten ist; "nil", falls nicht
-func updateSharedTask(task task, user string) error {
-	targetQuery := `SELECT target_name FROM sharing WHERE task_id = ?`
-
-	targetRows, err := db.Query(targetQuery, task.ID)
+func (srv *server) notifySharedTaskChanged(task task, user string) error {
+	targets, err := srv.store.GetSharedUsersForTask(task.ID)
 	if err != nil {
 		fmt.Println(err)
 		return err
 	}
-	defer targetRows.Close()
-
-	var targetName string
-
-	message, err := json.Marshal(task)
-	if err != nil {
-		fmt.Println(err)
-		return err
+	if task.Owner != user {
+		targets = append(targets, task.Owner)
 	}
-	for targetRows.Next() {
-		err = targetRows.Scan(&targetName)
+
+	for _, target := range targets {
+		err = notifyUser(target, task)
 		if err != nil {
 			fmt.Println(err)
-			continue
-		}
-		mu.Lock()
-		if conn, ok := clients[targetName]; ok {
-			if err := conn.WriteMessage(websocket.TextMessage, message); err != nil {
-				fmt.Println(err)
-				return err
-			}
-		}
-		mu.Unlock()
-	}
-	if task.Owner != user {
-		mu.Lock()
-		if conn, ok := clients[task.Owner]; ok {
-			if err := conn.WriteMessage(websocket.TextMessage, message); err != nil {
-				fmt.Println(err)
-				return err
-			}
+			return err
 		}
-		mu.Unlock()
 	}
-
 	return nil
 }
 
-// addCategory führt eine Transaktion in der Datenbank aus, um eine neue Kategorie für einen bestimmten Benutzer hinzuzufügen
+// AddCategory führt eine Transaktion in der Datenbank aus, um eine neue Kategorie für einen bestimmten Benutzer hinzuzufügen
 //
 // Parameter:
 //   - catName: Der Name der Kategorie
@@ -844,81 +1012,151 @@ func updateSharedTask(task task, user string) error {
 //
 // Rückgabewert:
 //   - addedCategoryID: Die von der Datenbank zurückgegebene ID der angelegten Kategorie; 0, falls ein Fehler aufgetreten ist
-func addCategory(catName, colorHeader, colorBody, name string) int {
-	query := `INSERT INTO categories (cat_name, color_header, color_body, user_name) VALUES (?,?,?,?)`
-	newCategory, err := db.Exec(query, catName, colorHeader, colorBody, name)
+//   - error: Ein Fehler, falls beim Anlegen ein Fehler auftritt; "nil", falls nicht
+func (s *sqlStore) AddCategory(catName, colorHeader, colorBody, name string) (int, error) {
+	query := `INSERT INTO categories (cat_name, color_header, color_body, user_id) VALUES (?,?,?,` + userIDSQL + `) RETURNING id`
+	var addedCategoryID int
+
+	tx, err := s.db.Begin()
 	if err != nil {
 		fmt.Println(err)
-		return 0
+		return 0, err
 	}
-	addedCategoryID, _ := newCategory.LastInsertId()
-	return int(addedCategoryID)
-}
-func deleteCategory(user_name string, id int) ([]task, error) {
-	taskQuery := `UPDATE tasks SET category_id = 1 WHERE category_id = ? AND user_name = ?`
-	categoryQuery := `DELETE FROM categories WHERE id = ? AND user_name = ?`
 
-	tx, err := db.Begin()
+	err = tx.QueryRow(query, catName, colorHeader, colorBody, name).Scan(&addedCategoryID)
 	if err != nil {
 		tx.Rollback()
 		fmt.Println(err)
-		return nil, err
+		return 0, err
 	}
 
-	_, err = tx.Exec(taskQuery, id, user_name)
+	err = insertWebhookDeliveries(tx, webhookEvent{Type: webhookCategoryChanged, Actor: name, CategoryID: addedCategoryID, Action: "created"})
 	if err != nil {
 		tx.Rollback()
 		fmt.Println(err)
-		return nil, err
+		return 0, err
 	}
 
-	_, err = tx.Exec(categoryQuery, id, user_name)
+	err = tx.Commit()
 	if err != nil {
 		tx.Rollback()
 		fmt.Println(err)
-		return nil, err
+		return 0, err
+	}
+	return addedCategoryID, nil
+}
+
+// DeleteCategory führt eine Transaktion in der Datenbank aus, um eine Kategorie in den Papierkorb zu verschieben
+// die Aufgaben dieser Kategorie werden der Standardkategorie des Benutzers zugeordnet, wobei die ursprüngliche Kategorie für eine Wiederherstellung gespeichert wird
+// die Standardkategorie selbst kann nicht gelöscht werden
+//
+// Parameter:
+//   - name: Der Name des Benutzers, der die Kategorie löschen möchte
+//   - id: Die ID der Kategorie
+//
+// Rückgabewert:
+//   - error: Ein Fehler, falls beim Löschen ein Fehler auftritt; errCategoryNotFound, falls die Kategorie dem Benutzer nicht gehört;
+//     errDefaultCategory, falls es sich um die Standardkategorie handelt; "nil", falls nicht
+func (s *sqlStore) DeleteCategory(name string, id int) error {
+	taskQuery := `UPDATE tasks SET category_id = (SELECT default_category_id FROM users WHERE name = ?), trashed_category_id = ?
+	WHERE category_id = ? AND user_id = ` + userIDSQL
+	categoryQuery := `UPDATE categories SET deleted_at = ? WHERE id = ? AND user_id = ` + userIDSQL + ` AND deleted_at IS NULL
+	AND id IS DISTINCT FROM (SELECT default_category_id FROM users WHERE name = ?)`
+	defaultQuery := `SELECT EXISTS(SELECT 1 FROM users WHERE name = ? AND default_category_id = ?)`
+	var isDefault bool
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		fmt.Println(err)
+		return err
+	}
+
+	result, err := tx.Exec(categoryQuery, time.Now().Unix(), id, name, name)
+	if err != nil {
+		tx.Rollback()
+		fmt.Println(err)
+		return err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		err = tx.QueryRow(defaultQuery, name, id).Scan(&isDefault)
+		tx.Rollback()
+		if err == nil && isDefault {
+			return errDefaultCategory
+		}
+		return errCategoryNotFound
+	}
+
+	_, err = tx.Exec(taskQuery, name, id, id, name)
+	if err != nil {
+		tx.Rollback()
+		fmt.Println(err)
+		return err
+	}
+	err = insertWebhookDeliveries(tx, webhookEvent{Type: webhookCategoryChanged, Actor: name, CategoryID: id, Action: "deleted"})
+	if err != nil {
+		tx.Rollback()
+		fmt.Println(err)
+		return err
 	}
 	err = tx.Commit()
 	if err != nil {
 		tx.Rollback()
 		fmt.Println(err)
-		return nil, err
+		return err
 	}
 
-	return getTasksForUser(user_name), nil
+	return nil
 }
 
-// getCategoriesForUser lädt alle Kategorien aus der Datenbank, die für den Benutzer bereits existieren
+// GetCategoriesForUser lädt alle Kategorien aus der Datenbank, die für den Benutzer bereits existieren
 //
 // Parameter:
 //   - name: Der Name des Benutzers, für welchen die Kategorien geladen werden sollen
 //
 // Rückgabewert:
 //   - loadedCategories: Die von der Datenbank gefundenen Kategorien für diesen Benutzer; "nil", falls ein Fehler auftritt
-func getCategoriesForUser(name string) []category {
-	query := `SELECT id, cat_name, color_header, color_body FROM categories WHERE user_name = ?`
-	rows, err := db.Query(query, name)
+//   - error: Ein Fehler, falls beim Laden ein Fehler auftritt; "nil", falls nicht
+func (s *sqlStore) GetCategoriesForUser(name string) ([]category, error) {
+	query := `SELECT c.id, c.cat_name, c.color_header, c.color_body, c.id IS NOT DISTINCT FROM u.default_category_id FROM categories c
+	INNER JOIN users u ON u.id = c.user_id
+	WHERE c.user_id = ` + userIDSQL + ` AND c.deleted_at IS NULL`
+	rows, err := s.db.Query(query, name)
 	if err != nil {
 		fmt.Println(err)
-		return nil
+		return nil, err
 	}
 	defer rows.Close()
 	loadedCategories := make([]category, 0)
 	for rows.Next() {
 		var id int
 		var cat_name, color_header, color_body string
-		err := rows.Scan(&id, &cat_name, &color_header, &color_body)
+		var isDefault bool
+		err := rows.Scan(&id, &cat_name, &color_header, &color_body, &isDefault)
 		if err != nil {
 			fmt.Println(err)
-			return nil
+			return nil, err
 		}
-		loadedCategories = append(loadedCategories, *NewCategory(id, cat_name, color_header, color_body))
+		loadedCategory := NewCategory(id, cat_name, color_header, color_body)
+		loadedCategory.IsDefault = isDefault
+		loadedCategories = append(loadedCategories, *loadedCategory)
 	}
-	return loadedCategories
+	return loadedCategories, rows.Err()
 }
 
-// updateOrder führt eine Transaktion in der Datenbank aus, um die Reihenfolge der Aufgaben für einen Benutzer zu aktualisieren
-// dabei werden zwei benachbarte Aufgaben getauscht
+// GetTaskIDsForCategory ermittelt alle Aufgaben, die einer Kategorie zugeordnet sind oder ihr vor dem Löschen der Kategorie zugeordnet waren
+//
+// Parameter:
+//   - catID: Die ID der Kategorie
+//
+// Rückgabewert:
+//   - taskIDs: Die IDs der gefundenen Aufgaben
+//   - error: Ein Fehler, falls bei der Abfrage ein Fehler auftritt; "nil", falls nicht
+func (s *sqlStore) GetTaskIDsForCategory(catID int) ([]int, error) {
+	return queryTaskIDs(s.db, `SELECT id FROM tasks WHERE category_id = ? OR trashed_category_id = ?`, catID, catID)
+}
+
+// UpdateOrder führt eine Transaktion in der Datenbank aus, um die Reihenfolge der Aufgaben für einen Benutzer zu aktualisieren
+// dabei werden die Rangschlüssel zweier benachbarter Aufgaben getauscht
 // Parameter:
 //   - name: Der Name des Benutzers, für welchen die Reihenfolge geändert werden soll
 //   - taskIDUp: Die ID der Aufgabe, die einen Platz nach unten rutschen soll
@@ -926,24 +1164,37 @@ func getCategoriesForUser(name string) []category {
 //
 // Rückgabewert:
 //   - error: Ein Fehler, falls bei der Transaktion ein Fehler auftritt; "nil", falls nicht
-func updateOrder(name string, taskIDUp, taskIDDown int) error {
-	queryOrderUp := `UPDATE task_order SET order_id = order_id + 1 WHERE user_name = ? AND task_id = ?`
-	queryOrderDown := `UPDATE task_order SET order_id = order_id - 1 WHERE user_name = ? AND task_id = ?`
+func (s *sqlStore) UpdateOrder(name string, taskIDUp, taskIDDown int) error {
+	rankQuery := `SELECT rank_key FROM task_order WHERE user_id = ` + userIDSQL + ` AND view_key = '' AND task_id = ?`
+	updateQuery := `UPDATE task_order SET rank_key = ? WHERE user_id = ` + userIDSQL + ` AND view_key = '' AND task_id = ?`
+	var rankUp, rankDown string
 
-	tx, err := db.Begin()
+	tx, err := s.db.Begin()
+	if err != nil {
+		fmt.Println(err)
+		return err
+	}
+	err = tx.QueryRow(rankQuery, name, taskIDUp).Scan(&rankUp)
+	if err != nil {
+		tx.Rollback()
+		fmt.Println(err)
+		return err
+	}
+	err = tx.QueryRow(rankQuery, name, taskIDDown).Scan(&rankDown)
 	if err != nil {
 		tx.Rollback()
 		fmt.Println(err)
 		return err
 	}
-	_, err = tx.Exec(queryOrderUp, name, taskIDUp)
+
+	_, err = tx.Exec(updateQuery, rankDown, name, taskIDUp)
 	if err != nil {
 		tx.Rollback()
 		fmt.Println(err)
 		return err
 	}
 
-	_, err = tx.Exec(queryOrderDown, name, taskIDDown)
+	_, err = tx.Exec(updateQuery, rankUp, name, taskIDDown)
 	if err != nil {
 		tx.Rollback()
 		fmt.Println(err)
@@ -959,14 +1210,14 @@ func updateOrder(name string, taskIDUp, taskIDDown int) error {
 	return nil
 }
 
-// HandleAddNewUser nimmt die mitgeschickten Parameter des Clients entgegen und ruft addNewUser damit auf, um einen neuen Benutzer anzulegen
+// HandleAddNewUser nimmt die mitgeschickten Parameter des Clients entgegen und ruft AddUser damit auf, um einen neuen Benutzer anzulegen
 //
 // Parameter:
 //   - c: Ein Pointer auf ein Context-Objekt von fiber
 //
 // Rückgabewert:
 //   - error: Ein Fehler, falls bei der Erstellung des Benutzers ein Fehler auftritt - wird an Client gesendet
-func HandleAddNewUser(c *fiber.Ctx) error {
+func (srv *server) HandleAddNewUser(c *fiber.Ctx) error {
 	type Credentials struct {
 		Name     string `json:"name"`
 		Password string `json:"password"`
@@ -979,7 +1230,10 @@ func HandleAddNewUser(c *fiber.Ctx) error {
 	}
 
 	if strings.TrimSpace(creds.Name) != "" && strings.TrimSpace(creds.Password) != "" {
-		err := addNewUser(creds.Name, creds.Password)
+		err := srv.store.AddUser(creds.Name, creds.Password)
+		if errors.Is(err, errPasswordTooLong) {
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
 		if err != nil {
 			fmt.Println(err)
 			return c.Status(400).JSON(fiber.Map{"error": "Dieser Benutzer existiert bereits"})
@@ -997,8 +1251,8 @@ func HandleAddNewUser(c *fiber.Ctx) error {
 //
 // Rückgabewert:
 //   - error: Ein Fehler, falls beim Login Benutzers ein Fehler auftritt - wird an Client gesendet
-//     Bei Erfolg werden token, Aufgaben und Kategorien an den Client gesendet
-func HandleLogInUser(c *fiber.Ctx) error {
+//     Bei Erfolg werden token, Aufgaben, Kategorien und intelligente Listen an den Client gesendet
+func (srv *server) HandleLogInUser(c *fiber.Ctx) error {
 	var err error
 	type Credentials struct {
 		Name     string `json:"name"`
@@ -1011,18 +1265,38 @@ func HandleLogInUser(c *fiber.Ctx) error {
 		return c.Status(400).JSON(fiber.Map{"error": "Ungültige Eingabedaten"})
 	}
 	if strings.TrimSpace(creds.Name) != "" && strings.TrimSpace(creds.Password) != "" {
-		token, tasks, categories, err := loginUser(creds.Name, creds.Password)
+		if throttled, err := srv.checkLoginThrottle(c, creds.Name); throttled {
+			return err
+		}
+		token, tasks, categories, err := srv.loginUser(creds.Name, creds.Password)
+		if errors.Is(err, errBadCredentials) {
+			srv.recordLoginFailure(c, creds.Name)
+		}
+		if errors.Is(err, errTOTPRequired) {
+			challenge, err := generateTOTPChallenge(creds.Name)
+			if err != nil {
+				fmt.Println(err)
+				return c.Status(400).JSON(fiber.Map{"error": "Anmeldung fehlgeschlagen"})
+			}
+			return c.Status(200).JSON(fiber.Map{"totpRequired": true, "challenge": challenge})
+		}
 		if err != nil {
 			fmt.Println(err)
 			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
 		}
-		return c.Status(200).JSON(fiber.Map{"token": token, "tasks": tasks, "categories": categories})
+		srv.clearLoginFailures(creds.Name)
+		smartLists, err := srv.store.GetSmartListsForUser(creds.Name)
+		if err != nil {
+			fmt.Println(err)
+			return c.Status(400).JSON(fiber.Map{"error": "Fehler beim Laden der Listen"})
+		}
+		return c.Status(200).JSON(fiber.Map{"token": token, "tasks": tasks, "categories": categories, "smartLists": smartLists})
 	} else {
 		return c.Status(400).JSON(fiber.Map{"error": "Benutzername und Passwort dürfen nicht leer sein"})
 	}
 }
 
-// HandleAddTask nimmt die mitgeschickten Parameter des Clients entgegen und ruft addTask damit auf, um eine neue Aufgabe anzulegen
+// HandleAddTask nimmt die mitgeschickten Parameter des Clients entgegen und ruft AddTask damit auf, um eine neue Aufgabe anzulegen
 //
 // Parameter:
 //   - c: Ein Pointer auf ein Context-Objekt von fiber
@@ -1030,13 +1304,12 @@ func HandleLogInUser(c *fiber.Ctx) error {
 // Rückgabewert:
 //   - error: Ein Fehler, falls bei der Erstellung des Benutzers ein Fehler auftritt - wird an Client gesendet
 //     Bei Erfolg wird die ID der neu erstellen Aufgabe an den Client gesendet
-func HandleAddTask(c *fiber.Ctx) error {
+func (srv *server) HandleAddTask(c *fiber.Ctx) error {
 	name := c.Locals("name").(string)
 	type TaskInput struct {
 		Title    string   `json:"title"`
 		Desc     string   `json:"desc"`
 		Category category `json:"category"`
-		Order    int      `json:"order"`
 	}
 
 	var input TaskInput
@@ -1045,24 +1318,27 @@ func HandleAddTask(c *fiber.Ctx) error {
 		return c.Status(400).JSON(fiber.Map{"error": "Ungültige Eingabedaten"})
 	}
 	if strings.TrimSpace(input.Title) != "" {
-		addedTaskID := addTask(name, input.Title, input.Desc, input.Category, input.Order)
-		if addedTaskID == 0 {
+		addedTaskID, err := srv.store.AddTask(name, input.Title, input.Desc, input.Category)
+		if err != nil {
+			fmt.Println(err)
 			return c.Status(400).JSON(fiber.Map{"error": "Aufgabe konnte nicht erstellt werden"})
 		}
+		srv.refreshSmartListsForTask(addedTaskID)
+		srv.wakeWebhookDelivery()
 		return c.Status(201).JSON(fiber.Map{"id": addedTaskID})
 	} else {
 		return c.Status(400).JSON(fiber.Map{"error": "Titel darf nicht leer sein"})
 	}
 }
 
-// HandleDeleteTask nimmt die mitgeschickten Parameter des Clients entgegen und ruft deleteTask damit auf, um eine Aufgabe zu löschen
+// HandleDeleteTask nimmt die mitgeschickten Parameter des Clients entgegen und ruft DeleteTask damit auf, um eine Aufgabe zu löschen
 //
 // Parameter:
 //   - c: Ein Pointer auf ein Context-Objekt von fiber
 //
 // Rückgabewert:
 //   - error: Ein Fehler, falls bei der Erstellung des Benutzers ein Fehler auftritt - wird an Client gesendet
-func HandleDeleteTask(c *fiber.Ctx) error {
+func (srv *server) HandleDeleteTask(c *fiber.Ctx) error {
 	id := c.Params("id")
 	name := c.Locals("name").(string)
 	if id != "" {
@@ -1071,21 +1347,31 @@ func HandleDeleteTask(c *fiber.Ctx) error {
 			fmt.Println(err)
 			return c.Status(400).JSON(fiber.Map{"error": "Fehler beim Löschen aufgetreten"})
 		}
-		deleteTask(name, i)
-		return c.Status(200).JSON(fiber.Map{"msg": "Aufgabe erfolgreich gelöscht"})
+		removedFrom, err := srv.store.DeleteTask(name, i)
+		if err != nil {
+			fmt.Println(err)
+			if errors.Is(err, errTaskNotFound) {
+				return c.Status(404).JSON(fiber.Map{"error": err.Error()})
+			}
+			return c.Status(400).JSON(fiber.Map{"error": "Fehler beim Löschen aufgetreten"})
+		}
+		notifyTaskRemoved(removedFrom, i)
+		srv.refreshSmartListsForTask(i)
+		srv.wakeWebhookDelivery()
+		return c.Status(200).JSON(fiber.Map{"msg": "Aufgabe in den Papierkorb verschoben"})
 	} else {
 		return c.Status(400).JSON(fiber.Map{"error": "Fehler beim Löschen aufgetreten"})
 	}
 }
 
-// HandleUpdateTask nimmt die mitgeschickten Parameter des Clients entgegen und ruft updateTask damit auf, um eine Aufgabe zu aktualisieren
+// HandleUpdateTask nimmt die mitgeschickten Parameter des Clients entgegen und ruft UpdateTask damit auf, um eine Aufgabe zu aktualisieren
 //
 // Parameter:
 //   - c: Ein Pointer auf ein Context-Objekt von fiber
 //
 // Rückgabewert:
 //   - error: Ein Fehler, falls bei der Erstellung des Benutzers ein Fehler auftritt - wird an Client gesendet
-func HandleUpdateTask(c *fiber.Ctx) error {
+func (srv *server) HandleUpdateTask(c *fiber.Ctx) error {
 	name := c.Locals("name").(string)
 	id := c.Params("id")
 	type TaskInput struct {
@@ -1106,66 +1392,86 @@ func HandleUpdateTask(c *fiber.Ctx) error {
 			fmt.Println(err)
 			return c.Status(400).JSON(fiber.Map{"error": "Ungültige Eingabedaten"})
 		}
-		err = updateTask(name, *NewTask(i, input.Title, input.Desc, input.IsDone, input.Category, input.Owner, []string{}, 0))
+		changedTask := NewTask(i, input.Title, input.Desc, input.IsDone, input.Category, input.Owner, []string{}, 0)
+		shared, err := srv.store.UpdateTask(name, *changedTask)
 		if err != nil {
 			fmt.Println(err)
+			if errors.Is(err, errTaskNotFound) {
+				return c.Status(404).JSON(fiber.Map{"error": "Aufgabe konnte nicht gefunden werden"})
+			}
 			return c.Status(400).JSON(fiber.Map{"error": "Aufgabe konnte nicht geändert werden"})
 		}
+		srv.refreshSmartListsForTask(i)
+		srv.wakeWebhookDelivery()
+		if shared {
+			err = srv.notifySharedTaskChanged(*changedTask, name)
+			if err != nil {
+				fmt.Println(err)
+				return c.Status(400).JSON(fiber.Map{"error": "Aufgabe konnte nicht geändert werden"})
+			}
+		}
 		return c.Status(200).JSON(fiber.Map{"msg": "Aufgabe erfolgreich geändert"})
 	} else {
 		return c.Status(400).JSON(fiber.Map{"error": "Titel darf nicht leer sein"})
 	}
 }
 
-// HandleShareTask nimmt die mitgeschickten Parameter des Clients entgegen und ruft shareTask damit auf, um eine Aufgabe mit einem anderen Benutzer zu teilen
+// HandleShareTask nimmt die mitgeschickten Parameter des Clients entgegen und ruft ShareTask damit auf, um eine Aufgabe mit einem anderen Benutzer zu teilen
+// der Zielbenutzer wird anschließend benachrichtigt, indem ihm die Aufgabe so übermittelt wird, wie sie für ihn geladen wird
 //
 // Parameter:
 //   - c: Ein Pointer auf ein Context-Objekt von fiber
 //
 // Rückgabewert:
 //   - error: Ein Fehler, falls bei der Erstellung des Benutzers ein Fehler auftritt - wird an Client gesendet
-func HandleShareTask(c *fiber.Ctx) error {
+//     Status 403, falls die Aufgabe dem Benutzer nicht gehört
+func (srv *server) HandleShareTask(c *fiber.Ctx) error {
 	name := c.Locals("name").(string)
 	id := c.Params("id")
 	target := c.Params("target")
 
-	type TaskInput struct {
-		Title    string   `json:"title"`
-		Desc     string   `json:"desc"`
-		IsDone   bool     `json:"isDone"`
-		Category category `json:"category"`
-		Owner    string   `json:"owner"`
-	}
-	var input TaskInput
-
 	if name != target && id != "" {
-		if err := c.BodyParser(&input); err != nil {
-			fmt.Println(err)
-			return c.Status(400).JSON(fiber.Map{"error": "Fehler beim Parsen"})
-		}
 		i, err := strconv.Atoi(id)
 		if err != nil {
 			fmt.Println(err)
 			return c.Status(400).JSON(fiber.Map{"error": "Fehler beim Konvertieren von ID"})
 		}
-		err = shareTask(*NewTask(i, input.Title, input.Desc, input.IsDone, input.Category, name, []string{}, 0), target)
+		err = srv.store.ShareTask(name, i, target)
 		if err != nil {
 			fmt.Println(err)
+			if errors.Is(err, errForbidden) {
+				return c.Status(403).JSON(fiber.Map{"error": err.Error()})
+			}
 			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
 		}
+		srv.refreshSmartListsForTask(i)
+		srv.wakeWebhookDelivery()
+
+		// die Freigabe ist bereits gespeichert, ein Fehler bei der Benachrichtigung wird daher nur protokolliert
+		sharedTask, err := srv.store.GetTaskForUser(target, i)
+		if err == nil {
+			err = notifyUser(target, sharedTask)
+		}
+		if err != nil {
+			fmt.Println(err)
+		}
 		return c.Status(201).JSON(fiber.Map{"msg": "Task erfolgreich freigegeben"})
 	}
 	return c.Status(400).JSON(fiber.Map{"error": "Besitzer und Zielperson dürfen nicht identisch sein"})
 }
 
-// HandleRemoveSharingForUser nimmt die mitgeschickten Parameter des Clients entgegen und ruft removeSharingForUser damit auf, um eine Freigabe mit einem Benutzer zu beenden
+// HandleRemoveSharingForUser nimmt die mitgeschickten Parameter des Clients entgegen und ruft RemoveSharingForUser damit auf, um eine Freigabe mit einem Benutzer zu beenden
+// der Besitzer kann die Freigabe für jeden Benutzer beenden, ein Zielbenutzer kann die Freigabe für sich selbst verlassen
+// der Zielbenutzer wird benachrichtigt; verlässt er die Freigabe selbst, erhält der Besitzer die aktualisierte Aufgabe
 //
 // Parameter:
 //   - c: Ein Pointer auf ein Context-Objekt von fiber
 //
 // Rückgabewert:
-//   - error: Ein Fehler, falls bei der Erstellung des Benutzers ein Fehler auftritt - wird an Client gesendet
-func HandleRemoveSharingForUser(c *fiber.Ctx) error {
+//   - error: Ein Fehler, falls beim Beenden der Freigabe ein Fehler auftritt - wird an Client gesendet
+//     Status 403, falls der Benutzer weder Besitzer noch Zielperson ist
+func (srv *server) HandleRemoveSharingForUser(c *fiber.Ctx) error {
+	name := c.Locals("name").(string)
 	id := c.Params("id")
 	target := c.Params("target")
 
@@ -1174,22 +1480,44 @@ func HandleRemoveSharingForUser(c *fiber.Ctx) error {
 		fmt.Println(err)
 		return c.Status(400).JSON(fiber.Map{"error": "Ungültige Eingabedaten"})
 	}
-	err = removeSharingForUser(i, target)
+	owner, err := srv.store.RemoveSharingForUser(name, i, target)
 	if err != nil {
 		fmt.Println(err)
+		if errors.Is(err, errForbidden) {
+			return c.Status(403).JSON(fiber.Map{"error": err.Error()})
+		}
+		if errors.Is(err, errTaskNotFound) {
+			return c.Status(404).JSON(fiber.Map{"error": "Freigabe konnte nicht gefunden werden"})
+		}
 		return c.Status(400).JSON(fiber.Map{"error": "Freigabe konnte nicht beendet werden"})
 	}
+	srv.refreshSmartListsForTask(i)
+
+	// die Freigabe ist bereits beendet, Fehler bei der Benachrichtigung werden daher nur protokolliert
+	err = notifyUser(target, i)
+	if err != nil {
+		fmt.Println(err)
+	}
+	if name != owner {
+		ownerTask, err := srv.store.GetTaskForUser(owner, i)
+		if err == nil {
+			err = notifyUser(owner, ownerTask)
+		}
+		if err != nil {
+			fmt.Println(err)
+		}
+	}
 	return c.Status(200).JSON(fiber.Map{"msg": "Freigabe erfolgreich beendet"})
 }
 
-// HandleUpdateCategory nimmt die mitgeschickten Parameter des Clients entgegen und ruft updateCategory damit auf, um eine Kategorie zu aktualisieren
+// HandleUpdateCategory nimmt die mitgeschickten Parameter des Clients entgegen und ruft UpdateCategory damit auf, um eine Kategorie zu aktualisieren
 //
 // Parameter:
 //   - c: Ein Pointer auf ein Context-Objekt von fiber
 //
 // Rückgabewert:
 //   - error: Ein Fehler, falls bei der Erstellung des Benutzers ein Fehler auftritt - wird an Client gesendet
-func HandleUpdateCategory(c *fiber.Ctx) error {
+func (srv *server) HandleUpdateCategory(c *fiber.Ctx) error {
 	name := c.Locals("name").(string)
 	id := c.Params("id")
 	type CategoryInput struct {
@@ -1208,18 +1536,20 @@ func HandleUpdateCategory(c *fiber.Ctx) error {
 			fmt.Println(err)
 			return c.Status(400).JSON(fiber.Map{"error": "Ungültige Eingabedaten"})
 		}
-		err = updateCategory(name, i, input.Cat_name, input.Color_header, input.Color_body)
+		err = srv.store.UpdateCategory(name, i, input.Cat_name, input.Color_header, input.Color_body)
 		if err != nil {
 			fmt.Println(err)
 			return c.Status(400).JSON(fiber.Map{"error": "Kategorie konnte nicht geändert werden"})
 		}
+		srv.refreshSmartListsForCategory(i)
+		srv.wakeWebhookDelivery()
 		return c.Status(200).JSON(fiber.Map{"msg": "Kategorie erfolgreich geändert"})
 	} else {
 		return c.Status(400).JSON(fiber.Map{"error": "Kategorie konnte nicht geändert werden"})
 	}
 }
 
-// HandleAddCategory nimmt die mitgeschickten Parameter des Clients entgegen und ruft addCategory damit auf, um eine neue Kategorie anzulegen
+// HandleAddCategory nimmt die mitgeschickten Parameter des Clients entgegen und ruft AddCategory damit auf, um eine neue Kategorie anzulegen
 //
 // Parameter:
 //   - c: Ein Pointer auf ein Context-Objekt von fiber
@@ -1227,7 +1557,7 @@ func HandleUpdateCategory(c *fiber.Ctx) error {
 // Rückgabewert:
 //   - error: Ein Fehler, falls bei der Erstellung des Benutzers ein Fehler auftritt - wird an Client gesendet
 //     Bei Erfolg wird die ID der neu erstellen Kategorie an den Client gesendet
-func HandleAddCategory(c *fiber.Ctx) error {
+func (srv *server) HandleAddCategory(c *fiber.Ctx) error {
 	name := c.Locals("name").(string)
 
 	var input category
@@ -1237,17 +1567,19 @@ func HandleAddCategory(c *fiber.Ctx) error {
 	}
 
 	if strings.TrimSpace(input.Cat_name) != "" {
-		addedCategoryID := addCategory(input.Cat_name, input.Color_header, input.Color_body, name)
-		if addedCategoryID == 0 {
+		addedCategoryID, err := srv.store.AddCategory(input.Cat_name, input.Color_header, input.Color_body, name)
+		if err != nil {
+			fmt.Println(err)
 			return c.Status(400).JSON(fiber.Map{"error": "Kategorie existiert bereits"})
 		}
+		srv.wakeWebhookDelivery()
 		return c.Status(201).JSON(fiber.Map{"id": addedCategoryID})
 	} else {
 		return c.Status(400).JSON(fiber.Map{"error": "Kategoriename darf nicht leer sein"})
 	}
 }
 
-// HandleDeleteCategory nimmt die mitgeschickten Parameter des Clients entgegen und ruft deleteCategory damit auf, um eine Kategorie zu löschen
+// HandleDeleteCategory nimmt die mitgeschickten Parameter des Clients entgegen und ruft DeleteCategory damit auf, um eine Kategorie zu löschen
 //
 // Parameter:
 //   - c: Ein Pointer auf ein Context-Objekt von fiber
@@ -1255,7 +1587,7 @@ func HandleAddCategory(c *fiber.Ctx) error {
 // Rückgabewert:
 //   - error: Ein Fehler, falls bei der Erstellung des Benutzers ein Fehler auftritt - wird an Client gesendet
 //     Bei Erfolg werden die aktualisierten Aufgabe zurück an den Client geschickt
-func HandleDeleteCategory(c *fiber.Ctx) error {
+func (srv *server) HandleDeleteCategory(c *fiber.Ctx) error {
 	name := c.Locals("name").(string)
 	id := c.Params("id")
 	if id != "" {
@@ -1264,25 +1596,39 @@ func HandleDeleteCategory(c *fiber.Ctx) error {
 			fmt.Println(err)
 			return c.Status(400).JSON(fiber.Map{"error": "Fehler beim Löschen aufgetreten"})
 		}
-		updatedTasks, err := deleteCategory(name, i)
+		err = srv.store.DeleteCategory(name, i)
 		if err != nil {
 			fmt.Println(err)
+			if errors.Is(err, errCategoryNotFound) {
+				return c.Status(404).JSON(fiber.Map{"error": err.Error()})
+			}
+			if errors.Is(err, errDefaultCategory) {
+				return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+			}
 			return c.Status(400).JSON(fiber.Map{"error": "Fehler beim Löschen aufgetreten"})
 		}
+		srv.refreshSmartListsForCategory(i)
+		srv.wakeWebhookDelivery()
+
+		updatedTasks, err := srv.store.GetTasksForUser(name)
+		if err != nil {
+			fmt.Println(err)
+			return c.Status(400).JSON(fiber.Map{"error": "Aufgaben konnten nicht geladen werden"})
+		}
 		return c.Status(200).JSON(fiber.Map{"tasks": updatedTasks})
 	} else {
 		return c.Status(400).JSON(fiber.Map{"error": "Fehler beim Löschen aufgetreten"})
 	}
 }
 
-// HandleUpdateOrder nimmt die mitgeschickten Parameter des Clients entgegen und ruft updateOrder damit auf, um die Reihenfolge der Aufgaben für einen Benutzer zu ändern
+// HandleUpdateOrder nimmt die mitgeschickten Parameter des Clients entgegen und ruft UpdateOrder damit auf, um die Reihenfolge der Aufgaben für einen Benutzer zu ändern
 //
 // Parameter:
 //   - c: Ein Pointer auf ein Context-Objekt von fiber
 //
 // Rückgabewert:
 //   - error: Ein Fehler, falls bei der Erstellung des Benutzers ein Fehler auftritt - wird an Client gesendet
-func HandleUpdateOrder(c *fiber.Ctx) error {
+func (srv *server) HandleUpdateOrder(c *fiber.Ctx) error {
 	name := c.Locals("name").(string)
 	id_up := c.Params("idUp")
 	id_down := c.Params("idDown")
@@ -1297,7 +1643,7 @@ func HandleUpdateOrder(c *fiber.Ctx) error {
 		fmt.Println(err)
 		return c.Status(400).JSON(fiber.Map{"error": "Ungültige Eingabedaten"})
 	}
-	err = updateOrder(name, up, down)
+	err = srv.store.UpdateOrder(name, up, down)
 	if err != nil {
 		fmt.Println(err)
 		return c.Status(400).JSON(fiber.Map{"error": "Reihenfolge konnte nicht geändert werden"})
@@ -1306,25 +1652,142 @@ func HandleUpdateOrder(c *fiber.Ctx) error {
 
 }
 
-var db *sql.DB
 var clients = make(map[string]*websocket.Conn)
 var mu sync.Mutex
 
-func main() {
-	var err error
+var (
+	databaseURL              = envString("GO_TODO_DATABASE_URL", "go-todo.db")
+	trashRetention           = envDuration("GO_TODO_TRASH_RETENTION", 30*24*time.Hour)
+	trashPurgeInterval       = envDuration("GO_TODO_TRASH_PURGE_INTERVAL", time.Hour)
+	autoArchiveInterval      = envDuration("GO_TODO_AUTO_ARCHIVE_INTERVAL", time.Hour)
+	rankRebalanceInterval    = envDuration("GO_TODO_RANK_REBALANCE_INTERVAL", time.Hour)
+	smartListRefreshInterval = envDuration("GO_TODO_SMART_LIST_REFRESH_INTERVAL", 15*time.Minute)
+	backupDir                = envString("GO_TODO_BACKUP_DIR", "backups")
+	backupInterval           = envDuration("GO_TODO_BACKUP_INTERVAL", 0)
+	backupRetention          = envDuration("GO_TODO_BACKUP_RETENTION", 7*24*time.Hour)
+	webhookRetryInterval     = envDuration("GO_TODO_WEBHOOK_RETRY_INTERVAL", 30*time.Second)
+	webhookRetention         = envDuration("GO_TODO_WEBHOOK_RETENTION", 30*24*time.Hour)
+	webhookPruneInterval     = envDuration("GO_TODO_WEBHOOK_PRUNE_INTERVAL", time.Hour)
+	webhookAllowPrivate      = envString("GO_TODO_WEBHOOK_ALLOW_PRIVATE", "false") == "true"
+	loginLockout             = envDuration("GO_TODO_LOGIN_LOCKOUT", 15*time.Minute)
+	oidcIssuer               = envString("GO_TODO_OIDC_ISSUER", "")
+	oidcClientID             = envString("GO_TODO_OIDC_CLIENT_ID", "")
+	oidcClientSecret         = envString("GO_TODO_OIDC_CLIENT_SECRET", "")
+	oidcRedirectURL          = envString("GO_TODO_OIDC_REDIRECT_URL", "http://localhost:5000/api/oidc/callback")
+	oidcUsernameClaim        = envString("GO_TODO_OIDC_USERNAME_CLAIM", "preferred_username")
+	oidcFrontendURL          = envString("GO_TODO_OIDC_FRONTEND_URL", "")
+	oidcLinkExisting         = envString("GO_TODO_OIDC_LINK_EXISTING", "false") == "true"
+	smtpAddr                 = envString("GO_TODO_SMTP_ADDR", "")
+	smtpUsername             = envString("GO_TODO_SMTP_USERNAME", "")
+	smtpPassword             = envString("GO_TODO_SMTP_PASSWORD", "")
+	smtpFrom                 = envString("GO_TODO_SMTP_FROM", "go-todo@localhost")
+	passwordResetURL         = envString("GO_TODO_PASSWORD_RESET_URL", "")
+	passwordResetTTL         = envDuration("GO_TODO_PASSWORD_RESET_TTL", time.Hour)
+)
+
+// envString liest eine Zeichenkette aus einer Umgebungsvariable
+//
+// Parameter:
+//   - key: Der Name der Umgebungsvariable
+//   - fallback: Der Standardwert, falls die Variable nicht gesetzt ist
+//
+// Rückgabewert:
+//   - string: Der gelesene Wert bzw. der Standardwert
+func envString(key, fallback string) string {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	return value
+}
 
-	db, err = sql.Open("sqlite", "go-todo.db")
+// envDuration liest eine Zeitdauer (z.B. "720h") aus einer Umgebungsvariable
+//
+// Parameter:
+//   - key: Der Name der Umgebungsvariable
+//   - fallback: Der Standardwert, falls die Variable nicht gesetzt oder ungültig ist
+//
+// Rückgabewert:
+//   - time.Duration: Die gelesene Zeitdauer bzw. der Standardwert
+func envDuration(key string, fallback time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	duration, err := time.ParseDuration(value)
 	if err != nil {
-		log.Fatal("Fehler beim Erstellen/Öffnen der Datenbank")
+		log.Printf("Ungültiger Wert für %s: %v", key, err)
+		return fallback
 	}
-	defer db.Close()
+	return duration
+}
 
-	initTables()
+func main() {
+	if len(os.Args) > 1 && os.Args[1] == "restore" {
+		os.Exit(runRestoreCommand(databaseURL, os.Args[2:]))
+	}
+
+	store, err := openStore(databaseURL)
+	if err != nil {
+		log.Fatal("Fehler beim Erstellen/Öffnen der Datenbank: ", err)
+	}
+	defer store.Close()
+
+	if len(os.Args) > 1 && os.Args[1] == "fsck" {
+		code := runFsckCommand(store, os.Args[2:])
+		store.Close()
+		os.Exit(code)
+	}
+	if len(os.Args) > 1 && os.Args[1] == "admin" {
+		code := runAdminCommand(store, os.Args[2:])
+		store.Close()
+		os.Exit(code)
+	}
+	if len(os.Args) > 1 && os.Args[1] == "backup" {
+		code := runBackupCommand(store, os.Args[2:])
+		store.Close()
+		os.Exit(code)
+	}
+
+	srv := newServer(store)
+	go srv.runTrashPurger(trashRetention, trashPurgeInterval)
+	go srv.runAutoArchiver(autoArchiveInterval)
+	go srv.runRankRebalancer(rankRebalanceInterval)
+	go srv.runSmartListRefresher(smartListRefreshInterval)
+	go srv.runWebhookDispatcher(webhookRetryInterval)
+	go srv.runWebhookPruner(webhookRetention, webhookPruneInterval)
+	if oidcIssuer != "" {
+		srv.oidc = newOIDCProvider(oidcConfig{
+			issuer:        oidcIssuer,
+			clientID:      oidcClientID,
+			clientSecret:  oidcClientSecret,
+			redirectURL:   oidcRedirectURL,
+			usernameClaim: oidcUsernameClaim,
+			frontendURL:   oidcFrontendURL,
+			linkExisting:  oidcLinkExisting,
+		})
+	}
+	if smtpAddr != "" {
+		srv.mailer = newMailer(mailConfig{
+			addr:     smtpAddr,
+			username: smtpUsername,
+			password: smtpPassword,
+			from:     smtpFrom,
+		})
+	}
+	if backupInterval > 0 {
+		go srv.runBackupScheduler(backupDir, backupInterval, backupRetention)
+	}
 
-	app := fiber.New()
+	// PROPFIND und REPORT werden vom CalDAV-Server benötigt
+	app := fiber.New(fiber.Config{
+		RequestMethods: append(append([]string{}, fiber.DefaultMethods...), "PROPFIND", "REPORT"),
+	})
 	app.Use(cors.New(cors.Config{
 		AllowOrigins: "http://localhost:5173, http://192.168.178.69:5173",
 		AllowHeaders: "Origin, Content-Type, Accept, Authorization",
+		// erlaubt dem Frontend, das Cookie aus HandleOIDCLink zu speichern
+		AllowCredentials: true,
 	}))
 
 	app.Use("/ws", func(c *fiber.Ctx) error {
@@ -1354,19 +1817,29 @@ func main() {
 			return
 		}
 
-		name := claims.Name
+		name, err := srv.sessionUser(claims)
+		if err != nil {
+			log.Println("Invalid token:", err)
+			c.Close()
+			return
+		}
 		mu.Lock()
 		clients[name] = c
 		mu.Unlock()
 
+		// nach einer Umbenennung ist die Verbindung unter dem neuen Namen eingetragen
 		defer func() {
 			mu.Lock()
-			delete(clients, name)
+			for client, conn := range clients {
+				if conn == c {
+					delete(clients, client)
+				}
+			}
 			mu.Unlock()
 			c.Close()
 		}()
 
-		log.Println("User:", claims.Name)
+		log.Println("User:", name)
 
 		var (
 			mt  int
@@ -1386,23 +1859,122 @@ func main() {
 		}
 	}))
 
-	app.Post("/api/users/new", HandleAddNewUser)
-	app.Post("/api/users", HandleLogInUser)
+	app.Post("/api/users/new", srv.HandleAddNewUser)
+	app.Post("/api/users", srv.HandleLogInUser)
+	app.Post("/api/users/totp", srv.HandleLogInTOTP)
+	app.Post("/api/users/reset", srv.HandleRequestPasswordReset)
+	app.Post("/api/users/reset/confirm", srv.HandleResetPassword)
+	app.Get("/api/oidc/login", srv.HandleOIDCLogin)
+	app.Get("/api/oidc/callback", srv.HandleOIDCCallback)
+
+	// Kalender-Abonnements sind über das geheime Token in der Adresse geschützt
+	app.Get("/feeds/:token", srv.HandleCalendarFeed)
+
+	// CalDAV-Clients melden sich per Basic-Auth mit einem App-Passwort an
+	app.All("/.well-known/caldav", srv.HandleWellKnownCalDAV)
+	app.All("/dav", srv.HandleCalDAV)
+	app.All("/dav/*", srv.HandleCalDAV)
+
+	// Aufgaben über Eingangsadressen werden über das geheime Token in der Adresse angelegt, nicht per JWT
+	app.Post("/inbound/:token", srv.HandleInbound)
 
-	app.Use(jwtMiddleware())
+	app.Use(srv.jwtMiddleware())
 
 	// Task Routen
-	app.Post("/api/tasks", HandleAddTask)
-	app.Delete("/api/tasks/:id", HandleDeleteTask)
-	app.Patch("/api/tasks/:id", HandleUpdateTask)
-	app.Post("/api/tasks/:id/:target", HandleShareTask)
-	app.Delete("/api/tasks/:id/:target", HandleRemoveSharingForUser)
-	app.Patch("/api/tasks/:idUp/:idDown", HandleUpdateOrder)
+	app.Post("/api/tasks", srv.HandleAddTask)
+	app.Delete("/api/tasks/:id", srv.HandleDeleteTask)
+	app.Patch("/api/tasks/:id", srv.HandleUpdateTask)
+	app.Put("/api/tasks/:id/position", srv.HandleMoveTask)
+	app.Put("/api/tasks/:id/due", srv.HandleSetTaskDue)
+	app.Post("/api/tasks/:id/:target", srv.HandleShareTask)
+	app.Delete("/api/tasks/:id/:target", srv.HandleRemoveSharingForUser)
+	app.Patch("/api/tasks/:idUp/:idDown", srv.HandleUpdateOrder)
 
 	// Category Routen
-	app.Post("/api/categories", HandleAddCategory)
-	app.Patch("/api/categories/:id/delete", HandleDeleteCategory)
-	app.Patch("/api/categories/:id", HandleUpdateCategory)
+	app.Post("/api/categories", srv.HandleAddCategory)
+	app.Patch("/api/categories/:id/delete", srv.HandleDeleteCategory)
+	app.Patch("/api/categories/:id", srv.HandleUpdateCategory)
+	app.Get("/api/categories/:id/tasks", srv.HandleGetCategoryTasks)
+
+	// Papierkorb Routen
+	app.Get("/api/trash", srv.HandleGetTrash)
+	app.Post("/api/trash/tasks/:id/restore", srv.HandleRestoreTask)
+	app.Post("/api/trash/categories/:id/restore", srv.HandleRestoreCategory)
+
+	// Archiv Routen
+	app.Get("/api/archive", srv.HandleGetArchive)
+	app.Put("/api/archive/settings", srv.HandleUpdateArchiveSettings)
+	app.Post("/api/archive/done", srv.HandleArchiveDoneTasks)
+	app.Post("/api/archive/tasks/:id", srv.HandleArchiveTask)
+	app.Post("/api/archive/tasks/:id/restore", srv.HandleUnarchiveTask)
+
+	// Export und Import Routen
+	app.Get("/api/export", srv.HandleExport)
+	app.Post("/api/import", srv.HandleImport)
+	app.Get("/api/todotxt", srv.HandleGetTodoTxt)
+	app.Post("/api/todotxt", srv.HandleMergeTodoTxt)
+
+	// Kalender Routen
+	app.Get("/api/feeds", srv.HandleGetCalendarFeeds)
+	app.Post("/api/feeds", srv.HandleAddCalendarFeed)
+	app.Delete("/api/feeds/:token", srv.HandleDeleteCalendarFeed)
+
+	// Webhook Routen
+	app.Get("/api/webhooks", srv.HandleGetWebhooks)
+	app.Post("/api/webhooks", srv.HandleAddWebhook)
+	app.Delete("/api/webhooks/:id", srv.HandleDeleteWebhook)
+	app.Get("/api/webhooks/:id/deliveries", srv.HandleGetWebhookDeliveries)
+	app.Post("/api/webhooks/:id/deliveries/:deliveryId/redeliver", srv.HandleRedeliverWebhook)
+
+	// App-Passwort Routen
+	app.Get("/api/apppasswords", srv.HandleGetAppPasswords)
+	app.Post("/api/apppasswords", srv.HandleAddAppPassword)
+	app.Delete("/api/apppasswords/:id", srv.HandleDeleteAppPassword)
+
+	// OpenID Connect Routen
+	app.Post("/api/oidc/link", srv.HandleOIDCLink)
+
+	// Konto Routen
+	app.Get("/api/account", srv.HandleGetAccount)
+	app.Patch("/api/account", srv.HandleRenameAccount)
+	app.Post("/api/account/password", srv.HandleChangePassword)
+	app.Put("/api/account/email", srv.HandleSetAccountEmail)
+	app.Delete("/api/account", srv.HandleDeleteAccount)
+
+	// Zwei-Faktor-Authentifizierung Routen
+	app.Get("/api/totp", srv.HandleGetTOTP)
+	app.Post("/api/totp", srv.HandleEnrollTOTP)
+	app.Post("/api/totp/verify", srv.HandleVerifyTOTP)
+	app.Post("/api/totp/recovery", srv.HandleRegenerateRecoveryCodes)
+	app.Delete("/api/totp", srv.HandleDisableTOTP)
+
+	// Zugriffstoken Routen
+	app.Get("/api/tokens", srv.HandleGetAccessTokens)
+	app.Post("/api/tokens", srv.HandleAddAccessToken)
+	app.Delete("/api/tokens/:id", srv.HandleDeleteAccessToken)
+
+	// Eingangsadressen Routen
+	app.Get("/api/inbound", srv.HandleGetInboundHooks)
+	app.Post("/api/inbound", srv.HandleAddInboundHook)
+	app.Delete("/api/inbound/:token", srv.HandleDeleteInboundHook)
+
+	// Such Routen
+	app.Get("/api/search", srv.HandleSearchTasks)
+
+	// Routen für intelligente Listen
+	app.Get("/api/smartlists", srv.HandleGetSmartLists)
+	app.Post("/api/smartlists", srv.HandleAddSmartList)
+	app.Get("/api/smartlists/:id/tasks", srv.HandleGetSmartListTasks)
+	app.Patch("/api/smartlists/:id", srv.HandleUpdateSmartList)
+	app.Delete("/api/smartlists/:id", srv.HandleDeleteSmartList)
+
+	// Admin Routen
+	app.Get("/api/admin/fsck", srv.HandleFsck)
+	app.Post("/api/admin/fsck", srv.HandleFsck)
+	app.Get("/api/admin/backups", srv.HandleGetBackups)
+	app.Post("/api/admin/backups", srv.HandleBackup)
+	app.Get("/api/admin/lockouts", srv.HandleGetLoginLocks)
+	app.Post("/api/admin/users/:name/unlock", srv.HandleUnlockUser)
 
 	app.Listen(":5000")
 }
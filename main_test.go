@@ -0,0 +1,315 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// newHandlerTestApp registriert die Routen für Benutzer, Aufgaben, Freigaben und Kategorien wie in main auf einem fakeStore
+func newHandlerTestApp(t *testing.T) (*fakeStore, *fiber.App) {
+	t.Helper()
+	store := newFakeStore()
+	srv := newServer(store)
+
+	app := fiber.New()
+	app.Post("/api/users/new", srv.HandleAddNewUser)
+	app.Post("/api/users", srv.HandleLogInUser)
+	app.Use(srv.jwtMiddleware())
+	app.Post("/api/tasks", srv.HandleAddTask)
+	app.Delete("/api/tasks/:id", srv.HandleDeleteTask)
+	app.Patch("/api/tasks/:id", srv.HandleUpdateTask)
+	app.Post("/api/tasks/:id/:target", srv.HandleShareTask)
+	app.Delete("/api/tasks/:id/:target", srv.HandleRemoveSharingForUser)
+	app.Patch("/api/tasks/:idUp/:idDown", srv.HandleUpdateOrder)
+	app.Post("/api/categories", srv.HandleAddCategory)
+	app.Patch("/api/categories/:id/delete", srv.HandleDeleteCategory)
+	app.Patch("/api/categories/:id", srv.HandleUpdateCategory)
+	return store, app
+}
+
+// call sendet eine Anfrage mit optionalem JSON-Body und token an die App und liefert Status und dekodierte Antwort
+func call(t *testing.T, app *fiber.App, method, path, token, body string) (int, map[string]any) {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := map[string]any{}
+	json.Unmarshal(raw, &result)
+	return resp.StatusCode, result
+}
+
+// register legt einen Benutzer über die API an, meldet ihn an und liefert sein token
+func register(t *testing.T, app *fiber.App, name string) string {
+	t.Helper()
+	credentials := `{"name":"` + name + `","password":"pw"}`
+	if status, body := call(t, app, http.MethodPost, "/api/users/new", "", credentials); status != 201 {
+		t.Fatalf("Registrierung von %s: %d %v", name, status, body)
+	}
+	status, body := call(t, app, http.MethodPost, "/api/users", "", credentials)
+	token, _ := body["token"].(string)
+	if status != 200 || token == "" {
+		t.Fatalf("Anmeldung von %s: %d %v", name, status, body)
+	}
+	return token
+}
+
+// tasksOf liest die Aufgaben aus der Antwort einer Anmeldung
+func tasksOf(t *testing.T, app *fiber.App, name string) []any {
+	t.Helper()
+	status, body := call(t, app, http.MethodPost, "/api/users", "", `{"name":"`+name+`","password":"pw"}`)
+	if status != 200 {
+		t.Fatalf("Anmeldung von %s: %d %v", name, status, body)
+	}
+	return body["tasks"].([]any)
+}
+
+func TestHandleAddNewUserAndLogin(t *testing.T) {
+	store, app := newHandlerTestApp(t)
+
+	if status, _ := call(t, app, http.MethodPost, "/api/users/new", "", `{"name":"alice","password":"pw"}`); status != 201 {
+		t.Fatalf("Registrierung: %d", status)
+	}
+	if status, _ := call(t, app, http.MethodPost, "/api/users/new", "", `{"name":"alice","password":"anders"}`); status != 400 {
+		t.Fatalf("Doppelte Registrierung: %d", status)
+	}
+	if status, _ := call(t, app, http.MethodPost, "/api/users/new", "", `{"name":"  ","password":"pw"}`); status != 400 {
+		t.Fatalf("Registrierung ohne Namen: %d", status)
+	}
+
+	status, body := call(t, app, http.MethodPost, "/api/users", "", `{"name":"alice","password":"falsch"}`)
+	if status != 400 || body["error"] != errBadCredentials.Error() {
+		t.Fatalf("Anmeldung mit falschem Passwort: %d %v", status, body)
+	}
+	if store.loginFailures["alice"] != 1 {
+		t.Fatalf("%d Fehlversuche protokolliert, erwartet 1", store.loginFailures["alice"])
+	}
+
+	status, body = call(t, app, http.MethodPost, "/api/users", "", `{"name":"alice","password":"pw"}`)
+	if status != 200 || body["token"] == "" {
+		t.Fatalf("Anmeldung: %d %v", status, body)
+	}
+	if store.loginFailures["alice"] != 0 {
+		t.Fatal("Fehlversuche wurden nach der Anmeldung nicht zurückgesetzt")
+	}
+	categories := body["categories"].([]any)
+	if len(categories) != 1 || categories[0].(map[string]any)["cat_name"] != "default" || categories[0].(map[string]any)["isDefault"] != true {
+		t.Fatalf("Kategorien nach der Registrierung: %v", categories)
+	}
+	if len(body["tasks"].([]any)) != 0 {
+		t.Fatalf("Aufgaben nach der Registrierung: %v", body["tasks"])
+	}
+}
+
+func TestHandlersRequireToken(t *testing.T) {
+	_, app := newHandlerTestApp(t)
+
+	if status, _ := call(t, app, http.MethodPost, "/api/tasks", "", `{"title":"Test"}`); status != 401 {
+		t.Fatalf("Anfrage ohne Token: %d", status)
+	}
+	if status, _ := call(t, app, http.MethodPost, "/api/tasks", "kein.jwt.token", `{"title":"Test"}`); status != 401 {
+		t.Fatalf("Anfrage mit ungültigem Token: %d", status)
+	}
+}
+
+func TestHandleAddTask(t *testing.T) {
+	_, app := newHandlerTestApp(t)
+	alice := register(t, app, "alice")
+	bob := register(t, app, "bob")
+
+	status, body := call(t, app, http.MethodPost, "/api/categories", bob, `{"cat_name":"Privat","color_header":"#000","color_body":"#fff"}`)
+	if status != 201 {
+		t.Fatalf("Kategorie anlegen: %d %v", status, body)
+	}
+	bobCategory := int(body["id"].(float64))
+
+	if status, _ := call(t, app, http.MethodPost, "/api/tasks", alice, `{"title":"  "}`); status != 400 {
+		t.Fatalf("Aufgabe ohne Titel: %d", status)
+	}
+	// die Kategorie eines anderen Benutzers wird durch die eigene Standardkategorie ersetzt
+	status, body = call(t, app, http.MethodPost, "/api/tasks", alice, `{"title":"Einkaufen","desc":"Milch","category":{"id":`+strconv.Itoa(bobCategory)+`}}`)
+	if status != 201 {
+		t.Fatalf("Aufgabe anlegen: %d %v", status, body)
+	}
+
+	tasks := tasksOf(t, app, "alice")
+	if len(tasks) != 1 {
+		t.Fatalf("Aufgaben von alice: %v", tasks)
+	}
+	created := tasks[0].(map[string]any)
+	if created["title"] != "Einkaufen" || created["desc"] != "Milch" || created["owner"] != "alice" {
+		t.Fatalf("Angelegte Aufgabe: %v", created)
+	}
+	if created["category"].(map[string]any)["cat_name"] != "default" {
+		t.Fatalf("Aufgabe wurde der fremden Kategorie zugeordnet: %v", created["category"])
+	}
+	if len(tasksOf(t, app, "bob")) != 0 {
+		t.Fatal("Aufgabe von alice ist bei bob sichtbar")
+	}
+}
+
+func TestHandleShareTask(t *testing.T) {
+	_, app := newHandlerTestApp(t)
+	alice := register(t, app, "alice")
+	bob := register(t, app, "bob")
+	carol := register(t, app, "carol")
+
+	_, body := call(t, app, http.MethodPost, "/api/tasks", alice, `{"title":"Gemeinsam"}`)
+	taskPath := "/api/tasks/" + strconv.Itoa(int(body["id"].(float64)))
+
+	if status, _ := call(t, app, http.MethodPost, taskPath+"/alice", alice, ""); status != 400 {
+		t.Fatalf("Freigabe für sich selbst: %d", status)
+	}
+	if status, _ := call(t, app, http.MethodPost, taskPath+"/niemand", alice, ""); status != 400 {
+		t.Fatalf("Freigabe für unbekannten Benutzer: %d", status)
+	}
+	if status, _ := call(t, app, http.MethodPost, taskPath+"/bob", carol, ""); status != 403 {
+		t.Fatalf("Freigabe einer fremden Aufgabe durch carol: %d", status)
+	}
+	if len(tasksOf(t, app, "bob")) != 0 {
+		t.Fatal("Aufgabe wurde trotz fehlender Berechtigung für bob freigegeben")
+	}
+	if status, body := call(t, app, http.MethodPost, taskPath+"/bob", alice, ""); status != 201 {
+		t.Fatalf("Freigabe für bob: %d %v", status, body)
+	}
+	if status, _ := call(t, app, http.MethodPost, taskPath+"/bob", alice, ""); status != 400 {
+		t.Fatalf("Doppelte Freigabe: %d", status)
+	}
+
+	bobTasks := tasksOf(t, app, "bob")
+	if len(bobTasks) != 1 || bobTasks[0].(map[string]any)["owner"] != "alice" {
+		t.Fatalf("Aufgaben von bob nach der Freigabe: %v", bobTasks)
+	}
+	aliceTasks := tasksOf(t, app, "alice")
+	if shared := aliceTasks[0].(map[string]any)["shared"].([]any); len(shared) != 1 || shared[0] != "bob" {
+		t.Fatalf("Freigaben aus Sicht von alice: %v", shared)
+	}
+
+	// Zielbenutzer ändern nur den Status, der Titel bleibt erhalten
+	if status, _ := call(t, app, http.MethodPatch, taskPath, bob, `{"title":"Überschrieben","isDone":true,"owner":"alice"}`); status != 200 {
+		t.Fatalf("Status durch bob ändern: %d", status)
+	}
+	updated := tasksOf(t, app, "alice")[0].(map[string]any)
+	if updated["title"] != "Gemeinsam" || updated["isDone"] != true {
+		t.Fatalf("Aufgabe nach Änderung durch bob: %v", updated)
+	}
+
+	if status, _ := call(t, app, http.MethodPatch, taskPath, carol, `{"title":"Gemeinsam","isDone":false,"owner":"alice"}`); status != 404 {
+		t.Fatalf("Status durch Unbeteiligte ändern: %d", status)
+	}
+	if updated := tasksOf(t, app, "alice")[0].(map[string]any); updated["isDone"] != true {
+		t.Fatalf("Aufgabe nach Änderung durch carol: %v", updated)
+	}
+
+	if status, _ := call(t, app, http.MethodDelete, taskPath+"/bob", carol, ""); status != 403 {
+		t.Fatalf("Freigabe durch Unbeteiligte beenden: %d", status)
+	}
+	if status, _ := call(t, app, http.MethodDelete, taskPath+"/carol", alice, ""); status != 404 {
+		t.Fatalf("Nicht vorhandene Freigabe beenden: %d", status)
+	}
+	if status, _ := call(t, app, http.MethodDelete, taskPath+"/bob", bob, ""); status != 200 {
+		t.Fatalf("Freigabe durch bob verlassen: %d", status)
+	}
+	if len(tasksOf(t, app, "bob")) != 0 {
+		t.Fatal("Aufgabe ist nach dem Verlassen der Freigabe noch bei bob sichtbar")
+	}
+}
+
+func TestHandleDeleteTask(t *testing.T) {
+	_, app := newHandlerTestApp(t)
+	alice := register(t, app, "alice")
+	bob := register(t, app, "bob")
+
+	_, body := call(t, app, http.MethodPost, "/api/tasks", alice, `{"title":"Löschen"}`)
+	taskPath := "/api/tasks/" + strconv.Itoa(int(body["id"].(float64)))
+	call(t, app, http.MethodPost, taskPath+"/bob", alice, "")
+
+	if status, _ := call(t, app, http.MethodDelete, taskPath, bob, ""); status != 404 {
+		t.Fatalf("Löschen durch Zielbenutzer: %d", status)
+	}
+	if status, _ := call(t, app, http.MethodDelete, "/api/tasks/abc", alice, ""); status != 400 {
+		t.Fatalf("Löschen mit ungültiger ID: %d", status)
+	}
+	if status, _ := call(t, app, http.MethodDelete, taskPath, alice, ""); status != 200 {
+		t.Fatalf("Löschen durch Besitzer: %d", status)
+	}
+	if status, _ := call(t, app, http.MethodDelete, taskPath, alice, ""); status != 404 {
+		t.Fatalf("Erneutes Löschen: %d", status)
+	}
+	if len(tasksOf(t, app, "alice")) != 0 || len(tasksOf(t, app, "bob")) != 0 {
+		t.Fatal("Gelöschte Aufgabe ist noch sichtbar")
+	}
+}
+
+func TestHandleDeleteCategory(t *testing.T) {
+	_, app := newHandlerTestApp(t)
+	alice := register(t, app, "alice")
+	bob := register(t, app, "bob")
+
+	_, body := call(t, app, http.MethodPost, "/api/categories", alice, `{"cat_name":"Arbeit"}`)
+	catID := strconv.Itoa(int(body["id"].(float64)))
+	call(t, app, http.MethodPost, "/api/tasks", alice, `{"title":"Bericht","category":{"id":`+catID+`}}`)
+
+	if status, _ := call(t, app, http.MethodPatch, "/api/categories/"+catID, alice, `{"cat_name":"Büro"}`); status != 200 {
+		t.Fatalf("Kategorie umbenennen: %d", status)
+	}
+	if category := tasksOf(t, app, "alice")[0].(map[string]any)["category"].(map[string]any); category["cat_name"] != "Büro" {
+		t.Fatalf("Kategorie der Aufgabe nach Umbenennung: %v", category)
+	}
+
+	if status, _ := call(t, app, http.MethodPatch, "/api/categories/"+catID+"/delete", bob, ""); status != 404 {
+		t.Fatalf("Fremde Kategorie löschen: %d", status)
+	}
+	status, body := call(t, app, http.MethodPatch, "/api/categories/"+catID+"/delete", alice, "")
+	if status != 200 {
+		t.Fatalf("Kategorie löschen: %d %v", status, body)
+	}
+	tasks := body["tasks"].([]any)
+	if len(tasks) != 1 || tasks[0].(map[string]any)["category"].(map[string]any)["cat_name"] != "default" {
+		t.Fatalf("Aufgaben nach dem Löschen der Kategorie: %v", tasks)
+	}
+
+	defaultID := strconv.Itoa(int(tasks[0].(map[string]any)["category"].(map[string]any)["id"].(float64)))
+	status, body = call(t, app, http.MethodPatch, "/api/categories/"+defaultID+"/delete", alice, "")
+	if status != 400 || body["error"] != errDefaultCategory.Error() {
+		t.Fatalf("Standardkategorie löschen: %d %v", status, body)
+	}
+}
+
+func TestHandleUpdateOrder(t *testing.T) {
+	_, app := newHandlerTestApp(t)
+	alice := register(t, app, "alice")
+
+	var ids []string
+	for _, title := range []string{"Erste", "Zweite"} {
+		_, body := call(t, app, http.MethodPost, "/api/tasks", alice, `{"title":"`+title+`"}`)
+		ids = append(ids, strconv.Itoa(int(body["id"].(float64))))
+	}
+	if status, _ := call(t, app, http.MethodPatch, "/api/tasks/"+ids[0]+"/"+ids[1], alice, ""); status != 200 {
+		t.Fatalf("Reihenfolge ändern: %d", status)
+	}
+	tasks := tasksOf(t, app, "alice")
+	if tasks[0].(map[string]any)["title"] != "Zweite" || tasks[1].(map[string]any)["title"] != "Erste" {
+		t.Fatalf("Reihenfolge nach dem Tausch: %v", tasks)
+	}
+	if status, _ := call(t, app, http.MethodPatch, "/api/tasks/"+ids[0]+"/999", alice, ""); status != 400 {
+		t.Fatalf("Tausch mit unbekannter Aufgabe: %d", status)
+	}
+}
@@ -0,0 +1,730 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// oidcLoginTimeout legt fest, wie lange ein begonnener Anmeldevorgang beim Anbieter gültig bleibt
+const oidcLoginTimeout = 10 * time.Minute
+
+// oidcBindingCookie ist das Cookie, das einen begonnenen Anmeldevorgang an den Browser bindet, in dem er begonnen wurde
+// ohne diese Bindung könnte ein Angreifer einem anderen Browser seinen eigenen state unterschieben (Login-CSRF)
+const oidcBindingCookie = "go_todo_oidc"
+
+var (
+	errOIDCIdentityNotFound = errors.New("Identität ist keinem Benutzer zugeordnet")
+	errOIDCIdentityLinked   = errors.New("Identität ist bereits einem anderen Benutzer zugeordnet")
+)
+
+// oidcConfig enthält die Einstellungen für die Anmeldung über einen OpenID-Connect-Anbieter
+// usernameClaim ist der Claim des ID-Tokens, aus dem beim ersten Login der Benutzername übernommen wird
+// linkExisting ordnet eine neue Identität einem lokalen Benutzer gleichen Namens zu, wenn der Anbieter dessen E-Mail-Adresse bestätigt
+type oidcConfig struct {
+	issuer        string
+	clientID      string
+	clientSecret  string
+	redirectURL   string
+	usernameClaim string
+	frontendURL   string
+	linkExisting  bool
+}
+
+// oidcDiscovery ist der benötigte Teil von /.well-known/openid-configuration des Anbieters
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// oidcLogin ist ein begonnener Anmeldevorgang, gespeichert unter seinem state
+// linkUser ist gesetzt, wenn ein angemeldeter Benutzer seine Identität verknüpft
+// bindingHash ist der Hash des Werts aus oidcBindingCookie, der beim Callback mitgesendet werden muss
+type oidcLogin struct {
+	verifier    string
+	nonce       string
+	linkUser    string
+	bindingHash string
+	expiresAt   time.Time
+}
+
+// jsonWebKey ist ein öffentlicher Schlüssel aus dem JWKS des Anbieters
+type jsonWebKey struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// oidcProvider führt den Authorization-Code-Flow mit PKCE gegen einen OpenID-Connect-Anbieter durch
+// Konfiguration und Schlüssel des Anbieters werden beim ersten Bedarf geladen und zwischengespeichert
+type oidcProvider struct {
+	config oidcConfig
+	client *http.Client
+
+	mu        sync.Mutex
+	discovery *oidcDiscovery
+	keys      map[string]crypto.PublicKey
+	logins    map[string]oidcLogin
+}
+
+// newOIDCProvider erstellt einen neuen oidcProvider
+//
+// Parameter:
+//   - config: Die Einstellungen des Anbieters
+//
+// Rückgabewert:
+//   - provider: Ein Pointer auf den neu erstellten oidcProvider
+func newOIDCProvider(config oidcConfig) *oidcProvider {
+	config.issuer = strings.TrimSuffix(config.issuer, "/")
+	return &oidcProvider{
+		config: config,
+		client: &http.Client{Timeout: 10 * time.Second},
+		logins: make(map[string]oidcLogin),
+	}
+}
+
+// getJSON lädt ein JSON-Dokument des Anbieters
+//
+// Parameter:
+//   - address: Die Adresse des Dokuments
+//   - v: Ein Pointer auf den Wert, in den das Dokument gelesen wird
+//
+// Rückgabewert:
+//   - error: Ein Fehler, falls das Dokument nicht geladen werden kann; "nil", falls nicht
+func (p *oidcProvider) getJSON(address string, v any) error {
+	resp, err := p.client.Get(address)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s antwortet mit Status %d", address, resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// discover lädt die Konfiguration des Anbieters, sofern sie noch nicht geladen wurde
+//
+// Rückgabewert:
+//   - discovery: Die Endpunkte des Anbieters
+//   - error: Ein Fehler, falls die Konfiguration nicht geladen werden kann oder nicht zum Aussteller passt; "nil", falls nicht
+func (p *oidcProvider) discover() (*oidcDiscovery, error) {
+	p.mu.Lock()
+	discovery := p.discovery
+	p.mu.Unlock()
+	if discovery != nil {
+		return discovery, nil
+	}
+
+	discovery = &oidcDiscovery{}
+	err := p.getJSON(p.config.issuer+"/.well-known/openid-configuration", discovery)
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSuffix(discovery.Issuer, "/") != p.config.issuer {
+		return nil, fmt.Errorf("Aussteller %q passt nicht zu %q", discovery.Issuer, p.config.issuer)
+	}
+
+	p.mu.Lock()
+	p.discovery = discovery
+	p.mu.Unlock()
+	return discovery, nil
+}
+
+// parseJSONWebKey wandelt einen RSA- oder EC-Schlüssel aus dem JWKS in einen öffentlichen Schlüssel um
+//
+// Parameter:
+//   - key: Der Schlüssel aus dem JWKS
+//
+// Rückgabewert:
+//   - crypto.PublicKey: Der öffentliche Schlüssel
+//   - error: Ein Fehler, falls der Schlüsseltyp nicht unterstützt wird oder ungültig ist; "nil", falls nicht
+func parseJSONWebKey(key jsonWebKey) (crypto.PublicKey, error) {
+	decode := func(value string) (*big.Int, error) {
+		data, err := base64.RawURLEncoding.DecodeString(value)
+		if err != nil {
+			return nil, err
+		}
+		return new(big.Int).SetBytes(data), nil
+	}
+
+	switch key.Kty {
+	case "RSA":
+		n, err := decode(key.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decode(key.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch key.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		default:
+			return nil, fmt.Errorf("Kurve %q wird nicht unterstützt", key.Crv)
+		}
+		x, err := decode(key.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decode(key.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+	return nil, fmt.Errorf("Schlüsseltyp %q wird nicht unterstützt", key.Kty)
+}
+
+// publicKey liefert den Schlüssel, mit dem der Anbieter ein ID-Token signiert hat
+// ist die Schlüssel-ID unbekannt, wird das JWKS einmal neu geladen, da der Anbieter seine Schlüssel gewechselt haben kann
+//
+// Parameter:
+//   - kid: Die Schlüssel-ID aus dem Header des ID-Tokens; "", falls der Anbieter nur einen Schlüssel verwendet
+//
+// Rückgabewert:
+//   - crypto.PublicKey: Der öffentliche Schlüssel
+//   - error: Ein Fehler, falls der Schlüssel nicht gefunden wird; "nil", falls nicht
+func (p *oidcProvider) publicKey(kid string) (crypto.PublicKey, error) {
+	lookup := func() crypto.PublicKey {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		if kid == "" && len(p.keys) == 1 {
+			for _, key := range p.keys {
+				return key
+			}
+		}
+		return p.keys[kid]
+	}
+	if key := lookup(); key != nil {
+		return key, nil
+	}
+
+	discovery, err := p.discover()
+	if err != nil {
+		return nil, err
+	}
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	err = p.getJSON(discovery.JWKSURI, &set)
+	if err != nil {
+		return nil, err
+	}
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, jwk := range set.Keys {
+		key, err := parseJSONWebKey(jwk)
+		if err != nil {
+			log.Println("OIDC: Schlüssel", jwk.Kid, "wird ignoriert:", err)
+			continue
+		}
+		keys[jwk.Kid] = key
+	}
+	p.mu.Lock()
+	p.keys = keys
+	p.mu.Unlock()
+
+	if key := lookup(); key != nil {
+		return key, nil
+	}
+	return nil, fmt.Errorf("Schlüssel %q ist beim Anbieter nicht bekannt", kid)
+}
+
+// beginLogin beginnt einen Anmeldevorgang und liefert die Adresse, an die der Browser weitergeleitet wird
+// state, nonce, code_verifier und der Wert für oidcBindingCookie werden zufällig erzeugt und bis zum Callback im Speicher gehalten
+//
+// Parameter:
+//   - linkUser: Der Name des angemeldeten Benutzers, der seine Identität verknüpft; "" für eine Anmeldung
+//
+// Rückgabewert:
+//   - authURL: Die Adresse des Anbieters zur Anmeldung
+//   - binding: Der Wert für oidcBindingCookie, ohne den der Callback abgelehnt wird
+//   - error: Ein Fehler, falls die Konfiguration des Anbieters nicht geladen werden kann; "nil", falls nicht
+func (p *oidcProvider) beginLogin(linkUser string) (authURL string, binding string, err error) {
+	discovery, err := p.discover()
+	if err != nil {
+		return "", "", err
+	}
+	endpoint, err := url.Parse(discovery.AuthorizationEndpoint)
+	if err != nil {
+		return "", "", err
+	}
+
+	var values [4]string
+	for i := range values {
+		values[i], err = newSecretToken()
+		if err != nil {
+			return "", "", err
+		}
+	}
+	state, nonce, verifier, binding := values[0], values[1], values[2], values[3]
+	challenge := sha256.Sum256([]byte(verifier))
+
+	now := time.Now()
+	p.mu.Lock()
+	for key, login := range p.logins {
+		if now.After(login.expiresAt) {
+			delete(p.logins, key)
+		}
+	}
+	p.logins[state] = oidcLogin{verifier: verifier, nonce: nonce, linkUser: linkUser, bindingHash: hashSecretToken(binding), expiresAt: now.Add(oidcLoginTimeout)}
+	p.mu.Unlock()
+
+	query := endpoint.Query()
+	query.Set("response_type", "code")
+	query.Set("client_id", p.config.clientID)
+	query.Set("redirect_uri", p.config.redirectURL)
+	query.Set("scope", "openid profile email")
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:]))
+	query.Set("code_challenge_method", "S256")
+	endpoint.RawQuery = query.Encode()
+	return endpoint.String(), binding, nil
+}
+
+// takeLogin entnimmt einen begonnenen Anmeldevorgang, jeder state kann nur einmal verwendet werden
+//
+// Parameter:
+//   - state: Der vom Anbieter zurückgegebene state
+//   - binding: Der Wert aus oidcBindingCookie des Browsers
+//
+// Rückgabewert:
+//   - login: Der Anmeldevorgang
+//   - bool: "false", falls der state unbekannt oder abgelaufen ist oder nicht in diesem Browser begonnen wurde
+func (p *oidcProvider) takeLogin(state, binding string) (oidcLogin, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	login, ok := p.logins[state]
+	delete(p.logins, state)
+	if !ok || time.Now().After(login.expiresAt) {
+		return oidcLogin{}, false
+	}
+	if subtle.ConstantTimeCompare([]byte(hashSecretToken(binding)), []byte(login.bindingHash)) != 1 {
+		return oidcLogin{}, false
+	}
+	return login, true
+}
+
+// setBindingCookie setzt oidcBindingCookie für einen begonnenen Anmeldevorgang bzw. löscht es nach dem Callback
+// SameSite=Lax erlaubt das Cookie bei der Weiterleitung vom Anbieter zurück zum Callback
+//
+// Parameter:
+//   - c: Ein Pointer auf ein Context-Objekt von fiber
+//   - binding: Der Wert aus beginLogin; "", um das Cookie zu löschen
+func (p *oidcProvider) setBindingCookie(c *fiber.Ctx, binding string) {
+	cookie := &fiber.Cookie{
+		Name:     oidcBindingCookie,
+		Value:    binding,
+		Path:     "/",
+		MaxAge:   int(oidcLoginTimeout.Seconds()),
+		Secure:   strings.HasPrefix(p.config.redirectURL, "https://"),
+		HTTPOnly: true,
+		SameSite: fiber.CookieSameSiteLaxMode,
+	}
+	if binding == "" {
+		cookie.MaxAge = 0
+		cookie.Expires = time.Unix(0, 0)
+	}
+	c.Cookie(cookie)
+}
+
+// exchangeCode tauscht den Autorisierungscode beim Token-Endpunkt gegen ein ID-Token
+//
+// Parameter:
+//   - code: Der Autorisierungscode aus dem Callback
+//   - verifier: Der code_verifier des Anmeldevorgangs
+//
+// Rückgabewert:
+//   - string: Das ID-Token
+//   - error: Ein Fehler, falls der Anbieter den Code ablehnt; "nil", falls nicht
+func (p *oidcProvider) exchangeCode(code, verifier string) (string, error) {
+	discovery, err := p.discover()
+	if err != nil {
+		return "", err
+	}
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.config.redirectURL},
+		"client_id":     {p.config.clientID},
+		"code_verifier": {verifier},
+	}
+	req, err := http.NewRequest(http.MethodPost, discovery.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.config.clientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.config.clientID), url.QueryEscape(p.config.clientSecret))
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	var result struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&result)
+	if err != nil {
+		return "", fmt.Errorf("Antwort des Token-Endpunkts mit Status %d ist ungültig: %w", resp.StatusCode, err)
+	}
+	if resp.StatusCode != http.StatusOK || result.Error != "" {
+		return "", fmt.Errorf("Token-Endpunkt antwortet mit Status %d: %s %s", resp.StatusCode, result.Error, result.ErrorDescription)
+	}
+	if result.IDToken == "" {
+		return "", errors.New("Token-Endpunkt hat kein ID-Token gesendet")
+	}
+	return result.IDToken, nil
+}
+
+// verifyIDToken prüft Signatur, Aussteller, Empfänger, Ablauf und nonce eines ID-Tokens
+//
+// Parameter:
+//   - raw: Das ID-Token
+//   - nonce: Die nonce des Anmeldevorgangs
+//
+// Rückgabewert:
+//   - claims: Die Claims des ID-Tokens
+//   - error: Ein Fehler, falls das ID-Token ungültig ist; "nil", falls nicht
+func (p *oidcProvider) verifyIDToken(raw, nonce string) (jwt.MapClaims, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(raw, claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		return p.publicKey(kid)
+	},
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "ES256", "ES384"}),
+		jwt.WithIssuer(p.config.issuer),
+		jwt.WithAudience(p.config.clientID),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	if claimNonce, _ := claims["nonce"].(string); claimNonce != nonce {
+		return nil, errors.New("nonce des ID-Tokens passt nicht zum Anmeldevorgang")
+	}
+	if subject, _ := claims["sub"].(string); subject == "" {
+		return nil, errors.New("ID-Token enthält kein sub")
+	}
+	return claims, nil
+}
+
+// GetOIDCIdentityUser lädt den Benutzer, dem eine Identität zugeordnet ist
+//
+// Parameter:
+//   - issuer: Der Aussteller der Identität
+//   - subject: Die ID der Identität beim Aussteller (sub)
+//
+// Rückgabewert:
+//   - name: Der Name des Benutzers
+//   - error: errOIDCIdentityNotFound, falls die Identität noch keinem Benutzer zugeordnet ist; "nil", falls kein Fehler auftritt
+func (s *sqlStore) GetOIDCIdentityUser(issuer, subject string) (name string, err error) {
+	err = s.db.QueryRow(`SELECT `+userNameSQL("user_id")+` FROM oidc_identities WHERE issuer = ? AND subject = ?`, issuer, subject).Scan(&name)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", errOIDCIdentityNotFound
+	}
+	return name, err
+}
+
+// LinkOIDCIdentity ordnet eine Identität einem bestehenden Benutzer zu
+//
+// Parameter:
+//   - name: Der Name des Benutzers
+//   - issuer: Der Aussteller der Identität
+//   - subject: Die ID der Identität beim Aussteller (sub)
+//
+// Rückgabewert:
+//   - error: errOIDCIdentityLinked, falls die Identität bereits einem anderen Benutzer zugeordnet ist; "nil", falls kein Fehler auftritt
+func (s *sqlStore) LinkOIDCIdentity(name, issuer, subject string) error {
+	_, err := s.db.Exec(`INSERT INTO oidc_identities (issuer, subject, user_id, created_at) VALUES (?,?,`+userIDSQL+`,?) ON CONFLICT (issuer, subject) DO NOTHING`,
+		issuer, subject, name, time.Now().Unix())
+	if err != nil {
+		return err
+	}
+	owner, err := s.GetOIDCIdentityUser(issuer, subject)
+	if err != nil {
+		return err
+	}
+	if owner != name {
+		return errOIDCIdentityLinked
+	}
+	return nil
+}
+
+// AddOIDCUser legt beim ersten Login über den Anbieter einen neuen Benutzer an und ordnet ihm die Identität zu
+// der Benutzer erhält ein zufälliges Passwort, sodass er sich nur über den Anbieter anmelden kann
+//
+// Parameter:
+//   - name: Der Name des neuen Benutzers
+//   - issuer: Der Aussteller der Identität
+//   - subject: Die ID der Identität beim Aussteller (sub)
+//
+// Rückgabewert:
+//   - error: Ein Fehler, falls der Benutzer bereits existiert oder beim Anlegen ein Fehler auftritt; "nil", falls nicht
+func (s *sqlStore) AddOIDCUser(name, issuer, subject string) error {
+	password, err := newSecretToken()
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		fmt.Println(err)
+		return err
+	}
+	err = insertUser(tx, name, password)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	_, err = tx.Exec(`INSERT INTO oidc_identities (issuer, subject, user_id, created_at) VALUES (?,?,`+userIDSQL+`,?)`, issuer, subject, name, time.Now().Unix())
+	if err != nil {
+		tx.Rollback()
+		fmt.Println(err)
+		return err
+	}
+	err = tx.Commit()
+	if err != nil {
+		tx.Rollback()
+		fmt.Println(err)
+		return err
+	}
+	return nil
+}
+
+// oidcUserForIdentity bestimmt den Benutzer zu einer angemeldeten Identität
+// beim ersten Login wird der Benutzername aus dem konfigurierten Claim übernommen und ein neuer Benutzer angelegt
+// ein vergebener Name wird nie einfach übernommen: mit linkExisting wird die Identität nur zugeordnet, wenn der Anbieter
+// die hinterlegte E-Mail-Adresse des Benutzers bestätigt und der Benutzer kein Administrator ist, sonst wird die Anmeldung abgelehnt
+//
+// Parameter:
+//   - claims: Die geprüften Claims des ID-Tokens
+//
+// Rückgabewert:
+//   - name: Der Name des Benutzers
+//   - status: Der http-Status für den Client, falls ein Fehler auftritt
+//   - error: Ein Fehler mit einer Beschreibung für den Client; "nil", falls kein Fehler auftritt
+func (srv *server) oidcUserForIdentity(claims jwt.MapClaims) (name string, status int, err error) {
+	issuer := srv.oidc.config.issuer
+	subject, _ := claims["sub"].(string)
+
+	name, err = srv.store.GetOIDCIdentityUser(issuer, subject)
+	if err == nil {
+		return name, 0, nil
+	}
+	if !errors.Is(err, errOIDCIdentityNotFound) {
+		fmt.Println(err)
+		return "", 400, errors.New("Anmeldung fehlgeschlagen")
+	}
+
+	name, _ = claims[srv.oidc.config.usernameClaim].(string)
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", 400, fmt.Errorf("Das ID-Token enthält keinen Benutzernamen im Claim %s", srv.oidc.config.usernameClaim)
+	}
+
+	existing, err := srv.store.GetAccount(name)
+	if errors.Is(err, errUserNotFound) {
+		err = srv.store.AddOIDCUser(name, issuer, subject)
+		if err == nil {
+			return name, 0, nil
+		}
+		// der Name kann zwischenzeitlich vergeben worden sein, dann gilt dasselbe wie für einen bestehenden Benutzer
+		fmt.Println(err)
+		existing, err = srv.store.GetAccount(name)
+	}
+	if err != nil {
+		fmt.Println(err)
+		return "", 400, errors.New("Anmeldung fehlgeschlagen")
+	}
+	if !srv.oidc.config.linkExisting || existing.Admin || !oidcEmailMatches(claims, existing.Email) {
+		return "", 409, errors.New("Ein Benutzer mit diesem Namen existiert bereits, bitte die Identität nach der Anmeldung mit Passwort verknüpfen")
+	}
+	err = srv.store.LinkOIDCIdentity(name, issuer, subject)
+	if err != nil {
+		fmt.Println(err)
+		return "", 400, errors.New("Identität konnte nicht zugeordnet werden")
+	}
+	return name, 0, nil
+}
+
+// oidcEmailMatches prüft, ob das ID-Token eine vom Anbieter bestätigte E-Mail-Adresse enthält, die der eines lokalen Benutzers entspricht
+//
+// Parameter:
+//   - claims: Die geprüften Claims des ID-Tokens
+//   - email: Die hinterlegte E-Mail-Adresse des lokalen Benutzers
+//
+// Rückgabewert:
+//   - bool: "true", falls beide Adressen übereinstimmen und die Adresse im ID-Token bestätigt ist
+func oidcEmailMatches(claims jwt.MapClaims, email string) bool {
+	verified, _ := claims["email_verified"].(bool)
+	claimed, _ := claims["email"].(string)
+	claimed, err := normalizeEmail(claimed)
+	return verified && err == nil && email != "" && claimed == email
+}
+
+// HandleOIDCLogin leitet den Browser zur Anmeldung an den OpenID-Connect-Anbieter weiter
+//
+// Parameter:
+//   - c: Ein Pointer auf ein Context-Objekt von fiber
+//
+// Rückgabewert:
+//   - error: Ein Fehler, falls OIDC nicht eingerichtet ist oder der Anbieter nicht erreichbar ist - wird an Client gesendet
+func (srv *server) HandleOIDCLogin(c *fiber.Ctx) error {
+	if srv.oidc == nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Anmeldung über OpenID Connect ist nicht eingerichtet"})
+	}
+	authURL, binding, err := srv.oidc.beginLogin("")
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(400).JSON(fiber.Map{"error": "Anbieter ist nicht erreichbar"})
+	}
+	srv.oidc.setBindingCookie(c, binding)
+	return c.Redirect(authURL, 302)
+}
+
+// HandleOIDCLink beginnt die Verknüpfung einer Identität mit dem anfragenden Benutzer
+// gesendet wird die Adresse des Anbieters, zu der der Client den Browser weiterleitet; der Callback muss im selben Browser erfolgen,
+// da der Anmeldevorgang über oidcBindingCookie an ihn gebunden ist
+//
+// Parameter:
+//   - c: Ein Pointer auf ein Context-Objekt von fiber
+//
+// Rückgabewert:
+//   - error: Ein Fehler, falls OIDC nicht eingerichtet ist oder der Anbieter nicht erreichbar ist - wird an Client gesendet
+func (srv *server) HandleOIDCLink(c *fiber.Ctx) error {
+	name := c.Locals("name").(string)
+	if srv.oidc == nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Anmeldung über OpenID Connect ist nicht eingerichtet"})
+	}
+	authURL, binding, err := srv.oidc.beginLogin(name)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(400).JSON(fiber.Map{"error": "Anbieter ist nicht erreichbar"})
+	}
+	srv.oidc.setBindingCookie(c, binding)
+	return c.Status(200).JSON(fiber.Map{"url": authURL})
+}
+
+// HandleOIDCCallback schließt die Anmeldung bzw. Verknüpfung ab, nachdem der Anbieter den Browser zurückgeleitet hat
+// ist GO_TODO_OIDC_FRONTEND_URL gesetzt, wird der Browser mit dem token im Fragment dorthin weitergeleitet,
+// sonst werden wie bei HandleLogInUser token, Aufgaben, Kategorien und intelligente Listen gesendet
+// bei aktivierter Zwei-Faktor-Authentifizierung tritt an die Stelle des token die Challenge für HandleLogInTOTP
+//
+// Parameter:
+//   - c: Ein Pointer auf ein Context-Objekt von fiber
+//
+// Rückgabewert:
+//   - error: Ein Fehler, falls der Anmeldevorgang ungültig ist oder das ID-Token abgelehnt wird - wird an Client gesendet
+func (srv *server) HandleOIDCCallback(c *fiber.Ctx) error {
+	if srv.oidc == nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Anmeldung über OpenID Connect ist nicht eingerichtet"})
+	}
+	if providerError := c.Query("error"); providerError != "" {
+		return c.Status(400).JSON(fiber.Map{"error": "Anmeldung beim Anbieter fehlgeschlagen", "details": providerError + " " + c.Query("error_description")})
+	}
+	login, ok := srv.oidc.takeLogin(c.Query("state"), c.Cookies(oidcBindingCookie))
+	srv.oidc.setBindingCookie(c, "")
+	if !ok {
+		return c.Status(400).JSON(fiber.Map{"error": "Ungültiger oder abgelaufener Anmeldevorgang"})
+	}
+
+	idToken, err := srv.oidc.exchangeCode(c.Query("code"), login.verifier)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(400).JSON(fiber.Map{"error": "Anmeldung beim Anbieter fehlgeschlagen"})
+	}
+	claims, err := srv.oidc.verifyIDToken(idToken, login.nonce)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(401).JSON(fiber.Map{"error": "Ungültiges ID-Token"})
+	}
+
+	if login.linkUser != "" {
+		subject, _ := claims["sub"].(string)
+		err = srv.store.LinkOIDCIdentity(login.linkUser, srv.oidc.config.issuer, subject)
+		if errors.Is(err, errOIDCIdentityLinked) {
+			return c.Status(409).JSON(fiber.Map{"error": err.Error()})
+		}
+		if err != nil {
+			fmt.Println(err)
+			return c.Status(400).JSON(fiber.Map{"error": "Identität konnte nicht verknüpft werden"})
+		}
+		if srv.oidc.config.frontendURL != "" {
+			return c.Redirect(srv.oidc.config.frontendURL+"#linked=1", 302)
+		}
+		return c.Status(200).JSON(fiber.Map{"msg": "Identität erfolgreich verknüpft"})
+	}
+
+	name, status, err := srv.oidcUserForIdentity(claims)
+	if err != nil {
+		return c.Status(status).JSON(fiber.Map{"error": err.Error()})
+	}
+	// wie bei HandleLogInUser erhält der Client mit aktivierter Zwei-Faktor-Authentifizierung nur eine Challenge für HandleLogInTOTP
+	required, err := srv.totpEnabled(name)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(400).JSON(fiber.Map{"error": "Anmeldung fehlgeschlagen"})
+	}
+	if required {
+		challenge, err := generateTOTPChallenge(name)
+		if err != nil {
+			fmt.Println(err)
+			return c.Status(400).JSON(fiber.Map{"error": "Anmeldung fehlgeschlagen"})
+		}
+		if srv.oidc.config.frontendURL != "" {
+			return c.Redirect(srv.oidc.config.frontendURL+"#totpRequired=1&challenge="+url.QueryEscape(challenge), 302)
+		}
+		return c.Status(200).JSON(fiber.Map{"totpRequired": true, "challenge": challenge})
+	}
+	token, tasks, categories, err := srv.startSession(name)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	if srv.oidc.config.frontendURL != "" {
+		return c.Redirect(srv.oidc.config.frontendURL+"#token="+url.QueryEscape(token), 302)
+	}
+	smartLists, err := srv.store.GetSmartListsForUser(name)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(400).JSON(fiber.Map{"error": "Fehler beim Laden der Listen"})
+	}
+	return c.Status(200).JSON(fiber.Map{"token": token, "tasks": tasks, "categories": categories, "smartLists": smartLists})
+}
@@ -0,0 +1,345 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// mockIssuer ist ein lokaler OpenID-Connect-Anbieter für Tests
+// authorize ersetzt die Anmeldeseite des Anbieters und legt fest, welche Claims das ID-Token zu einem Code enthält
+type mockIssuer struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+
+	mu    sync.Mutex
+	codes map[string]mockAuthorization
+}
+
+// mockAuthorization ist ein ausgestellter Autorisierungscode mit der PKCE-Challenge und den Claims des ID-Tokens
+type mockAuthorization struct {
+	challenge string
+	claims    jwt.MapClaims
+}
+
+func newMockIssuer(t *testing.T) *mockIssuer {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer := &mockIssuer{key: key, codes: make(map[string]mockAuthorization)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		base := issuer.server.URL
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 base,
+			"authorization_endpoint": base + "/authorize",
+			"token_endpoint":         base + "/token",
+			"jwks_uri":               base + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		encode := base64.RawURLEncoding.EncodeToString
+		json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "test",
+			"n":   encode(key.N.Bytes()),
+			"e":   encode(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		issuer.mu.Lock()
+		authorization, ok := issuer.codes[r.Form.Get("code")]
+		delete(issuer.codes, r.Form.Get("code"))
+		issuer.mu.Unlock()
+
+		sum := sha256.Sum256([]byte(r.Form.Get("code_verifier")))
+		if !ok || base64.RawURLEncoding.EncodeToString(sum[:]) != authorization.challenge {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, authorization.claims)
+		token.Header["kid"] = "test"
+		idToken, err := token.SignedString(key)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"access_token": "unused", "token_type": "Bearer", "id_token": idToken})
+	})
+	issuer.server = httptest.NewServer(mux)
+	t.Cleanup(issuer.server.Close)
+	return issuer
+}
+
+// authorize meldet einen Benutzer beim Anbieter an und liefert Code und state für den Callback
+func (m *mockIssuer) authorize(t *testing.T, authURL string, claims jwt.MapClaims) (code, state string) {
+	t.Helper()
+	parsed, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := parsed.Query()
+	claims["iss"] = m.server.URL
+	claims["aud"] = query.Get("client_id")
+	claims["nonce"] = query.Get("nonce")
+	claims["exp"] = time.Now().Add(time.Hour).Unix()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	code = strconv.Itoa(len(m.codes)+1) + "-" + query.Get("state")[:8]
+	m.codes[code] = mockAuthorization{challenge: query.Get("code_challenge"), claims: claims}
+	return code, query.Get("state")
+}
+
+// newOIDCTestApp erstellt einen Server mit einer leeren SQLite-Datenbank und den Routen für OpenID Connect
+func newOIDCTestApp(t *testing.T, issuer *mockIssuer, linkExisting bool) (*server, *fiber.App) {
+	t.Helper()
+	store, err := openSQLiteStore(filepath.Join(t.TempDir(), "go-todo.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+
+	srv := newServer(store)
+	srv.oidc = newOIDCProvider(oidcConfig{
+		issuer:        issuer.server.URL,
+		clientID:      "go-todo",
+		redirectURL:   "http://localhost:5000/api/oidc/callback",
+		usernameClaim: "preferred_username",
+		linkExisting:  linkExisting,
+	})
+
+	app := fiber.New()
+	app.Get("/api/oidc/login", srv.HandleOIDCLogin)
+	app.Get("/api/oidc/callback", srv.HandleOIDCCallback)
+	app.Use(srv.jwtMiddleware())
+	app.Post("/api/oidc/link", srv.HandleOIDCLink)
+	return srv, app
+}
+
+// bindingCookie liest den Wert von oidcBindingCookie aus einer Antwort
+func bindingCookie(t *testing.T, resp *http.Response) string {
+	t.Helper()
+	for _, cookie := range resp.Cookies() {
+		if cookie.Name == oidcBindingCookie && cookie.Value != "" {
+			return cookie.Value
+		}
+	}
+	t.Fatal("Antwort setzt kein Cookie " + oidcBindingCookie)
+	return ""
+}
+
+// beginOIDCLogin ruft /api/oidc/login auf und liefert die Adresse des Anbieters und das gesetzte Cookie
+func beginOIDCLogin(t *testing.T, app *fiber.App) (authURL, binding string) {
+	t.Helper()
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/api/oidc/login", nil), -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("Login: Status %d, erwartet 302", resp.StatusCode)
+	}
+	return resp.Header.Get("Location"), bindingCookie(t, resp)
+}
+
+// oidcCallback ruft /api/oidc/callback auf, binding wird als Cookie mitgesendet, sofern es nicht leer ist
+func oidcCallback(t *testing.T, app *fiber.App, code, state, binding string) (int, map[string]any) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/api/oidc/callback?"+url.Values{"code": {code}, "state": {state}}.Encode(), nil)
+	if binding != "" {
+		req.AddCookie(&http.Cookie{Name: oidcBindingCookie, Value: binding})
+	}
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	result := map[string]any{}
+	json.Unmarshal(body, &result)
+	return resp.StatusCode, result
+}
+
+func TestOIDCLoginProvisionsUser(t *testing.T) {
+	issuer := newMockIssuer(t)
+	srv, app := newOIDCTestApp(t, issuer, false)
+
+	authURL, binding := beginOIDCLogin(t, app)
+	code, state := issuer.authorize(t, authURL, jwt.MapClaims{"sub": "sub-carol", "preferred_username": "carol"})
+	status, body := oidcCallback(t, app, code, state, binding)
+	if status != http.StatusOK || body["token"] == nil {
+		t.Fatalf("Callback: Status %d, %v", status, body)
+	}
+	name, err := srv.store.GetOIDCIdentityUser(issuer.server.URL, "sub-carol")
+	if err != nil || name != "carol" {
+		t.Fatalf("Identität gehört %q (%v), erwartet carol", name, err)
+	}
+
+	// ein state kann nur einmal verwendet werden
+	status, _ = oidcCallback(t, app, code, state, binding)
+	if status != http.StatusBadRequest {
+		t.Fatalf("Wiederholter Callback: Status %d, erwartet 400", status)
+	}
+}
+
+func TestOIDCCallbackRequiresBindingCookie(t *testing.T) {
+	issuer := newMockIssuer(t)
+	srv, app := newOIDCTestApp(t, issuer, false)
+
+	// der Angreifer beginnt die Anmeldung in seinem Browser und schiebt Code und state einem anderen Browser unter
+	authURL, _ := beginOIDCLogin(t, app)
+	_, otherBinding := beginOIDCLogin(t, app)
+	code, state := issuer.authorize(t, authURL, jwt.MapClaims{"sub": "sub-mallory", "preferred_username": "mallory"})
+
+	for _, binding := range []string{"", otherBinding} {
+		status, _ := oidcCallback(t, app, code, state, binding)
+		if status != http.StatusBadRequest {
+			t.Fatalf("Callback mit Cookie %q: Status %d, erwartet 400", binding, status)
+		}
+	}
+	if _, err := srv.store.GetAccount("mallory"); err != errUserNotFound {
+		t.Fatalf("Benutzer wurde trotz fehlender Bindung angelegt: %v", err)
+	}
+}
+
+func TestOIDCLinkIsBoundToBrowser(t *testing.T) {
+	issuer := newMockIssuer(t)
+	srv, app := newOIDCTestApp(t, issuer, false)
+
+	if err := srv.store.AddUser("alice", "pw"); err != nil {
+		t.Fatal(err)
+	}
+	user, err := srv.store.GetAccount("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := generateJWT(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/oidc/link", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var link struct {
+		URL string `json:"url"`
+	}
+	json.NewDecoder(resp.Body).Decode(&link)
+	binding := bindingCookie(t, resp)
+
+	code, state := issuer.authorize(t, link.URL, jwt.MapClaims{"sub": "sub-victim", "preferred_username": "victim"})
+	status, _ := oidcCallback(t, app, code, state, "")
+	if status != http.StatusBadRequest {
+		t.Fatalf("Verknüpfung ohne Cookie: Status %d, erwartet 400", status)
+	}
+	if _, err := srv.store.GetOIDCIdentityUser(issuer.server.URL, "sub-victim"); err != errOIDCIdentityNotFound {
+		t.Fatalf("Identität wurde ohne Cookie verknüpft: %v", err)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/api/oidc/link", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err = app.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	json.NewDecoder(resp.Body).Decode(&link)
+	binding = bindingCookie(t, resp)
+	code, state = issuer.authorize(t, link.URL, jwt.MapClaims{"sub": "sub-alice", "preferred_username": "alice-sso"})
+	status, body := oidcCallback(t, app, code, state, binding)
+	if status != http.StatusOK {
+		t.Fatalf("Verknüpfung: Status %d, %v", status, body)
+	}
+	if name, err := srv.store.GetOIDCIdentityUser(issuer.server.URL, "sub-alice"); err != nil || name != "alice" {
+		t.Fatalf("Identität gehört %q (%v), erwartet alice", name, err)
+	}
+}
+
+func TestOIDCExistingNameIsNotTaken(t *testing.T) {
+	issuer := newMockIssuer(t)
+	srv, app := newOIDCTestApp(t, issuer, true)
+
+	for _, name := range []string{"dave", "root"} {
+		if err := srv.store.AddUser(name, "pw"); err != nil {
+			t.Fatal(err)
+		}
+		if err := srv.store.SetUserEmail(name, name+"@example.com"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := srv.store.SetUserAdmin("root", true); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		claims jwt.MapClaims
+		status int
+	}{
+		{"ohne E-Mail", jwt.MapClaims{"sub": "sub-1", "preferred_username": "dave"}, http.StatusConflict},
+		{"unbestätigte E-Mail", jwt.MapClaims{"sub": "sub-2", "preferred_username": "dave", "email": "dave@example.com"}, http.StatusConflict},
+		{"andere E-Mail", jwt.MapClaims{"sub": "sub-3", "preferred_username": "dave", "email": "eve@example.com", "email_verified": true}, http.StatusConflict},
+		{"Administrator", jwt.MapClaims{"sub": "sub-4", "preferred_username": "root", "email": "root@example.com", "email_verified": true}, http.StatusConflict},
+		{"bestätigte E-Mail", jwt.MapClaims{"sub": "sub-5", "preferred_username": "dave", "email": "Dave@example.com", "email_verified": true}, http.StatusOK},
+	}
+	for _, test := range tests {
+		authURL, binding := beginOIDCLogin(t, app)
+		code, state := issuer.authorize(t, authURL, test.claims)
+		status, body := oidcCallback(t, app, code, state, binding)
+		if status != test.status {
+			t.Errorf("%s: Status %d, erwartet %d (%v)", test.name, status, test.status, body)
+		}
+	}
+	if name, err := srv.store.GetOIDCIdentityUser(issuer.server.URL, "sub-5"); err != nil || name != "dave" {
+		t.Fatalf("Identität gehört %q (%v), erwartet dave", name, err)
+	}
+}
+
+func TestOIDCLoginRequiresTOTP(t *testing.T) {
+	issuer := newMockIssuer(t)
+	srv, app := newOIDCTestApp(t, issuer, false)
+
+	authURL, binding := beginOIDCLogin(t, app)
+	code, state := issuer.authorize(t, authURL, jwt.MapClaims{"sub": "sub-erin", "preferred_username": "erin"})
+	if status, body := oidcCallback(t, app, code, state, binding); status != http.StatusOK {
+		t.Fatalf("Erster Login: Status %d, %v", status, body)
+	}
+	if err := srv.store.SetTOTPSecret("erin", "JBSWY3DPEHPK3PXP"); err != nil {
+		t.Fatal(err)
+	}
+	if err := srv.store.EnableTOTP("erin", 1, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	authURL, binding = beginOIDCLogin(t, app)
+	code, state = issuer.authorize(t, authURL, jwt.MapClaims{"sub": "sub-erin", "preferred_username": "erin"})
+	status, body := oidcCallback(t, app, code, state, binding)
+	if status != http.StatusOK || body["totpRequired"] != true || body["token"] != nil {
+		t.Fatalf("Login mit Zwei-Faktor-Authentifizierung: Status %d, %v", status, body)
+	}
+	if name, err := parseTOTPChallenge(strings.TrimSpace(body["challenge"].(string))); err != nil || name != "erin" {
+		t.Fatalf("Challenge gehört %q (%v), erwartet erin", name, err)
+	}
+}
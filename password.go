@@ -0,0 +1,101 @@
+package main
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// bcrypt verarbeitet höchstens 72 Bytes, längere Passwörter werden abgelehnt statt stillschweigend gekürzt
+const passwordMaxBytes = 72
+
+// passwordHashCost ist der Kostenfaktor für neue Hashes; Tests setzen ihn herab
+var passwordHashCost = bcrypt.DefaultCost
+
+// unknownUserPasswordHash wird bei unbekannten Benutzern geprüft, damit die Antwortzeit nicht verrät, ob ein Benutzer existiert
+const unknownUserPasswordHash = "$2a$10$qD906KPKhfquOc/DpLxprOUq4pRuVryBPPDGSZ97dFMSAFDzbHEyu"
+
+var errPasswordTooLong = errors.New("Das Passwort darf höchstens 72 Bytes lang sein")
+
+// hashPassword erstellt den bcrypt-Hash, der statt des Passworts in users.password gespeichert wird
+//
+// Parameter:
+//   - password: Das Passwort im Klartext
+//
+// Rückgabewert:
+//   - string: Der Hash inklusive Salt und Kostenfaktor
+//   - error: errPasswordTooLong, falls das Passwort länger als 72 Bytes ist; "nil", falls kein Fehler auftritt
+func hashPassword(password string) (string, error) {
+	if len(password) > passwordMaxBytes {
+		return "", errPasswordTooLong
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), passwordHashCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// verifyPassword vergleicht ein eingegebenes Passwort mit dem gespeicherten Wert
+// Benutzer, die vor der Einführung der Hashes angelegt wurden, haben noch ein Passwort im Klartext gespeichert;
+// es wird in konstanter Zeit verglichen und muss danach durch einen Hash ersetzt werden
+//
+// Parameter:
+//   - stored: Der Wert aus users.password
+//   - password: Das eingegebene Passwort
+//
+// Rückgabewert:
+//   - ok: "true", falls das Passwort korrekt ist
+//   - legacy: "true", falls der gespeicherte Wert noch kein Hash ist
+func verifyPassword(stored, password string) (ok, legacy bool) {
+	if strings.HasPrefix(stored, "$2") {
+		if _, err := bcrypt.Cost([]byte(stored)); err == nil {
+			return bcrypt.CompareHashAndPassword([]byte(stored), []byte(password)) == nil, false
+		}
+	}
+	return subtle.ConstantTimeCompare([]byte(stored), []byte(password)) == 1, true
+}
+
+// CheckPassword prüft das Passwort eines Benutzers
+// ein noch im Klartext gespeichertes Passwort wird nach erfolgreicher Prüfung durch einen Hash ersetzt
+//
+// Parameter:
+//   - name: Der Name des Benutzers
+//   - password: Das eingegebene Passwort
+//
+// Rückgabewert:
+//   - error: errUserNotFound, falls der Benutzer nicht existiert; errBadCredentials, falls das Passwort falsch ist; "nil", falls es korrekt ist
+func (s *sqlStore) CheckPassword(name, password string) error {
+	var stored string
+	err := s.db.QueryRow(`SELECT password FROM users WHERE name = ?`, name).Scan(&stored)
+	if errors.Is(err, sql.ErrNoRows) {
+		bcrypt.CompareHashAndPassword([]byte(unknownUserPasswordHash), []byte(password))
+		return errUserNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	ok, legacy := verifyPassword(stored, password)
+	if !ok || password == "" {
+		return errBadCredentials
+	}
+	if !legacy {
+		return nil
+	}
+
+	hash, err := hashPassword(password)
+	if errors.Is(err, errPasswordTooLong) {
+		// ältere Passwörter über 72 Bytes bleiben gültig, bis der Benutzer sie ändert
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	// nur ersetzen, falls das Passwort nicht zwischenzeitlich geändert wurde
+	_, err = s.db.Exec(`UPDATE users SET password = ? WHERE name = ? AND password = ?`, hash, name, stored)
+	return err
+}
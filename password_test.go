@@ -0,0 +1,73 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func init() {
+	// der Standard-Kostenfaktor würde jeden Test mit Benutzern spürbar verlangsamen
+	passwordHashCost = bcrypt.MinCost
+}
+
+func TestVerifyPassword(t *testing.T) {
+	hash, err := hashPassword("geheim")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		stored, password string
+		ok, legacy       bool
+	}{
+		{hash, "geheim", true, false},
+		{hash, "Geheim", false, false},
+		{hash, hash, false, false},
+		{"geheim", "geheim", true, true},
+		{"geheim", "geheim2", false, true},
+		{"$2klartext", "$2klartext", true, true},
+	} {
+		ok, legacy := verifyPassword(c.stored, c.password)
+		if ok != c.ok || legacy != c.legacy {
+			t.Errorf("verifyPassword(%q, %q) = %v, %v, erwartet %v, %v", c.stored, c.password, ok, legacy, c.ok, c.legacy)
+		}
+	}
+
+	if _, err := hashPassword(strings.Repeat("a", passwordMaxBytes+1)); !errors.Is(err, errPasswordTooLong) {
+		t.Fatalf("Zu langes Passwort: %v", err)
+	}
+}
+
+func TestCheckPasswordUpgradesLegacyPassword(t *testing.T) {
+	forEachDialect(t, func(t *testing.T, store *sqlStore) {
+		addUsers(t, store, "alice")
+		var stored string
+		if err := store.db.QueryRow(`SELECT password FROM users WHERE name = ?`, "alice").Scan(&stored); err != nil {
+			t.Fatal(err)
+		}
+		if stored == "pw" || !strings.HasPrefix(stored, "$2") {
+			t.Fatalf("Passwort wurde nicht gehasht gespeichert: %q", stored)
+		}
+
+		if _, err := store.db.Exec(`UPDATE users SET password = ? WHERE name = ?`, "alt", "alice"); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.CheckPassword("alice", "falsch"); !errors.Is(err, errBadCredentials) {
+			t.Fatalf("Falsches Passwort: %v", err)
+		}
+		if err := store.db.QueryRow(`SELECT password FROM users WHERE name = ?`, "alice").Scan(&stored); err != nil || stored != "alt" {
+			t.Fatalf("Passwort nach Fehlversuch: %q, %v", stored, err)
+		}
+		if err := store.CheckPassword("alice", "alt"); err != nil {
+			t.Fatalf("Passwort im Klartext: %v", err)
+		}
+		if err := store.db.QueryRow(`SELECT password FROM users WHERE name = ?`, "alice").Scan(&stored); err != nil || !strings.HasPrefix(stored, "$2") {
+			t.Fatalf("Passwort wurde nicht durch einen Hash ersetzt: %q, %v", stored, err)
+		}
+		if err := store.CheckPassword("alice", "alt"); err != nil {
+			t.Fatalf("Passwort nach dem Ersetzen: %v", err)
+		}
+	})
+}
@@ -0,0 +1,363 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// passwordResetInterval ist der Mindestabstand zwischen zwei E-Mails zum Zurücksetzen an denselben Benutzer
+const passwordResetInterval = time.Minute
+
+var (
+	errPasswordResetInvalid = errors.New("Der Link zum Zurücksetzen ist ungültig oder abgelaufen")
+	errPasswordResetTooSoon = errors.New("Zum Zurücksetzen wurde gerade erst eine E-Mail versendet")
+	errEmailExists          = errors.New("Diese E-Mail-Adresse wird bereits verwendet")
+	errInvalidEmail         = errors.New("Ungültige E-Mail-Adresse")
+)
+
+// normalizeEmail prüft eine eingegebene E-Mail-Adresse und wandelt sie in Kleinbuchstaben um
+// Adressen mit Anzeigenamen wie "Alice <alice@example.com>" werden abgelehnt
+//
+// Parameter:
+//   - input: Die eingegebene Adresse
+//
+// Rückgabewert:
+//   - string: Die normalisierte Adresse; "", falls keine Adresse eingegeben wurde
+//   - error: errInvalidEmail, falls die Adresse ungültig ist; "nil", falls nicht
+func normalizeEmail(input string) (string, error) {
+	input = strings.TrimSpace(input)
+	if input == "" {
+		return "", nil
+	}
+	address, err := mail.ParseAddress(input)
+	if err != nil || address.Address != input {
+		return "", errInvalidEmail
+	}
+	return strings.ToLower(address.Address), nil
+}
+
+// SetUserEmail hinterlegt die E-Mail-Adresse eines Benutzers, an die Links zum Zurücksetzen des Passworts gesendet werden
+//
+// Parameter:
+//   - name: Der Name des Benutzers
+//   - email: Die normalisierte Adresse; "", um die Adresse zu entfernen
+//
+// Rückgabewert:
+//   - error: errEmailExists, falls ein anderer Benutzer die Adresse verwendet; errUserNotFound, falls der Benutzer nicht existiert; "nil", falls kein Fehler auftritt
+func (s *sqlStore) SetUserEmail(name, email string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	var value interface{}
+	if email != "" {
+		value = email
+		var exists bool
+		err = tx.QueryRow(`SELECT EXISTS(SELECT 1 FROM users WHERE email = ? AND name <> ?)`, email, name).Scan(&exists)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		if exists {
+			tx.Rollback()
+			return errEmailExists
+		}
+	}
+
+	result, err := tx.Exec(`UPDATE users SET email = ? WHERE name = ?`, value, name)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if affected == 0 {
+		tx.Rollback()
+		return errUserNotFound
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return nil
+}
+
+// GetAccountByEmail lädt einen Benutzer über seine E-Mail-Adresse
+//
+// Parameter:
+//   - email: Die normalisierte Adresse
+//
+// Rückgabewert:
+//   - user: Der Benutzer; "nil", falls ein Fehler auftritt
+//   - error: errUserNotFound, falls kein Benutzer die Adresse verwendet; "nil", falls kein Fehler auftritt
+func (s *sqlStore) GetAccountByEmail(email string) (*account, error) {
+	return scanAccount(s.db.QueryRow(`SELECT `+accountColumns+` FROM users WHERE email = ?`, email))
+}
+
+// AddPasswordReset erzeugt ein einmaliges Token zum Zurücksetzen des Passworts, gespeichert wird nur der SHA-256-Hash
+// verbrauchte und abgelaufene Token des Benutzers werden dabei entfernt
+//
+// Parameter:
+//   - name: Der Name des Benutzers
+//   - ttl: Die Gültigkeitsdauer des Token
+//
+// Rückgabewert:
+//   - secret: Das Token im Klartext; "", falls ein Fehler auftritt
+//   - expiresAt: Der Zeitpunkt, bis zu dem das Token gültig ist
+//   - error: errPasswordResetTooSoon, falls innerhalb von passwordResetInterval bereits ein Token erzeugt wurde; "nil", falls kein Fehler auftritt
+func (s *sqlStore) AddPasswordReset(name string, ttl time.Duration) (secret string, expiresAt time.Time, err error) {
+	now := time.Now()
+	expiresAt = now.Add(ttl).Truncate(time.Second)
+
+	secret, err = newSecretToken()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	_, err = tx.Exec(`DELETE FROM password_resets WHERE user_id = `+userIDSQL+` AND (used_at IS NOT NULL OR expires_at <= ?)`, name, now.Unix())
+	if err != nil {
+		tx.Rollback()
+		return "", time.Time{}, err
+	}
+
+	var recent bool
+	err = tx.QueryRow(`SELECT EXISTS(SELECT 1 FROM password_resets WHERE user_id = `+userIDSQL+` AND created_at > ?)`, name, now.Add(-passwordResetInterval).Unix()).Scan(&recent)
+	if err != nil {
+		tx.Rollback()
+		return "", time.Time{}, err
+	}
+	if recent {
+		tx.Rollback()
+		return "", time.Time{}, errPasswordResetTooSoon
+	}
+
+	_, err = tx.Exec(`INSERT INTO password_resets (token_hash, user_id, created_at, expires_at) VALUES (?,`+userIDSQL+`,?,?)`,
+		hashSecretToken(secret), name, now.Unix(), expiresAt.Unix())
+	if err != nil {
+		tx.Rollback()
+		return "", time.Time{}, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		tx.Rollback()
+		return "", time.Time{}, err
+	}
+	return secret, expiresAt, nil
+}
+
+// ResetPassword löst ein Token zum Zurücksetzen ein und setzt das neue Passwort
+// wie bei ChangePassword wird die Sitzungsversion erhöht und alle Zugriffstoken und App-Passwörter werden widerrufen; weitere offene Token des Benutzers verfallen
+//
+// Parameter:
+//   - secret: Das Token aus der E-Mail
+//   - password: Das neue Passwort
+//
+// Rückgabewert:
+//   - user: Der Benutzer mit der neuen Sitzungsversion; "nil", falls ein Fehler auftritt
+//   - error: errPasswordResetInvalid, falls das Token unbekannt, bereits verwendet oder abgelaufen ist; errPasswordTooLong, falls das Passwort zu lang ist; "nil", falls kein Fehler auftritt
+func (s *sqlStore) ResetPassword(secret, password string) (*account, error) {
+	now := time.Now().Unix()
+	hash, err := hashPassword(password)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	var name string
+	query := `UPDATE password_resets SET used_at = ? WHERE token_hash = ? AND used_at IS NULL AND expires_at > ? RETURNING ` + userNameSQL("user_id")
+	err = tx.QueryRow(query, now, hashSecretToken(secret), now).Scan(&name)
+	if err != nil {
+		tx.Rollback()
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errPasswordResetInvalid
+		}
+		return nil, err
+	}
+
+	query = `UPDATE users SET password = ?, token_version = token_version + 1 WHERE name = ? RETURNING ` + accountColumns
+	user, err := scanAccount(tx.QueryRow(query, hash, name))
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	_, err = tx.Exec(`DELETE FROM password_resets WHERE user_id = `+userIDSQL+` AND used_at IS NULL`, name)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	err = revokeCredentials(tx, name)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	return user, nil
+}
+
+// sendPasswordReset versendet die E-Mail mit dem Token zum Zurücksetzen, Fehler werden nur protokolliert
+// ist GO_TODO_PASSWORD_RESET_URL gesetzt, enthält die E-Mail einen Link zum Frontend mit dem Token im Fragment
+//
+// Parameter:
+//   - user: Der Benutzer mit hinterlegter E-Mail-Adresse
+//   - secret: Das Token im Klartext
+//   - expiresAt: Der Zeitpunkt, bis zu dem das Token gültig ist
+func (srv *server) sendPasswordReset(user *account, secret string, expiresAt time.Time) {
+	kind, instruction := "Code", "Gib den folgenden Code zusammen mit deinem neuen Passwort ein:\n\n"+secret
+	if passwordResetURL != "" {
+		kind, instruction = "Link", "Öffne den folgenden Link, um ein neues Passwort festzulegen:\n\n"+passwordResetURL+"#resetToken="+secret
+	}
+	body := fmt.Sprintf("Hallo %s,\n\nfür dein Konto wurde das Zurücksetzen des Passworts angefordert. %s\n\n"+
+		"Der %s ist bis %s gültig und kann nur einmal verwendet werden. Falls du das Zurücksetzen nicht angefordert hast, kannst du diese E-Mail ignorieren.\n",
+		user.Name, instruction, kind, expiresAt.Format("02.01.2006 15:04"))
+
+	err := srv.mailer.send(user.Email, "Passwort zurücksetzen", body)
+	if err != nil {
+		log.Printf("E-Mail zum Zurücksetzen des Passworts für %s konnte nicht versendet werden: %v", user.Name, err)
+	}
+}
+
+// HandleSetAccountEmail hinterlegt die E-Mail-Adresse des angemeldeten Benutzers, z.B. {"email": "alice@example.com", "password": "..."}
+// eine leere Adresse entfernt die hinterlegte Adresse
+//
+// Parameter:
+//   - c: Ein Pointer auf ein Context-Objekt von fiber
+//
+// Rückgabewert:
+//   - error: Ein Fehler, falls das Passwort falsch, die Adresse ungültig oder bereits vergeben ist - wird an Client gesendet
+func (srv *server) HandleSetAccountEmail(c *fiber.Ctx) error {
+	name := c.Locals("name").(string)
+	type EmailInput struct {
+		Email    string `json:"email"`
+		Password string `json:"password"`
+	}
+	var input EmailInput
+	if err := c.BodyParser(&input); err != nil {
+		fmt.Println(err)
+		return c.Status(400).JSON(fiber.Map{"error": "Ungültige Eingabedaten"})
+	}
+	email, err := normalizeEmail(input.Email)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	if rejected, err := srv.confirmPassword(c, name, input.Password); rejected {
+		return err
+	}
+
+	err = srv.store.SetUserEmail(name, email)
+	if err != nil {
+		fmt.Println(err)
+		if errors.Is(err, errEmailExists) {
+			return c.Status(409).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.Status(400).JSON(fiber.Map{"error": "E-Mail-Adresse konnte nicht gespeichert werden"})
+	}
+	return c.Status(200).JSON(fiber.Map{"msg": "E-Mail-Adresse erfolgreich gespeichert", "email": email})
+}
+
+// HandleRequestPasswordReset versendet eine E-Mail zum Zurücksetzen des Passworts, z.B. {"name": "alice"} oder {"name": "alice@example.com"}
+// die Antwort ist unabhängig davon, ob der Benutzer existiert und eine E-Mail-Adresse hinterlegt hat, damit keine Konten erraten werden können
+//
+// Parameter:
+//   - c: Ein Pointer auf ein Context-Objekt von fiber
+//
+// Rückgabewert:
+//   - error: Ein Fehler, falls kein SMTP-Relay eingerichtet ist - wird an Client gesendet
+func (srv *server) HandleRequestPasswordReset(c *fiber.Ctx) error {
+	if srv.mailer == nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Zurücksetzen des Passworts ist nicht eingerichtet"})
+	}
+	type ResetInput struct {
+		Name string `json:"name"`
+	}
+	var input ResetInput
+	if err := c.BodyParser(&input); err != nil {
+		fmt.Println(err)
+		return c.Status(400).JSON(fiber.Map{"error": "Ungültige Eingabedaten"})
+	}
+	login := strings.TrimSpace(input.Name)
+	if login == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "Benutzername oder E-Mail-Adresse darf nicht leer sein"})
+	}
+
+	user, err := srv.store.GetAccount(login)
+	if errors.Is(err, errUserNotFound) && strings.Contains(login, "@") {
+		user, err = srv.store.GetAccountByEmail(strings.ToLower(login))
+	}
+	if err == nil && user.Email != "" {
+		var secret string
+		var expiresAt time.Time
+		secret, expiresAt, err = srv.store.AddPasswordReset(user.Name, passwordResetTTL)
+		if err == nil {
+			go srv.sendPasswordReset(user, secret, expiresAt)
+		}
+	}
+	if err != nil && !errors.Is(err, errUserNotFound) && !errors.Is(err, errPasswordResetTooSoon) {
+		fmt.Println(err)
+		return c.Status(400).JSON(fiber.Map{"error": "Zurücksetzen konnte nicht angefordert werden"})
+	}
+	return c.Status(200).JSON(fiber.Map{"msg": "Falls für dieses Konto eine E-Mail-Adresse hinterlegt ist, wurde eine E-Mail zum Zurücksetzen versendet"})
+}
+
+// HandleResetPassword setzt mit dem Token aus der E-Mail ein neues Passwort, z.B. {"token": "...", "password": "..."}
+// alle bisherigen Sitzungen werden widerrufen und die Drosselung fehlgeschlagener Anmeldungen des Benutzers aufgehoben
+//
+// Parameter:
+//   - c: Ein Pointer auf ein Context-Objekt von fiber
+//
+// Rückgabewert:
+//   - error: Ein Fehler, falls das Token ungültig oder das Passwort leer ist - wird an Client gesendet
+func (srv *server) HandleResetPassword(c *fiber.Ctx) error {
+	type ResetInput struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+	var input ResetInput
+	if err := c.BodyParser(&input); err != nil {
+		fmt.Println(err)
+		return c.Status(400).JSON(fiber.Map{"error": "Ungültige Eingabedaten"})
+	}
+	if strings.TrimSpace(input.Password) == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "Das neue Passwort darf nicht leer sein"})
+	}
+
+	user, err := srv.store.ResetPassword(strings.TrimSpace(input.Token), input.Password)
+	if err != nil {
+		fmt.Println(err)
+		if errors.Is(err, errPasswordResetInvalid) || errors.Is(err, errPasswordTooLong) {
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.Status(400).JSON(fiber.Map{"error": "Passwort konnte nicht zurückgesetzt werden"})
+	}
+	closeClient(user.Name)
+	srv.clearLoginFailures(user.Name)
+	return c.Status(200).JSON(fiber.Map{"msg": "Passwort erfolgreich zurückgesetzt, bitte neu anmelden"})
+}
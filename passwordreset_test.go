@@ -0,0 +1,118 @@
+package main
+
+import (
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestPasswordResetRevokesCredentials(t *testing.T) {
+	addr, mails := newSMTPCapture(t)
+	store, err := openSQLiteStore(filepath.Join(t.TempDir(), "go-todo.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	srv := newServer(store)
+	srv.mailer = newMailer(mailConfig{addr: addr, from: "go-todo@localhost"})
+
+	previousURL := passwordResetURL
+	passwordResetURL = "https://todo.example.com/reset"
+	t.Cleanup(func() { passwordResetURL = previousURL })
+
+	if err := store.AddUser("alice", "alt"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SetUserEmail("alice", "alice@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	_, tokenSecret, err := store.AddAccessToken("alice", "skript", []string{scopeTasksRead})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, appSecret, err := store.AddAppPassword("alice", "telefon")
+	if err != nil {
+		t.Fatal(err)
+	}
+	before, err := store.GetAccount("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	secret, expiresAt, err := store.AddPasswordReset("alice", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.sendPasswordReset(before, secret, expiresAt)
+	captured, _, subject, body := receiveMail(t, mails)
+	if captured.to[0] != "alice@example.com" || subject != "Passwort zurücksetzen" {
+		t.Fatalf("E-Mail %q an %v", subject, captured.to)
+	}
+	match := regexp.MustCompile(`https://todo\.example\.com/reset#resetToken=(\S+)`).FindStringSubmatch(body)
+	if match == nil || match[1] != secret {
+		t.Fatalf("E-Mail enthält keinen Link mit dem Token:\n%s", body)
+	}
+
+	after, err := store.ResetPassword(match[1], "neu")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after.TokenVersion <= before.TokenVersion {
+		t.Fatalf("Sitzungsversion %d wurde nicht erhöht (vorher %d)", after.TokenVersion, before.TokenVersion)
+	}
+	if err := store.CheckPassword("alice", "neu"); err != nil {
+		t.Fatalf("Neues Passwort: %v", err)
+	}
+	if name, _, err := store.CheckAccessToken(tokenSecret); err == nil && name != "" {
+		t.Fatal("Zugriffstoken ist nach dem Zurücksetzen noch gültig")
+	}
+	if ok, _ := store.CheckAppPassword("alice", appSecret); ok {
+		t.Fatal("App-Passwort ist nach dem Zurücksetzen noch gültig")
+	}
+	if _, err := store.ResetPassword(match[1], "nochmal"); err != errPasswordResetInvalid {
+		t.Fatalf("Token konnte erneut verwendet werden: %v", err)
+	}
+}
+
+func TestChangePasswordRevokesCredentials(t *testing.T) {
+	store, err := openSQLiteStore(filepath.Join(t.TempDir(), "go-todo.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+
+	for _, name := range []string{"alice", "bob"} {
+		if err := store.AddUser(name, "alt"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, aliceToken, err := store.AddAccessToken("alice", "skript", []string{scopeTasksRead})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, bobToken, err := store.AddAccessToken("bob", "skript", []string{scopeTasksRead})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, appSecret, err := store.AddAppPassword("alice", "telefon")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := store.ChangePassword("alice", "neu"); err != nil {
+		t.Fatal(err)
+	}
+	if name, _, err := store.CheckAccessToken(aliceToken); err == nil && name != "" {
+		t.Fatal("Zugriffstoken ist nach der Passwortänderung noch gültig")
+	}
+	if ok, _ := store.CheckAppPassword("alice", appSecret); ok {
+		t.Fatal("App-Passwort ist nach der Passwortänderung noch gültig")
+	}
+	if name, _, err := store.CheckAccessToken(bobToken); err != nil || name != "bob" {
+		t.Fatalf("Zugriffstoken eines anderen Benutzers wurde widerrufen: %q, %v", name, err)
+	}
+	if _, err := store.ChangePassword("nobody", "neu"); err != errUserNotFound {
+		t.Fatalf("Passwortänderung für unbekannten Benutzer: %v", err)
+	}
+}
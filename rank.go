@@ -0,0 +1,566 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Die Reihenfolge der Aufgaben wird über Rangschlüssel in task_order.rank_key gespeichert, getrennt je Ansicht (task_order.view_key)
+// ein Rangschlüssel ist ein Bruch zwischen 0 und 1 in Basis 36 ohne führendes "0." und ohne Nullen am Ende,
+// wodurch der lexikographische Vergleich der Schlüssel dem Vergleich der Zahlen entspricht
+// zwischen zwei Schlüsseln lässt sich immer ein weiterer finden, eine Verschiebung ändert daher nur eine Zeile
+const rankDigits = "0123456789abcdefghijklmnopqrstuvwxyz"
+
+// rankRebalanceLength ist die Länge eines Rangschlüssels, ab der die Schlüssel eines Benutzers neu verteilt werden
+const rankRebalanceLength = 12
+
+// orderPositionSQL ermittelt die Position einer Aufgabe (Alias t) in der Liste des Benutzers aus dem Join task_order o
+// gezählt werden alle aktiven Aufgaben in der Gesamtliste des Benutzers mit kleinerem Rangschlüssel
+const orderPositionSQL = `COALESCE((SELECT COUNT(*) FROM task_order p INNER JOIN tasks pt ON pt.id = p.task_id
+	WHERE p.user_id = o.user_id AND p.view_key = o.view_key AND p.rank_key < o.rank_key AND pt.deleted_at IS NULL AND pt.archived_at IS NULL), 0)`
+
+var (
+	errInvalidPosition = errors.New("Aufgabe kann nicht relativ zu sich selbst verschoben werden")
+	errInvalidView     = errors.New("Ungültige Ansicht")
+)
+
+// rankBetween erstellt einen Rangschlüssel, der zwischen zwei bestehenden Schlüsseln liegt
+//
+// Parameter:
+//   - lo: Der untere Schlüssel; "" für den Anfang der Liste
+//   - hi: Der obere Schlüssel; "" für das Ende der Liste
+//
+// Rückgabewert:
+//   - string: Ein Schlüssel k mit lo < k < hi
+func rankBetween(lo, hi string) string {
+	if hi != "" && lo >= hi {
+		hi = ""
+	}
+	base := len(rankDigits)
+	key := make([]byte, 0, len(lo)+1)
+
+	for i := 0; ; i++ {
+		l := 0
+		if i < len(lo) {
+			l = strings.IndexByte(rankDigits, lo[i])
+		}
+		h := base
+		if hi != "" {
+			h = 0
+			if i < len(hi) {
+				h = strings.IndexByte(rankDigits, hi[i])
+			}
+		}
+
+		switch {
+		case l == h:
+			key = append(key, rankDigits[l])
+		case h-l > 1:
+			return string(append(key, rankDigits[(l+h)/2]))
+		default:
+			// ab hier liegt der Schlüssel bereits unter hi, es muss nur noch lo überschritten werden
+			key = append(key, rankDigits[l])
+			hi = ""
+		}
+	}
+}
+
+// evenRankKeys erstellt gleichmäßig verteilte, möglichst kurze Rangschlüssel für eine Liste
+//
+// Parameter:
+//   - n: Die Anzahl der benötigten Schlüssel
+//
+// Rückgabewert:
+//   - keys: Die Schlüssel in aufsteigender Reihenfolge
+func evenRankKeys(n int) []string {
+	width := len(strconv.FormatInt(int64(n+1), len(rankDigits))) + 1
+	space := int64(1)
+	for i := 0; i < width; i++ {
+		space *= int64(len(rankDigits))
+	}
+
+	keys := make([]string, 0, n)
+	for i := 1; i <= n; i++ {
+		value := strconv.FormatInt(int64(i)*space/int64(n+1), len(rankDigits))
+		value = strings.Repeat("0", width-len(value)) + value
+		keys = append(keys, strings.TrimRight(value, "0"))
+	}
+	return keys
+}
+
+// globalView bezeichnet die Gesamtliste eines Benutzers in task_order.view_key
+const globalView = ""
+
+// categoryView bezeichnet die Ansicht einer Kategorie in task_order.view_key
+//
+// Parameter:
+//   - catID: Die ID der Kategorie
+//
+// Rückgabewert:
+//   - string: Der Schlüssel der Ansicht
+func categoryView(catID int) string {
+	return "category:" + strconv.Itoa(catID)
+}
+
+// smartListView bezeichnet die Ansicht einer intelligenten Liste in task_order.view_key
+//
+// Parameter:
+//   - listID: Die ID der intelligenten Liste
+//
+// Rückgabewert:
+//   - string: Der Schlüssel der Ansicht
+func smartListView(listID int) string {
+	return "smartlist:" + strconv.Itoa(listID)
+}
+
+// lastRankForUser ermittelt den größten Rangschlüssel in der Gesamtliste eines Benutzers, damit neue Aufgaben am Ende eingefügt werden können
+//
+// Parameter:
+//   - tx: Die laufende Transaktion
+//   - name: Der Name des Benutzers
+//
+// Rückgabewert:
+//   - rankKey: Der größte Rangschlüssel; "", falls der Benutzer noch keine Aufgaben hat
+//   - error: Ein Fehler, falls bei der Abfrage ein Fehler auftritt; "nil", falls nicht
+func lastRankForUser(tx *sqlTx, name string) (rankKey string, err error) {
+	err = tx.QueryRow(`SELECT COALESCE(MAX(rank_key), '') FROM task_order WHERE user_id = `+userIDSQL+` AND view_key = ''`, name).Scan(&rankKey)
+	return rankKey, err
+}
+
+// getViewTaskIDs ermittelt die aktiven Aufgaben einer Ansicht in der Reihenfolge, in der sie dem Benutzer angezeigt werden
+// Aufgaben mit eigenem Rangschlüssel in der Ansicht stehen vorne, neue Aufgaben ohne Schlüssel folgen in der Reihenfolge der Gesamtliste
+//
+// Parameter:
+//   - q: Die Datenbank oder eine laufende Transaktion
+//   - name: Der Name des Benutzers
+//   - view: Der Schlüssel der Ansicht, siehe globalView, categoryView und smartListView
+//
+// Rückgabewert:
+//   - taskIDs: Die IDs der Aufgaben in angezeigter Reihenfolge
+//   - error: errCategoryNotFound bzw. errSmartListNotFound, falls die Ansicht nicht dem Benutzer gehört; errInvalidView bei unbekannter Ansicht
+func (s *sqlStore) getViewTaskIDs(q sqlQueryer, name, view string) ([]int, error) {
+	globalQuery := `SELECT o.task_id FROM task_order o INNER JOIN tasks t ON t.id = o.task_id
+	WHERE o.user_id = ` + userIDSQL + ` AND o.view_key = '' AND t.deleted_at IS NULL AND t.archived_at IS NULL
+	ORDER BY o.rank_key`
+	categoryQuery := `SELECT t.id FROM tasks t
+	INNER JOIN task_order o ON o.task_id = t.id AND o.user_id = ` + userIDSQL + ` AND o.view_key = ''
+	LEFT JOIN task_order v ON v.task_id = t.id AND v.user_id = o.user_id AND v.view_key = ?
+	WHERE t.category_id = ? AND t.deleted_at IS NULL AND t.archived_at IS NULL
+	ORDER BY v.rank_key IS NULL, v.rank_key, o.rank_key`
+	categoryExistsQuery := `SELECT EXISTS(SELECT 1 FROM categories WHERE id = ? AND user_id = ` + userIDSQL + ` AND deleted_at IS NULL)`
+
+	if view == globalView {
+		return queryTaskIDs(q, globalQuery, name)
+	}
+
+	kind, value, _ := strings.Cut(view, ":")
+	id, err := strconv.Atoi(value)
+	if err != nil {
+		return nil, errInvalidView
+	}
+	switch kind {
+	case "category":
+		var exists bool
+		err = q.QueryRow(categoryExistsQuery, id, name).Scan(&exists)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			return nil, errCategoryNotFound
+		}
+		return queryTaskIDs(q, categoryQuery, name, view, id)
+	case "smartlist":
+		results, err := s.smartListTasks(q, name, id)
+		if err != nil {
+			return nil, err
+		}
+		taskIDs := make([]int, 0, len(results))
+		for _, result := range results {
+			taskIDs = append(taskIDs, result.Task.ID)
+		}
+		return taskIDs, nil
+	}
+	return nil, errInvalidView
+}
+
+// GetTasksForView lädt die Aufgaben einer Ansicht in angezeigter Reihenfolge, order entspricht der Position in der Ansicht
+//
+// Parameter:
+//   - name: Der Name des Benutzers
+//   - view: Der Schlüssel der Ansicht
+//
+// Rückgabewert:
+//   - tasks: Die Aufgaben der Ansicht
+//   - error: Ein Fehler, falls die Ansicht nicht geladen werden kann; "nil", falls nicht
+func (s *sqlStore) GetTasksForView(name, view string) ([]task, error) {
+	taskIDs, err := s.getViewTaskIDs(s.db, name, view)
+	if err != nil {
+		return nil, err
+	}
+	tasks := make([]task, 0, len(taskIDs))
+	for i, taskID := range taskIDs {
+		viewTask, err := s.GetTaskForUser(name, taskID)
+		if err != nil {
+			return nil, err
+		}
+		viewTask.Order = i
+		tasks = append(tasks, *viewTask)
+	}
+	return tasks, nil
+}
+
+// materializeViewRanks legt für alle Aufgaben einer Ansicht, die dort noch keinen eigenen Rangschlüssel besitzen, einen Schlüssel am Ende der Ansicht an
+// dadurch bleibt die angezeigte Reihenfolge erhalten, bevor eine Aufgabe in der Ansicht verschoben wird
+//
+// Parameter:
+//   - tx: Die laufende Transaktion
+//   - name: Der Name des Benutzers
+//   - view: Der Schlüssel der Ansicht
+//   - taskIDs: Die Aufgaben der Ansicht in angezeigter Reihenfolge, siehe getViewTaskIDs
+//
+// Rückgabewert:
+//   - error: Ein Fehler, falls bei der Transaktion ein Fehler auftritt; "nil", falls nicht
+func materializeViewRanks(tx *sqlTx, name, view string, taskIDs []int) error {
+	existsQuery := `SELECT EXISTS(SELECT 1 FROM task_order WHERE user_id = ` + userIDSQL + ` AND view_key = ? AND task_id = ?)`
+	lastQuery := `SELECT COALESCE(MAX(rank_key), '') FROM task_order WHERE user_id = ` + userIDSQL + ` AND view_key = ?`
+	insertQuery := `INSERT INTO task_order (user_id, view_key, task_id, rank_key) VALUES (` + userIDSQL + `,?,?,?)`
+	var lastRank string
+
+	err := tx.QueryRow(lastQuery, name, view).Scan(&lastRank)
+	if err != nil {
+		return err
+	}
+	for _, taskID := range taskIDs {
+		var exists bool
+		err = tx.QueryRow(existsQuery, name, view, taskID).Scan(&exists)
+		if err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+		lastRank = rankBetween(lastRank, "")
+		_, err = tx.Exec(insertQuery, name, view, taskID, lastRank)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MoveTask führt eine Transaktion in der Datenbank aus, um eine Aufgabe in einer Ansicht direkt vor oder hinter eine andere Aufgabe zu verschieben
+// dabei erhält nur die verschobene Aufgabe einen neuen Rangschlüssel, die Reihenfolge in anderen Ansichten bleibt unverändert
+// in Kategorien und intelligenten Listen werden beim ersten Verschieben die Schlüssel der Ansicht angelegt;
+// die Aufgaben der Ansicht werden in derselben Transaktion ermittelt, gelöschte und archivierte Aufgaben können in keiner Ansicht verschoben werden
+//
+// Parameter:
+//   - name: Der Name des Benutzers, in dessen Liste die Aufgabe verschoben wird
+//   - view: Der Schlüssel der Ansicht, in der verschoben wird; globalView für die Gesamtliste
+//   - taskID: Die ID der zu verschiebenden Aufgabe
+//   - anchorID: Die ID der Aufgabe, an der sich die Verschiebung orientiert
+//   - before: "true", falls die Aufgabe vor anchorID stehen soll; "false", falls dahinter
+//
+// Rückgabewert:
+//   - error: errTaskNotFound, falls eine der Aufgaben nicht in der Ansicht des Benutzers steht; "nil", falls kein Fehler auftritt
+func (s *sqlStore) MoveTask(name, view string, taskID, anchorID int, before bool) error {
+	rankQuery := `SELECT rank_key FROM task_order WHERE user_id = ` + userIDSQL + ` AND view_key = ? AND task_id = ?`
+	prevQuery := `SELECT COALESCE(MAX(rank_key), '') FROM task_order WHERE user_id = ` + userIDSQL + ` AND view_key = ? AND task_id != ? AND rank_key < ?`
+	nextQuery := `SELECT COALESCE(MIN(rank_key), '') FROM task_order WHERE user_id = ` + userIDSQL + ` AND view_key = ? AND task_id != ? AND rank_key > ?`
+	updateQuery := `UPDATE task_order SET rank_key = ? WHERE user_id = ` + userIDSQL + ` AND view_key = ? AND task_id = ?`
+	var taskRank, anchorRank, lo, hi string
+	var viewTaskIDs []int
+
+	if taskID == anchorID {
+		return errInvalidPosition
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	viewTaskIDs, err = s.getViewTaskIDs(tx, name, view)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if !slices.Contains(viewTaskIDs, taskID) || !slices.Contains(viewTaskIDs, anchorID) {
+		tx.Rollback()
+		return errTaskNotFound
+	}
+
+	if view != globalView {
+		err = materializeViewRanks(tx, name, view, viewTaskIDs)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	err = tx.QueryRow(rankQuery, name, view, taskID).Scan(&taskRank)
+	if err == nil {
+		err = tx.QueryRow(rankQuery, name, view, anchorID).Scan(&anchorRank)
+	}
+	if err != nil {
+		tx.Rollback()
+		if errors.Is(err, sql.ErrNoRows) {
+			return errTaskNotFound
+		}
+		return err
+	}
+
+	if before {
+		hi = anchorRank
+		err = tx.QueryRow(prevQuery, name, view, taskID, anchorRank).Scan(&lo)
+	} else {
+		lo = anchorRank
+		err = tx.QueryRow(nextQuery, name, view, taskID, anchorRank).Scan(&hi)
+	}
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	_, err = tx.Exec(updateQuery, rankBetween(lo, hi), name, view, taskID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return nil
+}
+
+// rebalanceRanksForView führt eine Transaktion in der Datenbank aus, um die Rangschlüssel einer Ansicht eines Benutzers neu zu verteilen
+// die Reihenfolge bleibt dabei erhalten, die Schlüssel werden aber wieder gleichmäßig verteilt und möglichst kurz
+//
+// Parameter:
+//   - name: Der Name des Benutzers
+//   - view: Der Schlüssel der Ansicht
+//
+// Rückgabewert:
+//   - error: Ein Fehler, falls bei der Transaktion ein Fehler auftritt; "nil", falls nicht
+func (s *sqlStore) rebalanceRanksForView(name, view string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	err = rebalanceViewRanks(tx, name, view)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return nil
+}
+
+// rebalanceViewRanks verteilt die Rangschlüssel einer Ansicht innerhalb einer laufenden Transaktion neu
+// Einträge ohne gültigen Schlüssel werden dabei ans Ende gestellt, Einträge mit gleichem Schlüssel nach der ID der Aufgabe sortiert
+//
+// Parameter:
+//   - tx: Die laufende Transaktion
+//   - name: Der Name des Benutzers
+//   - view: Der Schlüssel der Ansicht
+//
+// Rückgabewert:
+//   - error: Ein Fehler, falls bei der Transaktion ein Fehler auftritt; "nil", falls nicht
+func rebalanceViewRanks(tx *sqlTx, name, view string) error {
+	selectQuery := `SELECT task_id FROM task_order WHERE user_id = ` + userIDSQL + ` AND view_key = ?
+	ORDER BY COALESCE(rank_key, '') = '', rank_key, task_id`
+	updateQuery := `UPDATE task_order SET rank_key = ? WHERE user_id = ` + userIDSQL + ` AND view_key = ? AND task_id = ?`
+
+	taskIDs, err := queryTxTaskIDs(tx, selectQuery, name, view)
+	if err != nil {
+		return err
+	}
+
+	for i, rankKey := range evenRankKeys(len(taskIDs)) {
+		_, err = tx.Exec(updateQuery, rankKey, name, view, taskIDs[i])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// queryTxTaskIDs führt innerhalb einer laufenden Transaktion eine Abfrage aus, deren erste Spalte eine Aufgaben-ID ist
+//
+// Parameter:
+//   - tx: Die laufende Transaktion
+//   - query: Die Abfrage
+//   - args: Die Parameter der Abfrage
+//
+// Rückgabewert:
+//   - taskIDs: Die gefundenen IDs
+//   - error: Ein Fehler, falls bei der Abfrage ein Fehler auftritt; "nil", falls nicht
+func queryTxTaskIDs(tx *sqlTx, query string, args ...interface{}) ([]int, error) {
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	taskIDs := make([]int, 0)
+	for rows.Next() {
+		var taskID int
+		err = rows.Scan(&taskID)
+		if err != nil {
+			return nil, err
+		}
+		taskIDs = append(taskIDs, taskID)
+	}
+	return taskIDs, rows.Err()
+}
+
+// RebalanceRanks verteilt die Rangschlüssel aller Ansichten neu, deren Schlüssel durch viele Verschiebungen zu lang geworden sind
+//
+// Rückgabewert:
+//   - rebalanced: Die Anzahl der Ansichten, deren Schlüssel neu verteilt wurden
+//   - error: Ein Fehler, falls beim Neuverteilen ein Fehler auftritt; "nil", falls nicht
+func (s *sqlStore) RebalanceRanks() (rebalanced int, err error) {
+	query := `SELECT ` + userNameSQL("user_id") + `, view_key FROM task_order GROUP BY user_id, view_key HAVING MAX(LENGTH(rank_key)) > ?`
+
+	type viewEntry struct {
+		name string
+		view string
+	}
+	entries := make([]viewEntry, 0)
+
+	rows, err := s.db.Query(query, rankRebalanceLength)
+	if err != nil {
+		return 0, err
+	}
+	for rows.Next() {
+		var entry viewEntry
+		err = rows.Scan(&entry.name, &entry.view)
+		if err != nil {
+			rows.Close()
+			return 0, err
+		}
+		entries = append(entries, entry)
+	}
+	rows.Close()
+
+	for _, entry := range entries {
+		err = s.rebalanceRanksForView(entry.name, entry.view)
+		if err != nil {
+			return rebalanced, err
+		}
+		rebalanced++
+	}
+	return rebalanced, nil
+}
+
+// runRankRebalancer prüft in regelmäßigen Abständen, ob Rangschlüssel neu verteilt werden müssen
+// läuft dauerhaft und sollte daher als Goroutine gestartet werden
+//
+// Parameter:
+//   - interval: Der Abstand zwischen zwei Durchläufen
+func (srv *server) runRankRebalancer(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		rebalanced, err := srv.store.RebalanceRanks()
+		if err != nil {
+			log.Println("Reihenfolge konnte nicht neu verteilt werden:", err)
+		} else if rebalanced > 0 {
+			log.Printf("Reihenfolge für %d Ansichten neu verteilt", rebalanced)
+		}
+		<-ticker.C
+	}
+}
+
+// HandleGetCategoryTasks gibt alle aktiven Aufgaben einer Kategorie in der Reihenfolge der Ansicht der Kategorie zurück
+//
+// Parameter:
+//   - c: Ein Pointer auf ein Context-Objekt von fiber
+//
+// Rückgabewert:
+//   - error: Ein Fehler, falls beim Laden ein Fehler auftritt - wird an Client gesendet
+//     Bei Erfolg werden die Aufgaben an den Client gesendet
+func (srv *server) HandleGetCategoryTasks(c *fiber.Ctx) error {
+	name := c.Locals("name").(string)
+
+	i, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(400).JSON(fiber.Map{"error": "Ungültige Eingabedaten"})
+	}
+	tasks, err := srv.store.GetTasksForView(name, categoryView(i))
+	if err != nil {
+		fmt.Println(err)
+		if errors.Is(err, errCategoryNotFound) {
+			return c.Status(404).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.Status(400).JSON(fiber.Map{"error": "Aufgaben konnten nicht geladen werden"})
+	}
+	return c.Status(200).JSON(fiber.Map{"tasks": tasks})
+}
+
+// HandleMoveTask nimmt die mitgeschickten Parameter des Clients entgegen und ruft MoveTask damit auf, um eine Aufgabe zu verschieben
+// im Body wird entweder "before" (Aufgabe vor diese ID) oder "after" (Aufgabe hinter diese ID) erwartet
+// optional gibt "view" die Ansicht an, in der verschoben wird (z.B. "category:3" oder "smartlist:2"), ohne Angabe die Gesamtliste
+//
+// Parameter:
+//   - c: Ein Pointer auf ein Context-Objekt von fiber
+//
+// Rückgabewert:
+//   - error: Ein Fehler, falls beim Verschieben ein Fehler auftritt - wird an Client gesendet
+func (srv *server) HandleMoveTask(c *fiber.Ctx) error {
+	name := c.Locals("name").(string)
+	type PositionInput struct {
+		Before *int   `json:"before"`
+		After  *int   `json:"after"`
+		View   string `json:"view"`
+	}
+
+	var input PositionInput
+	if err := c.BodyParser(&input); err != nil {
+		fmt.Println(err)
+		return c.Status(400).JSON(fiber.Map{"error": "Ungültige Eingabedaten"})
+	}
+	i, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(400).JSON(fiber.Map{"error": "Ungültige Eingabedaten"})
+	}
+	if (input.Before == nil) == (input.After == nil) {
+		return c.Status(400).JSON(fiber.Map{"error": "Es muss genau eines von before und after angegeben werden"})
+	}
+
+	if input.Before != nil {
+		err = srv.store.MoveTask(name, input.View, i, *input.Before, true)
+	} else {
+		err = srv.store.MoveTask(name, input.View, i, *input.After, false)
+	}
+	if err != nil {
+		fmt.Println(err)
+		if errors.Is(err, errTaskNotFound) || errors.Is(err, errCategoryNotFound) || errors.Is(err, errSmartListNotFound) {
+			return c.Status(404).JSON(fiber.Map{"error": err.Error()})
+		}
+		if errors.Is(err, errInvalidPosition) || errors.Is(err, errInvalidView) {
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.Status(400).JSON(fiber.Map{"error": "Aufgabe konnte nicht verschoben werden"})
+	}
+	return c.Status(200).JSON(fiber.Map{"msg": "Aufgabe erfolgreich verschoben"})
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+// checkRank prüft, dass ein Schlüssel zwischen lo und hi liegt und nicht auf "0" endet,
+// da vor einem solchen Schlüssel kein weiterer mehr eingefügt werden könnte
+func checkRank(t *testing.T, lo, hi, key string) {
+	t.Helper()
+	if key <= lo || (hi != "" && key >= hi) {
+		t.Fatalf("rankBetween(%q, %q) = %q liegt nicht dazwischen", lo, hi, key)
+	}
+	if key == "" || strings.HasSuffix(key, "0") {
+		t.Fatalf("rankBetween(%q, %q) = %q endet auf 0", lo, hi, key)
+	}
+}
+
+func TestRankBetween(t *testing.T) {
+	for _, c := range []struct {
+		lo, hi, want string
+	}{
+		{"", "", "i"},
+		{"i", "", "r"},
+		{"", "i", "9"},
+		{"a", "c", "b"},
+		{"a", "b", "ai"},
+		{"az", "b", "azi"},
+		{"", "1", "0i"},
+		{"", "01", "00i"},
+		{"zz", "", "zzi"},
+		{"a1", "a2", "a1i"},
+		// ein ungültiger oberer Schlüssel wird wie das Ende der Liste behandelt
+		{"b", "a", "n"},
+	} {
+		got := rankBetween(c.lo, c.hi)
+		if got != c.want {
+			t.Errorf("rankBetween(%q, %q) = %q, erwartet %q", c.lo, c.hi, got, c.want)
+		}
+		if c.hi < c.lo {
+			c.hi = ""
+		}
+		checkRank(t, c.lo, c.hi, got)
+	}
+}
+
+func TestRankBetweenRepeated(t *testing.T) {
+	// wiederholtes Einfügen am Anfang, am Ende und immer in dieselbe Lücke
+	first, last := "i", "i"
+	lo, hi := "a", "b"
+	for i := 0; i < 200; i++ {
+		key := rankBetween("", first)
+		checkRank(t, "", first, key)
+		first = key
+
+		key = rankBetween(last, "")
+		checkRank(t, last, "", key)
+		last = key
+
+		key = rankBetween(lo, hi)
+		checkRank(t, lo, hi, key)
+		if i%2 == 0 {
+			lo = key
+		} else {
+			hi = key
+		}
+	}
+}
+
+func TestEvenRankKeys(t *testing.T) {
+	for _, n := range []int{0, 1, 2, 10, 35, 36, 37, 100, 1295, 1296, 5000} {
+		keys := evenRankKeys(n)
+		if len(keys) != n {
+			t.Fatalf("evenRankKeys(%d) liefert %d Schlüssel", n, len(keys))
+		}
+		if !slices.IsSorted(keys) || len(slices.Compact(slices.Clone(keys))) != n {
+			t.Fatalf("evenRankKeys(%d) ist nicht streng aufsteigend: %v", n, keys)
+		}
+		for _, key := range keys {
+			if key == "" || strings.HasSuffix(key, "0") {
+				t.Fatalf("evenRankKeys(%d) enthält %q", n, key)
+			}
+		}
+		// zwischen und um die Schlüssel muss weiter eingefügt werden können
+		if n > 0 {
+			checkRank(t, "", keys[0], rankBetween("", keys[0]))
+			checkRank(t, keys[n-1], "", rankBetween(keys[n-1], ""))
+		}
+		for i := 1; i < n; i++ {
+			checkRank(t, keys[i-1], keys[i], rankBetween(keys[i-1], keys[i]))
+		}
+	}
+}
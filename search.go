@@ -0,0 +1,468 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// searchLimit begrenzt die Anzahl der Treffer einer Suche
+const searchLimit = 50
+
+type searchFilter struct {
+	Terms       []string
+	Category    string
+	Shared      string
+	Done        *bool
+	Archived    *bool
+	IsShared    *bool
+	HasDue      *bool
+	DueFrom     *time.Time
+	DueBefore   *time.Time
+	Priority    string
+	HasPriority *bool
+}
+
+// relativeDueValues sind die Werte von due:, die sich auf das aktuelle Datum beziehen
+// intelligente Listen mit diesen Werten ändern sich auch ohne Änderung an einer Aufgabe, siehe refreshRelativeSmartLists
+var relativeDueValues = []string{"overdue", "today", "tomorrow", "week"}
+
+// highlightStart und highlightEnd markieren Treffer in Titel und Textausschnitt, bevor diese maskiert werden
+// es handelt sich um Zeichen aus dem privaten Bereich von Unicode, die in normalem Text nicht vorkommen
+const (
+	highlightStart = "\uE000"
+	highlightEnd   = "\uE001"
+)
+
+type searchResult struct {
+	Task    task    `json:"task"`
+	Title   string  `json:"title"`
+	Snippet string  `json:"snippet"`
+	Rank    float64 `json:"rank"`
+}
+
+// tokenizeSearchQuery zerlegt eine Suchanfrage an Leerzeichen, wobei Abschnitte in Anführungszeichen zusammenbleiben
+// dadurch sind sowohl Phrasen ("milch und brot") als auch Operatoren mit Leerzeichen (category:"home office") möglich
+//
+// Parameter:
+//   - query: Die Suchanfrage des Benutzers
+//
+// Rückgabewert:
+//   - tokens: Die einzelnen Bestandteile der Suchanfrage ohne Anführungszeichen
+func tokenizeSearchQuery(query string) []string {
+	tokens := make([]string, 0)
+	var current strings.Builder
+	quoted := false
+
+	for _, r := range query {
+		switch {
+		case r == '"':
+			quoted = !quoted
+		case unicode.IsSpace(r) && !quoted:
+			if current.Len() > 0 {
+				tokens = append(tokens, current.String())
+				current.Reset()
+			}
+		default:
+			current.WriteRune(r)
+		}
+	}
+	if current.Len() > 0 {
+		tokens = append(tokens, current.String())
+	}
+	return tokens
+}
+
+// parseSearchQuery wertet die Operatoren einer Suchanfrage aus, alle übrigen Bestandteile werden als Suchbegriffe verwendet
+// unterstützt werden category:<name>, shared:<benutzer>, is:done, is:open, is:archived, is:active, is:shared,
+// due:<wert> (siehe parseDueFilter) und priority:<A-Z|any|none>
+//
+// Parameter:
+//   - query: Die Suchanfrage des Benutzers
+//
+// Rückgabewert:
+//   - filter: Die Suchbegriffe und Filter der Anfrage
+func parseSearchQuery(query string) searchFilter {
+	var filter searchFilter
+	yes, no := true, false
+	now := time.Now()
+
+	for _, token := range tokenizeSearchQuery(query) {
+		key, value, found := strings.Cut(token, ":")
+		if !found || value == "" {
+			filter.Terms = append(filter.Terms, token)
+			continue
+		}
+		switch strings.ToLower(key) {
+		case "category":
+			filter.Category = value
+		case "shared":
+			filter.Shared = value
+		case "is":
+			switch strings.ToLower(value) {
+			case "done":
+				filter.Done = &yes
+			case "open":
+				filter.Done = &no
+			case "archived":
+				filter.Archived = &yes
+			case "active":
+				filter.Archived = &no
+			case "shared":
+				filter.IsShared = &yes
+			default:
+				filter.Terms = append(filter.Terms, token)
+			}
+		case "due":
+			if !parseDueFilter(&filter, value, now) {
+				filter.Terms = append(filter.Terms, token)
+			}
+		case "priority":
+			switch value = strings.ToUpper(value); {
+			case value == "ANY":
+				filter.HasPriority = &yes
+			case value == "NONE":
+				filter.HasPriority = &no
+			case len(value) == 1 && value[0] >= 'A' && value[0] <= 'Z':
+				filter.Priority = value
+			default:
+				filter.Terms = append(filter.Terms, token)
+			}
+		default:
+			filter.Terms = append(filter.Terms, token)
+		}
+	}
+	return filter
+}
+
+// parseDueFilter wertet den Wert des Operators due: aus, Tage beginnen wie beim Fälligkeitsdatum um Mitternacht in der lokalen Zeitzone
+// unterstützt werden any, none, overdue (vor heute), today, tomorrow, week (heute und die nächsten 6 Tage),
+// ein Datum JJJJ-MM-TT sowie <JJJJ-MM-TT (vor dem Tag) und >JJJJ-MM-TT (nach dem Tag)
+//
+// Parameter:
+//   - filter: Der Filter, in den der Zeitraum eingetragen wird
+//   - value: Der Wert hinter due:
+//   - now: Der aktuelle Zeitpunkt, auf den sich relative Werte beziehen
+//
+// Rückgabewert:
+//   - bool: "false", falls der Wert nicht erkannt wurde
+func parseDueFilter(filter *searchFilter, value string, now time.Time) bool {
+	yes, no := true, false
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+	day := func(offset int) *time.Time {
+		date := today.AddDate(0, 0, offset)
+		return &date
+	}
+
+	switch strings.ToLower(value) {
+	case "any":
+		filter.HasDue = &yes
+	case "none":
+		filter.HasDue = &no
+	case "overdue":
+		filter.DueBefore = day(0)
+	case "today":
+		filter.DueFrom, filter.DueBefore = day(0), day(1)
+	case "tomorrow":
+		filter.DueFrom, filter.DueBefore = day(1), day(2)
+	case "week":
+		filter.DueFrom, filter.DueBefore = day(0), day(7)
+	default:
+		date := parseTodoTxtDate(strings.TrimLeft(value, "<>"))
+		if date == nil {
+			return false
+		}
+		next := date.AddDate(0, 0, 1)
+		switch value[0] {
+		case '<':
+			filter.DueBefore = date
+		case '>':
+			filter.DueFrom = &next
+		default:
+			filter.DueFrom, filter.DueBefore = date, &next
+		}
+	}
+	return true
+}
+
+// relativeSearchQuery prüft, ob eine Suchanfrage einen Wert von due: enthält, der sich auf das aktuelle Datum bezieht
+//
+// Parameter:
+//   - query: Die Suchanfrage
+//
+// Rückgabewert:
+//   - bool: "true", falls sich die Treffer allein durch den Tageswechsel ändern können
+func relativeSearchQuery(query string) bool {
+	for _, token := range tokenizeSearchQuery(query) {
+		key, value, found := strings.Cut(token, ":")
+		if found && strings.EqualFold(key, "due") && slices.Contains(relativeDueValues, strings.ToLower(value)) {
+			return true
+		}
+	}
+	return false
+}
+
+// empty prüft, ob eine Suchanfrage weder Suchbegriffe noch Filter enthält, z.B. bei einem einzelnen Anführungszeichen
+// eine solche Anfrage würde sonst alle Aufgaben finden
+//
+// Rückgabewert:
+//   - bool: "true", falls die Anfrage nichts einschränkt
+func (f searchFilter) empty() bool {
+	return len(f.Terms) == 0 && f.Category == "" && f.Shared == "" && f.Done == nil && f.Archived == nil && f.IsShared == nil &&
+		f.HasDue == nil && f.DueFrom == nil && f.DueBefore == nil && f.Priority == "" && f.HasPriority == nil
+}
+
+// highlightHTML maskiert einen Text für die Ausgabe als HTML und ersetzt erst danach die Markierungen der Treffer durch <mark>
+// dadurch wird HTML aus Titeln und Beschreibungen nie ungefiltert an den Client gesendet
+//
+// Parameter:
+//   - text: Der Text mit den Markierungen highlightStart und highlightEnd
+//
+// Rückgabewert:
+//   - string: Der maskierte Text mit <mark>-Elementen
+func highlightHTML(text string) string {
+	return strings.NewReplacer(highlightStart, "<mark>", highlightEnd, "</mark>").Replace(html.EscapeString(text))
+}
+
+// searchTasks durchsucht alle Aufgaben, die einem Benutzer gehören bzw. für ihn freigegeben sind, mit Hilfe der Volltextsuche
+// Treffer werden nach Relevanz sortiert, ohne Suchbegriffe wird nur gefiltert und nach der Reihenfolge des Benutzers sortiert
+// gelöschte Aufgaben werden nicht gefunden, archivierte nur, sofern nicht mit is:active gefiltert wird
+//
+// Parameter:
+//   - name: Der Name des suchenden Benutzers
+//   - query: Die Suchanfrage inklusive Operatoren
+//
+// Rückgabewert:
+//   - results: Die gefundenen Aufgaben mit hervorgehobenem Titel und Textausschnitt
+//   - error: Ein Fehler, falls bei der Suche ein Fehler auftritt; "nil", falls nicht
+func (srv *server) searchTasks(name, query string) ([]searchResult, error) {
+	return srv.store.SearchTasks(name, parseSearchQuery(query), 0, searchLimit, globalView)
+}
+
+// matchesSearch prüft, ob eine einzelne Aufgabe für einen Benutzer von einer Suchanfrage gefunden wird
+//
+// Parameter:
+//   - name: Der Name des Benutzers
+//   - query: Die Suchanfrage inklusive Operatoren
+//   - taskID: Die ID der zu prüfenden Aufgabe
+//
+// Rückgabewert:
+//   - bool: "true", falls die Aufgabe gefunden wird
+//   - error: Ein Fehler, falls bei der Suche ein Fehler auftritt; "nil", falls nicht
+func (srv *server) matchesSearch(name, query string, taskID int) (bool, error) {
+	results, err := srv.store.SearchTasks(name, parseSearchQuery(query), taskID, 1, globalView)
+	if err != nil {
+		return false, err
+	}
+	return len(results) > 0, nil
+}
+
+// SearchTasks führt eine Suche mit bereits ausgewerteten Filtern aus
+//
+// Parameter:
+//   - name: Der Name des suchenden Benutzers
+//   - filter: Die Suchbegriffe und Filter
+//   - taskID: Schränkt die Suche auf eine einzelne Aufgabe ein; 0, falls alle Aufgaben durchsucht werden sollen
+//   - limit: Die maximale Anzahl an Treffern; 0 für unbegrenzt
+//   - view: Die Ansicht, deren manuelle Reihenfolge vor der Relevanz gilt; globalView für die übliche Sortierung
+//
+// Rückgabewert:
+//   - results: Die gefundenen Aufgaben mit hervorgehobenem Titel und Textausschnitt
+//   - error: Ein Fehler, falls bei der Suche ein Fehler auftritt; "nil", falls nicht
+func (s *sqlStore) SearchTasks(name string, filter searchFilter, taskID int, limit int, view string) ([]searchResult, error) {
+	return s.searchTasks(s.db, name, filter, taskID, limit, view)
+}
+
+// searchTasks führt eine Suche in der Datenbank oder einer laufenden Transaktion aus, siehe SearchTasks
+// die Freigaben werden erst nach dem Lesen aller Treffer geladen, da eine Transaktion nur eine Abfrage zur Zeit ausführen kann
+//
+// Parameter:
+//   - q: Die Datenbank oder eine laufende Transaktion
+//   - name: Der Name des suchenden Benutzers
+//   - filter: Die Suchbegriffe und Filter
+//   - taskID: Schränkt die Suche auf eine einzelne Aufgabe ein; 0, falls alle Aufgaben durchsucht werden sollen
+//   - limit: Die maximale Anzahl an Treffern; 0 für unbegrenzt
+//   - view: Die Ansicht, deren manuelle Reihenfolge vor der Relevanz gilt; globalView für die übliche Sortierung
+//
+// Rückgabewert:
+//   - results: Die gefundenen Aufgaben mit hervorgehobenem Titel und Textausschnitt
+//   - error: Ein Fehler, falls bei der Suche ein Fehler auftritt; "nil", falls nicht
+func (s *sqlStore) searchTasks(q sqlQueryer, name string, filter searchFilter, taskID int, limit int, view string) ([]searchResult, error) {
+	if filter.empty() {
+		return []searchResult{}, nil
+	}
+	var sb strings.Builder
+	var fts fullTextSearch
+	args := make([]interface{}, 0)
+
+	if len(filter.Terms) > 0 {
+		fts = s.dialect.fullTextSearch(filter.Terms)
+		sb.WriteString(`SELECT t.id, t.title, t.desc, t.isDone, ` + userNameSQL("t.user_id") + `, c.id, c.cat_name, c.color_header, c.color_body, ` + orderPositionSQL + `, t.archived_at,
+		` + fts.columns + `
+		FROM tasks t
+		` + fts.join)
+		args = append(args, fts.joinArgs...)
+	} else {
+		sb.WriteString(`SELECT t.id, t.title, t.desc, t.isDone, ` + userNameSQL("t.user_id") + `, c.id, c.cat_name, c.color_header, c.color_body, ` + orderPositionSQL + `, t.archived_at,
+		t.title, COALESCE(t.desc, ''), 0.0
+		FROM tasks t`)
+	}
+	sb.WriteString(`
+	LEFT JOIN categories c ON t.category_id = c.id
+	LEFT JOIN task_order o ON t.id = o.task_id AND o.user_id = ` + userIDSQL + ` AND o.view_key = ''`)
+	args = append(args, name)
+	if view != globalView {
+		sb.WriteString(`
+	LEFT JOIN task_order v ON t.id = v.task_id AND v.user_id = ` + userIDSQL + ` AND v.view_key = ?`)
+		args = append(args, name, view)
+	}
+	sb.WriteString(`
+	WHERE t.deleted_at IS NULL
+	AND (t.user_id = ` + userIDSQL + ` OR EXISTS(SELECT 1 FROM sharing s WHERE s.task_id = t.id AND s.target_id = ` + userIDSQL + `))`)
+	args = append(args, name, name)
+
+	if taskID != 0 {
+		sb.WriteString(` AND t.id = ?`)
+		args = append(args, taskID)
+	}
+	if len(filter.Terms) > 0 {
+		sb.WriteString(` AND ` + fts.condition)
+		args = append(args, fts.conditionArgs...)
+	}
+	if filter.Category != "" {
+		sb.WriteString(` AND LOWER(c.cat_name) = LOWER(?)`)
+		args = append(args, filter.Category)
+	}
+	if filter.Shared != "" {
+		sb.WriteString(` AND ((t.user_id = ` + userIDSQL + ` AND EXISTS(SELECT 1 FROM sharing s WHERE s.task_id = t.id AND s.target_id = ` + userIDSQL + `))
+		OR (t.user_id = ` + userIDSQL + ` AND EXISTS(SELECT 1 FROM sharing s WHERE s.task_id = t.id AND s.target_id = ` + userIDSQL + `)))`)
+		args = append(args, name, filter.Shared, filter.Shared, name)
+	}
+	if filter.Done != nil {
+		sb.WriteString(` AND t.isDone = ?`)
+		args = append(args, *filter.Done)
+	}
+	if filter.Archived != nil {
+		if *filter.Archived {
+			sb.WriteString(` AND t.archived_at IS NOT NULL`)
+		} else {
+			sb.WriteString(` AND t.archived_at IS NULL`)
+		}
+	}
+	if filter.IsShared != nil {
+		sb.WriteString(` AND EXISTS(SELECT 1 FROM sharing s WHERE s.task_id = t.id)`)
+	}
+	if filter.HasDue != nil {
+		if *filter.HasDue {
+			sb.WriteString(` AND t.due_at IS NOT NULL`)
+		} else {
+			sb.WriteString(` AND t.due_at IS NULL`)
+		}
+	}
+	if filter.DueFrom != nil {
+		sb.WriteString(` AND t.due_at >= ?`)
+		args = append(args, filter.DueFrom.Unix())
+	}
+	if filter.DueBefore != nil {
+		sb.WriteString(` AND t.due_at < ?`)
+		args = append(args, filter.DueBefore.Unix())
+	}
+	if filter.Priority != "" {
+		sb.WriteString(` AND t.priority = ?`)
+		args = append(args, filter.Priority)
+	}
+	if filter.HasPriority != nil {
+		if *filter.HasPriority {
+			sb.WriteString(` AND t.priority <> ''`)
+		} else {
+			sb.WriteString(` AND t.priority = ''`)
+		}
+	}
+	sb.WriteString(` ORDER BY `)
+	if view != globalView {
+		sb.WriteString(`v.rank_key IS NULL, v.rank_key, `)
+	}
+	if len(filter.Terms) > 0 {
+		sb.WriteString(fts.order)
+	} else {
+		sb.WriteString(`t.archived_at IS NOT NULL, o.rank_key`)
+	}
+	if limit > 0 {
+		sb.WriteString(` LIMIT ` + strconv.Itoa(limit))
+	}
+
+	rows, err := q.Query(sb.String(), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := make([]searchResult, 0)
+	for rows.Next() {
+		var task_id, cat_id, order int
+		var title, desc, cat_name, color_header, color_body, owner string
+		var isDone bool
+		var archivedAt *int64
+		var result searchResult
+
+		err = rows.Scan(&task_id, &title, &desc, &isDone, &owner, &cat_id, &cat_name, &color_header, &color_body, &order, &archivedAt,
+			&result.Title, &result.Snippet, &result.Rank)
+		if err != nil {
+			return nil, err
+		}
+		result.Title = highlightHTML(result.Title)
+		result.Snippet = highlightHTML(result.Snippet)
+		foundTask := NewTask(task_id, title, desc, isDone, *NewCategory(cat_id, cat_name, color_header, color_body), owner, []string{}, order)
+		if archivedAt != nil {
+			archivedTime := time.Unix(*archivedAt, 0)
+			foundTask.ArchivedAt = &archivedTime
+		}
+		result.Task = *foundTask
+		results = append(results, result)
+	}
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range results {
+		if results[i].Task.Owner != name {
+			continue
+		}
+		results[i].Task.Shared, err = loadSharedUsersForTask(q, results[i].Task.ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return results, nil
+}
+
+// HandleSearchTasks nimmt die Suchanfrage aus dem Query-Parameter "q" entgegen und ruft searchTasks damit auf
+//
+// Parameter:
+//   - c: Ein Pointer auf ein Context-Objekt von fiber
+//
+// Rückgabewert:
+//   - error: Ein Fehler, falls bei der Suche ein Fehler auftritt - wird an Client gesendet
+//     Bei Erfolg werden die Treffer an den Client gesendet
+func (srv *server) HandleSearchTasks(c *fiber.Ctx) error {
+	name := c.Locals("name").(string)
+	query := strings.TrimSpace(c.Query("q"))
+
+	if parseSearchQuery(query).empty() {
+		return c.Status(400).JSON(fiber.Map{"error": "Suchanfrage darf nicht leer sein"})
+	}
+	results, err := srv.searchTasks(name, query)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(400).JSON(fiber.Map{"error": "Suche konnte nicht ausgeführt werden"})
+	}
+	return c.Status(200).JSON(fiber.Map{"results": results})
+}
@@ -0,0 +1,624 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type smartList struct {
+	ID           int    `json:"id"`
+	List_name    string `json:"list_name"`
+	Query        string `json:"query"`
+	Color_header string `json:"color_header"`
+	Color_body   string `json:"color_body"`
+}
+
+// smartListEvent wird per WebSocket gesendet, wenn eine Aufgabe in eine intelligente Liste aufgenommen wird oder diese verlässt
+type smartListEvent struct {
+	Type   string `json:"type"`
+	ListID int    `json:"listId"`
+	TaskID int    `json:"taskId"`
+	Action string `json:"action"`
+}
+
+// smartListMembership beschreibt eine intelligente Liste, die von der Änderung einer Aufgabe betroffen sein kann, und ob die Aufgabe bisher in ihr enthalten ist
+type smartListMembership struct {
+	ListID   int
+	UserName string
+	Query    string
+	Member   bool
+}
+
+var errSmartListNotFound = errors.New("Liste konnte nicht gefunden werden")
+
+// NewSmartList erstellt ein neues Objekt vom Typ smartList
+//
+// Parameter:
+//   - listID: Die ID der Liste
+//   - listName: Der Name der Liste
+//   - query: Die gespeicherte Suchanfrage, siehe parseSearchQuery
+//   - colorHeader: Der Hex-Wert der Farbe des Header
+//   - colorBody: Der Hex-Wert der Farbe des Body
+//
+// Rückgabewert:
+//   - newSmartList: Ein Pointer auf die neu erstellte Liste
+func NewSmartList(listID int, listName, query, colorHeader, colorBody string) *smartList {
+	newSmartList := smartList{ID: listID, List_name: listName, Query: query, Color_header: colorHeader, Color_body: colorBody}
+	return &newSmartList
+}
+
+// GetSmartListsForUser lädt alle intelligenten Listen eines Benutzers
+//
+// Parameter:
+//   - name: Der Name des Benutzers
+//
+// Rückgabewert:
+//   - lists: Die gespeicherten Listen des Benutzers
+//   - error: Ein Fehler, falls beim Laden ein Fehler auftritt; "nil", falls nicht
+func (s *sqlStore) GetSmartListsForUser(name string) ([]smartList, error) {
+	query := `SELECT id, list_name, query, color_header, color_body FROM smart_lists WHERE user_id = ` + userIDSQL + ` ORDER BY id`
+	rows, err := s.db.Query(query, name)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lists := make([]smartList, 0)
+	for rows.Next() {
+		var id int
+		var list_name, listQuery, color_header, color_body string
+		err = rows.Scan(&id, &list_name, &listQuery, &color_header, &color_body)
+		if err != nil {
+			return nil, err
+		}
+		lists = append(lists, *NewSmartList(id, list_name, listQuery, color_header, color_body))
+	}
+	return lists, rows.Err()
+}
+
+// AddSmartList speichert eine neue intelligente Liste für einen Benutzer und ermittelt ihre aktuellen Aufgaben
+//
+// Parameter:
+//   - name: Der Name des Benutzers, welcher die Liste anlegt
+//   - list: Die anzulegende Liste
+//
+// Rückgabewert:
+//   - listID: Die von der Datenbank erstellte ID der Liste; 0, falls ein Fehler auftritt
+//   - error: Ein Fehler, falls beim Anlegen ein Fehler auftritt; "nil", falls nicht
+func (s *sqlStore) AddSmartList(name string, list smartList) (int, error) {
+	query := `INSERT INTO smart_lists (list_name, query, color_header, color_body, user_id) VALUES (?,?,?,?,` + userIDSQL + `) RETURNING id`
+	var listID int
+	err := s.db.QueryRow(query, list.List_name, list.Query, list.Color_header, list.Color_body, name).Scan(&listID)
+	if err != nil {
+		return 0, err
+	}
+
+	err = s.syncSmartListMembers(name, listID, list.Query)
+	if err != nil {
+		return 0, err
+	}
+	return listID, nil
+}
+
+// UpdateSmartList ändert Name, Suchanfrage und Farben einer intelligenten Liste und ermittelt ihre Aufgaben neu
+//
+// Parameter:
+//   - name: Der Name des Benutzers, welcher die Liste ändert
+//   - list: Die Liste mit den geänderten Attributen
+//
+// Rückgabewert:
+//   - error: errSmartListNotFound, falls die Liste dem Benutzer nicht gehört; "nil", falls kein Fehler auftritt
+func (s *sqlStore) UpdateSmartList(name string, list smartList) error {
+	query := `UPDATE smart_lists SET list_name = ?, query = ?, color_header = ?, color_body = ? WHERE id = ? AND user_id = ` + userIDSQL
+	result, err := s.db.Exec(query, list.List_name, list.Query, list.Color_header, list.Color_body, list.ID, name)
+	if err != nil {
+		return err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return errSmartListNotFound
+	}
+	return s.syncSmartListMembers(name, list.ID, list.Query)
+}
+
+// DeleteSmartList führt eine Transaktion in der Datenbank aus, um eine intelligente Liste zu löschen
+// die Aufgaben selbst bleiben dabei unverändert
+//
+// Parameter:
+//   - name: Der Name des Benutzers, welcher die Liste löscht
+//   - listID: Die ID der Liste
+//
+// Rückgabewert:
+//   - error: errSmartListNotFound, falls die Liste dem Benutzer nicht gehört; "nil", falls kein Fehler auftritt
+func (s *sqlStore) DeleteSmartList(name string, listID int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.Exec(`DELETE FROM smart_lists WHERE id = ? AND user_id = `+userIDSQL, listID, name)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		tx.Rollback()
+		return errSmartListNotFound
+	}
+
+	_, err = tx.Exec(`DELETE FROM smart_list_members WHERE list_id = ?`, listID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	_, err = tx.Exec(`DELETE FROM task_order WHERE user_id = `+userIDSQL+` AND view_key = ?`, name, smartListView(listID))
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return nil
+}
+
+// GetSmartListTasks wertet eine intelligente Liste aus und gibt alle Aufgaben zurück, die aktuell von ihrer Suchanfrage gefunden werden
+//
+// Parameter:
+//   - name: Der Name des Benutzers
+//   - listID: Die ID der Liste
+//
+// Rückgabewert:
+//   - results: Die gefundenen Aufgaben
+//   - error: errSmartListNotFound, falls die Liste dem Benutzer nicht gehört; "nil", falls kein Fehler auftritt
+func (s *sqlStore) GetSmartListTasks(name string, listID int) ([]searchResult, error) {
+	return s.smartListTasks(s.db, name, listID)
+}
+
+// smartListTasks wertet eine intelligente Liste in der Datenbank oder einer laufenden Transaktion aus, siehe GetSmartListTasks
+//
+// Parameter:
+//   - q: Die Datenbank oder eine laufende Transaktion
+//   - name: Der Name des Benutzers
+//   - listID: Die ID der Liste
+//
+// Rückgabewert:
+//   - results: Die gefundenen Aufgaben
+//   - error: errSmartListNotFound, falls die Liste dem Benutzer nicht gehört; "nil", falls kein Fehler auftritt
+func (s *sqlStore) smartListTasks(q sqlQueryer, name string, listID int) ([]searchResult, error) {
+	var query string
+	err := q.QueryRow(`SELECT query FROM smart_lists WHERE id = ? AND user_id = `+userIDSQL, listID, name).Scan(&query)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errSmartListNotFound
+		}
+		return nil, err
+	}
+	return s.searchTasks(q, name, parseSearchQuery(query), 0, 0, smartListView(listID))
+}
+
+// syncSmartListMembers ermittelt alle Aufgaben einer intelligenten Liste neu und speichert sie als aktuelle Mitglieder der Liste
+// die gespeicherten Mitglieder dienen als Vergleich, um bei späteren Änderungen Ereignisse senden zu können
+//
+// Parameter:
+//   - name: Der Name des Besitzers der Liste
+//   - listID: Die ID der Liste
+//   - query: Die Suchanfrage der Liste
+//
+// Rückgabewert:
+//   - error: Ein Fehler, falls bei der Auswertung oder Transaktion ein Fehler auftritt; "nil", falls nicht
+func (s *sqlStore) syncSmartListMembers(name string, listID int, query string) error {
+	results, err := s.SearchTasks(name, parseSearchQuery(query), 0, 0, globalView)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`DELETE FROM smart_list_members WHERE list_id = ?`, listID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	for _, result := range results {
+		_, err = tx.Exec(`INSERT INTO smart_list_members (list_id, task_id) VALUES (?,?)`, listID, result.Task.ID)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return nil
+}
+
+// GetSmartListsForTask lädt alle intelligenten Listen, die von der Änderung einer Aufgabe betroffen sein können
+// betroffen sind die Listen des Besitzers, aller Zielbenutzer und aller Benutzer, in deren Listen die Aufgabe bisher enthalten war
+//
+// Parameter:
+//   - taskID: Die ID der geänderten Aufgabe
+//
+// Rückgabewert:
+//   - lists: Die betroffenen Listen und ob die Aufgabe bisher in ihnen enthalten ist
+//   - error: Ein Fehler, falls beim Laden ein Fehler auftritt; "nil", falls nicht
+func (s *sqlStore) GetSmartListsForTask(taskID int) ([]smartListMembership, error) {
+	query := `SELECT l.id, ` + userNameSQL("l.user_id") + `, l.query, EXISTS(SELECT 1 FROM smart_list_members m WHERE m.list_id = l.id AND m.task_id = ?)
+	FROM smart_lists l
+	WHERE l.user_id IN (
+		SELECT user_id FROM tasks WHERE id = ?
+		UNION
+		SELECT target_id FROM sharing WHERE task_id = ?
+		UNION
+		SELECT sl.user_id FROM smart_list_members m INNER JOIN smart_lists sl ON sl.id = m.list_id WHERE m.task_id = ?
+	)`
+
+	rows, err := s.db.Query(query, taskID, taskID, taskID, taskID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lists := make([]smartListMembership, 0)
+	for rows.Next() {
+		var list smartListMembership
+		err = rows.Scan(&list.ListID, &list.UserName, &list.Query, &list.Member)
+		if err != nil {
+			return nil, err
+		}
+		lists = append(lists, list)
+	}
+	return lists, rows.Err()
+}
+
+// SetSmartListMember nimmt eine Aufgabe in die gespeicherten Mitglieder einer intelligenten Liste auf bzw. entfernt sie daraus
+//
+// Parameter:
+//   - listID: Die ID der Liste
+//   - taskID: Die ID der Aufgabe
+//   - member: "true", falls die Aufgabe aufgenommen werden soll; "false", falls sie entfernt werden soll
+//
+// Rückgabewert:
+//   - error: Ein Fehler, falls beim Speichern ein Fehler auftritt; "nil", falls nicht
+func (s *sqlStore) SetSmartListMember(listID, taskID int, member bool) error {
+	var err error
+	if member {
+		_, err = s.db.Exec(`INSERT INTO smart_list_members (list_id, task_id) VALUES (?,?) ON CONFLICT DO NOTHING`, listID, taskID)
+	} else {
+		_, err = s.db.Exec(`DELETE FROM smart_list_members WHERE list_id = ? AND task_id = ?`, listID, taskID)
+	}
+	return err
+}
+
+// refreshSmartListsForTask prüft nach einer Änderung an einer Aufgabe alle intelligenten Listen der betroffenen Benutzer
+// betroffen sind der Besitzer, alle Zielbenutzer und alle Benutzer, in deren Listen die Aufgabe bisher enthalten war
+// wird eine Aufgabe neu in eine Liste aufgenommen oder verlässt diese, wird der Besitzer der Liste per WebSocket benachrichtigt
+// Fehler werden nur protokolliert, da die Änderung an der Aufgabe bereits abgeschlossen ist
+//
+// Parameter:
+//   - taskID: Die ID der geänderten Aufgabe
+func (srv *server) refreshSmartListsForTask(taskID int) {
+	lists, err := srv.store.GetSmartListsForTask(taskID)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	for _, list := range lists {
+		matches, err := srv.matchesSearch(list.UserName, list.Query, taskID)
+		if err != nil {
+			fmt.Println(err)
+			continue
+		}
+		if matches == list.Member {
+			continue
+		}
+
+		err = srv.store.SetSmartListMember(list.ListID, taskID, matches)
+		if err != nil {
+			fmt.Println(err)
+			continue
+		}
+		event := smartListEvent{Type: "smartlist", ListID: list.ListID, TaskID: taskID, Action: "leave"}
+		if matches {
+			event.Action = "enter"
+		}
+		err = notifyUser(list.UserName, event)
+		if err != nil {
+			fmt.Println(err)
+		}
+	}
+}
+
+// GetSmartListsWithDue lädt die intelligenten Listen aller Benutzer, deren Suchanfrage den Operator due: enthält
+// Member ist dabei immer "false", da keine einzelne Aufgabe betrachtet wird
+//
+// Rückgabewert:
+//   - lists: Die gefundenen Listen
+//   - error: Ein Fehler, falls beim Laden ein Fehler auftritt; "nil", falls nicht
+func (s *sqlStore) GetSmartListsWithDue() ([]smartListMembership, error) {
+	rows, err := s.db.Query(`SELECT id, ` + userNameSQL("user_id") + `, query FROM smart_lists WHERE LOWER(query) LIKE '%due:%' ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lists := make([]smartListMembership, 0)
+	for rows.Next() {
+		var list smartListMembership
+		err = rows.Scan(&list.ListID, &list.UserName, &list.Query)
+		if err != nil {
+			return nil, err
+		}
+		lists = append(lists, list)
+	}
+	return lists, rows.Err()
+}
+
+// GetSmartListMembers lädt die zuletzt gespeicherten Mitglieder einer intelligenten Liste
+//
+// Parameter:
+//   - listID: Die ID der Liste
+//
+// Rückgabewert:
+//   - taskIDs: Die IDs der Aufgaben, die zuletzt in der Liste enthalten waren
+//   - error: Ein Fehler, falls beim Laden ein Fehler auftritt; "nil", falls nicht
+func (s *sqlStore) GetSmartListMembers(listID int) ([]int, error) {
+	rows, err := s.db.Query(`SELECT task_id FROM smart_list_members WHERE list_id = ? ORDER BY task_id`, listID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	taskIDs := make([]int, 0)
+	for rows.Next() {
+		var taskID int
+		err = rows.Scan(&taskID)
+		if err != nil {
+			return nil, err
+		}
+		taskIDs = append(taskIDs, taskID)
+	}
+	return taskIDs, rows.Err()
+}
+
+// refreshRelativeSmartLists wertet alle intelligenten Listen mit einem relativen Fälligkeitsdatum (z.B. due:today) neu aus
+// diese ändern sich beim Tageswechsel, ohne dass eine Aufgabe geändert wird; Änderungen werden wie bei refreshSmartListsForTask gesendet
+func (srv *server) refreshRelativeSmartLists() {
+	lists, err := srv.store.GetSmartListsWithDue()
+	if err != nil {
+		log.Println("Intelligente Listen konnten nicht geladen werden:", err)
+		return
+	}
+
+	for _, list := range lists {
+		if !relativeSearchQuery(list.Query) {
+			continue
+		}
+		results, err := srv.store.SearchTasks(list.UserName, parseSearchQuery(list.Query), 0, 0, globalView)
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+		members, err := srv.store.GetSmartListMembers(list.ListID)
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+
+		matches := make(map[int]bool, len(results))
+		for _, result := range results {
+			matches[result.Task.ID] = true
+		}
+		changes := make(map[int]bool)
+		for _, taskID := range members {
+			if !matches[taskID] {
+				changes[taskID] = false
+			}
+			delete(matches, taskID)
+		}
+		for taskID := range matches {
+			changes[taskID] = true
+		}
+
+		for taskID, member := range changes {
+			err = srv.store.SetSmartListMember(list.ListID, taskID, member)
+			if err != nil {
+				log.Println(err)
+				continue
+			}
+			event := smartListEvent{Type: "smartlist", ListID: list.ListID, TaskID: taskID, Action: "leave"}
+			if member {
+				event.Action = "enter"
+			}
+			err = notifyUser(list.UserName, event)
+			if err != nil {
+				log.Println(err)
+			}
+		}
+	}
+}
+
+// runSmartListRefresher ruft refreshRelativeSmartLists in regelmäßigen Abständen auf
+// läuft dauerhaft und sollte daher als Goroutine gestartet werden
+//
+// Parameter:
+//   - interval: Der Abstand zwischen zwei Durchläufen
+func (srv *server) runSmartListRefresher(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		srv.refreshRelativeSmartLists()
+		<-ticker.C
+	}
+}
+
+// refreshSmartListsForCategory prüft die intelligenten Listen für alle Aufgaben einer Kategorie, z.B. nachdem sie umbenannt oder gelöscht wurde
+//
+// Parameter:
+//   - catID: Die ID der geänderten Kategorie
+func (srv *server) refreshSmartListsForCategory(catID int) {
+	taskIDs, err := srv.store.GetTaskIDsForCategory(catID)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	for _, taskID := range taskIDs {
+		srv.refreshSmartListsForTask(taskID)
+	}
+}
+
+// HandleGetSmartLists lädt die intelligenten Listen des anfragenden Benutzers
+//
+// Parameter:
+//   - c: Ein Pointer auf ein Context-Objekt von fiber
+//
+// Rückgabewert:
+//   - error: Ein Fehler, falls beim Laden ein Fehler auftritt - wird an Client gesendet
+func (srv *server) HandleGetSmartLists(c *fiber.Ctx) error {
+	name := c.Locals("name").(string)
+
+	lists, err := srv.store.GetSmartListsForUser(name)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(400).JSON(fiber.Map{"error": "Listen konnten nicht geladen werden"})
+	}
+	return c.Status(200).JSON(fiber.Map{"smartLists": lists})
+}
+
+// HandleGetSmartListTasks ruft GetSmartListTasks auf, um eine intelligente Liste auszuwerten
+//
+// Parameter:
+//   - c: Ein Pointer auf ein Context-Objekt von fiber
+//
+// Rückgabewert:
+//   - error: Ein Fehler, falls bei der Auswertung ein Fehler auftritt - wird an Client gesendet
+//     Bei Erfolg werden die gefundenen Aufgaben an den Client gesendet
+func (srv *server) HandleGetSmartListTasks(c *fiber.Ctx) error {
+	name := c.Locals("name").(string)
+
+	i, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(400).JSON(fiber.Map{"error": "Ungültige Eingabedaten"})
+	}
+	results, err := srv.store.GetSmartListTasks(name, i)
+	if err != nil {
+		fmt.Println(err)
+		if errors.Is(err, errSmartListNotFound) {
+			return c.Status(404).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.Status(400).JSON(fiber.Map{"error": "Liste konnte nicht ausgewertet werden"})
+	}
+	tasks := make([]task, 0, len(results))
+	for i, result := range results {
+		result.Task.Order = i
+		tasks = append(tasks, result.Task)
+	}
+	return c.Status(200).JSON(fiber.Map{"tasks": tasks})
+}
+
+// HandleAddSmartList nimmt die mitgeschickten Parameter des Clients entgegen und ruft AddSmartList damit auf, um eine neue intelligente Liste anzulegen
+//
+// Parameter:
+//   - c: Ein Pointer auf ein Context-Objekt von fiber
+//
+// Rückgabewert:
+//   - error: Ein Fehler, falls beim Anlegen ein Fehler auftritt - wird an Client gesendet
+//     Bei Erfolg wird die ID der neuen Liste an den Client gesendet
+func (srv *server) HandleAddSmartList(c *fiber.Ctx) error {
+	name := c.Locals("name").(string)
+
+	var input smartList
+	if err := c.BodyParser(&input); err != nil {
+		fmt.Println(err)
+		return c.Status(400).JSON(fiber.Map{"error": "Ungültige Eingabedaten"})
+	}
+	if strings.TrimSpace(input.List_name) == "" || parseSearchQuery(input.Query).empty() {
+		return c.Status(400).JSON(fiber.Map{"error": "Name und Suchanfrage dürfen nicht leer sein"})
+	}
+	listID, err := srv.store.AddSmartList(name, input)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(400).JSON(fiber.Map{"error": "Liste konnte nicht erstellt werden"})
+	}
+	return c.Status(201).JSON(fiber.Map{"id": listID})
+}
+
+// HandleUpdateSmartList nimmt die mitgeschickten Parameter des Clients entgegen und ruft UpdateSmartList damit auf, um eine intelligente Liste zu ändern
+//
+// Parameter:
+//   - c: Ein Pointer auf ein Context-Objekt von fiber
+//
+// Rückgabewert:
+//   - error: Ein Fehler, falls beim Ändern ein Fehler auftritt - wird an Client gesendet
+func (srv *server) HandleUpdateSmartList(c *fiber.Ctx) error {
+	name := c.Locals("name").(string)
+
+	var input smartList
+	if err := c.BodyParser(&input); err != nil {
+		fmt.Println(err)
+		return c.Status(400).JSON(fiber.Map{"error": "Ungültige Eingabedaten"})
+	}
+	i, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(400).JSON(fiber.Map{"error": "Ungültige Eingabedaten"})
+	}
+	if strings.TrimSpace(input.List_name) == "" || parseSearchQuery(input.Query).empty() {
+		return c.Status(400).JSON(fiber.Map{"error": "Name und Suchanfrage dürfen nicht leer sein"})
+	}
+	input.ID = i
+	err = srv.store.UpdateSmartList(name, input)
+	if err != nil {
+		fmt.Println(err)
+		if errors.Is(err, errSmartListNotFound) {
+			return c.Status(404).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.Status(400).JSON(fiber.Map{"error": "Liste konnte nicht geändert werden"})
+	}
+	return c.Status(200).JSON(fiber.Map{"msg": "Liste erfolgreich geändert"})
+}
+
+// HandleDeleteSmartList nimmt die mitgeschickten Parameter des Clients entgegen und ruft DeleteSmartList damit auf, um eine intelligente Liste zu löschen
+//
+// Parameter:
+//   - c: Ein Pointer auf ein Context-Objekt von fiber
+//
+// Rückgabewert:
+//   - error: Ein Fehler, falls beim Löschen ein Fehler auftritt - wird an Client gesendet
+func (srv *server) HandleDeleteSmartList(c *fiber.Ctx) error {
+	name := c.Locals("name").(string)
+
+	i, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(400).JSON(fiber.Map{"error": "Ungültige Eingabedaten"})
+	}
+	err = srv.store.DeleteSmartList(name, i)
+	if err != nil {
+		fmt.Println(err)
+		if errors.Is(err, errSmartListNotFound) {
+			return c.Status(404).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.Status(400).JSON(fiber.Map{"error": "Liste konnte nicht gelöscht werden"})
+	}
+	return c.Status(200).JSON(fiber.Map{"msg": "Liste erfolgreich gelöscht"})
+}
@@ -0,0 +1,787 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+
+	_ "modernc.org/sqlite"
+)
+
+// sqliteDialect ist der Dialekt für SQLite, Platzhalter werden unverändert übernommen
+type sqliteDialect struct{}
+
+// openSQLiteStore öffnet die SQLite-Datenbank unter dem angegebenen Pfad bzw. legt sie an und bringt das Schema auf den aktuellen Stand
+//
+// Parameter:
+//   - path: Der Pfad der Datenbankdatei
+//
+// Rückgabewert:
+//   - store: Ein Pointer auf den geöffneten Speicher; "nil", falls ein Fehler auftritt
+//   - error: Ein Fehler, falls die Datenbank nicht geöffnet oder migriert werden konnte; "nil", falls nicht
+func openSQLiteStore(path string) (*sqlStore, error) {
+	// Fremdschlüssel werden von SQLite nur beachtet, wenn sie für jede Verbindung eingeschaltet werden
+	// busy_timeout lässt Schreibzugriffe warten, während z.B. die Zustellung der Webhooks im Hintergrund schreibt
+	db, err := sql.Open("sqlite", path+"?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)")
+	if err != nil {
+		return nil, err
+	}
+	return newSQLStore(db, sqliteDialect{})
+}
+
+// rebind gibt die Abfrage unverändert zurück, da SQLite "?" als Platzhalter versteht
+//
+// Parameter:
+//   - query: Die Abfrage mit "?" als Platzhalter
+//
+// Rückgabewert:
+//   - string: Die unveränderte Abfrage
+func (sqliteDialect) rebind(query string) string {
+	return query
+}
+
+// sqliteTables enthält die Tabellen der ersten Version des Schemas, die angelegt werden, falls sie noch nicht existieren
+var sqliteTables = []string{
+	`CREATE TABLE IF NOT EXISTS users (
+		name TEXT PRIMARY KEY,
+		password TEXT NOT NULL
+	);`,
+	`CREATE TABLE IF NOT EXISTS categories (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		cat_name TEXT NOT NULL,
+		color_header TEXT,
+		color_body TEXT,
+		user_name TEXT,
+		FOREIGN KEY (user_name) REFERENCES users(name)
+	);`,
+	`CREATE TABLE IF NOT EXISTS tasks (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        title TEXT NOT NULL,
+        desc TEXT,
+		isDone BOOL,
+		category_id INTEGER,
+        user_name TEXT,
+		FOREIGN KEY (category_id) REFERENCES categories(id),
+        FOREIGN KEY (user_name) REFERENCES users(name)
+    );`,
+	`CREATE TABLE IF NOT EXISTS sharing (
+	task_id INTEGER,
+	target_name TEXT,
+	PRIMARY KEY(target_name, task_id),
+	FOREIGN KEY (target_name) REFERENCES users(name),
+	FOREIGN KEY (task_id) REFERENCES tasks(id)
+	)`,
+	`CREATE TABLE IF NOT EXISTS task_order (
+	user_name TEXT,
+	task_id INTEGER,
+	order_id INTEGER,
+	PRIMARY KEY(user_name, task_id),
+	FOREIGN KEY (user_name) REFERENCES users(name),
+	FOREIGN KEY (task_id) REFERENCES tasks(id)
+	)`,
+}
+
+// sqliteMigrations enthält alle Schemaänderungen, die nach sqliteTables der Reihe nach auf die Datenbank angewendet werden
+// die Position in der Liste entspricht der Schemaversion, bereits angewendete Migrationen werden übersprungen
+// neue Migrationen dürfen nur am Ende angehängt werden
+var sqliteMigrations = []string{
+	// 1: Papierkorb für Aufgaben und Kategorien
+	`ALTER TABLE tasks ADD COLUMN deleted_at INTEGER;
+	ALTER TABLE tasks ADD COLUMN trashed_category_id INTEGER;
+	ALTER TABLE categories ADD COLUMN deleted_at INTEGER;`,
+	// 2: Archiv für erledigte Aufgaben
+	`ALTER TABLE tasks ADD COLUMN archived_at INTEGER;
+	ALTER TABLE tasks ADD COLUMN done_at INTEGER;
+	ALTER TABLE users ADD COLUMN auto_archive_days INTEGER NOT NULL DEFAULT 0;
+	UPDATE tasks SET done_at = CAST(strftime('%s', 'now') AS INTEGER) WHERE isDone;`,
+	// 3: Volltextsuche über Titel, Beschreibung und Kategoriename (rowid entspricht tasks.id)
+	`CREATE VIRTUAL TABLE tasks_fts USING fts5(title, desc, category, tokenize = 'unicode61 remove_diacritics 2');
+	INSERT INTO tasks_fts (rowid, title, desc, category)
+		SELECT t.id, t.title, COALESCE(t.desc, ''), COALESCE(c.cat_name, '') FROM tasks t LEFT JOIN categories c ON t.category_id = c.id;
+	CREATE TRIGGER tasks_fts_insert AFTER INSERT ON tasks BEGIN
+		INSERT INTO tasks_fts (rowid, title, desc, category)
+		VALUES (new.id, new.title, COALESCE(new.desc, ''), COALESCE((SELECT cat_name FROM categories WHERE id = new.category_id), ''));
+	END;
+	CREATE TRIGGER tasks_fts_update AFTER UPDATE OF title, desc, category_id ON tasks BEGIN
+		DELETE FROM tasks_fts WHERE rowid = old.id;
+		INSERT INTO tasks_fts (rowid, title, desc, category)
+		VALUES (new.id, new.title, COALESCE(new.desc, ''), COALESCE((SELECT cat_name FROM categories WHERE id = new.category_id), ''));
+	END;
+	CREATE TRIGGER tasks_fts_delete AFTER DELETE ON tasks BEGIN
+		DELETE FROM tasks_fts WHERE rowid = old.id;
+	END;
+	CREATE TRIGGER categories_fts_update AFTER UPDATE OF cat_name ON categories BEGIN
+		UPDATE tasks_fts SET category = new.cat_name WHERE rowid IN (SELECT id FROM tasks WHERE category_id = new.id);
+	END;`,
+	// 4: Intelligente Listen (gespeicherte Suchanfragen) und ihre zuletzt ermittelten Aufgaben
+	`CREATE TABLE smart_lists (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		list_name TEXT NOT NULL,
+		query TEXT NOT NULL,
+		color_header TEXT,
+		color_body TEXT,
+		user_name TEXT,
+		FOREIGN KEY (user_name) REFERENCES users(name)
+	);
+	CREATE TABLE smart_list_members (
+		list_id INTEGER,
+		task_id INTEGER,
+		PRIMARY KEY(list_id, task_id),
+		FOREIGN KEY (list_id) REFERENCES smart_lists(id),
+		FOREIGN KEY (task_id) REFERENCES tasks(id)
+	);`,
+	// 5: Rangschlüssel statt fortlaufender Nummern für die Reihenfolge, bestehende Nummern werden je Benutzer übernommen
+	`ALTER TABLE task_order ADD COLUMN rank_key TEXT;
+	UPDATE task_order SET rank_key = (
+		SELECT rtrim(printf('%06d', r.rn), '0') FROM (
+			SELECT user_name, task_id, ROW_NUMBER() OVER (PARTITION BY user_name ORDER BY order_id, task_id) AS rn FROM task_order
+		) r WHERE r.user_name = task_order.user_name AND r.task_id = task_order.task_id
+	);
+	ALTER TABLE task_order DROP COLUMN order_id;
+	CREATE INDEX task_order_rank ON task_order (user_name, rank_key);`,
+	// 6: Reihenfolge je Ansicht, bestehende Rangschlüssel bilden die Gesamtliste (view_key = '')
+	`CREATE TABLE task_order_scoped (
+		user_name TEXT,
+		view_key TEXT NOT NULL DEFAULT '',
+		task_id INTEGER,
+		rank_key TEXT,
+		PRIMARY KEY(user_name, view_key, task_id),
+		FOREIGN KEY (user_name) REFERENCES users(name),
+		FOREIGN KEY (task_id) REFERENCES tasks(id)
+	);
+	INSERT INTO task_order_scoped (user_name, view_key, task_id, rank_key) SELECT user_name, '', task_id, rank_key FROM task_order;
+	DROP TABLE task_order;
+	ALTER TABLE task_order_scoped RENAME TO task_order;
+	CREATE INDEX task_order_rank ON task_order (user_name, view_key, rank_key);`,
+	// 7: Administratorrechte werden am Benutzer gespeichert und mit "go-todo admin <name>" vergeben
+	`ALTER TABLE users ADD COLUMN is_admin BOOL NOT NULL DEFAULT FALSE;`,
+	// 8: Standardkategorie je Benutzer, Aufgaben in fremden Kategorien werden in die Standardkategorie ihres Besitzers verschoben
+	// anschließend werden alle Tabellen mit ON DELETE-Verhalten neu aufgebaut, verwaiste Zeilen werden dabei nicht übernommen
+	`ALTER TABLE users ADD COLUMN default_category_id INTEGER REFERENCES categories(id) ON DELETE SET NULL;
+	INSERT INTO categories (cat_name, color_header, color_body, user_name)
+		SELECT 'default', '#00a4ba', '#00ceea', u.name FROM users u
+		WHERE NOT EXISTS(SELECT 1 FROM categories c WHERE c.user_name = u.name AND c.deleted_at IS NULL);
+	UPDATE users SET default_category_id = (
+		SELECT c.id FROM categories c WHERE c.user_name = users.name AND c.deleted_at IS NULL
+		ORDER BY c.cat_name != 'default', c.id LIMIT 1
+	);
+	UPDATE tasks SET category_id = (SELECT u.default_category_id FROM users u WHERE u.name = tasks.user_name)
+		WHERE NOT EXISTS(SELECT 1 FROM categories c WHERE c.id = tasks.category_id AND c.user_name = tasks.user_name);
+	UPDATE tasks SET trashed_category_id = NULL
+		WHERE NOT EXISTS(SELECT 1 FROM categories c WHERE c.id = tasks.trashed_category_id AND c.user_name = tasks.user_name);
+
+	CREATE TABLE categories_new (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		cat_name TEXT NOT NULL,
+		color_header TEXT,
+		color_body TEXT,
+		user_name TEXT NOT NULL,
+		deleted_at INTEGER,
+		FOREIGN KEY (user_name) REFERENCES users(name) ON DELETE CASCADE
+	);
+	INSERT INTO categories_new (id, cat_name, color_header, color_body, user_name, deleted_at)
+		SELECT id, cat_name, color_header, color_body, user_name, deleted_at FROM categories
+		WHERE user_name IN (SELECT name FROM users);
+
+	CREATE TABLE tasks_new (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		title TEXT NOT NULL,
+		desc TEXT,
+		isDone BOOL,
+		category_id INTEGER NOT NULL,
+		user_name TEXT NOT NULL,
+		deleted_at INTEGER,
+		trashed_category_id INTEGER,
+		archived_at INTEGER,
+		done_at INTEGER,
+		FOREIGN KEY (category_id) REFERENCES categories(id),
+		FOREIGN KEY (trashed_category_id) REFERENCES categories(id) ON DELETE SET NULL,
+		FOREIGN KEY (user_name) REFERENCES users(name) ON DELETE CASCADE
+	);
+	INSERT INTO tasks_new (id, title, desc, isDone, category_id, user_name, deleted_at, trashed_category_id, archived_at, done_at)
+		SELECT id, title, desc, isDone, category_id, user_name, deleted_at, trashed_category_id, archived_at, done_at FROM tasks
+		WHERE category_id IN (SELECT id FROM categories_new);
+	DELETE FROM tasks_fts WHERE rowid NOT IN (SELECT id FROM tasks_new);
+
+	CREATE TABLE sharing_new (
+		task_id INTEGER,
+		target_name TEXT,
+		PRIMARY KEY(target_name, task_id),
+		FOREIGN KEY (target_name) REFERENCES users(name) ON DELETE CASCADE,
+		FOREIGN KEY (task_id) REFERENCES tasks(id) ON DELETE CASCADE
+	);
+	INSERT INTO sharing_new (task_id, target_name)
+		SELECT task_id, target_name FROM sharing
+		WHERE task_id IN (SELECT id FROM tasks_new) AND target_name IN (SELECT name FROM users);
+
+	CREATE TABLE task_order_new (
+		user_name TEXT,
+		view_key TEXT NOT NULL DEFAULT '',
+		task_id INTEGER,
+		rank_key TEXT,
+		PRIMARY KEY(user_name, view_key, task_id),
+		FOREIGN KEY (user_name) REFERENCES users(name) ON DELETE CASCADE,
+		FOREIGN KEY (task_id) REFERENCES tasks(id) ON DELETE CASCADE
+	);
+	INSERT INTO task_order_new (user_name, view_key, task_id, rank_key)
+		SELECT user_name, view_key, task_id, rank_key FROM task_order
+		WHERE task_id IN (SELECT id FROM tasks_new) AND user_name IN (SELECT name FROM users);
+
+	CREATE TABLE smart_lists_new (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		list_name TEXT NOT NULL,
+		query TEXT NOT NULL,
+		color_header TEXT,
+		color_body TEXT,
+		user_name TEXT NOT NULL,
+		FOREIGN KEY (user_name) REFERENCES users(name) ON DELETE CASCADE
+	);
+	INSERT INTO smart_lists_new (id, list_name, query, color_header, color_body, user_name)
+		SELECT id, list_name, query, color_header, color_body, user_name FROM smart_lists
+		WHERE user_name IN (SELECT name FROM users);
+
+	CREATE TABLE smart_list_members_new (
+		list_id INTEGER,
+		task_id INTEGER,
+		PRIMARY KEY(list_id, task_id),
+		FOREIGN KEY (list_id) REFERENCES smart_lists(id) ON DELETE CASCADE,
+		FOREIGN KEY (task_id) REFERENCES tasks(id) ON DELETE CASCADE
+	);
+	INSERT INTO smart_list_members_new (list_id, task_id)
+		SELECT list_id, task_id FROM smart_list_members
+		WHERE list_id IN (SELECT id FROM smart_lists_new) AND task_id IN (SELECT id FROM tasks_new);
+
+	DELETE FROM sqlite_sequence WHERE name IN ('categories_new', 'tasks_new', 'smart_lists_new');
+	INSERT INTO sqlite_sequence (name, seq)
+		SELECT name || '_new', seq FROM sqlite_sequence WHERE name IN ('categories', 'tasks', 'smart_lists');
+
+	DROP TABLE smart_list_members;
+	DROP TABLE smart_lists;
+	DROP TABLE task_order;
+	DROP TABLE sharing;
+	DROP TABLE tasks;
+	DROP TABLE categories;
+	ALTER TABLE categories_new RENAME TO categories;
+	ALTER TABLE tasks_new RENAME TO tasks;
+	ALTER TABLE sharing_new RENAME TO sharing;
+	ALTER TABLE task_order_new RENAME TO task_order;
+	ALTER TABLE smart_lists_new RENAME TO smart_lists;
+	ALTER TABLE smart_list_members_new RENAME TO smart_list_members;
+	CREATE INDEX task_order_rank ON task_order (user_name, view_key, rank_key);
+
+	CREATE TRIGGER tasks_fts_insert AFTER INSERT ON tasks BEGIN
+		INSERT INTO tasks_fts (rowid, title, desc, category)
+		VALUES (new.id, new.title, COALESCE(new.desc, ''), COALESCE((SELECT cat_name FROM categories WHERE id = new.category_id), ''));
+	END;
+	CREATE TRIGGER tasks_fts_update AFTER UPDATE OF title, desc, category_id ON tasks BEGIN
+		DELETE FROM tasks_fts WHERE rowid = old.id;
+		INSERT INTO tasks_fts (rowid, title, desc, category)
+		VALUES (new.id, new.title, COALESCE(new.desc, ''), COALESCE((SELECT cat_name FROM categories WHERE id = new.category_id), ''));
+	END;
+	CREATE TRIGGER tasks_fts_delete AFTER DELETE ON tasks BEGIN
+		DELETE FROM tasks_fts WHERE rowid = old.id;
+	END;
+	CREATE TRIGGER categories_fts_update AFTER UPDATE OF cat_name ON categories BEGIN
+		UPDATE tasks_fts SET category = new.cat_name WHERE rowid IN (SELECT id FROM tasks WHERE category_id = new.id);
+	END;`,
+	// 9: Priorität, Erstellungs- und Fälligkeitsdatum sowie Kontexte (Tags) für das Format todo.txt
+	`ALTER TABLE tasks ADD COLUMN priority TEXT NOT NULL DEFAULT '';
+	ALTER TABLE tasks ADD COLUMN created_at INTEGER;
+	ALTER TABLE tasks ADD COLUMN due_at INTEGER;
+	CREATE TABLE task_tags (
+		task_id INTEGER NOT NULL,
+		tag TEXT NOT NULL,
+		PRIMARY KEY(task_id, tag),
+		FOREIGN KEY (task_id) REFERENCES tasks(id) ON DELETE CASCADE
+	);`,
+	// 10: Geheime Adressen für Kalender-Abonnements, view_key schränkt den Kalender auf eine Ansicht ein
+	`CREATE TABLE calendar_feeds (
+		token TEXT PRIMARY KEY,
+		user_name TEXT NOT NULL,
+		view_key TEXT NOT NULL DEFAULT '',
+		created_at INTEGER NOT NULL,
+		FOREIGN KEY (user_name) REFERENCES users(name) ON DELETE CASCADE
+	);`,
+	// 11: CalDAV - App-Passwörter, Ressourcennamen der Aufgaben und ein Änderungsprotokoll je Kategorie für Sync-Tokens
+	`CREATE TABLE app_passwords (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_name TEXT NOT NULL,
+		label TEXT NOT NULL,
+		password_hash TEXT NOT NULL UNIQUE,
+		created_at INTEGER NOT NULL,
+		last_used_at INTEGER,
+		FOREIGN KEY (user_name) REFERENCES users(name) ON DELETE CASCADE
+	);
+	ALTER TABLE tasks ADD COLUMN caldav_name TEXT;
+	ALTER TABLE tasks ADD COLUMN ical_uid TEXT;
+	CREATE TABLE task_changes (
+		seq INTEGER PRIMARY KEY AUTOINCREMENT,
+		category_id INTEGER NOT NULL,
+		href_name TEXT NOT NULL
+	);
+	CREATE INDEX task_changes_category ON task_changes (category_id, seq);
+	CREATE TRIGGER task_changes_insert AFTER INSERT ON tasks BEGIN
+		INSERT INTO task_changes (category_id, href_name) VALUES (new.category_id, COALESCE(new.caldav_name, CAST(new.id AS TEXT)));
+	END;
+	CREATE TRIGGER task_changes_update AFTER UPDATE OF title, desc, isDone, done_at, priority, due_at, category_id, deleted_at, archived_at, caldav_name, ical_uid ON tasks BEGIN
+		INSERT INTO task_changes (category_id, href_name) SELECT old.category_id, COALESCE(old.caldav_name, CAST(old.id AS TEXT))
+			WHERE old.category_id != new.category_id OR old.caldav_name IS NOT new.caldav_name;
+		INSERT INTO task_changes (category_id, href_name) VALUES (new.category_id, COALESCE(new.caldav_name, CAST(new.id AS TEXT)));
+	END;
+	CREATE TRIGGER task_changes_delete AFTER DELETE ON tasks BEGIN
+		INSERT INTO task_changes (category_id, href_name) VALUES (old.category_id, COALESCE(old.caldav_name, CAST(old.id AS TEXT)));
+	END;`,
+	// 12: Webhooks mit Abonnements je Ereignis und ein Protokoll der Zustellungen inklusive Wiederholungen
+	`CREATE TABLE webhooks (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_name TEXT NOT NULL,
+		url TEXT NOT NULL,
+		secret TEXT NOT NULL,
+		events TEXT NOT NULL,
+		is_global BOOL NOT NULL DEFAULT FALSE,
+		created_at INTEGER NOT NULL,
+		FOREIGN KEY (user_name) REFERENCES users(name) ON DELETE CASCADE
+	);
+	CREATE TABLE webhook_deliveries (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		webhook_id INTEGER NOT NULL,
+		event TEXT NOT NULL,
+		payload TEXT NOT NULL,
+		status TEXT NOT NULL DEFAULT 'pending',
+		attempts INTEGER NOT NULL DEFAULT 0,
+		last_status_code INTEGER,
+		last_error TEXT,
+		created_at INTEGER NOT NULL,
+		next_attempt_at INTEGER,
+		delivered_at INTEGER,
+		FOREIGN KEY (webhook_id) REFERENCES webhooks(id) ON DELETE CASCADE
+	);
+	CREATE INDEX webhook_deliveries_due ON webhook_deliveries (status, next_attempt_at);
+	CREATE INDEX webhook_deliveries_webhook ON webhook_deliveries (webhook_id, id);`,
+	// 13: Geheime Adressen für eingehende Aufgaben, category_id legt die Kategorie neuer Aufgaben fest
+	`CREATE TABLE inbound_hooks (
+		token TEXT PRIMARY KEY,
+		user_name TEXT NOT NULL,
+		category_id INTEGER,
+		created_at INTEGER NOT NULL,
+		FOREIGN KEY (user_name) REFERENCES users(name) ON DELETE CASCADE,
+		FOREIGN KEY (category_id) REFERENCES categories(id) ON DELETE SET NULL
+	);`,
+	// 14: Persönliche Zugriffstoken für Skripte, scopes enthält die erlaubten Bereiche durch Kommas getrennt
+	`CREATE TABLE access_tokens (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_name TEXT NOT NULL,
+		label TEXT NOT NULL,
+		token_hash TEXT NOT NULL UNIQUE,
+		scopes TEXT NOT NULL,
+		created_at INTEGER NOT NULL,
+		last_used_at INTEGER,
+		FOREIGN KEY (user_name) REFERENCES users(name) ON DELETE CASCADE
+	);`,
+	// 15: Identitäten eines OpenID-Connect-Anbieters, die einem lokalen Benutzer zugeordnet sind
+	`CREATE TABLE oidc_identities (
+		issuer TEXT NOT NULL,
+		subject TEXT NOT NULL,
+		user_name TEXT NOT NULL,
+		created_at INTEGER NOT NULL,
+		PRIMARY KEY (issuer, subject),
+		FOREIGN KEY (user_name) REFERENCES users(name) ON DELETE CASCADE
+	);`,
+	// 16: Zwei-Faktor-Authentifizierung per TOTP, last_step verhindert die erneute Verwendung eines Codes
+	`CREATE TABLE totp_secrets (
+		user_name TEXT PRIMARY KEY,
+		secret TEXT NOT NULL,
+		enabled BOOL NOT NULL DEFAULT FALSE,
+		last_step INTEGER NOT NULL DEFAULT 0,
+		created_at INTEGER NOT NULL,
+		FOREIGN KEY (user_name) REFERENCES users(name) ON DELETE CASCADE
+	);
+	CREATE TABLE recovery_codes (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_name TEXT NOT NULL,
+		code_hash TEXT NOT NULL,
+		used_at INTEGER,
+		FOREIGN KEY (user_name) REFERENCES users(name) ON DELETE CASCADE
+	);
+	CREATE INDEX recovery_codes_user ON recovery_codes (user_name);`,
+	// 17: Protokoll fehlgeschlagener Anmeldungen und Drosselung je Benutzer bzw. IP-Adresse (kind "user" oder "ip")
+	`CREATE TABLE login_failures (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_name TEXT NOT NULL,
+		ip TEXT NOT NULL,
+		created_at INTEGER NOT NULL
+	);
+	CREATE INDEX login_failures_created ON login_failures (created_at);
+	CREATE TABLE login_throttles (
+		kind TEXT NOT NULL,
+		subject TEXT NOT NULL,
+		failures INTEGER NOT NULL,
+		blocked_until INTEGER NOT NULL,
+		updated_at INTEGER NOT NULL,
+		PRIMARY KEY (kind, subject)
+	);`,
+	// 18: stabile ID und Sitzungsversion je Benutzer; die Tabelle wird neu aufgebaut, der Name bleibt eindeutig
+	`CREATE TABLE users_new (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL UNIQUE,
+		password TEXT NOT NULL,
+		auto_archive_days INTEGER NOT NULL DEFAULT 0,
+		default_category_id INTEGER REFERENCES categories(id) ON DELETE SET NULL,
+		is_admin BOOL NOT NULL DEFAULT FALSE,
+		token_version INTEGER NOT NULL DEFAULT 0
+	);
+	INSERT INTO users_new (name, password, auto_archive_days, default_category_id, is_admin)
+		SELECT name, password, auto_archive_days, default_category_id, is_admin FROM users ORDER BY rowid;
+	DROP TABLE users;
+	ALTER TABLE users_new RENAME TO users;`,
+	// 19: alle Fremdschlüssel auf Benutzer verweisen auf users(id) statt auf den Namen, damit eine Umbenennung nur users.name ändert
+	// die betroffenen Tabellen werden neu aufgebaut, die Namen werden dabei über users in IDs übersetzt
+	`CREATE TABLE categories_new (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		cat_name TEXT NOT NULL,
+		color_header TEXT,
+		color_body TEXT,
+		user_id INTEGER NOT NULL,
+		deleted_at INTEGER,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	);
+	INSERT INTO categories_new (id, cat_name, color_header, color_body, user_id, deleted_at)
+		SELECT c.id, c.cat_name, c.color_header, c.color_body, u.id, c.deleted_at FROM categories c
+		INNER JOIN users u ON u.name = c.user_name;
+
+	CREATE TABLE tasks_new (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		title TEXT NOT NULL,
+		desc TEXT,
+		isDone BOOL,
+		category_id INTEGER NOT NULL,
+		user_id INTEGER NOT NULL,
+		deleted_at INTEGER,
+		trashed_category_id INTEGER,
+		archived_at INTEGER,
+		done_at INTEGER,
+		priority TEXT NOT NULL DEFAULT '',
+		created_at INTEGER,
+		due_at INTEGER,
+		caldav_name TEXT,
+		ical_uid TEXT,
+		FOREIGN KEY (category_id) REFERENCES categories(id),
+		FOREIGN KEY (trashed_category_id) REFERENCES categories(id) ON DELETE SET NULL,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	);
+	INSERT INTO tasks_new (id, title, desc, isDone, category_id, user_id, deleted_at, trashed_category_id, archived_at, done_at,
+		priority, created_at, due_at, caldav_name, ical_uid)
+		SELECT t.id, t.title, t.desc, t.isDone, t.category_id, u.id, t.deleted_at, t.trashed_category_id, t.archived_at, t.done_at,
+		t.priority, t.created_at, t.due_at, t.caldav_name, t.ical_uid FROM tasks t
+		INNER JOIN users u ON u.name = t.user_name;
+
+	CREATE TABLE sharing_new (
+		task_id INTEGER,
+		target_id INTEGER,
+		PRIMARY KEY(target_id, task_id),
+		FOREIGN KEY (target_id) REFERENCES users(id) ON DELETE CASCADE,
+		FOREIGN KEY (task_id) REFERENCES tasks(id) ON DELETE CASCADE
+	);
+	INSERT INTO sharing_new (task_id, target_id)
+		SELECT s.task_id, u.id FROM sharing s INNER JOIN users u ON u.name = s.target_name;
+
+	CREATE TABLE task_order_new (
+		user_id INTEGER,
+		view_key TEXT NOT NULL DEFAULT '',
+		task_id INTEGER,
+		rank_key TEXT,
+		PRIMARY KEY(user_id, view_key, task_id),
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+		FOREIGN KEY (task_id) REFERENCES tasks(id) ON DELETE CASCADE
+	);
+	INSERT INTO task_order_new (user_id, view_key, task_id, rank_key)
+		SELECT u.id, o.view_key, o.task_id, o.rank_key FROM task_order o INNER JOIN users u ON u.name = o.user_name;
+
+	CREATE TABLE smart_lists_new (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		list_name TEXT NOT NULL,
+		query TEXT NOT NULL,
+		color_header TEXT,
+		color_body TEXT,
+		user_id INTEGER NOT NULL,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	);
+	INSERT INTO smart_lists_new (id, list_name, query, color_header, color_body, user_id)
+		SELECT l.id, l.list_name, l.query, l.color_header, l.color_body, u.id FROM smart_lists l INNER JOIN users u ON u.name = l.user_name;
+
+	CREATE TABLE calendar_feeds_new (
+		token TEXT PRIMARY KEY,
+		user_id INTEGER NOT NULL,
+		view_key TEXT NOT NULL DEFAULT '',
+		created_at INTEGER NOT NULL,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	);
+	INSERT INTO calendar_feeds_new (token, user_id, view_key, created_at)
+		SELECT f.token, u.id, f.view_key, f.created_at FROM calendar_feeds f INNER JOIN users u ON u.name = f.user_name;
+
+	CREATE TABLE app_passwords_new (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		label TEXT NOT NULL,
+		password_hash TEXT NOT NULL UNIQUE,
+		created_at INTEGER NOT NULL,
+		last_used_at INTEGER,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	);
+	INSERT INTO app_passwords_new (id, user_id, label, password_hash, created_at, last_used_at)
+		SELECT p.id, u.id, p.label, p.password_hash, p.created_at, p.last_used_at FROM app_passwords p INNER JOIN users u ON u.name = p.user_name;
+
+	CREATE TABLE webhooks_new (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		url TEXT NOT NULL,
+		secret TEXT NOT NULL,
+		events TEXT NOT NULL,
+		is_global BOOL NOT NULL DEFAULT FALSE,
+		created_at INTEGER NOT NULL,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	);
+	INSERT INTO webhooks_new (id, user_id, url, secret, events, is_global, created_at)
+		SELECT w.id, u.id, w.url, w.secret, w.events, w.is_global, w.created_at FROM webhooks w INNER JOIN users u ON u.name = w.user_name;
+
+	CREATE TABLE inbound_hooks_new (
+		token TEXT PRIMARY KEY,
+		user_id INTEGER NOT NULL,
+		category_id INTEGER,
+		created_at INTEGER NOT NULL,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+		FOREIGN KEY (category_id) REFERENCES categories(id) ON DELETE SET NULL
+	);
+	INSERT INTO inbound_hooks_new (token, user_id, category_id, created_at)
+		SELECT h.token, u.id, h.category_id, h.created_at FROM inbound_hooks h INNER JOIN users u ON u.name = h.user_name;
+
+	CREATE TABLE access_tokens_new (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		label TEXT NOT NULL,
+		token_hash TEXT NOT NULL UNIQUE,
+		scopes TEXT NOT NULL,
+		created_at INTEGER NOT NULL,
+		last_used_at INTEGER,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	);
+	INSERT INTO access_tokens_new (id, user_id, label, token_hash, scopes, created_at, last_used_at)
+		SELECT a.id, u.id, a.label, a.token_hash, a.scopes, a.created_at, a.last_used_at FROM access_tokens a INNER JOIN users u ON u.name = a.user_name;
+
+	CREATE TABLE oidc_identities_new (
+		issuer TEXT NOT NULL,
+		subject TEXT NOT NULL,
+		user_id INTEGER NOT NULL,
+		created_at INTEGER NOT NULL,
+		PRIMARY KEY (issuer, subject),
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	);
+	INSERT INTO oidc_identities_new (issuer, subject, user_id, created_at)
+		SELECT i.issuer, i.subject, u.id, i.created_at FROM oidc_identities i INNER JOIN users u ON u.name = i.user_name;
+
+	CREATE TABLE totp_secrets_new (
+		user_id INTEGER PRIMARY KEY,
+		secret TEXT NOT NULL,
+		enabled BOOL NOT NULL DEFAULT FALSE,
+		last_step INTEGER NOT NULL DEFAULT 0,
+		created_at INTEGER NOT NULL,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	);
+	INSERT INTO totp_secrets_new (user_id, secret, enabled, last_step, created_at)
+		SELECT u.id, s.secret, s.enabled, s.last_step, s.created_at FROM totp_secrets s INNER JOIN users u ON u.name = s.user_name;
+
+	CREATE TABLE recovery_codes_new (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		code_hash TEXT NOT NULL,
+		used_at INTEGER,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	);
+	INSERT INTO recovery_codes_new (id, user_id, code_hash, used_at)
+		SELECT r.id, u.id, r.code_hash, r.used_at FROM recovery_codes r INNER JOIN users u ON u.name = r.user_name;
+
+	DELETE FROM sqlite_sequence WHERE name IN ('categories_new', 'tasks_new', 'smart_lists_new', 'app_passwords_new', 'webhooks_new',
+		'access_tokens_new', 'recovery_codes_new');
+	INSERT INTO sqlite_sequence (name, seq)
+		SELECT name || '_new', seq FROM sqlite_sequence WHERE name IN ('categories', 'tasks', 'smart_lists', 'app_passwords', 'webhooks',
+		'access_tokens', 'recovery_codes');
+
+	DROP TABLE recovery_codes;
+	DROP TABLE totp_secrets;
+	DROP TABLE oidc_identities;
+	DROP TABLE access_tokens;
+	DROP TABLE inbound_hooks;
+	DROP TABLE webhooks;
+	DROP TABLE app_passwords;
+	DROP TABLE calendar_feeds;
+	DROP TABLE smart_lists;
+	DROP TABLE task_order;
+	DROP TABLE sharing;
+	DROP TABLE tasks;
+	DROP TABLE categories;
+	ALTER TABLE categories_new RENAME TO categories;
+	ALTER TABLE tasks_new RENAME TO tasks;
+	ALTER TABLE sharing_new RENAME TO sharing;
+	ALTER TABLE task_order_new RENAME TO task_order;
+	ALTER TABLE smart_lists_new RENAME TO smart_lists;
+	ALTER TABLE calendar_feeds_new RENAME TO calendar_feeds;
+	ALTER TABLE app_passwords_new RENAME TO app_passwords;
+	ALTER TABLE webhooks_new RENAME TO webhooks;
+	ALTER TABLE inbound_hooks_new RENAME TO inbound_hooks;
+	ALTER TABLE access_tokens_new RENAME TO access_tokens;
+	ALTER TABLE oidc_identities_new RENAME TO oidc_identities;
+	ALTER TABLE totp_secrets_new RENAME TO totp_secrets;
+	ALTER TABLE recovery_codes_new RENAME TO recovery_codes;
+	CREATE INDEX task_order_rank ON task_order (user_id, view_key, rank_key);
+	CREATE INDEX recovery_codes_user ON recovery_codes (user_id);
+
+	CREATE TRIGGER tasks_fts_insert AFTER INSERT ON tasks BEGIN
+		INSERT INTO tasks_fts (rowid, title, desc, category)
+		VALUES (new.id, new.title, COALESCE(new.desc, ''), COALESCE((SELECT cat_name FROM categories WHERE id = new.category_id), ''));
+	END;
+	CREATE TRIGGER tasks_fts_update AFTER UPDATE OF title, desc, category_id ON tasks BEGIN
+		DELETE FROM tasks_fts WHERE rowid = old.id;
+		INSERT INTO tasks_fts (rowid, title, desc, category)
+		VALUES (new.id, new.title, COALESCE(new.desc, ''), COALESCE((SELECT cat_name FROM categories WHERE id = new.category_id), ''));
+	END;
+	CREATE TRIGGER tasks_fts_delete AFTER DELETE ON tasks BEGIN
+		DELETE FROM tasks_fts WHERE rowid = old.id;
+	END;
+	CREATE TRIGGER categories_fts_update AFTER UPDATE OF cat_name ON categories BEGIN
+		UPDATE tasks_fts SET category = new.cat_name WHERE rowid IN (SELECT id FROM tasks WHERE category_id = new.id);
+	END;
+	CREATE TRIGGER task_changes_insert AFTER INSERT ON tasks BEGIN
+		INSERT INTO task_changes (category_id, href_name) VALUES (new.category_id, COALESCE(new.caldav_name, CAST(new.id AS TEXT)));
+	END;
+	CREATE TRIGGER task_changes_update AFTER UPDATE OF title, desc, isDone, done_at, priority, due_at, category_id, deleted_at, archived_at, caldav_name, ical_uid ON tasks BEGIN
+		INSERT INTO task_changes (category_id, href_name) SELECT old.category_id, COALESCE(old.caldav_name, CAST(old.id AS TEXT))
+			WHERE old.category_id != new.category_id OR old.caldav_name IS NOT new.caldav_name;
+		INSERT INTO task_changes (category_id, href_name) VALUES (new.category_id, COALESCE(new.caldav_name, CAST(new.id AS TEXT)));
+	END;
+	CREATE TRIGGER task_changes_delete AFTER DELETE ON tasks BEGIN
+		INSERT INTO task_changes (category_id, href_name) VALUES (old.category_id, COALESCE(old.caldav_name, CAST(old.id AS TEXT)));
+	END;`,
+	// 20: E-Mail-Adresse je Benutzer und einmalige Token zum Zurücksetzen des Passworts, gespeichert wird nur der Hash
+	`ALTER TABLE users ADD COLUMN email TEXT;
+	CREATE UNIQUE INDEX users_email ON users (email);
+	CREATE TABLE password_resets (
+		token_hash TEXT PRIMARY KEY,
+		user_id INTEGER NOT NULL,
+		created_at INTEGER NOT NULL,
+		expires_at INTEGER NOT NULL,
+		used_at INTEGER,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	);
+	CREATE INDEX password_resets_user ON password_resets (user_id);`,
+	// 21: Zustellungen werden in der Transaktion der Änderung ohne Body angelegt (event_data, viewer_id) und beim Versand gesperrt (locked_until)
+	`ALTER TABLE webhook_deliveries ADD COLUMN event_data TEXT;
+	ALTER TABLE webhook_deliveries ADD COLUMN viewer_id INTEGER;
+	ALTER TABLE webhook_deliveries ADD COLUMN locked_until INTEGER;
+	CREATE INDEX webhook_deliveries_created ON webhook_deliveries (created_at);`,
+}
+
+// migrate legt die Tabellen an und wendet alle noch nicht ausgeführten Einträge aus sqliteMigrations jeweils in einer eigenen Transaktion an
+// während der Migrationen sind Fremdschlüssel deaktiviert, damit Tabellen neu aufgebaut werden können; danach wird geprüft, dass keine Fremdschlüssel verletzt sind
+//
+// Parameter:
+//   - db: Die geöffnete Datenbank
+//
+// Rückgabewert:
+//   - error: Ein Fehler, falls eine Migration fehlschlägt oder danach Fremdschlüssel verletzt sind; "nil", falls nicht
+func (d sqliteDialect) migrate(db *sql.DB) error {
+	for _, table := range sqliteTables {
+		_, err := db.Exec(table)
+		if err != nil {
+			return err
+		}
+	}
+
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	version, err := schemaVersion(ctx, conn)
+	if err != nil {
+		return err
+	}
+	if version >= len(sqliteMigrations) {
+		return nil
+	}
+
+	_, err = conn.ExecContext(ctx, `PRAGMA foreign_keys = OFF`)
+	if err != nil {
+		return err
+	}
+
+	for i := version; i < len(sqliteMigrations); i++ {
+		err = applyMigration(ctx, conn, d, i+1, sqliteMigrations[i])
+		if err != nil {
+			return err
+		}
+	}
+
+	rows, err := conn.QueryContext(ctx, `PRAGMA foreign_key_check`)
+	if err != nil {
+		return err
+	}
+	violated := rows.Next()
+	rows.Close()
+	if violated {
+		return errors.New("Nach der Migration sind Fremdschlüssel verletzt, siehe PRAGMA foreign_key_check")
+	}
+
+	_, err = conn.ExecContext(ctx, `PRAGMA foreign_keys = ON`)
+	return err
+}
+
+// backup schreibt mit VACUUM INTO eine konsistente und kompakte Kopie der Datenbank
+// VACUUM INTO liest innerhalb einer Lesetransaktion, sodass Schreibzugriffe anderer Verbindungen nicht blockiert werden
+//
+// Parameter:
+//   - db: Die zu sichernde Datenbank
+//   - path: Der Pfad der Sicherung, die Datei darf noch nicht existieren
+//
+// Rückgabewert:
+//   - error: Ein Fehler, falls die Sicherung fehlschlägt; "nil", falls nicht
+func (sqliteDialect) backup(db *sqlDB, path string) error {
+	_, err := db.Exec(`VACUUM INTO ?`, path)
+	return err
+}
+
+// fullTextSearch durchsucht die FTS5-Tabelle tasks_fts, deren rowid der ID der Aufgabe entspricht
+// Titel, Beschreibung und Kategoriename werden für den Rang mit 10, 5 und 2 gewichtet
+//
+// Parameter:
+//   - terms: Die Suchbegriffe
+//
+// Rückgabewert:
+//   - fullTextSearch: Die Bestandteile der Abfrage an tasks_fts
+func (sqliteDialect) fullTextSearch(terms []string) fullTextSearch {
+	return fullTextSearch{
+		columns:       `highlight(tasks_fts, 0, '` + highlightStart + `', '` + highlightEnd + `'), snippet(tasks_fts, 1, '` + highlightStart + `', '` + highlightEnd + `', '…', 12), bm25(tasks_fts, 10.0, 5.0, 2.0)`,
+		join:          `INNER JOIN tasks_fts ON tasks_fts.rowid = t.id`,
+		condition:     `tasks_fts MATCH ?`,
+		conditionArgs: []interface{}{ftsMatchExpression(terms)},
+		order:         `bm25(tasks_fts, 10.0, 5.0, 2.0)`,
+	}
+}
+
+// ftsMatchExpression erstellt aus den Suchbegriffen einen Ausdruck für FTS5 MATCH
+// jeder Begriff wird maskiert und als Präfix gesucht, alle Begriffe müssen vorkommen
+//
+// Parameter:
+//   - terms: Die Suchbegriffe
+//
+// Rückgabewert:
+//   - string: Der Ausdruck für MATCH
+func ftsMatchExpression(terms []string) string {
+	parts := make([]string, 0, len(terms))
+	for _, term := range terms {
+		parts = append(parts, `"`+strings.ReplaceAll(term, `"`, `""`)+`"*`)
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// sqlDialect beschreibt die Unterschiede zwischen den unterstützten SQL-Datenbanken
+// die Abfragen des sqlStore verwenden "?" als Platzhalter, die vor der Ausführung mit rebind umgewandelt werden
+type sqlDialect interface {
+	// rebind wandelt die Platzhalter einer Abfrage in die Schreibweise der Datenbank um
+	rebind(query string) string
+	// migrate legt die Tabellen an und wendet alle noch nicht ausgeführten Migrationen des Dialekts an
+	migrate(db *sql.DB) error
+	// backup schreibt eine konsistente Sicherung der Datenbank in eine neue Datei
+	backup(db *sqlDB, path string) error
+	// fullTextSearch liefert die Bestandteile einer Abfrage an die Volltextsuche für die übergebenen Suchbegriffe
+	fullTextSearch(terms []string) fullTextSearch
+}
+
+// fullTextSearch enthält die Bestandteile, mit denen SearchTasks eine Abfrage an die Volltextsuche der Datenbank zusammensetzt
+// columns liefert den hervorgehobenen Titel, einen Textausschnitt und den Rang, wobei ein kleinerer Rang relevanter ist
+type fullTextSearch struct {
+	columns       string
+	join          string
+	joinArgs      []interface{}
+	condition     string
+	conditionArgs []interface{}
+	order         string
+}
+
+// sqlStore implementiert Store auf Basis einer SQL-Datenbank, die Unterschiede zwischen den Datenbanken kapselt dialect
+type sqlStore struct {
+	db      *sqlDB
+	dialect sqlDialect
+}
+
+// openStore öffnet den Speicher, der durch die übergebene Adresse beschrieben wird
+// Adressen mit dem Schema postgres:// bzw. postgresql:// öffnen eine PostgreSQL-Datenbank, alle anderen werden als Pfad einer SQLite-Datei verwendet
+//
+// Parameter:
+//   - databaseURL: Die Adresse der Datenbank bzw. der Pfad der Datenbankdatei
+//
+// Rückgabewert:
+//   - store: Ein Pointer auf den geöffneten Speicher; "nil", falls ein Fehler auftritt
+//   - error: Ein Fehler, falls die Datenbank nicht geöffnet oder migriert werden konnte; "nil", falls nicht
+func openStore(databaseURL string) (*sqlStore, error) {
+	if isPostgresURL(databaseURL) {
+		return openPostgresStore(databaseURL)
+	}
+	return openSQLiteStore(databaseURL)
+}
+
+// isPostgresURL prüft, ob eine Adresse aus GO_TODO_DATABASE_URL eine PostgreSQL-Datenbank beschreibt
+//
+// Parameter:
+//   - databaseURL: Die Adresse der Datenbank bzw. der Pfad der Datenbankdatei
+//
+// Rückgabewert:
+//   - bool: "true", falls die Adresse mit postgres:// bzw. postgresql:// beginnt
+func isPostgresURL(databaseURL string) bool {
+	return strings.HasPrefix(databaseURL, "postgres://") || strings.HasPrefix(databaseURL, "postgresql://")
+}
+
+// newSQLStore bringt das Schema einer geöffneten Datenbank auf den aktuellen Stand und erstellt den dazugehörigen sqlStore
+// schlägt die Migration fehl, wird die Datenbank wieder geschlossen
+//
+// Parameter:
+//   - db: Die geöffnete Datenbank
+//   - dialect: Der Dialekt der Datenbank
+//
+// Rückgabewert:
+//   - store: Ein Pointer auf den erstellten Speicher; "nil", falls ein Fehler auftritt
+//   - error: Ein Fehler, falls die Migration fehlschlägt; "nil", falls nicht
+func newSQLStore(db *sql.DB, dialect sqlDialect) (*sqlStore, error) {
+	err := dialect.migrate(db)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &sqlStore{db: &sqlDB{DB: db, dialect: dialect}, dialect: dialect}, nil
+}
+
+// Close schließt die Verbindung zur Datenbank
+//
+// Rückgabewert:
+//   - error: Ein Fehler, falls beim Schließen ein Fehler auftritt; "nil", falls nicht
+func (s *sqlStore) Close() error {
+	return s.db.Close()
+}
+
+// Backup schreibt eine konsistente Sicherung der Datenbank in eine neue Datei, während andere Zugriffe weiterlaufen können
+//
+// Parameter:
+//   - path: Der Pfad der Sicherung, die Datei darf noch nicht existieren
+//
+// Rückgabewert:
+//   - error: errBackupUnsupported, falls die Datenbank keine Sicherungen unterstützt; ein Fehler, falls die Sicherung fehlschlägt; "nil", falls nicht
+func (s *sqlStore) Backup(path string) error {
+	return s.dialect.backup(s.db, path)
+}
+
+// sqlDB ergänzt sql.DB um die Umwandlung der Platzhalter für den Dialekt der Datenbank
+type sqlDB struct {
+	*sql.DB
+	dialect sqlDialect
+}
+
+// Query führt eine Abfrage aus, nachdem ihre Platzhalter umgewandelt wurden
+func (db *sqlDB) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return db.DB.Query(db.dialect.rebind(query), args...)
+}
+
+// QueryRow führt eine Abfrage mit höchstens einer Ergebniszeile aus, nachdem ihre Platzhalter umgewandelt wurden
+func (db *sqlDB) QueryRow(query string, args ...interface{}) *sql.Row {
+	return db.DB.QueryRow(db.dialect.rebind(query), args...)
+}
+
+// Exec führt eine Anweisung ohne Ergebniszeilen aus, nachdem ihre Platzhalter umgewandelt wurden
+func (db *sqlDB) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return db.DB.Exec(db.dialect.rebind(query), args...)
+}
+
+// Begin startet eine Transaktion, deren Abfragen ebenfalls umgewandelt werden
+func (db *sqlDB) Begin() (*sqlTx, error) {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	return &sqlTx{Tx: tx, dialect: db.dialect}, nil
+}
+
+// sqlQueryer wird von sqlDB und sqlTx erfüllt, damit Abfragen sowohl direkt als auch innerhalb einer Transaktion ausgeführt werden können
+type sqlQueryer interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// sqlTx ergänzt sql.Tx um die Umwandlung der Platzhalter für den Dialekt der Datenbank
+type sqlTx struct {
+	*sql.Tx
+	dialect sqlDialect
+}
+
+// Query führt eine Abfrage innerhalb der Transaktion aus, nachdem ihre Platzhalter umgewandelt wurden
+func (tx *sqlTx) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return tx.Tx.Query(tx.dialect.rebind(query), args...)
+}
+
+// QueryRow führt eine Abfrage mit höchstens einer Ergebniszeile innerhalb der Transaktion aus, nachdem ihre Platzhalter umgewandelt wurden
+func (tx *sqlTx) QueryRow(query string, args ...interface{}) *sql.Row {
+	return tx.Tx.QueryRow(tx.dialect.rebind(query), args...)
+}
+
+// Exec führt eine Anweisung ohne Ergebniszeilen innerhalb der Transaktion aus, nachdem ihre Platzhalter umgewandelt wurden
+func (tx *sqlTx) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return tx.Tx.Exec(tx.dialect.rebind(query), args...)
+}
+
+// schemaVersion legt bei Bedarf die Tabelle schema_version an und liefert die aktuelle Schemaversion
+// die Schemaversion entspricht der Anzahl der bereits angewendeten Migrationen des Dialekts
+//
+// Parameter:
+//   - ctx: Der Kontext der Verbindung
+//   - conn: Die Verbindung, auf der migriert wird
+//
+// Rückgabewert:
+//   - version: Die aktuelle Schemaversion; 0, falls noch keine Migration angewendet wurde
+//   - error: Ein Fehler, falls die Version nicht gelesen werden konnte; "nil", falls nicht
+func schemaVersion(ctx context.Context, conn *sql.Conn) (int, error) {
+	_, err := conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_version (version INTEGER NOT NULL)`)
+	if err != nil {
+		return 0, err
+	}
+
+	var version int
+	err = conn.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_version`).Scan(&version)
+	return version, err
+}
+
+// applyMigration wendet eine einzelne Migration in einer eigenen Transaktion an und speichert die neue Schemaversion
+//
+// Parameter:
+//   - ctx: Der Kontext der Verbindung
+//   - conn: Die Verbindung, auf der migriert wird
+//   - dialect: Der Dialekt der Datenbank
+//   - version: Die Schemaversion, die nach der Migration erreicht ist
+//   - migration: Die Anweisungen der Migration
+//
+// Rückgabewert:
+//   - error: Ein Fehler, falls die Migration fehlschlägt; "nil", falls nicht
+func applyMigration(ctx context.Context, conn *sql.Conn, dialect sqlDialect, version int, migration string) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(migration)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("Migration %d fehlgeschlagen: %w", version, err)
+	}
+	_, err = tx.Exec(`DELETE FROM schema_version`)
+	if err == nil {
+		_, err = tx.Exec(dialect.rebind(`INSERT INTO schema_version (version) VALUES (?)`), version)
+	}
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,245 @@
+package main
+
+import "time"
+
+// UserStore verwaltet die Benutzer, ihre Anmeldedaten und Administratorrechte
+type UserStore interface {
+	AddUser(name, password string) error
+	CheckPassword(name, password string) error
+	IsAdmin(name string) (bool, error)
+	SetUserAdmin(name string, admin bool) error
+}
+
+// AccountStore verwaltet die Konten der Benutzer: stabile ID, Passwortänderung, Umbenennung und Löschung
+type AccountStore interface {
+	GetAccount(name string) (*account, error)
+	GetAccountByID(id int) (*account, error)
+	ChangePassword(name, password string) (*account, error)
+	RenameUser(name, newName string) error
+	DeleteUser(name, transferTo string) (*accountDeletion, error)
+}
+
+// PasswordResetStore verwaltet die E-Mail-Adressen der Benutzer und die Token zum Zurücksetzen des Passworts
+type PasswordResetStore interface {
+	SetUserEmail(name, email string) error
+	GetAccountByEmail(email string) (*account, error)
+	AddPasswordReset(name string, ttl time.Duration) (secret string, expiresAt time.Time, err error)
+	ResetPassword(secret, password string) (*account, error)
+}
+
+// TaskStore verwaltet die Aufgaben der Benutzer
+type TaskStore interface {
+	AddTask(name string, title string, desc string, category category) (int, error)
+	DeleteTask(name string, taskID int) (removedFrom []string, err error)
+	UpdateTask(name string, changedTask task) (shared bool, err error)
+	GetTasksForUser(name string) ([]task, error)
+	GetTaskForUser(name string, taskID int) (*task, error)
+	GetSharedUsersForTask(taskID int) ([]string, error)
+}
+
+// CategoryStore verwaltet die Kategorien der Benutzer
+type CategoryStore interface {
+	AddCategory(catName, colorHeader, colorBody, name string) (int, error)
+	UpdateCategory(name string, catID int, catName, colorHeader, colorBody string) error
+	DeleteCategory(name string, catID int) error
+	GetCategoriesForUser(name string) ([]category, error)
+	GetTaskIDsForCategory(catID int) ([]int, error)
+}
+
+// ShareStore verwaltet die Freigaben von Aufgaben für andere Benutzer
+type ShareStore interface {
+	ShareTask(name string, taskID int, target string) error
+	RemoveSharingForUser(name string, taskID int, target string) (owner string, err error)
+}
+
+// OrderStore verwaltet die manuelle Reihenfolge der Aufgaben in den Ansichten der Benutzer
+type OrderStore interface {
+	UpdateOrder(name string, taskIDUp, taskIDDown int) error
+	MoveTask(name, view string, taskID, anchorID int, before bool) error
+	GetTasksForView(name, view string) ([]task, error)
+	RebalanceRanks() (rebalanced int, err error)
+}
+
+// TrashStore verwaltet den Papierkorb für Aufgaben und Kategorien
+type TrashStore interface {
+	GetTrashForUser(name string) (tasks []task, categories []category, err error)
+	RestoreTask(name string, taskID int) (active bool, err error)
+	RestoreCategory(name string, catID int) error
+	PurgeTrash(before time.Time) (purged int64, err error)
+}
+
+// ArchiveStore verwaltet das Archiv für erledigte Aufgaben
+// die Methoden zum Archivieren liefern je archivierter Aufgabe die Zielbenutzer, bei denen sie ausgeblendet wurde
+type ArchiveStore interface {
+	ArchiveTask(name string, taskID int) (map[int][]string, error)
+	ArchiveDoneTasks(name string) (map[int][]string, error)
+	AutoArchiveDoneTasks(now time.Time) (map[int][]string, error)
+	UnarchiveTask(name string, taskID int) error
+	GetArchivedTasksForUser(name, search string) ([]task, error)
+	GetAutoArchiveDays(name string) (int, error)
+	SetAutoArchiveDays(name string, days int) error
+}
+
+// SearchStore durchsucht die Aufgaben eines Benutzers
+type SearchStore interface {
+	SearchTasks(name string, filter searchFilter, taskID int, limit int, view string) ([]searchResult, error)
+}
+
+// SmartListStore verwaltet die intelligenten Listen und ihre zuletzt ermittelten Aufgaben
+type SmartListStore interface {
+	GetSmartListsForUser(name string) ([]smartList, error)
+	AddSmartList(name string, list smartList) (int, error)
+	UpdateSmartList(name string, list smartList) error
+	DeleteSmartList(name string, listID int) error
+	GetSmartListTasks(name string, listID int) ([]searchResult, error)
+	GetSmartListsForTask(taskID int) ([]smartListMembership, error)
+	SetSmartListMember(listID, taskID int, member bool) error
+	GetSmartListsWithDue() ([]smartListMembership, error)
+	GetSmartListMembers(listID int) ([]int, error)
+}
+
+// ImportStore beschreibt das Anlegen importierter Daten
+type ImportStore interface {
+	ImportData(name string, data *importData, dryRun bool) (*importReport, error)
+}
+
+// TodoTxtStore beschreibt das Lesen und Zusammenführen von Aufgaben im Format todo.txt
+type TodoTxtStore interface {
+	GetTodoTxtTasks(name string) ([]todoTxtTask, error)
+	MergeTodoTxt(name string, tasks []todoTxtTask) (*todoTxtReport, error)
+}
+
+// CalendarStore verwaltet die Kalender-Abonnements und liefert die Aufgaben mit Fälligkeitsdatum
+type CalendarStore interface {
+	AddCalendarFeed(name, view string) (calendarFeed, error)
+	GetCalendarFeedsForUser(name string) ([]calendarFeed, error)
+	GetCalendarFeed(token string) (*calendarFeed, error)
+	DeleteCalendarFeed(name, token string) error
+	GetDueTasksForView(name, view string) ([]calendarTask, error)
+	SetTaskDue(name string, taskID int, due *time.Time) error
+}
+
+// AppPasswordStore verwaltet die App-Passwörter, mit denen sich Clients ohne JWT anmelden
+type AppPasswordStore interface {
+	AddAppPassword(name, label string) (appPassword, string, error)
+	GetAppPasswordsForUser(name string) ([]appPassword, error)
+	DeleteAppPassword(name string, id int) error
+	CheckAppPassword(name, secret string) (bool, error)
+}
+
+// AccessTokenStore verwaltet die persönlichen Zugriffstoken für Skripte
+type AccessTokenStore interface {
+	AddAccessToken(name, label string, scopes []string) (accessToken, string, error)
+	GetAccessTokensForUser(name string) ([]accessToken, error)
+	DeleteAccessToken(name string, id int) error
+	CheckAccessToken(secret string) (string, []string, error)
+}
+
+// CalDAVStore liefert die Kategorien und Aufgaben für den CalDAV-Server und speichert die von Clients gesendeten Aufgaben
+type CalDAVStore interface {
+	GetCalendarCollections(name string) ([]calendarCollection, error)
+	GetCalendarCollection(name string, catID int) (*calendarCollection, error)
+	GetCalendarObjects(name string, catID int) ([]calendarTask, error)
+	GetCalendarObject(name string, catID int, href string) (*calendarTask, error)
+	GetCalendarChanges(catID int, since int64) ([]string, error)
+	PutCalendarObject(name string, catID int, t calendarTask) (int, bool, error)
+}
+
+// WebhookStore verwaltet die Webhooks und das Protokoll ihrer Zustellungen
+type WebhookStore interface {
+	AddWebhook(name, hookURL string, events []string, global bool) (webhook, error)
+	GetWebhooksForUser(name string) ([]webhook, error)
+	DeleteWebhook(name string, id int) error
+	ClaimWebhookDeliveries(now time.Time, lease time.Duration) ([]webhookDelivery, error)
+	RecordWebhookAttempt(delivery webhookDelivery) error
+	PruneWebhookDeliveries(before time.Time) (int64, error)
+	GetWebhookDeliveries(name string, webhookID int) ([]webhookDelivery, error)
+	RedeliverWebhook(name string, webhookID, deliveryID int) (int, error)
+}
+
+// InboundStore verwaltet die geheimen Adressen, über die Aufgaben ohne Anmeldung angelegt werden
+type InboundStore interface {
+	AddInboundHook(name string, catID int) (inboundHook, error)
+	GetInboundHooksForUser(name string) ([]inboundHook, error)
+	GetInboundHook(token string) (*inboundHook, error)
+	DeleteInboundHook(name, token string) error
+}
+
+// OIDCStore verwaltet die Zuordnung von Identitäten eines OpenID-Connect-Anbieters zu Benutzern
+type OIDCStore interface {
+	GetOIDCIdentityUser(issuer, subject string) (string, error)
+	LinkOIDCIdentity(name, issuer, subject string) error
+	AddOIDCUser(name, issuer, subject string) error
+}
+
+// TOTPStore verwaltet die Zwei-Faktor-Authentifizierung und die Wiederherstellungscodes der Benutzer
+type TOTPStore interface {
+	SetTOTPSecret(name, secret string) error
+	GetTOTP(name string) (*totpState, error)
+	EnableTOTP(name string, step int64, hashes []string) error
+	SetRecoveryCodes(name string, hashes []string) error
+	UseTOTPStep(name string, step int64) (bool, error)
+	UseRecoveryCode(name, hash string) (bool, error)
+	DeleteTOTP(name string) error
+}
+
+// LoginThrottleStore protokolliert fehlgeschlagene Anmeldungen und verwaltet die Drosselung von Benutzern und IP-Adressen
+type LoginThrottleStore interface {
+	GetLoginBlock(name, ip string) (time.Time, error)
+	RecordLoginFailure(name, ip string) error
+	ClearLoginFailures(name string) error
+	GetLoginLocks() ([]loginLock, error)
+	GetLoginFailures(name string) ([]loginFailure, error)
+}
+
+// Store fasst alle Zugriffe auf die gespeicherten Daten zusammen
+// die Handler greifen ausschließlich über dieses Interface auf die Daten zu, sodass weitere Backends ergänzt werden können
+type Store interface {
+	UserStore
+	AccountStore
+	PasswordResetStore
+	TaskStore
+	CategoryStore
+	ShareStore
+	OrderStore
+	TrashStore
+	ArchiveStore
+	SearchStore
+	SmartListStore
+	ImportStore
+	TodoTxtStore
+	CalendarStore
+	AppPasswordStore
+	AccessTokenStore
+	OIDCStore
+	TOTPStore
+	LoginThrottleStore
+	CalDAVStore
+	WebhookStore
+	InboundStore
+	Fsck(repair bool) (*fsckReport, error)
+	Backup(path string) error
+	Close() error
+}
+
+// server stellt die Handler der http-Routen und die Hintergrundaufgaben bereit
+// Benachrichtigungen per WebSocket werden hier nach erfolgreichen Änderungen am Store versendet
+// Zustellungen an Webhooks legt der Store in der Transaktion der Änderung an, webhookWake weckt runWebhookDispatcher für den sofortigen Versand
+// oidc ist "nil", falls keine Anmeldung über OpenID Connect eingerichtet ist
+type server struct {
+	store       Store
+	webhookWake chan struct{}
+	oidc        *oidcProvider
+	mailer      *mailer
+}
+
+// newServer erstellt einen neuen server, der auf den übergebenen Store zugreift
+//
+// Parameter:
+//   - store: Der Speicher, auf den die Handler zugreifen
+//
+// Rückgabewert:
+//   - srv: Ein Pointer auf den neu erstellten server
+func newServer(store Store) *server {
+	return &server{store: store, webhookWake: make(chan struct{}, 1)}
+}
@@ -0,0 +1,725 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testDatabaseURL ist eine PostgreSQL-Datenbank, gegen die die Tests des Stores zusätzlich zu SQLite laufen
+// ihr Schema public wird vor jedem Test gelöscht, die Datenbank darf daher nur für die Tests verwendet werden
+var testDatabaseURL = os.Getenv("GO_TODO_TEST_DATABASE_URL")
+
+// forEachDialect führt einen Test mit einem leeren Store je Dialekt aus
+// SQLite verwendet eine temporäre Datei, PostgreSQL wird ohne GO_TODO_TEST_DATABASE_URL übersprungen
+func forEachDialect(t *testing.T, test func(t *testing.T, store *sqlStore)) {
+	t.Run("sqlite", func(t *testing.T) {
+		store, err := openSQLiteStore(filepath.Join(t.TempDir(), "go-todo.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { store.Close() })
+		test(t, store)
+	})
+	t.Run("postgres", func(t *testing.T) {
+		if testDatabaseURL == "" {
+			t.Skip("GO_TODO_TEST_DATABASE_URL ist nicht gesetzt")
+		}
+		if !strings.HasPrefix(testDatabaseURL, "postgres://") && !strings.HasPrefix(testDatabaseURL, "postgresql://") {
+			t.Fatal("GO_TODO_TEST_DATABASE_URL ist keine PostgreSQL-Adresse")
+		}
+		db, err := sql.Open("pgx", testDatabaseURL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = db.Exec(`DROP SCHEMA public CASCADE; CREATE SCHEMA public`)
+		db.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		store, err := openPostgresStore(testDatabaseURL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { store.Close() })
+		test(t, store)
+	})
+}
+
+// addUsers legt Benutzer mit dem Passwort "pw" an
+func addUsers(t *testing.T, store Store, names ...string) {
+	t.Helper()
+	for _, name := range names {
+		if err := store.AddUser(name, "pw"); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// addTask legt eine Aufgabe in einer Kategorie an und liefert ihre ID
+func addTask(t *testing.T, store Store, name, title string, catID int) int {
+	t.Helper()
+	taskID, err := store.AddTask(name, title, "", category{ID: catID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return taskID
+}
+
+// taskTitles lädt die Titel der Aufgaben eines Benutzers in angezeigter Reihenfolge
+func taskTitles(t *testing.T, store Store, name string) []string {
+	t.Helper()
+	tasks, err := store.GetTasksForUser(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	titles := []string{}
+	for _, loaded := range tasks {
+		titles = append(titles, loaded.Title)
+	}
+	return titles
+}
+
+func TestStoreUsers(t *testing.T) {
+	forEachDialect(t, func(t *testing.T, store *sqlStore) {
+		addUsers(t, store, "alice")
+		if err := store.AddUser("alice", "anders"); err == nil {
+			t.Fatal("Benutzername wurde doppelt vergeben")
+		}
+		if err := store.CheckPassword("alice", "pw"); err != nil {
+			t.Fatalf("Korrektes Passwort: %v", err)
+		}
+		if err := store.CheckPassword("alice", "anders"); !errors.Is(err, errBadCredentials) {
+			t.Fatalf("Falsches Passwort: %v", err)
+		}
+		if err := store.CheckPassword("bob", "pw"); !errors.Is(err, errUserNotFound) {
+			t.Fatalf("Unbekannter Benutzer: %v", err)
+		}
+
+		user, err := store.GetAccount("alice")
+		if err != nil {
+			t.Fatal(err)
+		}
+		byID, err := store.GetAccountByID(user.ID)
+		if err != nil || byID.Name != "alice" || byID.Admin {
+			t.Fatalf("Konto über ID: %+v, %v", byID, err)
+		}
+
+		categories, err := store.GetCategoriesForUser("alice")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(categories) != 1 || categories[0].Cat_name != "default" || !categories[0].IsDefault {
+			t.Fatalf("Kategorien nach der Registrierung: %+v", categories)
+		}
+	})
+}
+
+func TestStoreTasks(t *testing.T) {
+	forEachDialect(t, func(t *testing.T, store *sqlStore) {
+		addUsers(t, store, "alice", "bob")
+		work, err := store.AddCategory("Arbeit", "#000", "#fff", "alice")
+		if err != nil {
+			t.Fatal(err)
+		}
+		private, err := store.AddCategory("Privat", "#000", "#fff", "bob")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		first := addTask(t, store, "alice", "Bericht", work)
+		second := addTask(t, store, "alice", "Einkaufen", private)
+		if titles := taskTitles(t, store, "alice"); !slices.Equal(titles, []string{"Bericht", "Einkaufen"}) {
+			t.Fatalf("Aufgaben von alice: %v", titles)
+		}
+		loaded, err := store.GetTaskForUser("alice", second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if loaded.Category.Cat_name != "default" || loaded.Owner != "alice" || loaded.Order != 1 {
+			t.Fatalf("Aufgabe mit fremder Kategorie: %+v", loaded)
+		}
+		if _, err := store.GetTaskForUser("bob", first); !errors.Is(err, errTaskNotFound) {
+			t.Fatalf("Fremde Aufgabe geladen: %v", err)
+		}
+
+		shared, err := store.UpdateTask("alice", task{ID: first, Title: "Bericht 2024", Desc: "Entwurf", IsDone: true, Owner: "alice", Category: category{ID: work}})
+		if err != nil || shared {
+			t.Fatalf("Aufgabe ändern: %v, geteilt %v", err, shared)
+		}
+		loaded, err = store.GetTaskForUser("alice", first)
+		if err != nil || loaded.Title != "Bericht 2024" || loaded.Desc != "Entwurf" || !loaded.IsDone || loaded.Category.ID != work {
+			t.Fatalf("Geänderte Aufgabe: %+v, %v", loaded, err)
+		}
+
+		if _, err := store.DeleteTask("bob", first); !errors.Is(err, errTaskNotFound) {
+			t.Fatalf("Fremde Aufgabe gelöscht: %v", err)
+		}
+		if _, err := store.DeleteTask("alice", first); err != nil {
+			t.Fatal(err)
+		}
+		if titles := taskTitles(t, store, "alice"); !slices.Equal(titles, []string{"Einkaufen"}) {
+			t.Fatalf("Aufgaben nach dem Löschen: %v", titles)
+		}
+		trashed, _, err := store.GetTrashForUser("alice")
+		if err != nil || len(trashed) != 1 || trashed[0].ID != first {
+			t.Fatalf("Papierkorb: %+v, %v", trashed, err)
+		}
+		if active, err := store.RestoreTask("alice", first); err != nil || !active {
+			t.Fatalf("Wiederherstellen: %v, aktiv %v", err, active)
+		}
+		if titles := taskTitles(t, store, "alice"); !slices.Equal(titles, []string{"Bericht 2024", "Einkaufen"}) {
+			t.Fatalf("Aufgaben nach dem Wiederherstellen: %v", titles)
+		}
+	})
+}
+
+func TestStoreSharing(t *testing.T) {
+	forEachDialect(t, func(t *testing.T, store *sqlStore) {
+		addUsers(t, store, "alice", "bob", "carol")
+		taskID := addTask(t, store, "alice", "Gemeinsam", 0)
+
+		if err := store.ShareTask("alice", taskID, "niemand"); !errors.Is(err, errUserNotFound) {
+			t.Fatalf("Freigabe für unbekannten Benutzer: %v", err)
+		}
+		if err := store.ShareTask("carol", taskID, "bob"); !errors.Is(err, errForbidden) {
+			t.Fatalf("Freigabe einer fremden Aufgabe: %v", err)
+		}
+		if err := store.ShareTask("alice", taskID, "bob"); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.ShareTask("alice", taskID, "bob"); err == nil {
+			t.Fatal("Aufgabe wurde doppelt freigegeben")
+		}
+
+		forOwner, err := store.GetTaskForUser("alice", taskID)
+		if err != nil || !slices.Equal(forOwner.Shared, []string{"bob"}) {
+			t.Fatalf("Freigaben aus Sicht des Besitzers: %+v, %v", forOwner, err)
+		}
+		forTarget, err := store.GetTaskForUser("bob", taskID)
+		if err != nil || len(forTarget.Shared) != 0 || forTarget.Owner != "alice" {
+			t.Fatalf("Aufgabe aus Sicht des Zielbenutzers: %+v, %v", forTarget, err)
+		}
+
+		// Zielbenutzer ändern nur den Status
+		shared, err := store.UpdateTask("bob", task{ID: taskID, Title: "Überschrieben", IsDone: true, Owner: "alice"})
+		if err != nil || !shared {
+			t.Fatalf("Status durch Zielbenutzer ändern: %v, geteilt %v", err, shared)
+		}
+		forOwner, _ = store.GetTaskForUser("alice", taskID)
+		if forOwner.Title != "Gemeinsam" || !forOwner.IsDone {
+			t.Fatalf("Aufgabe nach Änderung durch Zielbenutzer: %+v", forOwner)
+		}
+		// Unbeteiligte können den Status nicht ändern, auch wenn sie einen fremden Besitzer angeben
+		if _, err := store.UpdateTask("carol", task{ID: taskID, Title: "Gemeinsam", IsDone: false, Owner: "alice"}); !errors.Is(err, errTaskNotFound) {
+			t.Fatalf("Status durch Unbeteiligte ändern: %v", err)
+		}
+		if _, err := store.UpdateTask("carol", task{ID: taskID, Title: "Gemeinsam", IsDone: false, Owner: "carol"}); !errors.Is(err, errTaskNotFound) {
+			t.Fatalf("Fremde Aufgabe als Besitzer ändern: %v", err)
+		}
+		if forOwner, _ = store.GetTaskForUser("alice", taskID); !forOwner.IsDone {
+			t.Fatalf("Aufgabe nach Änderung durch Unbeteiligte: %+v", forOwner)
+		}
+
+		if _, err := store.RemoveSharingForUser("carol", taskID, "bob"); !errors.Is(err, errForbidden) {
+			t.Fatalf("Freigabe durch Unbeteiligte beendet: %v", err)
+		}
+		if _, err := store.RemoveSharingForUser("alice", taskID, "carol"); !errors.Is(err, errTaskNotFound) {
+			t.Fatalf("Nicht vorhandene Freigabe beendet: %v", err)
+		}
+		if owner, err := store.RemoveSharingForUser("bob", taskID, "bob"); err != nil || owner != "alice" {
+			t.Fatalf("Freigabe verlassen: %q, %v", owner, err)
+		}
+		if titles := taskTitles(t, store, "bob"); len(titles) != 0 {
+			t.Fatalf("Aufgaben von bob nach dem Verlassen: %v", titles)
+		}
+	})
+}
+
+func TestStoreCategories(t *testing.T) {
+	forEachDialect(t, func(t *testing.T, store *sqlStore) {
+		addUsers(t, store, "alice", "bob")
+		catID, err := store.AddCategory("Arbeit", "#000", "#fff", "alice")
+		if err != nil {
+			t.Fatal(err)
+		}
+		taskID := addTask(t, store, "alice", "Bericht", catID)
+
+		categories, _ := store.GetCategoriesForUser("alice")
+		defaultID := categories[0].ID
+		if err := store.DeleteCategory("alice", defaultID); !errors.Is(err, errDefaultCategory) {
+			t.Fatalf("Standardkategorie gelöscht: %v", err)
+		}
+		if err := store.DeleteCategory("bob", catID); !errors.Is(err, errCategoryNotFound) {
+			t.Fatalf("Fremde Kategorie gelöscht: %v", err)
+		}
+		if err := store.DeleteCategory("alice", catID); err != nil {
+			t.Fatal(err)
+		}
+		loaded, _ := store.GetTaskForUser("alice", taskID)
+		if loaded.Category.ID != defaultID {
+			t.Fatalf("Aufgabe nach dem Löschen der Kategorie: %+v", loaded.Category)
+		}
+		if taskIDs, err := store.GetTaskIDsForCategory(catID); err != nil || !slices.Equal(taskIDs, []int{taskID}) {
+			t.Fatalf("Aufgaben der gelöschten Kategorie: %v, %v", taskIDs, err)
+		}
+
+		if err := store.RestoreCategory("alice", catID); err != nil {
+			t.Fatal(err)
+		}
+		loaded, _ = store.GetTaskForUser("alice", taskID)
+		if loaded.Category.ID != catID {
+			t.Fatalf("Aufgabe nach dem Wiederherstellen der Kategorie: %+v", loaded.Category)
+		}
+	})
+}
+
+func TestStoreOrder(t *testing.T) {
+	forEachDialect(t, func(t *testing.T, store *sqlStore) {
+		addUsers(t, store, "alice")
+		catID, err := store.AddCategory("Arbeit", "#000", "#fff", "alice")
+		if err != nil {
+			t.Fatal(err)
+		}
+		first := addTask(t, store, "alice", "Eins", catID)
+		second := addTask(t, store, "alice", "Zwei", catID)
+		third := addTask(t, store, "alice", "Drei", catID)
+
+		if err := store.UpdateOrder("alice", first, second); err != nil {
+			t.Fatal(err)
+		}
+		if titles := taskTitles(t, store, "alice"); !slices.Equal(titles, []string{"Zwei", "Eins", "Drei"}) {
+			t.Fatalf("Reihenfolge nach dem Tausch: %v", titles)
+		}
+		if err := store.MoveTask("alice", globalView, third, second, true); err != nil {
+			t.Fatal(err)
+		}
+		if titles := taskTitles(t, store, "alice"); !slices.Equal(titles, []string{"Drei", "Zwei", "Eins"}) {
+			t.Fatalf("Reihenfolge nach dem Verschieben: %v", titles)
+		}
+
+		// die Ansicht der Kategorie hat eine eigene Reihenfolge
+		if err := store.MoveTask("alice", categoryView(catID), first, third, false); err != nil {
+			t.Fatal(err)
+		}
+		tasks, err := store.GetTasksForView("alice", categoryView(catID))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var titles []string
+		for _, loaded := range tasks {
+			titles = append(titles, loaded.Title)
+		}
+		if !slices.Equal(titles, []string{"Drei", "Eins", "Zwei"}) {
+			t.Fatalf("Reihenfolge der Kategorie: %v", titles)
+		}
+		if titles := taskTitles(t, store, "alice"); !slices.Equal(titles, []string{"Drei", "Zwei", "Eins"}) {
+			t.Fatalf("Gesamtliste nach dem Verschieben in der Kategorie: %v", titles)
+		}
+	})
+}
+
+// viewTitles lädt die Titel der Aufgaben einer Ansicht in angezeigter Reihenfolge
+func viewTitles(t *testing.T, store Store, name, view string) []string {
+	t.Helper()
+	tasks, err := store.GetTasksForView(name, view)
+	if err != nil {
+		t.Fatal(err)
+	}
+	titles := []string{}
+	for _, loaded := range tasks {
+		titles = append(titles, loaded.Title)
+	}
+	return titles
+}
+
+func TestStoreMoveTaskViews(t *testing.T) {
+	forEachDialect(t, func(t *testing.T, store *sqlStore) {
+		addUsers(t, store, "alice")
+		catID, err := store.AddCategory("Einkauf", "#000", "#fff", "alice")
+		if err != nil {
+			t.Fatal(err)
+		}
+		a := addTask(t, store, "alice", "A kaufen", catID)
+		b := addTask(t, store, "alice", "B kaufen", catID)
+		c := addTask(t, store, "alice", "C kaufen", catID)
+		d := addTask(t, store, "alice", "D", catID)
+		listID, err := store.AddSmartList("alice", smartList{List_name: "Kaufen", Query: "kaufen", Color_header: "#000", Color_body: "#fff"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		global, category, list := globalView, categoryView(catID), smartListView(listID)
+
+		expect := func(step string, view string, want ...string) {
+			t.Helper()
+			if titles := viewTitles(t, store, "alice", view); !slices.Equal(titles, want) {
+				t.Fatalf("%s: Ansicht %q ist %v, erwartet %v", step, view, titles, want)
+			}
+		}
+		move := func(view string, taskID, anchorID int, before bool) {
+			t.Helper()
+			if err := store.MoveTask("alice", view, taskID, anchorID, before); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		move(category, a, c, false)
+		expect("Kategorie hinter", category, "B kaufen", "C kaufen", "A kaufen", "D")
+		move(category, d, b, true)
+		expect("Kategorie vor", category, "D", "B kaufen", "C kaufen", "A kaufen")
+		expect("Kategorie verschoben", global, "A kaufen", "B kaufen", "C kaufen", "D")
+		expect("Kategorie verschoben", list, "A kaufen", "B kaufen", "C kaufen")
+
+		move(list, c, a, true)
+		expect("Liste vor", list, "C kaufen", "A kaufen", "B kaufen")
+		move(list, a, b, false)
+		expect("Liste hinter", list, "C kaufen", "B kaufen", "A kaufen")
+		expect("Liste verschoben", global, "A kaufen", "B kaufen", "C kaufen", "D")
+		expect("Liste verschoben", category, "D", "B kaufen", "C kaufen", "A kaufen")
+
+		move(global, d, a, true)
+		expect("Gesamtliste vor", global, "D", "A kaufen", "B kaufen", "C kaufen")
+		move(global, b, c, false)
+		expect("Gesamtliste hinter", global, "D", "A kaufen", "C kaufen", "B kaufen")
+		expect("Gesamtliste verschoben", category, "D", "B kaufen", "C kaufen", "A kaufen")
+		expect("Gesamtliste verschoben", list, "C kaufen", "B kaufen", "A kaufen")
+
+		// eine Aufgabe außerhalb der Ansicht kann dort weder verschoben noch als Bezug verwendet werden
+		if err := store.MoveTask("alice", list, d, a, true); !errors.Is(err, errTaskNotFound) {
+			t.Fatalf("Verschieben außerhalb der Liste: %v", err)
+		}
+		if err := store.MoveTask("alice", list, a, d, true); !errors.Is(err, errTaskNotFound) {
+			t.Fatalf("Bezug außerhalb der Liste: %v", err)
+		}
+	})
+}
+
+func TestStoreMoveHiddenTask(t *testing.T) {
+	forEachDialect(t, func(t *testing.T, store *sqlStore) {
+		addUsers(t, store, "alice")
+		visible := addTask(t, store, "alice", "Sichtbar", 0)
+		archived := addTask(t, store, "alice", "Archiviert", 0)
+		deleted := addTask(t, store, "alice", "Gelöscht", 0)
+		if _, err := store.ArchiveTask("alice", archived); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := store.DeleteTask("alice", deleted); err != nil {
+			t.Fatal(err)
+		}
+
+		// auch in der Gesamtliste können ausgeblendete Aufgaben weder verschoben noch als Bezug verwendet werden
+		for _, move := range [][2]int{{archived, visible}, {visible, archived}, {deleted, visible}, {visible, deleted}} {
+			if err := store.MoveTask("alice", globalView, move[0], move[1], true); !errors.Is(err, errTaskNotFound) {
+				t.Fatalf("Verschieben von %d vor %d: %v", move[0], move[1], err)
+			}
+		}
+	})
+}
+
+func TestStoreRenameAndDeleteUser(t *testing.T) {
+	forEachDialect(t, func(t *testing.T, store *sqlStore) {
+		addUsers(t, store, "alice", "bob")
+		taskID := addTask(t, store, "alice", "Gemeinsam", 0)
+		if err := store.ShareTask("alice", taskID, "bob"); err != nil {
+			t.Fatal(err)
+		}
+		_, secret, err := store.AddAccessToken("alice", "skript", []string{scopeTasksRead})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := store.SetUserAdmin("alice", true); err != nil {
+			t.Fatal(err)
+		}
+		before, _ := store.GetAccount("alice")
+
+		if err := store.RenameUser("alice", "bob"); !errors.Is(err, errUserExists) {
+			t.Fatalf("Umbenennung auf vergebenen Namen: %v", err)
+		}
+		if err := store.RenameUser("alice", "alicia"); err != nil {
+			t.Fatal(err)
+		}
+		after, err := store.GetAccount("alicia")
+		if err != nil || after.ID != before.ID || after.TokenVersion != before.TokenVersion || !after.Admin {
+			t.Fatalf("Konto nach der Umbenennung: %+v, %v", after, err)
+		}
+		if _, err := store.GetAccount("alice"); !errors.Is(err, errUserNotFound) {
+			t.Fatalf("Alter Name ist noch vergeben: %v", err)
+		}
+		if titles := taskTitles(t, store, "alicia"); !slices.Equal(titles, []string{"Gemeinsam"}) {
+			t.Fatalf("Aufgaben nach der Umbenennung: %v", titles)
+		}
+		forTarget, err := store.GetTaskForUser("bob", taskID)
+		if err != nil || forTarget.Owner != "alicia" {
+			t.Fatalf("Freigabe nach der Umbenennung: %+v, %v", forTarget, err)
+		}
+		if name, _, err := store.CheckAccessToken(secret); err != nil || name != "alicia" {
+			t.Fatalf("Zugriffstoken nach der Umbenennung: %q, %v", name, err)
+		}
+		if categories, _ := store.GetCategoriesForUser("alicia"); len(categories) != 1 || !categories[0].IsDefault {
+			t.Fatalf("Kategorien nach der Umbenennung: %+v", categories)
+		}
+
+		// nicht freigegebene Aufgaben werden nicht übertragen, sondern gelöscht
+		private := addTask(t, store, "alicia", "Privat", 0)
+		deletion, err := store.DeleteUser("alicia", "bob")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := store.GetTaskForUser("bob", private); !errors.Is(err, errTaskNotFound) {
+			t.Fatalf("Nicht freigegebene Aufgabe wurde übertragen: %v", err)
+		}
+		if !slices.Equal(deletion.Transferred, []int{taskID}) {
+			t.Fatalf("Übertragene Aufgaben: %v", deletion.Transferred)
+		}
+		transferred, err := store.GetTaskForUser("bob", taskID)
+		if err != nil || transferred.Owner != "bob" || len(transferred.Shared) != 0 {
+			t.Fatalf("Übertragene Aufgabe: %+v, %v", transferred, err)
+		}
+		if _, err := store.GetAccountByID(before.ID); !errors.Is(err, errUserNotFound) {
+			t.Fatalf("Gelöschtes Konto: %v", err)
+		}
+		if name, _, err := store.CheckAccessToken(secret); err == nil && name != "" {
+			t.Fatal("Zugriffstoken des gelöschten Kontos ist noch gültig")
+		}
+
+		// ein neues Konto mit dem Namen eines gelöschten Administrators erhält dessen Rechte nicht
+		addUsers(t, store, "alicia")
+		if admin, err := store.IsAdmin("alicia"); err != nil || admin {
+			t.Fatalf("Neues Konto ist Administrator: %v, %v", admin, err)
+		}
+	})
+}
+
+func TestStoreSearch(t *testing.T) {
+	forEachDialect(t, func(t *testing.T, store *sqlStore) {
+		addUsers(t, store, "alice", "bob")
+		catID, err := store.AddCategory("Haushalt", "#000", "#fff", "alice")
+		if err != nil {
+			t.Fatal(err)
+		}
+		milk, err := store.AddTask("alice", "Milch kaufen", "<b>frisch</b> vom Hof", category{ID: catID})
+		if err != nil {
+			t.Fatal(err)
+		}
+		bread := addTask(t, store, "alice", "Brot backen", 0)
+		if err := store.ShareTask("alice", bread, "bob"); err != nil {
+			t.Fatal(err)
+		}
+
+		results, err := store.SearchTasks("alice", parseSearchQuery("milch"), 0, 0, globalView)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(results) != 1 || results[0].Task.ID != milk {
+			t.Fatalf("Treffer für milch: %+v", results)
+		}
+		if !strings.Contains(results[0].Title, "<mark>Milch</mark>") {
+			t.Fatalf("Titel ist nicht hervorgehoben: %q", results[0].Title)
+		}
+		if strings.Contains(results[0].Snippet, "<b>") {
+			t.Fatalf("Textausschnitt ist nicht maskiert: %q", results[0].Snippet)
+		}
+
+		results, err = store.SearchTasks("alice", parseSearchQuery(`category:Haushalt`), 0, 0, globalView)
+		if err != nil || len(results) != 1 || results[0].Task.ID != milk {
+			t.Fatalf("Treffer für category:Haushalt: %+v, %v", results, err)
+		}
+		results, err = store.SearchTasks("bob", parseSearchQuery("brot"), 0, 0, globalView)
+		if err != nil || len(results) != 1 || results[0].Task.ID != bread {
+			t.Fatalf("Treffer des Zielbenutzers: %+v, %v", results, err)
+		}
+		results, err = store.SearchTasks("bob", parseSearchQuery("milch"), 0, 0, globalView)
+		if err != nil || len(results) != 0 {
+			t.Fatalf("Fremde Aufgabe gefunden: %+v, %v", results, err)
+		}
+	})
+}
+
+func TestStoreWebhookDeliveries(t *testing.T) {
+	forEachDialect(t, func(t *testing.T, store *sqlStore) {
+		addUsers(t, store, "alice", "bob")
+		aliceHook, err := store.AddWebhook("alice", "https://example.com/alice", []string{webhookTaskCreated, webhookTaskShared, webhookTaskCompleted}, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		bobHook, err := store.AddWebhook("bob", "https://example.com/bob", []string{webhookTaskShared}, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		taskID := addTask(t, store, "alice", "Einkaufen", 0)
+		if err := store.ShareTask("alice", taskID, "bob"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := store.UpdateTask("alice", task{ID: taskID, Title: "Einkaufen", IsDone: true, Owner: "alice"}); err != nil {
+			t.Fatal(err)
+		}
+		// eine abgebrochene Transaktion darf keine Zustellung hinterlassen
+		if err := store.ShareTask("alice", taskID, "bob"); err == nil {
+			t.Fatal("Doppelte Freigabe wurde akzeptiert")
+		}
+
+		now := time.Now()
+		claimed, err := store.ClaimWebhookDeliveries(now, webhookClaimLease)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := []string{}
+		for _, delivery := range claimed {
+			got = append(got, fmt.Sprintf("%d %s %s", delivery.WebhookID, delivery.Event, delivery.Viewer))
+			if delivery.Payload != nil || delivery.EventData == "" || delivery.URL == "" || delivery.Secret == "" {
+				t.Fatalf("Beanspruchte Zustellung: %+v", delivery)
+			}
+		}
+		slices.Sort(got)
+		want := []string{
+			fmt.Sprintf("%d %s alice", aliceHook.ID, webhookTaskCompleted),
+			fmt.Sprintf("%d %s alice", aliceHook.ID, webhookTaskCreated),
+			fmt.Sprintf("%d %s alice", aliceHook.ID, webhookTaskShared),
+			fmt.Sprintf("%d %s bob", bobHook.ID, webhookTaskShared),
+		}
+		slices.Sort(want)
+		if !slices.Equal(got, want) {
+			t.Fatalf("Zustellungen %v, erwartet %v", got, want)
+		}
+
+		again, err := store.ClaimWebhookDeliveries(now, webhookClaimLease)
+		if err != nil || len(again) != 0 {
+			t.Fatalf("Bereits beanspruchte Zustellungen wurden erneut geliefert: %+v, %v", again, err)
+		}
+		expired, err := store.ClaimWebhookDeliveries(now.Add(webhookClaimLease+time.Second), webhookClaimLease)
+		if err != nil || len(expired) != len(claimed) {
+			t.Fatalf("Zustellungen nach Ablauf der Sperre: %d, %v", len(expired), err)
+		}
+
+		deliveredAt := now
+		for _, delivery := range expired {
+			delivery.Payload = []byte(`{}`)
+			delivery.Status = deliveryDelivered
+			delivery.Attempts = 1
+			delivery.NextAttemptAt = nil
+			delivery.DeliveredAt = &deliveredAt
+			if err := store.RecordWebhookAttempt(delivery); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if pending, err := store.ClaimWebhookDeliveries(now.Add(time.Hour), webhookClaimLease); err != nil || len(pending) != 0 {
+			t.Fatalf("Zugestellte Zustellungen sind noch offen: %+v, %v", pending, err)
+		}
+
+		if pruned, err := store.PruneWebhookDeliveries(now.Add(-time.Hour)); err != nil || pruned != 0 {
+			t.Fatalf("Neue Zustellungen entfernt: %d, %v", pruned, err)
+		}
+		if pruned, err := store.PruneWebhookDeliveries(now.Add(time.Hour)); err != nil || pruned != int64(len(claimed)) {
+			t.Fatalf("Entfernte Zustellungen: %d, %v", pruned, err)
+		}
+		if deliveries, err := store.GetWebhookDeliveries("alice", aliceHook.ID); err != nil || len(deliveries) != 0 {
+			t.Fatalf("Protokoll nach dem Entfernen: %+v, %v", deliveries, err)
+		}
+	})
+}
+
+func TestStoreLoginThrottlePurge(t *testing.T) {
+	forEachDialect(t, func(t *testing.T, store *sqlStore) {
+		for _, name := range []string{"alice", "bob"} {
+			if err := store.RecordLoginFailure(name, "192.0.2.1"); err != nil {
+				t.Fatal(err)
+			}
+		}
+		// alice ist außerhalb des Zeitfensters und nicht mehr gesperrt, bob noch gesperrt
+		old := time.Now().Add(-2 * loginFailureWindow).Unix()
+		if _, err := store.db.Exec(`UPDATE login_throttles SET updated_at = ?, blocked_until = 0 WHERE subject = ?`, old, "alice"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := store.db.Exec(`UPDATE login_throttles SET updated_at = ?, blocked_until = ? WHERE subject = ?`, old, time.Now().Add(time.Hour).Unix(), "bob"); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := store.RecordLoginFailure("carol", "198.51.100.1"); err != nil {
+			t.Fatal(err)
+		}
+		var subjects []string
+		rows, err := store.db.Query(`SELECT subject FROM login_throttles WHERE kind = ? ORDER BY subject`, loginThrottleUser)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var subject string
+			if err := rows.Scan(&subject); err != nil {
+				t.Fatal(err)
+			}
+			subjects = append(subjects, subject)
+		}
+		if !slices.Equal(subjects, []string{"bob", "carol"}) {
+			t.Fatalf("Verbleibende Drosselungen: %v", subjects)
+		}
+	})
+}
+
+func TestStoreCredentialLastUsed(t *testing.T) {
+	forEachDialect(t, func(t *testing.T, store *sqlStore) {
+		addUsers(t, store, "alice")
+		_, tokenSecret, err := store.AddAccessToken("alice", "skript", []string{scopeTasksRead})
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, appSecret, err := store.AddAppPassword("alice", "Telefon")
+		if err != nil {
+			t.Fatal(err)
+		}
+		lastUsed := func(table string) int64 {
+			var value int64
+			if err := store.db.QueryRow(`SELECT COALESCE(last_used_at, 0) FROM ` + table).Scan(&value); err != nil {
+				t.Fatal(err)
+			}
+			return value
+		}
+		check := func() {
+			if name, _, err := store.CheckAccessToken(tokenSecret); err != nil || name != "alice" {
+				t.Fatalf("Zugriffstoken: %q, %v", name, err)
+			}
+			if ok, err := store.CheckAppPassword("alice", appSecret); err != nil || !ok {
+				t.Fatalf("App-Passwort: %v, %v", ok, err)
+			}
+		}
+
+		check()
+		if lastUsed("access_tokens") == 0 || lastUsed("app_passwords") == 0 {
+			t.Fatal("Erste Verwendung wurde nicht vermerkt")
+		}
+
+		// innerhalb von credentialUsageInterval wird nicht erneut geschrieben
+		recent := time.Now().Add(-credentialUsageInterval / 2).Unix()
+		for _, table := range []string{"access_tokens", "app_passwords"} {
+			if _, err := store.db.Exec(`UPDATE `+table+` SET last_used_at = ?`, recent); err != nil {
+				t.Fatal(err)
+			}
+		}
+		check()
+		if lastUsed("access_tokens") != recent || lastUsed("app_passwords") != recent {
+			t.Fatal("Verwendung wurde innerhalb des Intervalls erneut vermerkt")
+		}
+
+		stale := time.Now().Add(-2 * credentialUsageInterval).Unix()
+		for _, table := range []string{"access_tokens", "app_passwords"} {
+			if _, err := store.db.Exec(`UPDATE `+table+` SET last_used_at = ?`, stale); err != nil {
+				t.Fatal(err)
+			}
+		}
+		check()
+		if lastUsed("access_tokens") <= stale || lastUsed("app_passwords") <= stale {
+			t.Fatal("Verwendung nach dem Intervall wurde nicht vermerkt")
+		}
+
+		if ok, err := store.CheckAppPassword("alice", "falsch"); err != nil || ok {
+			t.Fatalf("Falsches App-Passwort: %v, %v", ok, err)
+		}
+	})
+}
@@ -0,0 +1,545 @@
+package main
+
+import (
+	"bufio"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// todoTxtDateLayout ist das Datumsformat von todo.txt
+const todoTxtDateLayout = "2006-01-02"
+
+var todoTxtPriority = regexp.MustCompile(`^\(([A-Z])\)$`)
+
+// todoTxtTask ist eine Aufgabe in der Darstellung von todo.txt
+// die ID wird als Erweiterung id:<ID> geschrieben, damit geänderte Zeilen beim Zusammenführen ihrer Aufgabe zugeordnet werden können; 0 bei neuen Zeilen
+// eine leere Kategorie steht für die Standardkategorie, Leerzeichen im Namen werden in der Datei durch "_" ersetzt
+type todoTxtTask struct {
+	ID        int
+	Title     string
+	IsDone    bool
+	Priority  string
+	Category  string
+	Tags      []string
+	CreatedAt *time.Time
+	DoneAt    *time.Time
+	DueAt     *time.Time
+}
+
+// todoTxtReport fasst zusammen, welche Aufgaben beim Zusammenführen einer todo.txt-Datei angelegt bzw. geändert wurden
+type todoTxtReport struct {
+	Created    int      `json:"created"`
+	Updated    int      `json:"updated"`
+	Categories []string `json:"categories"`
+	Skipped    []string `json:"skipped"`
+	TaskIDs    []int    `json:"-"`
+	SharedIDs  []int    `json:"-"`
+}
+
+// parseTodoTxtDate liest ein Datum im Format von todo.txt in der lokalen Zeitzone
+//
+// Parameter:
+//   - value: Das Datum, z.B. 2024-06-01
+//
+// Rückgabewert:
+//   - date: Ein Pointer auf das gelesene Datum; "nil", falls der Wert kein Datum ist
+func parseTodoTxtDate(value string) *time.Time {
+	date, err := time.ParseInLocation(todoTxtDateLayout, value, time.Local)
+	if err != nil {
+		return nil
+	}
+	return &date
+}
+
+// parseTodoTxtLine liest eine Zeile im Format todo.txt
+// erkannt werden "x" für erledigte Aufgaben, die Priorität (A), Erledigungs- und Erstellungsdatum, das erste +projekt als Kategorie,
+// @kontext als Tags sowie die Erweiterungen id:, due: und pri:; alle übrigen Wörter bilden den Titel
+//
+// Parameter:
+//   - line: Die Zeile
+//
+// Rückgabewert:
+//   - t: Die gelesene Aufgabe
+//   - bool: "false", falls die Zeile leer ist
+func parseTodoTxtLine(line string) (t todoTxtTask, ok bool) {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return t, false
+	}
+
+	if fields[0] == "x" {
+		t.IsDone = true
+		fields = fields[1:]
+	}
+	if len(fields) > 0 && todoTxtPriority.MatchString(fields[0]) {
+		t.Priority = fields[0][1:2]
+		fields = fields[1:]
+	}
+	// bei erledigten Aufgaben steht das Erledigungsdatum vor dem Erstellungsdatum
+	if t.IsDone && len(fields) > 0 && parseTodoTxtDate(fields[0]) != nil {
+		t.DoneAt = parseTodoTxtDate(fields[0])
+		fields = fields[1:]
+	}
+	if len(fields) > 0 && parseTodoTxtDate(fields[0]) != nil {
+		t.CreatedAt = parseTodoTxtDate(fields[0])
+		fields = fields[1:]
+	}
+
+	words := make([]string, 0, len(fields))
+	for _, field := range fields {
+		switch {
+		case strings.HasPrefix(field, "+") && len(field) > 1 && t.Category == "":
+			t.Category = field[1:]
+			continue
+		case strings.HasPrefix(field, "@") && len(field) > 1:
+			if !containsString(t.Tags, field[1:]) {
+				t.Tags = append(t.Tags, field[1:])
+			}
+			continue
+		}
+
+		key, value, found := strings.Cut(field, ":")
+		switch {
+		case found && key == "id":
+			if id, err := strconv.Atoi(value); err == nil && id > 0 {
+				t.ID = id
+				continue
+			}
+		case found && key == "due":
+			if due := parseTodoTxtDate(value); due != nil {
+				t.DueAt = due
+				continue
+			}
+		case found && key == "pri":
+			if todoTxtPriority.MatchString("(" + value + ")") {
+				t.Priority = value
+				continue
+			}
+		}
+		words = append(words, field)
+	}
+	t.Title = strings.Join(words, " ")
+	return t, true
+}
+
+// formatTodoTxtLine schreibt eine Aufgabe als Zeile im Format todo.txt
+// die Priorität erledigter Aufgaben wird wie üblich als pri:<Priorität> ans Ende gestellt
+//
+// Parameter:
+//   - t: Die Aufgabe
+//
+// Rückgabewert:
+//   - string: Die Zeile ohne Zeilenumbruch
+func formatTodoTxtLine(t todoTxtTask) string {
+	parts := make([]string, 0)
+	if t.IsDone {
+		parts = append(parts, "x")
+		// ohne Erledigungsdatum würde das Erstellungsdatum beim Lesen als Erledigungsdatum verstanden
+		if t.DoneAt != nil {
+			parts = append(parts, t.DoneAt.Local().Format(todoTxtDateLayout))
+			if t.CreatedAt != nil {
+				parts = append(parts, t.CreatedAt.Local().Format(todoTxtDateLayout))
+			}
+		}
+	} else {
+		if t.Priority != "" {
+			parts = append(parts, "("+t.Priority+")")
+		}
+		if t.CreatedAt != nil {
+			parts = append(parts, t.CreatedAt.Local().Format(todoTxtDateLayout))
+		}
+	}
+
+	parts = append(parts, strings.Fields(t.Title)...)
+	if t.Category != "" {
+		parts = append(parts, "+"+strings.Join(strings.Fields(t.Category), "_"))
+	}
+	for _, tag := range t.Tags {
+		parts = append(parts, "@"+tag)
+	}
+	if t.DueAt != nil {
+		parts = append(parts, "due:"+t.DueAt.Local().Format(todoTxtDateLayout))
+	}
+	if t.IsDone && t.Priority != "" {
+		parts = append(parts, "pri:"+t.Priority)
+	}
+	if t.ID != 0 {
+		parts = append(parts, "id:"+strconv.Itoa(t.ID))
+	}
+	return strings.Join(parts, " ")
+}
+
+// containsString prüft, ob ein Wert in einer Liste enthalten ist
+//
+// Parameter:
+//   - values: Die Liste
+//   - value: Der gesuchte Wert
+//
+// Rückgabewert:
+//   - bool: "true", falls der Wert enthalten ist
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// unixTime wandelt einen gespeicherten Unix-Zeitstempel in einen Zeitpunkt um
+//
+// Parameter:
+//   - seconds: Ein Pointer auf den Zeitstempel; "nil", falls keiner gespeichert ist
+//
+// Rückgabewert:
+//   - *time.Time: Der Zeitpunkt; "nil", falls kein Zeitstempel gespeichert ist
+func unixTime(seconds *int64) *time.Time {
+	if seconds == nil {
+		return nil
+	}
+	t := time.Unix(*seconds, 0)
+	return &t
+}
+
+// unixSeconds wandelt einen Zeitpunkt in einen Unix-Zeitstempel für die Datenbank um
+//
+// Parameter:
+//   - t: Ein Pointer auf den Zeitpunkt
+//
+// Rückgabewert:
+//   - interface{}: Der Zeitstempel; "nil", falls kein Zeitpunkt übergeben wurde
+func unixSeconds(t *time.Time) interface{} {
+	if t == nil {
+		return nil
+	}
+	return t.Unix()
+}
+
+// setTaskTags ersetzt die Tags einer Aufgabe innerhalb einer laufenden Transaktion
+//
+// Parameter:
+//   - tx: Die laufende Transaktion
+//   - taskID: Die ID der Aufgabe
+//   - tags: Die neuen Tags der Aufgabe
+//
+// Rückgabewert:
+//   - error: Ein Fehler, falls bei der Transaktion ein Fehler auftritt; "nil", falls nicht
+func setTaskTags(tx *sqlTx, taskID int, tags []string) error {
+	_, err := tx.Exec(`DELETE FROM task_tags WHERE task_id = ?`, taskID)
+	if err != nil {
+		return err
+	}
+	for _, tag := range tags {
+		_, err = tx.Exec(`INSERT INTO task_tags (task_id, tag) VALUES (?,?) ON CONFLICT DO NOTHING`, taskID, tag)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetTodoTxtTasks lädt alle aktiven Aufgaben eines Benutzers inklusive der für ihn freigegebenen in der Reihenfolge seiner Gesamtliste
+// die Kategorie bleibt leer, falls die Aufgabe in der Standardkategorie ihres Besitzers liegt
+//
+// Parameter:
+//   - name: Der Name des Benutzers
+//
+// Rückgabewert:
+//   - tasks: Die Aufgaben in der Darstellung von todo.txt
+//   - error: Ein Fehler, falls bei der Abfrage ein Fehler auftritt; "nil", falls nicht
+func (s *sqlStore) GetTodoTxtTasks(name string) ([]todoTxtTask, error) {
+	taskQuery := `SELECT t.id, t.title, t.isDone, t.priority, CASE WHEN c.id = u.default_category_id THEN '' ELSE c.cat_name END,
+	t.created_at, t.done_at, t.due_at
+	FROM tasks t
+	INNER JOIN categories c ON t.category_id = c.id
+	INNER JOIN users u ON u.id = t.user_id
+	LEFT JOIN task_order o ON t.id = o.task_id AND o.user_id = ` + userIDSQL + ` AND o.view_key = ''
+	WHERE t.deleted_at IS NULL AND t.archived_at IS NULL
+	AND (t.user_id = ` + userIDSQL + ` OR EXISTS(SELECT 1 FROM sharing s WHERE s.task_id = t.id AND s.target_id = ` + userIDSQL + `))
+	ORDER BY o.rank_key, t.id`
+	tagQuery := `SELECT g.task_id, g.tag FROM task_tags g INNER JOIN tasks t ON t.id = g.task_id
+	WHERE t.user_id = ` + userIDSQL + ` OR EXISTS(SELECT 1 FROM sharing s WHERE s.task_id = t.id AND s.target_id = ` + userIDSQL + `)
+	ORDER BY g.tag`
+
+	tags := make(map[int][]string)
+	rows, err := s.db.Query(tagQuery, name, name)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var taskID int
+		var tag string
+		err = rows.Scan(&taskID, &tag)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		tags[taskID] = append(tags[taskID], tag)
+	}
+	rows.Close()
+
+	rows, err = s.db.Query(taskQuery, name, name, name)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tasks := make([]todoTxtTask, 0)
+	for rows.Next() {
+		var t todoTxtTask
+		var createdAt, doneAt, dueAt *int64
+		err = rows.Scan(&t.ID, &t.Title, &t.IsDone, &t.Priority, &t.Category, &createdAt, &doneAt, &dueAt)
+		if err != nil {
+			return nil, err
+		}
+		t.CreatedAt, t.DoneAt, t.DueAt = unixTime(createdAt), unixTime(doneAt), unixTime(dueAt)
+		t.Tags = tags[t.ID]
+		tasks = append(tasks, t)
+	}
+	return tasks, rows.Err()
+}
+
+// MergeTodoTxt führt die Zeilen einer todo.txt-Datei in einer einzigen Transaktion mit den Aufgaben eines Benutzers zusammen
+// Zeilen mit id: ändern die zugehörige Aufgabe, Zeilen ohne id: werden als neue Aufgaben angelegt; Aufgaben, die in der Datei fehlen, bleiben unverändert
+// wie bei UpdateTask darf bei freigegebenen Aufgaben nur der Status geändert werden, fehlende Kategorien werden angelegt
+// für jede angelegte bzw. geänderte Aufgabe und jede neue Kategorie werden wie bei einzelnen Änderungen Webhook-Zustellungen angelegt
+//
+// Parameter:
+//   - name: Der Name des Benutzers
+//   - tasks: Die gelesenen Zeilen
+//
+// Rückgabewert:
+//   - report: Ein Pointer auf die Zusammenfassung; "nil", falls ein Fehler auftritt
+//   - error: Ein Fehler, falls bei der Transaktion ein Fehler auftritt; "nil", falls nicht
+func (s *sqlStore) MergeTodoTxt(name string, tasks []todoTxtTask) (*todoTxtReport, error) {
+	accessQuery := `SELECT ` + userNameSQL("t.user_id") + `, EXISTS(SELECT 1 FROM sharing s WHERE s.task_id = t.id), COALESCE(t.isDone, FALSE) FROM tasks t
+	WHERE t.id = ? AND t.deleted_at IS NULL AND (t.user_id = ` + userIDSQL + ` OR EXISTS(SELECT 1 FROM sharing s WHERE s.task_id = t.id AND s.target_id = ` + userIDSQL + `))`
+	updateQuery := `UPDATE tasks SET title = ?, isDone = ?, done_at = CASE WHEN ? THEN COALESCE(?, done_at, ?) END, priority = ?, category_id = ?,
+	created_at = COALESCE(?, created_at), due_at = ?, trashed_category_id = NULL WHERE id = ?`
+	doneQuery := `UPDATE tasks SET isDone = ?, done_at = CASE WHEN ? THEN COALESCE(?, done_at, ?) END WHERE id = ?`
+	insertQuery := `INSERT INTO tasks (title, "desc", isDone, category_id, user_id, done_at, priority, created_at, due_at) VALUES (?,'',?,?,` + userIDSQL + `,?,?,?,?) RETURNING id`
+	orderQuery := `INSERT INTO task_order (user_id, task_id, rank_key) VALUES (` + userIDSQL + `,?,?)`
+	report := &todoTxtReport{Categories: []string{}, Skipped: []string{}, TaskIDs: []int{}, SharedIDs: []int{}}
+	now := time.Now()
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	categoryIDs, defaultID, err := categoryIDsForUser(tx, name)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	ensureCategory := func(catName string) (int, error) {
+		if catName == "" {
+			return defaultID, nil
+		}
+		if catID, ok := categoryIDs[strings.ToLower(catName)]; ok {
+			return catID, nil
+		}
+		if catID, ok := categoryIDs[strings.ToLower(strings.ReplaceAll(catName, "_", " "))]; ok {
+			return catID, nil
+		}
+		var catID int
+		err := tx.QueryRow(`INSERT INTO categories (cat_name, color_header, color_body, user_id) VALUES (?,?,?,`+userIDSQL+`) RETURNING id`,
+			catName, "#00a4ba", "#00ceea", name).Scan(&catID)
+		if err == nil {
+			err = insertWebhookDeliveries(tx, webhookEvent{Type: webhookCategoryChanged, Actor: name, CategoryID: catID, Action: "created"})
+		}
+		if err != nil {
+			return 0, err
+		}
+		categoryIDs[strings.ToLower(catName)] = catID
+		report.Categories = append(report.Categories, catName)
+		return catID, nil
+	}
+
+	rankKey, err := lastRankForUser(tx, name)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	for _, t := range tasks {
+		if t.Title == "" {
+			report.Skipped = append(report.Skipped, "Zeile ohne Titel")
+			continue
+		}
+
+		if t.ID == 0 {
+			catID, err := ensureCategory(t.Category)
+			if err != nil {
+				tx.Rollback()
+				return nil, err
+			}
+			var doneAt interface{}
+			if t.IsDone {
+				doneAt = now.Unix()
+				if t.DoneAt != nil {
+					doneAt = t.DoneAt.Unix()
+				}
+			}
+			createdAt := now.Unix()
+			if t.CreatedAt != nil {
+				createdAt = t.CreatedAt.Unix()
+			}
+			var taskID int
+			err = tx.QueryRow(insertQuery, t.Title, t.IsDone, catID, name, doneAt, t.Priority, createdAt, unixSeconds(t.DueAt)).Scan(&taskID)
+			if err == nil {
+				rankKey = rankBetween(rankKey, "")
+				_, err = tx.Exec(orderQuery, name, taskID, rankKey)
+			}
+			if err == nil {
+				err = setTaskTags(tx, taskID, t.Tags)
+			}
+			if err == nil {
+				err = insertWebhookDeliveries(tx, webhookEvent{Type: webhookTaskCreated, Actor: name, TaskID: taskID})
+			}
+			if err != nil {
+				tx.Rollback()
+				return nil, err
+			}
+			report.Created++
+			report.TaskIDs = append(report.TaskIDs, taskID)
+			continue
+		}
+
+		var owner string
+		var shared, wasDone bool
+		err = tx.QueryRow(accessQuery, t.ID, name, name).Scan(&owner, &shared, &wasDone)
+		if errors.Is(err, sql.ErrNoRows) {
+			report.Skipped = append(report.Skipped, fmt.Sprintf("Aufgabe %d nicht gefunden", t.ID))
+			continue
+		}
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+
+		if owner == name {
+			catID, err := ensureCategory(t.Category)
+			if err == nil {
+				_, err = tx.Exec(updateQuery, t.Title, t.IsDone, t.IsDone, unixSeconds(t.DoneAt), now.Unix(), t.Priority, catID,
+					unixSeconds(t.CreatedAt), unixSeconds(t.DueAt), t.ID)
+			}
+			if err == nil {
+				err = setTaskTags(tx, t.ID, t.Tags)
+			}
+			if err != nil {
+				tx.Rollback()
+				return nil, err
+			}
+		} else {
+			_, err = tx.Exec(doneQuery, t.IsDone, t.IsDone, unixSeconds(t.DoneAt), now.Unix(), t.ID)
+			if err != nil {
+				tx.Rollback()
+				return nil, err
+			}
+		}
+		err = insertWebhookDeliveries(tx, webhookEvent{Type: webhookTaskUpdated, Actor: name, TaskID: t.ID})
+		if err == nil && t.IsDone && !wasDone {
+			err = insertWebhookDeliveries(tx, webhookEvent{Type: webhookTaskCompleted, Actor: name, TaskID: t.ID})
+		}
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		report.Updated++
+		report.TaskIDs = append(report.TaskIDs, t.ID)
+		if shared {
+			report.SharedIDs = append(report.SharedIDs, t.ID)
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	return report, nil
+}
+
+// HandleGetTodoTxt sendet alle aktiven Aufgaben des anfragenden Benutzers als todo.txt-Datei
+// jede Zeile enthält die Erweiterung id:, über die geänderte Zeilen mit HandleMergeTodoTxt wieder zugeordnet werden
+//
+// Parameter:
+//   - c: Ein Pointer auf ein Context-Objekt von fiber
+//
+// Rückgabewert:
+//   - error: Ein Fehler, falls beim Laden ein Fehler auftritt - wird an Client gesendet
+//     Bei Erfolg wird die Datei zeilenweise an den Client gestreamt
+func (srv *server) HandleGetTodoTxt(c *fiber.Ctx) error {
+	name := c.Locals("name").(string)
+
+	tasks, err := srv.store.GetTodoTxtTasks(name)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(400).JSON(fiber.Map{"error": "Aufgaben konnten nicht geladen werden"})
+	}
+
+	c.Attachment("todo.txt")
+	c.Type("txt", "utf-8")
+	c.Status(200).Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		for _, t := range tasks {
+			w.WriteString(formatTodoTxtLine(t))
+			w.WriteString("\n")
+		}
+		w.Flush()
+	})
+	return nil
+}
+
+// HandleMergeTodoTxt führt eine todo.txt-Datei mit den Aufgaben des anfragenden Benutzers zusammen, siehe MergeTodoTxt
+// die Datei wird als Body oder als Feld file eines Formulars übermittelt
+//
+// Parameter:
+//   - c: Ein Pointer auf ein Context-Objekt von fiber
+//
+// Rückgabewert:
+//   - error: Ein Fehler, falls die Datei nicht gelesen oder zusammengeführt werden konnte - wird an Client gesendet
+//     Bei Erfolg wird die Zusammenfassung an den Client gesendet
+func (srv *server) HandleMergeTodoTxt(c *fiber.Ctx) error {
+	name := c.Locals("name").(string)
+
+	body, err := readUploadedFile(c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	tasks := make([]todoTxtTask, 0)
+	for _, line := range strings.Split(string(body), "\n") {
+		t, ok := parseTodoTxtLine(line)
+		if ok {
+			tasks = append(tasks, t)
+		}
+	}
+
+	report, err := srv.store.MergeTodoTxt(name, tasks)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(400).JSON(fiber.Map{"error": "todo.txt konnte nicht übernommen werden"})
+	}
+
+	for _, taskID := range report.TaskIDs {
+		srv.refreshSmartListsForTask(taskID)
+	}
+	srv.wakeWebhookDelivery()
+	for _, taskID := range report.SharedIDs {
+		changedTask, err := srv.store.GetTaskForUser(name, taskID)
+		if err == nil {
+			err = srv.notifySharedTaskChanged(*changedTask, name)
+		}
+		if err != nil {
+			fmt.Println(err)
+		}
+	}
+	return c.Status(200).JSON(report)
+}
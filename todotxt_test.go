@@ -0,0 +1,100 @@
+package main
+
+import (
+	"reflect"
+	"slices"
+	"strconv"
+	"testing"
+)
+
+func TestTodoTxtLineRoundTrip(t *testing.T) {
+	created := parseTodoTxtDate("2024-05-01")
+	done := parseTodoTxtDate("2024-05-03")
+	due := parseTodoTxtDate("2024-06-01")
+	for _, want := range []todoTxtTask{
+		{Title: "Milch kaufen"},
+		{ID: 7, Title: "Steuer machen", Priority: "A", Category: "Büro", Tags: []string{"telefon", "pc"}, CreatedAt: created, DueAt: due},
+		{ID: 8, Title: "Fenster putzen", IsDone: true, DoneAt: done, CreatedAt: created},
+		{ID: 9, Title: "Rechnung zahlen", IsDone: true, Priority: "B", DoneAt: done, Category: "Haushalt"},
+		{Title: "Notiz mit key:value und x am Anfang"},
+	} {
+		line := formatTodoTxtLine(want)
+		got, ok := parseTodoTxtLine(line)
+		if !ok || !reflect.DeepEqual(got, want) {
+			t.Errorf("%q wurde als %+v gelesen, erwartet %+v", line, got, want)
+		}
+		if again := formatTodoTxtLine(got); again != line {
+			t.Errorf("Erneut geschrieben %q, erwartet %q", again, line)
+		}
+	}
+
+	// Leerzeichen im Namen einer Kategorie werden zu Unterstrichen
+	if line := formatTodoTxtLine(todoTxtTask{Title: "Tisch decken", Category: "Mein Haushalt"}); line != "Tisch decken +Mein_Haushalt" {
+		t.Fatalf("Kategorie mit Leerzeichen: %q", line)
+	}
+}
+
+func TestMergeTodoTxtRoundTrip(t *testing.T) {
+	forEachDialect(t, func(t *testing.T, store *sqlStore) {
+		addUsers(t, store, "alice")
+		catID, err := store.AddCategory("Mein Haushalt", "#000", "#fff", "alice")
+		if err != nil {
+			t.Fatal(err)
+		}
+		milk := addTask(t, store, "alice", "Milch kaufen", catID)
+		addTask(t, store, "alice", "Steuer machen", 0)
+
+		exported, err := store.GetTodoTxtTasks("alice")
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines := make([]string, 0, len(exported))
+		for _, task := range exported {
+			lines = append(lines, formatTodoTxtLine(task))
+		}
+
+		// die unveränderte Datei ändert nur bestehende Aufgaben und legt nichts an
+		parsed := make([]todoTxtTask, 0, len(lines))
+		for _, line := range lines {
+			task, _ := parseTodoTxtLine(line)
+			parsed = append(parsed, task)
+		}
+		report, err := store.MergeTodoTxt("alice", parsed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if report.Created != 0 || report.Updated != 2 || len(report.Categories) != 0 {
+			t.Fatalf("Zusammenführen der unveränderten Datei: %+v", report)
+		}
+		// todo.txt kennt nur Tage, die Datei bleibt daher Zeile für Zeile gleich
+		again, err := store.GetTodoTxtTasks("alice")
+		if err != nil {
+			t.Fatal(err)
+		}
+		againLines := make([]string, 0, len(again))
+		for _, task := range again {
+			againLines = append(againLines, formatTodoTxtLine(task))
+		}
+		if !slices.Equal(againLines, lines) {
+			t.Fatalf("Datei nach dem Zusammenführen: %q, erwartet %q", againLines, lines)
+		}
+
+		// über id: wird die bestehende Aufgabe geändert, Zeilen ohne id: werden angelegt
+		changed, _ := parseTodoTxtLine("x (A) Milch und Brot kaufen +Mein_Haushalt @markt id:" + strconv.Itoa(milk))
+		added, _ := parseTodoTxtLine("Fahrrad reparieren +Werkstatt")
+		report, err = store.MergeTodoTxt("alice", []todoTxtTask{changed, added})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if report.Created != 1 || report.Updated != 1 || !slices.Equal(report.Categories, []string{"Werkstatt"}) {
+			t.Fatalf("Zusammenführen der geänderten Datei: %+v", report)
+		}
+		loaded, err := store.GetTaskForUser("alice", milk)
+		if err != nil || loaded.Title != "Milch und Brot kaufen" || !loaded.IsDone || loaded.Category.ID != catID {
+			t.Fatalf("Geänderte Aufgabe: %+v, %v", loaded, err)
+		}
+		if titles := taskTitles(t, store, "alice"); !slices.Equal(titles, []string{"Milch und Brot kaufen", "Steuer machen", "Fahrrad reparieren"}) {
+			t.Fatalf("Aufgaben nach dem Zusammenführen: %v", titles)
+		}
+	})
+}
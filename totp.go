@@ -0,0 +1,688 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Parameter der Einmal-Codes nach RFC 6238, wie sie von den üblichen Authenticator-Apps erwartet werden
+// totpSkew erlaubt Codes aus dem vorherigen und nächsten Zeitschritt, falls die Uhren leicht abweichen
+const (
+	totpIssuer           = "go-todo"
+	totpPeriod           = 30
+	totpDigits           = 6
+	totpSkew             = 1
+	recoveryCodeCount    = 10
+	totpChallengeTimeout = 5 * time.Minute
+)
+
+var (
+	errTOTPRequired    = errors.New("Zweiter Faktor erforderlich")
+	errTOTPNotEnrolled = errors.New("Zwei-Faktor-Authentifizierung ist nicht eingerichtet")
+	errTOTPEnabled     = errors.New("Zwei-Faktor-Authentifizierung ist bereits aktiviert")
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// totpState ist die gespeicherte Zwei-Faktor-Authentifizierung eines Benutzers
+// vor der ersten erfolgreichen Bestätigung ist enabled "false" und der Login bleibt einstufig
+type totpState struct {
+	secret            string
+	enabled           bool
+	lastStep          int64
+	recoveryCodesLeft int
+}
+
+// totpCode berechnet den Einmal-Code für einen Zeitschritt
+//
+// Parameter:
+//   - secret: Das Geheimnis in Base32
+//   - step: Der Zeitschritt, die Sekunden seit 1970 geteilt durch totpPeriod
+//
+// Rückgabewert:
+//   - string: Der Code mit führenden Nullen
+//   - error: Ein Fehler, falls das Geheimnis ungültig ist; "nil", falls nicht
+func totpCode(secret string, step int64) (string, error) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", err
+	}
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(step))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, value%1000000), nil
+}
+
+// matchTOTP prüft einen Einmal-Code gegen die Zeitschritte um den aktuellen Zeitpunkt
+//
+// Parameter:
+//   - secret: Das Geheimnis in Base32
+//   - code: Der eingegebene Code
+//   - now: Der aktuelle Zeitpunkt
+//
+// Rückgabewert:
+//   - step: Der Zeitschritt, zu dem der Code passt
+//   - bool: "true", falls der Code gültig ist
+func matchTOTP(secret, code string, now time.Time) (int64, bool) {
+	current := now.Unix() / totpPeriod
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		expected, err := totpCode(secret, step)
+		if err != nil {
+			return 0, false
+		}
+		if hmac.Equal([]byte(expected), []byte(code)) {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// totpURI erstellt die Provisioning-URI, die von Authenticator-Apps als QR-Code eingelesen wird
+//
+// Parameter:
+//   - name: Der Name des Benutzers
+//   - secret: Das Geheimnis in Base32
+//
+// Rückgabewert:
+//   - string: Die URI im Format otpauth://totp/...
+func totpURI(name, secret string) string {
+	query := url.Values{
+		"secret":    {secret},
+		"issuer":    {totpIssuer},
+		"algorithm": {"SHA1"},
+		"digits":    {fmt.Sprint(totpDigits)},
+		"period":    {fmt.Sprint(totpPeriod)},
+	}
+	return "otpauth://totp/" + url.PathEscape(totpIssuer+":"+name) + "?" + query.Encode()
+}
+
+// newRecoveryCodes erzeugt neue Wiederherstellungscodes im Format xxxxx-xxxxx
+//
+// Rückgabewert:
+//   - codes: Die Codes im Klartext
+//   - error: Ein Fehler, falls keine Zufallszahlen erzeugt werden können; "nil", falls nicht
+func newRecoveryCodes() ([]string, error) {
+	codes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		secret, err := newSecretToken()
+		if err != nil {
+			return nil, err
+		}
+		codes[i] = secret[:5] + "-" + secret[5:10]
+	}
+	return codes, nil
+}
+
+// hashRecoveryCodes berechnet die gespeicherten Hashes der Wiederherstellungscodes
+//
+// Parameter:
+//   - codes: Die Codes im Klartext
+//
+// Rückgabewert:
+//   - hashes: Die Hashes in derselben Reihenfolge
+func hashRecoveryCodes(codes []string) []string {
+	hashes := make([]string, len(codes))
+	for i, code := range codes {
+		hashes[i] = hashSecretToken(normalizeRecoveryCode(code))
+	}
+	return hashes
+}
+
+// normalizeRecoveryCode vereinheitlicht die Eingabe eines Wiederherstellungscodes, Groß-/Kleinschreibung und Leerzeichen werden ignoriert
+//
+// Parameter:
+//   - code: Der eingegebene Code
+//
+// Rückgabewert:
+//   - string: Der Code in Kleinbuchstaben ohne Leerzeichen
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.Join(strings.Fields(code), ""))
+}
+
+// totpChallengeKey leitet aus jwtSecret den Schlüssel für Anmelde-Challenges ab
+// dadurch wird eine Challenge von jwtMiddleware nicht als Token akzeptiert
+//
+// Rückgabewert:
+//   - []byte: Der Schlüssel
+func totpChallengeKey() []byte {
+	mac := hmac.New(sha256.New, jwtSecret)
+	mac.Write([]byte("totp-challenge"))
+	return mac.Sum(nil)
+}
+
+// generateTOTPChallenge erstellt nach korrektem Passwort eine kurzlebige Challenge für den zweiten Schritt des Logins
+//
+// Parameter:
+//   - name: Der Name des Benutzers
+//
+// Rückgabewert:
+//   - string: Die Challenge
+//   - error: Ein Fehler, falls beim Signieren ein Fehler auftritt; "nil", falls nicht
+func generateTOTPChallenge(name string) (string, error) {
+	claims := &Claims{
+		Name: name,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(totpChallengeTimeout)),
+		},
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(totpChallengeKey())
+}
+
+// parseTOTPChallenge prüft eine Challenge aus generateTOTPChallenge
+//
+// Parameter:
+//   - challenge: Die Challenge
+//
+// Rückgabewert:
+//   - string: Der Name des Benutzers
+//   - error: Ein Fehler, falls die Challenge ungültig oder abgelaufen ist; "nil", falls nicht
+func parseTOTPChallenge(challenge string) (string, error) {
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(challenge, claims, func(t *jwt.Token) (interface{}, error) {
+		return totpChallengeKey(), nil
+	}, jwt.WithValidMethods([]string{"HS256"}), jwt.WithExpirationRequired())
+	if err != nil {
+		return "", err
+	}
+	return claims.Name, nil
+}
+
+// SetTOTPSecret speichert ein neues, noch nicht bestätigtes Geheimnis und ersetzt dabei ein unbestätigtes
+//
+// Parameter:
+//   - name: Der Name des Benutzers
+//   - secret: Das Geheimnis in Base32
+//
+// Rückgabewert:
+//   - error: errTOTPEnabled, falls die Zwei-Faktor-Authentifizierung bereits aktiviert ist; "nil", falls kein Fehler auftritt
+func (s *sqlStore) SetTOTPSecret(name, secret string) error {
+	result, err := s.db.Exec(`INSERT INTO totp_secrets (user_id, secret, created_at) VALUES (`+userIDSQL+`,?,?)
+		ON CONFLICT (user_id) DO UPDATE SET secret = excluded.secret, created_at = excluded.created_at WHERE NOT totp_secrets.enabled`,
+		name, secret, time.Now().Unix())
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return errTOTPEnabled
+	}
+	return nil
+}
+
+// GetTOTP lädt die Zwei-Faktor-Authentifizierung eines Benutzers
+//
+// Parameter:
+//   - name: Der Name des Benutzers
+//
+// Rückgabewert:
+//   - state: Ein Pointer auf Geheimnis, Status und die Anzahl der unbenutzten Wiederherstellungscodes
+//   - error: errTOTPNotEnrolled, falls kein Geheimnis gespeichert ist; "nil", falls kein Fehler auftritt
+func (s *sqlStore) GetTOTP(name string) (*totpState, error) {
+	var state totpState
+	err := s.db.QueryRow(`SELECT secret, enabled, last_step,
+		(SELECT COUNT(*) FROM recovery_codes WHERE user_id = t.user_id AND used_at IS NULL)
+		FROM totp_secrets t WHERE user_id = `+userIDSQL, name).Scan(&state.secret, &state.enabled, &state.lastStep, &state.recoveryCodesLeft)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errTOTPNotEnrolled
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+// replaceRecoveryCodes ersetzt innerhalb einer Transaktion alle Wiederherstellungscodes eines Benutzers
+//
+// Parameter:
+//   - tx: Die laufende Transaktion
+//   - name: Der Name des Benutzers
+//   - hashes: Die Hashes der neuen Codes
+//
+// Rückgabewert:
+//   - error: Ein Fehler, falls beim Speichern ein Fehler auftritt; "nil", falls nicht
+func replaceRecoveryCodes(tx *sqlTx, name string, hashes []string) error {
+	_, err := tx.Exec(`DELETE FROM recovery_codes WHERE user_id = `+userIDSQL, name)
+	if err != nil {
+		return err
+	}
+	for _, hash := range hashes {
+		_, err = tx.Exec(`INSERT INTO recovery_codes (user_id, code_hash) VALUES (`+userIDSQL+`,?)`, name, hash)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// EnableTOTP aktiviert die Zwei-Faktor-Authentifizierung nach der ersten Bestätigung und speichert die Wiederherstellungscodes
+//
+// Parameter:
+//   - name: Der Name des Benutzers
+//   - step: Der Zeitschritt des bestätigten Codes, er kann danach nicht erneut verwendet werden
+//   - hashes: Die Hashes der Wiederherstellungscodes
+//
+// Rückgabewert:
+//   - error: errTOTPNotEnrolled, falls kein unbestätigtes Geheimnis existiert; "nil", falls kein Fehler auftritt
+func (s *sqlStore) EnableTOTP(name string, step int64, hashes []string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		fmt.Println(err)
+		return err
+	}
+	result, err := tx.Exec(`UPDATE totp_secrets SET enabled = ?, last_step = ? WHERE user_id = `+userIDSQL+` AND NOT enabled`, true, step, name)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if affected == 0 {
+		tx.Rollback()
+		return errTOTPNotEnrolled
+	}
+	err = replaceRecoveryCodes(tx, name, hashes)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	err = tx.Commit()
+	if err != nil {
+		tx.Rollback()
+		fmt.Println(err)
+		return err
+	}
+	return nil
+}
+
+// SetRecoveryCodes ersetzt alle Wiederherstellungscodes eines Benutzers, die bisherigen werden ungültig
+//
+// Parameter:
+//   - name: Der Name des Benutzers
+//   - hashes: Die Hashes der neuen Codes
+//
+// Rückgabewert:
+//   - error: Ein Fehler, falls beim Speichern ein Fehler auftritt; "nil", falls nicht
+func (s *sqlStore) SetRecoveryCodes(name string, hashes []string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		fmt.Println(err)
+		return err
+	}
+	err = replaceRecoveryCodes(tx, name, hashes)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	err = tx.Commit()
+	if err != nil {
+		tx.Rollback()
+		fmt.Println(err)
+		return err
+	}
+	return nil
+}
+
+// UseTOTPStep vermerkt den Zeitschritt eines verwendeten Codes, sodass jeder Code nur einmal gültig ist
+//
+// Parameter:
+//   - name: Der Name des Benutzers
+//   - step: Der Zeitschritt des Codes
+//
+// Rückgabewert:
+//   - bool: "false", falls ein Code dieses oder eines späteren Zeitschritts bereits verwendet wurde
+//   - error: Ein Fehler, falls bei der Abfrage ein Fehler auftritt; "nil", falls nicht
+func (s *sqlStore) UseTOTPStep(name string, step int64) (bool, error) {
+	result, err := s.db.Exec(`UPDATE totp_secrets SET last_step = ? WHERE user_id = `+userIDSQL+` AND enabled AND last_step < ?`, step, name, step)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+// UseRecoveryCode löst einen Wiederherstellungscode ein, jeder Code ist nur einmal gültig
+//
+// Parameter:
+//   - name: Der Name des Benutzers
+//   - hash: Der Hash des eingegebenen Codes
+//
+// Rückgabewert:
+//   - bool: "true", falls der Code gültig und noch unbenutzt war
+//   - error: Ein Fehler, falls bei der Abfrage ein Fehler auftritt; "nil", falls nicht
+func (s *sqlStore) UseRecoveryCode(name, hash string) (bool, error) {
+	result, err := s.db.Exec(`UPDATE recovery_codes SET used_at = ? WHERE user_id = `+userIDSQL+` AND code_hash = ? AND used_at IS NULL`,
+		time.Now().Unix(), name, hash)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+// DeleteTOTP deaktiviert die Zwei-Faktor-Authentifizierung und löscht Geheimnis und Wiederherstellungscodes
+//
+// Parameter:
+//   - name: Der Name des Benutzers
+//
+// Rückgabewert:
+//   - error: Ein Fehler, falls beim Löschen ein Fehler auftritt; "nil", falls nicht
+func (s *sqlStore) DeleteTOTP(name string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		fmt.Println(err)
+		return err
+	}
+	_, err = tx.Exec(`DELETE FROM recovery_codes WHERE user_id = `+userIDSQL, name)
+	if err == nil {
+		_, err = tx.Exec(`DELETE FROM totp_secrets WHERE user_id = `+userIDSQL, name)
+	}
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	err = tx.Commit()
+	if err != nil {
+		tx.Rollback()
+		fmt.Println(err)
+		return err
+	}
+	return nil
+}
+
+// totpEnabled prüft, ob für einen Benutzer die Zwei-Faktor-Authentifizierung aktiviert ist
+//
+// Parameter:
+//   - name: Der Name des Benutzers
+//
+// Rückgabewert:
+//   - bool: "true", falls der Login einen zweiten Faktor erfordert
+//   - error: Ein Fehler, falls bei der Abfrage ein Fehler auftritt; "nil", falls nicht
+func (srv *server) totpEnabled(name string) (bool, error) {
+	state, err := srv.store.GetTOTP(name)
+	if errors.Is(err, errTOTPNotEnrolled) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return state.enabled, nil
+}
+
+// verifySecondFactor prüft einen Einmal-Code oder Wiederherstellungscode eines Benutzers mit aktivierter Zwei-Faktor-Authentifizierung
+//
+// Parameter:
+//   - name: Der Name des Benutzers
+//   - code: Der eingegebene Code
+//
+// Rückgabewert:
+//   - bool: "true", falls der Code gültig ist; er wird dabei als verwendet vermerkt
+//   - error: Ein Fehler, falls bei der Abfrage ein Fehler auftritt; "nil", falls nicht
+func (srv *server) verifySecondFactor(name, code string) (bool, error) {
+	state, err := srv.store.GetTOTP(name)
+	if errors.Is(err, errTOTPNotEnrolled) {
+		return false, nil
+	}
+	if err != nil || !state.enabled {
+		return false, err
+	}
+
+	code = strings.TrimSpace(code)
+	if len(code) == totpDigits {
+		step, ok := matchTOTP(state.secret, code, time.Now())
+		if !ok {
+			return false, nil
+		}
+		return srv.store.UseTOTPStep(name, step)
+	}
+	return srv.store.UseRecoveryCode(name, hashSecretToken(normalizeRecoveryCode(code)))
+}
+
+// HandleGetTOTP sendet, ob die Zwei-Faktor-Authentifizierung aktiviert ist und wie viele Wiederherstellungscodes übrig sind
+//
+// Parameter:
+//   - c: Ein Pointer auf ein Context-Objekt von fiber
+//
+// Rückgabewert:
+//   - error: Ein Fehler, falls beim Laden ein Fehler auftritt - wird an Client gesendet
+func (srv *server) HandleGetTOTP(c *fiber.Ctx) error {
+	name := c.Locals("name").(string)
+
+	state, err := srv.store.GetTOTP(name)
+	if errors.Is(err, errTOTPNotEnrolled) {
+		return c.Status(200).JSON(fiber.Map{"enabled": false})
+	}
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(400).JSON(fiber.Map{"error": "Zwei-Faktor-Authentifizierung konnte nicht geladen werden"})
+	}
+	return c.Status(200).JSON(fiber.Map{"enabled": state.enabled, "recoveryCodesLeft": state.recoveryCodesLeft})
+}
+
+// HandleEnrollTOTP erzeugt ein neues Geheimnis und sendet es mit der Provisioning-URI für den QR-Code
+// aktiviert wird die Zwei-Faktor-Authentifizierung erst mit HandleVerifyTOTP
+//
+// Parameter:
+//   - c: Ein Pointer auf ein Context-Objekt von fiber
+//
+// Rückgabewert:
+//   - error: Ein Fehler, falls die Zwei-Faktor-Authentifizierung bereits aktiviert ist - wird an Client gesendet
+func (srv *server) HandleEnrollTOTP(c *fiber.Ctx) error {
+	name := c.Locals("name").(string)
+
+	key := make([]byte, 20)
+	if _, err := rand.Read(key); err != nil {
+		fmt.Println(err)
+		return c.Status(400).JSON(fiber.Map{"error": "Geheimnis konnte nicht erzeugt werden"})
+	}
+	secret := totpEncoding.EncodeToString(key)
+
+	err := srv.store.SetTOTPSecret(name, secret)
+	if errors.Is(err, errTOTPEnabled) {
+		return c.Status(409).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(400).JSON(fiber.Map{"error": "Geheimnis konnte nicht gespeichert werden"})
+	}
+	return c.Status(201).JSON(fiber.Map{"secret": secret, "uri": totpURI(name, secret)})
+}
+
+// HandleVerifyTOTP bestätigt das Geheimnis mit einem ersten Code, z.B. {"code": "123456"}, und aktiviert die Zwei-Faktor-Authentifizierung
+// die Wiederherstellungscodes werden nur in dieser Antwort im Klartext gesendet
+//
+// Parameter:
+//   - c: Ein Pointer auf ein Context-Objekt von fiber
+//
+// Rückgabewert:
+//   - error: Ein Fehler, falls kein Geheimnis eingerichtet ist oder der Code falsch ist - wird an Client gesendet
+func (srv *server) HandleVerifyTOTP(c *fiber.Ctx) error {
+	name := c.Locals("name").(string)
+	type TOTPInput struct {
+		Code string `json:"code"`
+	}
+	var input TOTPInput
+	if err := c.BodyParser(&input); err != nil {
+		fmt.Println(err)
+		return c.Status(400).JSON(fiber.Map{"error": "Ungültige Eingabedaten"})
+	}
+
+	state, err := srv.store.GetTOTP(name)
+	if errors.Is(err, errTOTPNotEnrolled) {
+		return c.Status(404).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(400).JSON(fiber.Map{"error": "Zwei-Faktor-Authentifizierung konnte nicht geladen werden"})
+	}
+	if state.enabled {
+		return c.Status(409).JSON(fiber.Map{"error": errTOTPEnabled.Error()})
+	}
+	step, ok := matchTOTP(state.secret, strings.TrimSpace(input.Code), time.Now())
+	if !ok {
+		return c.Status(400).JSON(fiber.Map{"error": "Der Code ist nicht korrekt"})
+	}
+
+	codes, err := newRecoveryCodes()
+	if err == nil {
+		err = srv.store.EnableTOTP(name, step, hashRecoveryCodes(codes))
+	}
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(400).JSON(fiber.Map{"error": "Zwei-Faktor-Authentifizierung konnte nicht aktiviert werden"})
+	}
+	return c.Status(200).JSON(fiber.Map{"recoveryCodes": codes})
+}
+
+// HandleRegenerateRecoveryCodes erzeugt nach Eingabe eines gültigen Codes neue Wiederherstellungscodes, die bisherigen werden ungültig
+//
+// Parameter:
+//   - c: Ein Pointer auf ein Context-Objekt von fiber
+//
+// Rückgabewert:
+//   - error: Ein Fehler, falls der Code falsch ist - wird an Client gesendet
+//     Bei Erfolg werden die neuen Codes im Klartext gesendet
+func (srv *server) HandleRegenerateRecoveryCodes(c *fiber.Ctx) error {
+	name := c.Locals("name").(string)
+	type TOTPInput struct {
+		Code string `json:"code"`
+	}
+	var input TOTPInput
+	if err := c.BodyParser(&input); err != nil {
+		fmt.Println(err)
+		return c.Status(400).JSON(fiber.Map{"error": "Ungültige Eingabedaten"})
+	}
+
+	ok, err := srv.verifySecondFactor(name, input.Code)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(400).JSON(fiber.Map{"error": "Code konnte nicht geprüft werden"})
+	}
+	if !ok {
+		return c.Status(400).JSON(fiber.Map{"error": "Der Code ist nicht korrekt"})
+	}
+
+	codes, err := newRecoveryCodes()
+	if err == nil {
+		err = srv.store.SetRecoveryCodes(name, hashRecoveryCodes(codes))
+	}
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(400).JSON(fiber.Map{"error": "Wiederherstellungscodes konnten nicht erzeugt werden"})
+	}
+	return c.Status(200).JSON(fiber.Map{"recoveryCodes": codes})
+}
+
+// HandleDisableTOTP deaktiviert nach Eingabe eines gültigen Codes die Zwei-Faktor-Authentifizierung
+//
+// Parameter:
+//   - c: Ein Pointer auf ein Context-Objekt von fiber
+//
+// Rückgabewert:
+//   - error: Ein Fehler, falls der Code falsch ist - wird an Client gesendet
+func (srv *server) HandleDisableTOTP(c *fiber.Ctx) error {
+	name := c.Locals("name").(string)
+	type TOTPInput struct {
+		Code string `json:"code"`
+	}
+	var input TOTPInput
+	if err := c.BodyParser(&input); err != nil {
+		fmt.Println(err)
+		return c.Status(400).JSON(fiber.Map{"error": "Ungültige Eingabedaten"})
+	}
+
+	ok, err := srv.verifySecondFactor(name, input.Code)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(400).JSON(fiber.Map{"error": "Code konnte nicht geprüft werden"})
+	}
+	if !ok {
+		return c.Status(400).JSON(fiber.Map{"error": "Der Code ist nicht korrekt"})
+	}
+	err = srv.store.DeleteTOTP(name)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(400).JSON(fiber.Map{"error": "Zwei-Faktor-Authentifizierung konnte nicht deaktiviert werden"})
+	}
+	return c.Status(200).JSON(fiber.Map{"msg": "Zwei-Faktor-Authentifizierung erfolgreich deaktiviert"})
+}
+
+// HandleLogInTOTP schließt den zweiten Schritt des Logins ab, z.B. {"challenge": "...", "code": "123456"}
+// statt des Einmal-Codes kann ein Wiederherstellungscode verwendet werden
+//
+// Parameter:
+//   - c: Ein Pointer auf ein Context-Objekt von fiber
+//
+// Rückgabewert:
+//   - error: Ein Fehler, falls die Challenge abgelaufen oder der Code falsch ist - wird an Client gesendet
+//     Bei Erfolg werden wie bei HandleLogInUser token, Aufgaben, Kategorien und intelligente Listen gesendet
+func (srv *server) HandleLogInTOTP(c *fiber.Ctx) error {
+	type TOTPLoginInput struct {
+		Challenge string `json:"challenge"`
+		Code      string `json:"code"`
+	}
+	var input TOTPLoginInput
+	if err := c.BodyParser(&input); err != nil {
+		fmt.Println(err)
+		return c.Status(400).JSON(fiber.Map{"error": "Ungültige Eingabedaten"})
+	}
+
+	name, err := parseTOTPChallenge(input.Challenge)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Die Anmeldung ist abgelaufen, bitte erneut mit Passwort anmelden"})
+	}
+	if throttled, err := srv.checkLoginThrottle(c, name); throttled {
+		return err
+	}
+	ok, err := srv.verifySecondFactor(name, input.Code)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(400).JSON(fiber.Map{"error": "Code konnte nicht geprüft werden"})
+	}
+	if !ok {
+		srv.recordLoginFailure(c, name)
+		return c.Status(401).JSON(fiber.Map{"error": "Der Code ist nicht korrekt"})
+	}
+	srv.clearLoginFailures(name)
+
+	token, tasks, categories, err := srv.startSession(name)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	smartLists, err := srv.store.GetSmartListsForUser(name)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(400).JSON(fiber.Map{"error": "Fehler beim Laden der Listen"})
+	}
+	return c.Status(200).JSON(fiber.Map{"token": token, "tasks": tasks, "categories": categories, "smartLists": smartLists})
+}
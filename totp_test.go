@@ -0,0 +1,127 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// rfc6238Secret ist das SHA1-Geheimnis "12345678901234567890" aus Anhang B von RFC 6238 in Base32
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPCodeRFC6238(t *testing.T) {
+	// die Testvektoren haben 8 Stellen, go-todo verwendet die letzten 6
+	for unix, want := range map[int64]string{
+		59:          "287082",
+		1111111109:  "081804",
+		1111111111:  "050471",
+		1234567890:  "005924",
+		2000000000:  "279037",
+		20000000000: "353130",
+	} {
+		got, err := totpCode(rfc6238Secret, unix/totpPeriod)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("totpCode zum Zeitpunkt %d = %s, erwartet %s", unix, got, want)
+		}
+	}
+	if _, err := totpCode("kein base32!", 1); err == nil {
+		t.Fatal("Ungültiges Geheimnis wurde akzeptiert")
+	}
+}
+
+func TestMatchTOTPSkew(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	current := now.Unix() / totpPeriod
+	for offset := int64(-3); offset <= 3; offset++ {
+		code, err := totpCode(rfc6238Secret, current+offset)
+		if err != nil {
+			t.Fatal(err)
+		}
+		step, ok := matchTOTP(rfc6238Secret, code, now)
+		inWindow := offset >= -totpSkew && offset <= totpSkew
+		if ok != inWindow || (ok && step != current+offset) {
+			t.Errorf("Code mit Abstand %d: Schritt %d, %v", offset, step, ok)
+		}
+	}
+}
+
+func TestTOTPChallengeExpiry(t *testing.T) {
+	challenge, err := generateTOTPChallenge("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name, err := parseTOTPChallenge(challenge); err != nil || name != "alice" {
+		t.Fatalf("Gültige Challenge: %q, %v", name, err)
+	}
+
+	expired := &Claims{Name: "alice", RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(-time.Second))}}
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, expired).SignedString(totpChallengeKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := parseTOTPChallenge(signed); err == nil {
+		t.Fatal("Abgelaufene Challenge wurde akzeptiert")
+	}
+
+	// ein normales JWT ist keine Challenge
+	session := &Claims{Name: "alice", RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute))}}
+	signed, err = jwt.NewWithClaims(jwt.SigningMethodHS256, session).SignedString(jwtSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := parseTOTPChallenge(signed); err == nil {
+		t.Fatal("JWT wurde als Challenge akzeptiert")
+	}
+}
+
+func TestVerifySecondFactor(t *testing.T) {
+	forEachDialect(t, func(t *testing.T, store *sqlStore) {
+		srv := newServer(store)
+		addUsers(t, store, "alice")
+		if err := store.SetTOTPSecret("alice", rfc6238Secret); err != nil {
+			t.Fatal(err)
+		}
+		codes := []string{"abcde-fghij", "klmno-pqrst"}
+		if err := store.EnableTOTP("alice", 0, hashRecoveryCodes(codes)); err != nil {
+			t.Fatal(err)
+		}
+
+		code, err := totpCode(rfc6238Secret, time.Now().Unix()/totpPeriod)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok, err := srv.verifySecondFactor("alice", code); err != nil || !ok {
+			t.Fatalf("Aktueller Code: %v, %v", ok, err)
+		}
+		// derselbe Code und Codes früherer Zeitschritte können nicht erneut verwendet werden
+		if ok, err := srv.verifySecondFactor("alice", code); err != nil || ok {
+			t.Fatalf("Wiederverwendeter Code: %v, %v", ok, err)
+		}
+		previous, _ := totpCode(rfc6238Secret, time.Now().Unix()/totpPeriod-1)
+		if ok, err := srv.verifySecondFactor("alice", previous); err != nil || ok {
+			t.Fatalf("Code des vorherigen Zeitschritts: %v, %v", ok, err)
+		}
+		if ok, err := store.UseTOTPStep("alice", time.Now().Unix()/totpPeriod); err != nil || ok {
+			t.Fatalf("Zeitschritt erneut vermerkt: %v, %v", ok, err)
+		}
+
+		// Wiederherstellungscodes sind unabhängig von Schreibweise und Leerzeichen genau einmal gültig
+		if ok, err := srv.verifySecondFactor("alice", " ABCDE-FGHIJ "); err != nil || !ok {
+			t.Fatalf("Wiederherstellungscode: %v, %v", ok, err)
+		}
+		if ok, err := srv.verifySecondFactor("alice", "abcde-fghij"); err != nil || ok {
+			t.Fatalf("Wiederverwendeter Wiederherstellungscode: %v, %v", ok, err)
+		}
+		state, err := store.GetTOTP("alice")
+		if err != nil || state.recoveryCodesLeft != 1 {
+			t.Fatalf("Verbleibende Wiederherstellungscodes: %+v, %v", state, err)
+		}
+		if ok, err := srv.verifySecondFactor("alice", "00000-00000"); err != nil || ok {
+			t.Fatalf("Unbekannter Wiederherstellungscode: %v, %v", ok, err)
+		}
+	})
+}
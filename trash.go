@@ -0,0 +1,353 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetTrashForUser lädt alle Aufgaben und Kategorien eines Benutzers, die sich im Papierkorb befinden
+// geteilte Aufgaben erscheinen nur im Papierkorb des Besitzers
+//
+// Parameter:
+//   - name: Der Name des Benutzers, für welchen der Papierkorb geladen werden soll
+//
+// Rückgabewert:
+//   - tasks: Die gelöschten Aufgaben des Benutzers, zuletzt gelöschte zuerst
+//   - categories: Die gelöschten Kategorien des Benutzers, zuletzt gelöschte zuerst
+//   - error: Ein Fehler, falls beim Laden ein Fehler auftritt; "nil", falls nicht
+func (s *sqlStore) GetTrashForUser(name string) (tasks []task, categories []category, err error) {
+	taskQuery := `SELECT t.id, t.title, t.desc, t.isDone, ` + userNameSQL("t.user_id") + `, c.id, c.cat_name, c.color_header, c.color_body, ` + orderPositionSQL + `, t.deleted_at
+	FROM tasks t
+	LEFT JOIN categories c ON t.category_id = c.id
+	LEFT JOIN task_order o ON t.id = o.task_id AND o.user_id = t.user_id AND o.view_key = ''
+	WHERE t.user_id = ` + userIDSQL + ` AND t.deleted_at IS NOT NULL
+	ORDER BY t.deleted_at DESC`
+	categoryQuery := `SELECT id, cat_name, color_header, color_body, deleted_at FROM categories
+	WHERE user_id = ` + userIDSQL + ` AND deleted_at IS NOT NULL
+	ORDER BY deleted_at DESC`
+
+	taskRows, err := s.db.Query(taskQuery, name)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer taskRows.Close()
+
+	tasks = make([]task, 0)
+	for taskRows.Next() {
+		var task_id, cat_id, order int
+		var title, desc, cat_name, color_header, color_body, owner string
+		var isDone bool
+		var deletedAt int64
+
+		err = taskRows.Scan(&task_id, &title, &desc, &isDone, &owner, &cat_id, &cat_name, &color_header, &color_body, &order, &deletedAt)
+		if err != nil {
+			return nil, nil, err
+		}
+		shared, err := s.GetSharedUsersForTask(task_id)
+		if err != nil {
+			return nil, nil, err
+		}
+		trashedTask := NewTask(task_id, title, desc, isDone, *NewCategory(cat_id, cat_name, color_header, color_body), owner, shared, order)
+		deletedTime := time.Unix(deletedAt, 0)
+		trashedTask.DeletedAt = &deletedTime
+		tasks = append(tasks, *trashedTask)
+	}
+	if err = taskRows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	categoryRows, err := s.db.Query(categoryQuery, name)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer categoryRows.Close()
+
+	categories = make([]category, 0)
+	for categoryRows.Next() {
+		var id int
+		var cat_name, color_header, color_body string
+		var deletedAt int64
+
+		err = categoryRows.Scan(&id, &cat_name, &color_header, &color_body, &deletedAt)
+		if err != nil {
+			return nil, nil, err
+		}
+		trashedCategory := NewCategory(id, cat_name, color_header, color_body)
+		deletedTime := time.Unix(deletedAt, 0)
+		trashedCategory.DeletedAt = &deletedTime
+		categories = append(categories, *trashedCategory)
+	}
+	if err = categoryRows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	return tasks, categories, nil
+}
+
+// RestoreTask führt eine Transaktion in der Datenbank aus, um eine Aufgabe aus dem Papierkorb wiederherzustellen
+// die Aufgabe erhält für den Besitzer und alle Zielbenutzer wieder ihre ursprüngliche Position, da ihr Rangschlüssel erhalten bleibt
+//
+// Parameter:
+//   - name: Der Name des Benutzers, der die Aufgabe wiederherstellen möchte
+//   - taskID: Die ID der gelöschten Aufgabe
+//
+// Rückgabewert:
+//   - active: "true", falls die Aufgabe nicht archiviert ist und daher wieder an alle Zielbenutzer übermittelt werden muss
+//   - error: errTaskNotFound, falls sich die Aufgabe nicht im Papierkorb des Benutzers befindet; "nil", falls kein Fehler auftritt
+func (s *sqlStore) RestoreTask(name string, taskID int) (active bool, err error) {
+	activeQuery := `SELECT archived_at IS NULL FROM tasks WHERE id = ? AND user_id = ` + userIDSQL + ` AND deleted_at IS NOT NULL`
+	restoreQuery := `UPDATE tasks SET deleted_at = NULL WHERE id = ?`
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return false, err
+	}
+
+	err = tx.QueryRow(activeQuery, taskID, name).Scan(&active)
+	if err != nil {
+		tx.Rollback()
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, errTaskNotFound
+		}
+		return false, err
+	}
+
+	_, err = tx.Exec(restoreQuery, taskID)
+	if err != nil {
+		tx.Rollback()
+		return false, err
+	}
+
+	err = insertWebhookDeliveries(tx, webhookEvent{Type: webhookTaskUpdated, Actor: name, TaskID: taskID, Action: "restored"})
+	if err != nil {
+		tx.Rollback()
+		return false, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		tx.Rollback()
+		return false, err
+	}
+
+	// archivierte Aufgaben kehren ins Archiv zurück und werden daher nicht übermittelt
+	return active, nil
+}
+
+// RestoreCategory führt eine Transaktion in der Datenbank aus, um eine Kategorie aus dem Papierkorb wiederherzustellen
+// Aufgaben, die beim Löschen der Kategorie der Standardkategorie zugeordnet wurden, werden ihr wieder zugeordnet
+//
+// Parameter:
+//   - name: Der Name des Benutzers, der die Kategorie wiederherstellen möchte
+//   - catID: Die ID der gelöschten Kategorie
+//
+// Rückgabewert:
+//   - error: errCategoryNotFound, falls sich die Kategorie nicht im Papierkorb des Benutzers befindet; "nil", falls kein Fehler auftritt
+func (s *sqlStore) RestoreCategory(name string, catID int) error {
+	categoryQuery := `UPDATE categories SET deleted_at = NULL WHERE id = ? AND user_id = ` + userIDSQL + ` AND deleted_at IS NOT NULL`
+	taskQuery := `UPDATE tasks SET category_id = ?, trashed_category_id = NULL WHERE trashed_category_id = ? AND user_id = ` + userIDSQL
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.Exec(categoryQuery, catID, name)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		tx.Rollback()
+		return errCategoryNotFound
+	}
+
+	_, err = tx.Exec(taskQuery, catID, catID, name)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = insertWebhookDeliveries(tx, webhookEvent{Type: webhookCategoryChanged, Actor: name, CategoryID: catID, Action: "restored"})
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return nil
+}
+
+// PurgeTrash entfernt alle Aufgaben und Kategorien endgültig, die vor dem angegebenen Zeitpunkt in den Papierkorb verschoben wurden
+// Freigaben, Einträge in task_order und Mitgliedschaften in intelligenten Listen werden über ON DELETE CASCADE mit entfernt,
+// die Reihenfolge in den Ansichten der Kategorien wird ausdrücklich gelöscht
+//
+// Parameter:
+//   - before: Alle Einträge, die vor diesem Zeitpunkt gelöscht wurden, werden entfernt
+//
+// Rückgabewert:
+//   - purged: Die Anzahl der endgültig entfernten Aufgaben und Kategorien
+//   - error: Ein Fehler, falls bei der Transaktion ein Fehler auftritt; "nil", falls nicht
+func (s *sqlStore) PurgeTrash(before time.Time) (purged int64, err error) {
+	expiredTasks := `SELECT id FROM tasks WHERE deleted_at IS NOT NULL AND deleted_at < ?`
+	expiredCategories := `SELECT id FROM categories WHERE deleted_at IS NOT NULL AND deleted_at < ?`
+	queries := []string{
+		`DELETE FROM tasks WHERE id IN (` + expiredTasks + `)`,
+		`UPDATE tasks SET category_id = (SELECT default_category_id FROM users WHERE users.id = tasks.user_id) WHERE category_id IN (` + expiredCategories + `)`,
+		`DELETE FROM task_order WHERE view_key IN (SELECT 'category:' || id FROM categories WHERE deleted_at IS NOT NULL AND deleted_at < ?)`,
+		`DELETE FROM categories WHERE id IN (` + expiredCategories + `)`,
+	}
+	counted := map[int]bool{0: true, 3: true}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+
+	for i, query := range queries {
+		result, err := tx.Exec(query, before.Unix())
+		if err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+		if counted[i] {
+			affected, _ := result.RowsAffected()
+			purged += affected
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	return purged, nil
+}
+
+// runTrashPurger leert in regelmäßigen Abständen alle Einträge im Papierkorb, deren Aufbewahrungsdauer abgelaufen ist
+// läuft dauerhaft und sollte daher als Goroutine gestartet werden
+//
+// Parameter:
+//   - retention: Die Dauer, für die gelöschte Einträge wiederhergestellt werden können
+//   - interval: Der Abstand zwischen zwei Durchläufen
+func (srv *server) runTrashPurger(retention, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		purged, err := srv.store.PurgeTrash(time.Now().Add(-retention))
+		if err != nil {
+			log.Println("Papierkorb konnte nicht geleert werden:", err)
+		} else if purged > 0 {
+			log.Printf("%d Einträge endgültig aus dem Papierkorb entfernt", purged)
+		}
+		<-ticker.C
+	}
+}
+
+// HandleGetTrash ruft GetTrashForUser auf, um den Papierkorb des anfragenden Benutzers zu laden
+//
+// Parameter:
+//   - c: Ein Pointer auf ein Context-Objekt von fiber
+//
+// Rückgabewert:
+//   - error: Ein Fehler, falls beim Laden des Papierkorbs ein Fehler auftritt - wird an Client gesendet
+//     Bei Erfolg werden die gelöschten Aufgaben und Kategorien an den Client gesendet
+func (srv *server) HandleGetTrash(c *fiber.Ctx) error {
+	name := c.Locals("name").(string)
+
+	tasks, categories, err := srv.store.GetTrashForUser(name)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(400).JSON(fiber.Map{"error": "Papierkorb konnte nicht geladen werden"})
+	}
+	return c.Status(200).JSON(fiber.Map{"tasks": tasks, "categories": categories})
+}
+
+// HandleRestoreTask nimmt die mitgeschickten Parameter des Clients entgegen und ruft RestoreTask damit auf, um eine Aufgabe wiederherzustellen
+//
+// Parameter:
+//   - c: Ein Pointer auf ein Context-Objekt von fiber
+//
+// Rückgabewert:
+//   - error: Ein Fehler, falls bei der Wiederherstellung ein Fehler auftritt - wird an Client gesendet
+//     Bei Erfolg wird die wiederhergestellte Aufgabe an den Client gesendet
+func (srv *server) HandleRestoreTask(c *fiber.Ctx) error {
+	name := c.Locals("name").(string)
+
+	i, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(400).JSON(fiber.Map{"error": "Ungültige Eingabedaten"})
+	}
+	active, err := srv.store.RestoreTask(name, i)
+	if err != nil {
+		fmt.Println(err)
+		if errors.Is(err, errTaskNotFound) {
+			return c.Status(404).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.Status(400).JSON(fiber.Map{"error": "Aufgabe konnte nicht wiederhergestellt werden"})
+	}
+	if active {
+		srv.notifyTaskAdded(i)
+	}
+	srv.refreshSmartListsForTask(i)
+	srv.wakeWebhookDelivery()
+
+	restoredTask, err := srv.store.GetTaskForUser(name, i)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(400).JSON(fiber.Map{"error": "Aufgabe konnte nicht geladen werden"})
+	}
+	return c.Status(200).JSON(fiber.Map{"task": restoredTask})
+}
+
+// HandleRestoreCategory nimmt die mitgeschickten Parameter des Clients entgegen und ruft RestoreCategory damit auf, um eine Kategorie wiederherzustellen
+//
+// Parameter:
+//   - c: Ein Pointer auf ein Context-Objekt von fiber
+//
+// Rückgabewert:
+//   - error: Ein Fehler, falls bei der Wiederherstellung ein Fehler auftritt - wird an Client gesendet
+//     Bei Erfolg werden die aktualisierten Aufgaben und Kategorien an den Client gesendet
+func (srv *server) HandleRestoreCategory(c *fiber.Ctx) error {
+	name := c.Locals("name").(string)
+
+	i, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(400).JSON(fiber.Map{"error": "Ungültige Eingabedaten"})
+	}
+	err = srv.store.RestoreCategory(name, i)
+	if err != nil {
+		fmt.Println(err)
+		if errors.Is(err, errCategoryNotFound) {
+			return c.Status(404).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.Status(400).JSON(fiber.Map{"error": "Kategorie konnte nicht wiederhergestellt werden"})
+	}
+	srv.refreshSmartListsForCategory(i)
+	srv.wakeWebhookDelivery()
+
+	tasks, err := srv.store.GetTasksForUser(name)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(400).JSON(fiber.Map{"error": "Aufgaben konnten nicht geladen werden"})
+	}
+	categories, err := srv.store.GetCategoriesForUser(name)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(400).JSON(fiber.Map{"error": "Kategorien konnten nicht geladen werden"})
+	}
+	return c.Status(200).JSON(fiber.Map{"tasks": tasks, "categories": categories})
+}
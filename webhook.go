@@ -0,0 +1,968 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Ereignisse, die Webhooks abonnieren können
+const (
+	webhookTaskCreated     = "task.created"
+	webhookTaskUpdated     = "task.updated"
+	webhookTaskCompleted   = "task.completed"
+	webhookTaskDeleted     = "task.deleted"
+	webhookTaskShared      = "task.shared"
+	webhookCategoryChanged = "category.changed"
+)
+
+// webhookEventTypes enthält alle gültigen Ereignisse in der Reihenfolge der Dokumentation
+var webhookEventTypes = []string{webhookTaskCreated, webhookTaskUpdated, webhookTaskCompleted, webhookTaskDeleted, webhookTaskShared, webhookCategoryChanged}
+
+// Zustände einer Zustellung
+const (
+	deliveryPending   = "pending"
+	deliveryDelivered = "delivered"
+	deliveryFailed    = "failed"
+)
+
+const (
+	// webhookMaxAttempts ist die Anzahl der Versuche, nach denen eine Zustellung als fehlgeschlagen gilt
+	webhookMaxAttempts = 6
+	// webhookRetryDelay ist der Abstand vor dem ersten erneuten Versuch, er verdoppelt sich mit jedem weiteren
+	webhookRetryDelay = 30 * time.Second
+	// webhookTimeout begrenzt die Dauer eines einzelnen Zustellversuchs
+	webhookTimeout = 10 * time.Second
+	// webhookClaimBatch ist die Anzahl der Zustellungen, die ein Durchlauf höchstens für sich beansprucht
+	webhookClaimBatch = 20
+	// webhookClaimLease ist die Dauer, für die beanspruchte Zustellungen für andere Instanzen gesperrt sind
+	// sie muss länger sein als webhookClaimBatch Versuche mit webhookTimeout
+	webhookClaimLease = 5 * time.Minute
+)
+
+var (
+	errWebhookNotFound  = errors.New("Webhook konnte nicht gefunden werden")
+	errDeliveryNotFound = errors.New("Zustellung konnte nicht gefunden werden")
+	errWebhookAddress   = errors.New("Webhooks können nur an öffentliche Adressen zugestellt werden")
+)
+
+// webhook ist eine Adresse, an die bei abonnierten Ereignissen eine signierte JSON-Nachricht gesendet wird
+// ein globaler Webhook eines Administrators erhält die Ereignisse aller Benutzer, sonst nur die seines Besitzers
+// secret wird nur beim Anlegen an den Client gesendet
+type webhook struct {
+	ID        int       `json:"id"`
+	User      string    `json:"user"`
+	URL       string    `json:"url"`
+	Events    []string  `json:"events"`
+	Global    bool      `json:"global"`
+	CreatedAt time.Time `json:"createdAt"`
+	Secret    string    `json:"secret,omitempty"`
+}
+
+// webhookDelivery ist eine Zustellung eines Ereignisses an einen Webhook
+// Zustellungen werden in der Transaktion der Änderung ohne Body angelegt, den Body erstellt der erste Versuch aus EventData,
+// das die Aufgabe bzw. Kategorie so enthält, wie Viewer sie zum Zeitpunkt der Änderung gesehen hat;
+// url, secret, EventData und Viewer werden nur für den Versand geladen
+type webhookDelivery struct {
+	ID             int             `json:"id"`
+	WebhookID      int             `json:"webhookId"`
+	Event          string          `json:"event"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	LastStatusCode int             `json:"lastStatusCode,omitempty"`
+	LastError      string          `json:"lastError,omitempty"`
+	CreatedAt      time.Time       `json:"createdAt"`
+	NextAttemptAt  *time.Time      `json:"nextAttemptAt,omitempty"`
+	DeliveredAt    *time.Time      `json:"deliveredAt,omitempty"`
+	URL            string          `json:"-"`
+	Secret         string          `json:"-"`
+	EventData      string          `json:"-"`
+	Viewer         string          `json:"-"`
+}
+
+// webhookEvent ist ein Ereignis, das der Store mit insertWebhookDeliveries in der Transaktion der Änderung festhält
+// es wird als JSON in webhook_deliveries.event_data gespeichert, bis der erste Zustellversuch daraus den Body erstellt;
+// Task und Category sind der Stand der Daten in dieser Transaktion und werden von insertWebhookDeliveries je Sicht ergänzt
+type webhookEvent struct {
+	Type       string    `json:"type"`
+	Actor      string    `json:"actor"`
+	TaskID     int       `json:"taskId,omitempty"`
+	CategoryID int       `json:"categoryId,omitempty"`
+	Action     string    `json:"action,omitempty"`
+	Target     string    `json:"target,omitempty"`
+	OccurredAt time.Time `json:"occurredAt"`
+	Task       *task     `json:"task,omitempty"`
+	Category   *category `json:"category,omitempty"`
+}
+
+// webhookPayload ist der Body einer Zustellung
+type webhookPayload struct {
+	Event      string    `json:"event"`
+	OccurredAt time.Time `json:"occurredAt"`
+	User       string    `json:"user"`
+	Task       *task     `json:"task,omitempty"`
+	TaskID     int       `json:"taskId,omitempty"`
+	Category   *category `json:"category,omitempty"`
+	CategoryID int       `json:"categoryId,omitempty"`
+	Action     string    `json:"action,omitempty"`
+	Target     string    `json:"target,omitempty"`
+}
+
+// AddWebhook legt einen neuen Webhook mit zufälligem Geheimnis für die Signatur an
+//
+// Parameter:
+//   - name: Der Name des Benutzers
+//   - hookURL: Die Adresse, an die zugestellt wird
+//   - events: Die abonnierten Ereignisse
+//   - global: "true", falls der Webhook die Ereignisse aller Benutzer erhält
+//
+// Rückgabewert:
+//   - hook: Der angelegte Webhook inklusive Geheimnis
+//   - error: Ein Fehler, falls beim Anlegen ein Fehler auftritt; "nil", falls nicht
+func (s *sqlStore) AddWebhook(name, hookURL string, events []string, global bool) (webhook, error) {
+	secret, err := newSecretToken()
+	if err != nil {
+		return webhook{}, err
+	}
+
+	hook := webhook{User: name, URL: hookURL, Events: events, Global: global, CreatedAt: time.Now().Truncate(time.Second), Secret: secret}
+	query := `INSERT INTO webhooks (user_id, url, secret, events, is_global, created_at) VALUES (` + userIDSQL + `,?,?,?,?,?) RETURNING id`
+	err = s.db.QueryRow(query, name, hookURL, secret, strings.Join(events, ","), global, hook.CreatedAt.Unix()).Scan(&hook.ID)
+	if err != nil {
+		return webhook{}, err
+	}
+	return hook, nil
+}
+
+// queryWebhooks lädt Webhooks inklusive Geheimnis
+//
+// Parameter:
+//   - query: Die Abfrage, sie muss id, den Namen des Besitzers, url, secret, events, is_global und created_at liefern
+//   - args: Die Parameter der Abfrage
+//
+// Rückgabewert:
+//   - hooks: Die geladenen Webhooks
+//   - error: Ein Fehler, falls bei der Abfrage ein Fehler auftritt; "nil", falls nicht
+func (s *sqlStore) queryWebhooks(query string, args ...interface{}) ([]webhook, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	hooks := make([]webhook, 0)
+	for rows.Next() {
+		var hook webhook
+		var events string
+		var createdAt int64
+		err = rows.Scan(&hook.ID, &hook.User, &hook.URL, &hook.Secret, &events, &hook.Global, &createdAt)
+		if err != nil {
+			return nil, err
+		}
+		hook.Events = strings.Split(events, ",")
+		hook.CreatedAt = time.Unix(createdAt, 0)
+		hooks = append(hooks, hook)
+	}
+	return hooks, rows.Err()
+}
+
+// GetWebhooksForUser lädt alle Webhooks eines Benutzers ohne Geheimnis
+//
+// Parameter:
+//   - name: Der Name des Benutzers
+//
+// Rückgabewert:
+//   - hooks: Die Webhooks, die ältesten zuerst
+//   - error: Ein Fehler, falls bei der Abfrage ein Fehler auftritt; "nil", falls nicht
+func (s *sqlStore) GetWebhooksForUser(name string) ([]webhook, error) {
+	hooks, err := s.queryWebhooks(`SELECT id, `+userNameSQL("user_id")+`, url, secret, events, is_global, created_at FROM webhooks WHERE user_id = `+userIDSQL+` ORDER BY id`, name)
+	if err != nil {
+		return nil, err
+	}
+	for i := range hooks {
+		hooks[i].Secret = ""
+	}
+	return hooks, nil
+}
+
+// DeleteWebhook entfernt einen Webhook inklusive seiner Zustellungen
+//
+// Parameter:
+//   - name: Der Name des Benutzers
+//   - id: Die ID des Webhooks
+//
+// Rückgabewert:
+//   - error: errWebhookNotFound, falls der Webhook nicht dem Benutzer gehört; "nil", falls kein Fehler auftritt
+func (s *sqlStore) DeleteWebhook(name string, id int) error {
+	result, err := s.db.Exec(`DELETE FROM webhooks WHERE id = ? AND user_id = `+userIDSQL, id, name)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return errWebhookNotFound
+	}
+	return nil
+}
+
+// insertWebhookDeliveries legt in der Transaktion einer Änderung die Zustellungen eines Ereignisses an alle passenden Webhooks an
+// ein Webhook passt, wenn er das Ereignis abonniert hat und entweder global ist oder einem betroffenen Benutzer gehört;
+// betroffen sind der Besitzer und alle Zielbenutzer einer Aufgabe bzw. der Besitzer einer Kategorie.
+// Die Aufgabe bzw. Kategorie wird noch in der Transaktion aus Sicht des Besitzers des Webhooks geladen und mit dem Ereignis gespeichert,
+// sodass spätere Änderungen den Body nicht verfälschen; globale Webhooks erhalten die Sicht des Benutzers, der die Änderung vorgenommen hat
+//
+// Parameter:
+//   - tx: Die Transaktion der Änderung
+//   - event: Das Ereignis, OccurredAt wird hier gesetzt
+//
+// Rückgabewert:
+//   - error: Ein Fehler, falls die Zustellungen nicht angelegt werden können; "nil", falls nicht
+func insertWebhookDeliveries(tx *sqlTx, event webhookEvent) error {
+	event.OccurredAt = time.Now().UTC().Truncate(time.Second)
+
+	affectedSQL := `SELECT id FROM users WHERE name = ?`
+	affectedArgs := []interface{}{event.Actor}
+	if event.TaskID != 0 {
+		affectedSQL = `SELECT user_id FROM tasks WHERE id = ? UNION SELECT target_id FROM sharing WHERE task_id = ?`
+		affectedArgs = []interface{}{event.TaskID, event.TaskID}
+	}
+	hooksQuery := `SELECT w.id, u.name FROM webhooks w
+	INNER JOIN users u ON u.id = CASE WHEN w.user_id IN (` + affectedSQL + `) THEN w.user_id ELSE ` + userIDSQL + ` END
+	WHERE ',' || w.events || ',' LIKE ? AND (w.is_global OR w.user_id IN (` + affectedSQL + `)) ORDER BY w.id`
+	insertQuery := `INSERT INTO webhook_deliveries (webhook_id, event, payload, event_data, viewer_id, status, created_at, next_attempt_at)
+	VALUES (?,?,'',?,` + userIDSQL + `,?,?,?)`
+
+	args := append([]interface{}{}, affectedArgs...)
+	args = append(args, event.Actor, "%,"+event.Type+",%")
+	args = append(args, affectedArgs...)
+	rows, err := tx.Query(hooksQuery, args...)
+	if err != nil {
+		return err
+	}
+	type hookViewer struct {
+		id     int
+		viewer string
+	}
+	hooks := make([]hookViewer, 0)
+	for rows.Next() {
+		var hook hookViewer
+		err = rows.Scan(&hook.id, &hook.viewer)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		hooks = append(hooks, hook)
+	}
+	rows.Close()
+	err = rows.Err()
+	if err != nil {
+		return err
+	}
+
+	// je Sicht wird der Stand nur einmal geladen
+	eventData := make(map[string]string)
+	now := time.Now().Unix()
+	for _, hook := range hooks {
+		data, ok := eventData[hook.viewer]
+		if !ok {
+			snapshot, err := webhookSnapshot(tx, event, hook.viewer)
+			if err != nil {
+				return err
+			}
+			encoded, err := json.Marshal(snapshot)
+			if err != nil {
+				return err
+			}
+			data = string(encoded)
+			eventData[hook.viewer] = data
+		}
+		_, err = tx.Exec(insertQuery, hook.id, event.Type, data, hook.viewer, deliveryPending, now, now)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// webhookSnapshot ergänzt ein Ereignis um die Aufgabe bzw. Kategorie, wie sie ein Benutzer in der laufenden Transaktion sieht
+// gelöschte Aufgaben und Kategorien werden nur mit ihrer ID gemeldet; ist die Aufgabe für den Benutzer nicht sichtbar, gilt dasselbe
+//
+// Parameter:
+//   - tx: Die Transaktion der Änderung
+//   - event: Das Ereignis
+//   - viewer: Der Benutzer, aus dessen Sicht die Aufgabe geladen wird
+//
+// Rückgabewert:
+//   - webhookEvent: Das Ereignis inklusive Aufgabe bzw. Kategorie
+//   - error: Ein Fehler, falls beim Laden ein Fehler auftritt; "nil", falls nicht
+func webhookSnapshot(tx *sqlTx, event webhookEvent, viewer string) (webhookEvent, error) {
+	switch {
+	case event.Type == webhookTaskDeleted:
+	case event.Type == webhookCategoryChanged && event.Action == "deleted":
+	case event.Type == webhookCategoryChanged:
+		query := `SELECT c.id, c.cat_name, c.color_header, c.color_body, c.id IS NOT DISTINCT FROM u.default_category_id FROM categories c
+		INNER JOIN users u ON u.id = c.user_id
+		WHERE c.id = ? AND c.user_id = ` + userIDSQL + ` AND c.deleted_at IS NULL`
+		var loaded category
+		err := tx.QueryRow(query, event.CategoryID, event.Actor).Scan(&loaded.ID, &loaded.Cat_name, &loaded.Color_header, &loaded.Color_body, &loaded.IsDefault)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return event, err
+		}
+		if err == nil {
+			event.Category = &loaded
+		}
+	default:
+		loadedTask, err := loadTaskForUser(tx, viewer, event.TaskID)
+		if err != nil && !errors.Is(err, errTaskNotFound) {
+			return event, err
+		}
+		event.Task = loadedTask
+	}
+	return event, nil
+}
+
+// webhookDeliveryColumns liefert die Spalten, die scanWebhookDelivery erwartet
+// SQLite erlaubt in RETURNING keinen Alias, ClaimWebhookDeliveries übergibt daher den Namen der Tabelle
+//
+// Parameter:
+//   - table: Der Alias bzw. Name der Tabelle webhook_deliveries
+//
+// Rückgabewert:
+//   - string: Die Spalten für SELECT bzw. RETURNING
+func webhookDeliveryColumns(table string) string {
+	return strings.NewReplacer("d.", table+".").Replace(`d.id, d.webhook_id, d.event, d.payload, d.status, d.attempts, COALESCE(d.last_status_code, 0),
+	COALESCE(d.last_error, ''), d.created_at, d.next_attempt_at, d.delivered_at`)
+}
+
+// scanWebhookDelivery liest eine Zustellung mit den Spalten aus webhookDeliveryColumns
+//
+// Parameter:
+//   - scan: Die Scan-Funktion der Zeile
+//   - extra: Weitere Ziele für Spalten, die auf webhookDeliveryColumns folgen
+//
+// Rückgabewert:
+//   - delivery: Die gelesene Zustellung
+//   - error: Ein Fehler, falls die Zeile nicht gelesen werden kann; "nil", falls nicht
+func scanWebhookDelivery(scan func(dest ...interface{}) error, extra ...interface{}) (webhookDelivery, error) {
+	var delivery webhookDelivery
+	var payload string
+	var createdAt int64
+	var nextAttemptAt, deliveredAt *int64
+	dest := []interface{}{&delivery.ID, &delivery.WebhookID, &delivery.Event, &payload, &delivery.Status, &delivery.Attempts,
+		&delivery.LastStatusCode, &delivery.LastError, &createdAt, &nextAttemptAt, &deliveredAt}
+	err := scan(append(dest, extra...)...)
+	if err != nil {
+		return webhookDelivery{}, err
+	}
+	if payload != "" {
+		delivery.Payload = json.RawMessage(payload)
+	}
+	delivery.CreatedAt = time.Unix(createdAt, 0)
+	delivery.NextAttemptAt = unixTime(nextAttemptAt)
+	delivery.DeliveredAt = unixTime(deliveredAt)
+	return delivery, nil
+}
+
+// ClaimWebhookDeliveries beansprucht die offenen Zustellungen, deren nächster Versuch fällig ist, und lädt sie inklusive Adresse und Geheimnis
+// die Zustellungen werden dafür bis now + lease gesperrt, sodass mehrere Instanzen auf derselben Datenbank sie nicht doppelt versenden;
+// die Bedingungen der Unterabfrage werden in der äußeren Abfrage wiederholt, da PostgreSQL nur diese nach dem Warten auf eine gesperrte Zeile erneut prüft
+//
+// Parameter:
+//   - now: Der aktuelle Zeitpunkt
+//   - lease: Die Dauer der Sperre, siehe webhookClaimLease
+//
+// Rückgabewert:
+//   - deliveries: Die beanspruchten Zustellungen, die ältesten zuerst
+//   - error: Ein Fehler, falls bei der Abfrage ein Fehler auftritt; "nil", falls nicht
+func (s *sqlStore) ClaimWebhookDeliveries(now time.Time, lease time.Duration) ([]webhookDelivery, error) {
+	dueSQL := `status = ? AND next_attempt_at <= ? AND (locked_until IS NULL OR locked_until <= ?)`
+	query := `UPDATE webhook_deliveries SET locked_until = ?
+	WHERE id IN (SELECT id FROM webhook_deliveries WHERE ` + dueSQL + ` ORDER BY id LIMIT ?) AND ` + dueSQL + `
+	RETURNING ` + webhookDeliveryColumns("webhook_deliveries") + `,
+	(SELECT w.url FROM webhooks w WHERE w.id = webhook_deliveries.webhook_id), (SELECT w.secret FROM webhooks w WHERE w.id = webhook_deliveries.webhook_id),
+	COALESCE(webhook_deliveries.event_data, ''), COALESCE(` + userNameSQL("webhook_deliveries.viewer_id") + `, '')`
+	rows, err := s.db.Query(query, now.Add(lease).Unix(), deliveryPending, now.Unix(), now.Unix(), webhookClaimBatch, deliveryPending, now.Unix(), now.Unix())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := make([]webhookDelivery, 0)
+	for rows.Next() {
+		var hookURL, secret, eventData, viewer string
+		delivery, err := scanWebhookDelivery(rows.Scan, &hookURL, &secret, &eventData, &viewer)
+		if err != nil {
+			return nil, err
+		}
+		delivery.URL, delivery.Secret, delivery.EventData, delivery.Viewer = hookURL, secret, eventData, viewer
+		deliveries = append(deliveries, delivery)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(deliveries, func(i, j int) bool { return deliveries[i].ID < deliveries[j].ID })
+	return deliveries, nil
+}
+
+// RecordWebhookAttempt speichert das Ergebnis eines Zustellversuchs und hebt die Sperre aus ClaimWebhookDeliveries auf
+//
+// Parameter:
+//   - delivery: Die Zustellung mit Body, aktualisiertem Status, Anzahl der Versuche, Ergebnis und nächstem Versuch
+//
+// Rückgabewert:
+//   - error: Ein Fehler, falls beim Speichern ein Fehler auftritt; "nil", falls nicht
+func (s *sqlStore) RecordWebhookAttempt(delivery webhookDelivery) error {
+	query := `UPDATE webhook_deliveries SET payload = ?, status = ?, attempts = ?, last_status_code = NULLIF(?, 0), last_error = NULLIF(?, ''),
+	next_attempt_at = ?, delivered_at = ?, locked_until = NULL WHERE id = ?`
+	_, err := s.db.Exec(query, string(delivery.Payload), delivery.Status, delivery.Attempts, delivery.LastStatusCode, delivery.LastError,
+		unixSeconds(delivery.NextAttemptAt), unixSeconds(delivery.DeliveredAt), delivery.ID)
+	return err
+}
+
+// PruneWebhookDeliveries entfernt zugestellte und endgültig fehlgeschlagene Zustellungen, die vor dem angegebenen Zeitpunkt angelegt wurden
+// offene Zustellungen bleiben unabhängig von ihrem Alter erhalten
+//
+// Parameter:
+//   - before: Zustellungen, die vor diesem Zeitpunkt angelegt wurden, werden entfernt
+//
+// Rückgabewert:
+//   - pruned: Die Anzahl der entfernten Zustellungen
+//   - error: Ein Fehler, falls beim Entfernen ein Fehler auftritt; "nil", falls nicht
+func (s *sqlStore) PruneWebhookDeliveries(before time.Time) (pruned int64, err error) {
+	result, err := s.db.Exec(`DELETE FROM webhook_deliveries WHERE status != ? AND created_at < ?`, deliveryPending, before.Unix())
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// GetWebhookDeliveries lädt das Protokoll der letzten 100 Zustellungen eines Webhooks
+//
+// Parameter:
+//   - name: Der Name des Benutzers
+//   - webhookID: Die ID des Webhooks
+//
+// Rückgabewert:
+//   - deliveries: Die Zustellungen, die neuesten zuerst
+//   - error: errWebhookNotFound, falls der Webhook nicht dem Benutzer gehört; "nil", falls kein Fehler auftritt
+func (s *sqlStore) GetWebhookDeliveries(name string, webhookID int) ([]webhookDelivery, error) {
+	var exists bool
+	err := s.db.QueryRow(`SELECT EXISTS(SELECT 1 FROM webhooks WHERE id = ? AND user_id = `+userIDSQL+`)`, webhookID, name).Scan(&exists)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, errWebhookNotFound
+	}
+
+	rows, err := s.db.Query(`SELECT `+webhookDeliveryColumns("d")+` FROM webhook_deliveries d WHERE d.webhook_id = ? ORDER BY d.id DESC LIMIT 100`, webhookID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := make([]webhookDelivery, 0)
+	for rows.Next() {
+		delivery, err := scanWebhookDelivery(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	return deliveries, rows.Err()
+}
+
+// RedeliverWebhook legt eine neue Zustellung mit dem Ereignis und Body einer früheren Zustellung an
+// wurde für die frühere Zustellung noch kein Body erstellt, übernimmt die neue das gespeicherte Ereignis
+//
+// Parameter:
+//   - name: Der Name des Benutzers
+//   - webhookID: Die ID des Webhooks
+//   - deliveryID: Die ID der früheren Zustellung
+//
+// Rückgabewert:
+//   - newID: Die ID der neuen Zustellung
+//   - error: errDeliveryNotFound, falls die Zustellung nicht zu einem Webhook des Benutzers gehört; "nil", falls kein Fehler auftritt
+func (s *sqlStore) RedeliverWebhook(name string, webhookID, deliveryID int) (newID int, err error) {
+	query := `INSERT INTO webhook_deliveries (webhook_id, event, payload, event_data, viewer_id, status, created_at, next_attempt_at)
+	SELECT d.webhook_id, d.event, d.payload, d.event_data, d.viewer_id, ?, ?, ? FROM webhook_deliveries d INNER JOIN webhooks w ON w.id = d.webhook_id
+	WHERE d.id = ? AND d.webhook_id = ? AND w.user_id = ` + userIDSQL + ` RETURNING id`
+	now := time.Now().Unix()
+	err = s.db.QueryRow(query, deliveryPending, now, now, deliveryID, webhookID, name).Scan(&newID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, errDeliveryNotFound
+	}
+	return newID, err
+}
+
+// webhookPayloadFor erstellt den Body eines Ereignisses aus dem Stand, den insertWebhookDeliveries mit dem Ereignis gespeichert hat
+// enthält das Ereignis keine Aufgabe bzw. Kategorie, wird nur deren ID gesendet
+//
+// Parameter:
+//   - event: Das Ereignis
+//
+// Rückgabewert:
+//   - []byte: Der Body als JSON
+//   - error: Ein Fehler, falls der Body nicht erstellt werden kann; "nil", falls nicht
+func webhookPayloadFor(event webhookEvent) ([]byte, error) {
+	payload := webhookPayload{Event: event.Type, OccurredAt: event.OccurredAt, User: event.Actor, Action: event.Action, Target: event.Target,
+		Task: event.Task, Category: event.Category}
+	if event.Task == nil {
+		payload.TaskID = event.TaskID
+	}
+	if event.Category == nil {
+		payload.CategoryID = event.CategoryID
+	}
+	return json.Marshal(payload)
+}
+
+// signWebhookPayload berechnet die Signatur eines Bodys, die im Header X-Go-Todo-Signature gesendet wird
+//
+// Parameter:
+//   - secret: Das Geheimnis des Webhooks
+//   - payload: Der Body der Zustellung
+//
+// Rückgabewert:
+//   - string: Die Signatur im Format "sha256=<hex>"
+func signWebhookPayload(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// deliverWebhook führt einen Zustellversuch aus und berechnet den neuen Zustand der Zustellung
+// jede Antwort mit einem Status 2xx gilt als Erfolg, sonst wird der Versuch mit exponentiell wachsendem Abstand wiederholt
+//
+// Parameter:
+//   - client: Der HTTP-Client für den Versand
+//   - delivery: Die Zustellung
+//   - now: Der Zeitpunkt des Versuchs
+//
+// Rückgabewert:
+//   - webhookDelivery: Die Zustellung mit aktualisiertem Status, Ergebnis und nächstem Versuch
+func deliverWebhook(client *http.Client, delivery webhookDelivery, now time.Time) webhookDelivery {
+	delivery.Attempts++
+	delivery.LastStatusCode = 0
+	delivery.LastError = ""
+
+	req, err := http.NewRequest(http.MethodPost, delivery.URL, bytes.NewReader(delivery.Payload))
+	if err == nil {
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("User-Agent", "go-todo-webhooks")
+		req.Header.Set("X-Go-Todo-Event", delivery.Event)
+		req.Header.Set("X-Go-Todo-Delivery", strconv.Itoa(delivery.ID))
+		req.Header.Set("X-Go-Todo-Signature", signWebhookPayload(delivery.Secret, delivery.Payload))
+
+		var resp *http.Response
+		resp, err = client.Do(req)
+		if err == nil {
+			io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+			resp.Body.Close()
+			delivery.LastStatusCode = resp.StatusCode
+			if resp.StatusCode < 200 || resp.StatusCode > 299 {
+				err = fmt.Errorf("Empfänger antwortete mit Status %d", resp.StatusCode)
+			}
+		}
+	}
+
+	if err == nil {
+		delivery.Status = deliveryDelivered
+		delivery.DeliveredAt = &now
+		delivery.NextAttemptAt = nil
+		return delivery
+	}
+	delivery.LastError = err.Error()
+	if delivery.Attempts >= webhookMaxAttempts {
+		delivery.Status = deliveryFailed
+		delivery.NextAttemptAt = nil
+		return delivery
+	}
+	next := now.Add(webhookRetryDelay << (delivery.Attempts - 1))
+	delivery.Status = deliveryPending
+	delivery.NextAttemptAt = &next
+	return delivery
+}
+
+// deliverDueWebhooks beansprucht die fälligen Zustellungen und versendet sie nacheinander
+// Zustellungen ohne Body erhalten ihn vor dem ersten Versuch; kann das gespeicherte Ereignis nicht gelesen werden, gilt die Zustellung als fehlgeschlagen
+//
+// Parameter:
+//   - client: Der HTTP-Client für den Versand
+func (srv *server) deliverDueWebhooks(client *http.Client) {
+	deliveries, err := srv.store.ClaimWebhookDeliveries(time.Now(), webhookClaimLease)
+	if err != nil {
+		log.Println("Webhook-Zustellungen konnten nicht geladen werden:", err)
+		return
+	}
+	for _, delivery := range deliveries {
+		var renderErr error
+		if len(delivery.Payload) == 0 {
+			delivery.Payload, renderErr = renderWebhookPayload(delivery)
+		}
+		if renderErr != nil {
+			delivery.Attempts++
+			delivery.Status = deliveryFailed
+			delivery.LastError = "Ereignis konnte nicht gelesen werden: " + renderErr.Error()
+			delivery.NextAttemptAt = nil
+		} else {
+			delivery = deliverWebhook(client, delivery, time.Now())
+		}
+		err = srv.store.RecordWebhookAttempt(delivery)
+		if err != nil {
+			log.Println("Webhook-Zustellung konnte nicht gespeichert werden:", err)
+		}
+	}
+}
+
+// renderWebhookPayload erstellt den Body einer Zustellung aus dem gespeicherten Ereignis
+//
+// Parameter:
+//   - delivery: Die Zustellung mit EventData
+//
+// Rückgabewert:
+//   - []byte: Der Body als JSON
+//   - error: Ein Fehler, falls das Ereignis nicht gelesen werden kann; "nil", falls nicht
+func renderWebhookPayload(delivery webhookDelivery) ([]byte, error) {
+	var event webhookEvent
+	err := json.Unmarshal([]byte(delivery.EventData), &event)
+	if err != nil {
+		return nil, err
+	}
+	return webhookPayloadFor(event)
+}
+
+// runWebhookDispatcher versendet die Zustellungen, die der Store in der Transaktion einer Änderung angelegt hat
+// fällige Zustellungen werden in regelmäßigen Abständen versendet, nach wakeWebhookDelivery sofort;
+// läuft dauerhaft und sollte daher als Goroutine gestartet werden
+//
+// Parameter:
+//   - interval: Der Abstand, in dem nach fälligen Zustellungen gesucht wird
+func (srv *server) runWebhookDispatcher(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	client := newWebhookClient(webhookAllowPrivate)
+
+	for {
+		srv.deliverDueWebhooks(client)
+		select {
+		case <-ticker.C:
+		case <-srv.webhookWake:
+		}
+	}
+}
+
+// wakeWebhookDelivery veranlasst den sofortigen Versand neuer Zustellungen, ohne auf den nächsten regelmäßigen Durchlauf zu warten
+// die Handler rufen sie nach Änderungen auf, für die der Store Zustellungen angelegt haben kann
+func (srv *server) wakeWebhookDelivery() {
+	select {
+	case srv.webhookWake <- struct{}{}:
+	default:
+	}
+}
+
+// runWebhookPruner entfernt in regelmäßigen Abständen abgeschlossene Zustellungen, die älter als die Aufbewahrungsdauer sind
+// läuft dauerhaft und sollte daher als Goroutine gestartet werden
+//
+// Parameter:
+//   - retention: Die Dauer, für die abgeschlossene Zustellungen im Protokoll bleiben
+//   - interval: Der Abstand zwischen zwei Durchläufen
+func (srv *server) runWebhookPruner(retention, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		pruned, err := srv.store.PruneWebhookDeliveries(time.Now().Add(-retention))
+		if err != nil {
+			log.Println("Webhook-Zustellungen konnten nicht entfernt werden:", err)
+		} else if pruned > 0 {
+			log.Printf("%d abgeschlossene Webhook-Zustellungen entfernt", pruned)
+		}
+		<-ticker.C
+	}
+}
+
+// privateNetworks sind Adressbereiche, die zusätzlich zu den von net.IP erkannten nicht öffentlich erreichbar sind
+var privateNetworks = []*net.IPNet{
+	mustParseCIDR("100.64.0.0/10"),
+	mustParseCIDR("192.0.0.0/24"),
+	mustParseCIDR("198.18.0.0/15"),
+	mustParseCIDR("64:ff9b::/96"),
+}
+
+// mustParseCIDR liest einen Adressbereich und bricht bei einem ungültigen Wert ab
+//
+// Parameter:
+//   - cidr: Der Adressbereich, z.B. 10.0.0.0/8
+//
+// Rückgabewert:
+//   - *net.IPNet: Der gelesene Adressbereich
+func mustParseCIDR(cidr string) *net.IPNet {
+	_, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		panic(err)
+	}
+	return network
+}
+
+// publicWebhookIP prüft, ob ein Webhook an eine Adresse zugestellt werden darf
+// abgelehnt werden Loopback-, Link-Local-, private, Multicast- und unspezifizierte Adressen, damit Webhooks keine internen Dienste erreichen
+//
+// Parameter:
+//   - ip: Die aufgelöste Adresse
+//
+// Rückgabewert:
+//   - bool: "true", falls es sich um eine öffentliche Unicast-Adresse handelt
+func publicWebhookIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() ||
+		ip.IsMulticast() || ip.IsPrivate() || ip.IsUnspecified() {
+		return false
+	}
+	for _, network := range privateNetworks {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// checkWebhookHost löst den Host einer Webhook-Adresse auf und prüft alle Adressen mit publicWebhookIP
+//
+// Parameter:
+//   - host: Der Hostname oder die IP-Adresse
+//
+// Rückgabewert:
+//   - error: errWebhookAddress, falls eine Adresse nicht öffentlich ist; ein Fehler, falls der Host nicht aufgelöst werden kann; "nil", falls nicht
+func checkWebhookHost(host string) error {
+	addrs, err := net.DefaultResolver.LookupIPAddr(context.Background(), host)
+	if err != nil {
+		return err
+	}
+	for _, addr := range addrs {
+		if !publicWebhookIP(addr.IP) {
+			return errWebhookAddress
+		}
+	}
+	return nil
+}
+
+// newWebhookClient erstellt den HTTP-Client für die Zustellungen
+// jede Verbindung wird nach der Namensauflösung mit publicWebhookIP geprüft, das gilt auch für Weiterleitungen und
+// für Hosts, deren DNS-Eintrag sich nach dem Anlegen des Webhooks geändert hat; Proxys aus der Umgebung werden nicht verwendet
+//
+// Parameter:
+//   - allowPrivate: "true", falls auch nicht öffentliche Adressen erreicht werden dürfen, siehe GO_TODO_WEBHOOK_ALLOW_PRIVATE
+//
+// Rückgabewert:
+//   - *http.Client: Der Client
+func newWebhookClient(allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{Timeout: webhookTimeout}
+	if !allowPrivate {
+		dialer.Control = func(network, address string, c syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip := net.ParseIP(host)
+			if ip == nil || !publicWebhookIP(ip) {
+				return errWebhookAddress
+			}
+			return nil
+		}
+	}
+	transport := &http.Transport{DialContext: dialer.DialContext, TLSHandshakeTimeout: webhookTimeout}
+	return &http.Client{Timeout: webhookTimeout, Transport: transport}
+}
+
+// validWebhookURL prüft, ob eine Adresse als Ziel eines Webhooks verwendet werden kann
+//
+// Parameter:
+//   - hookURL: Die Adresse
+//
+// Rückgabewert:
+//   - bool: "true", falls es sich um eine absolute http- oder https-Adresse handelt
+func validWebhookURL(hookURL string) bool {
+	parsed, err := url.Parse(hookURL)
+	return err == nil && (parsed.Scheme == "http" || parsed.Scheme == "https") && parsed.Host != ""
+}
+
+// HandleGetWebhooks sendet alle Webhooks des anfragenden Benutzers ohne Geheimnis
+//
+// Parameter:
+//   - c: Ein Pointer auf ein Context-Objekt von fiber
+//
+// Rückgabewert:
+//   - error: Ein Fehler, falls beim Laden ein Fehler auftritt - wird an Client gesendet
+func (srv *server) HandleGetWebhooks(c *fiber.Ctx) error {
+	name := c.Locals("name").(string)
+
+	hooks, err := srv.store.GetWebhooksForUser(name)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(400).JSON(fiber.Map{"error": "Webhooks konnten nicht geladen werden"})
+	}
+	return c.Status(200).JSON(fiber.Map{"webhooks": hooks, "events": webhookEventTypes})
+}
+
+// HandleAddWebhook legt einen Webhook an, z.B. {"url": "https://example.com/hook", "events": ["task.created"]}
+// ohne Angabe von events werden alle Ereignisse abonniert; nur Administratoren dürfen mit "global": true die Ereignisse aller Benutzer abonnieren
+// das Geheimnis für die Prüfung der Signatur wird nur in dieser Antwort gesendet
+//
+// Parameter:
+//   - c: Ein Pointer auf ein Context-Objekt von fiber
+//
+// Rückgabewert:
+//   - error: Ein Fehler, falls die Eingabe ungültig ist oder beim Anlegen ein Fehler auftritt - wird an Client gesendet
+func (srv *server) HandleAddWebhook(c *fiber.Ctx) error {
+	name := c.Locals("name").(string)
+	type WebhookInput struct {
+		URL    string   `json:"url"`
+		Events []string `json:"events"`
+		Global bool     `json:"global"`
+	}
+	var input WebhookInput
+	if err := c.BodyParser(&input); err != nil {
+		fmt.Println(err)
+		return c.Status(400).JSON(fiber.Map{"error": "Ungültige Eingabedaten"})
+	}
+	if !validWebhookURL(input.URL) {
+		return c.Status(400).JSON(fiber.Map{"error": "Ungültige Adresse, erlaubt sind http- und https-Adressen"})
+	}
+	if !webhookAllowPrivate {
+		parsed, _ := url.Parse(input.URL)
+		err := checkWebhookHost(parsed.Hostname())
+		if errors.Is(err, errWebhookAddress) {
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+		if err != nil {
+			fmt.Println(err)
+			return c.Status(400).JSON(fiber.Map{"error": "Die Adresse konnte nicht aufgelöst werden"})
+		}
+	}
+	if input.Global && !srv.isAdmin(name) {
+		return c.Status(403).JSON(fiber.Map{"error": errForbidden.Error()})
+	}
+
+	events := make([]string, 0, len(input.Events))
+	for _, event := range input.Events {
+		if !containsString(webhookEventTypes, event) {
+			return c.Status(400).JSON(fiber.Map{"error": "Unbekanntes Ereignis " + event + ", erlaubt sind " + strings.Join(webhookEventTypes, ", ")})
+		}
+		if !containsString(events, event) {
+			events = append(events, event)
+		}
+	}
+	if len(events) == 0 {
+		events = webhookEventTypes
+	}
+
+	hook, err := srv.store.AddWebhook(name, input.URL, events, input.Global)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(400).JSON(fiber.Map{"error": "Webhook konnte nicht angelegt werden"})
+	}
+	return c.Status(201).JSON(hook)
+}
+
+// HandleDeleteWebhook entfernt einen Webhook des anfragenden Benutzers inklusive seiner Zustellungen
+//
+// Parameter:
+//   - c: Ein Pointer auf ein Context-Objekt von fiber
+//
+// Rückgabewert:
+//   - error: Ein Fehler, falls der Webhook nicht existiert - wird an Client gesendet
+func (srv *server) HandleDeleteWebhook(c *fiber.Ctx) error {
+	name := c.Locals("name").(string)
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Ungültige Eingabedaten"})
+	}
+
+	err = srv.store.DeleteWebhook(name, id)
+	if errors.Is(err, errWebhookNotFound) {
+		return c.Status(404).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(400).JSON(fiber.Map{"error": "Webhook konnte nicht entfernt werden"})
+	}
+	return c.Status(200).JSON(fiber.Map{"msg": "Webhook erfolgreich entfernt"})
+}
+
+// HandleGetWebhookDeliveries sendet das Protokoll der letzten Zustellungen eines Webhooks
+//
+// Parameter:
+//   - c: Ein Pointer auf ein Context-Objekt von fiber
+//
+// Rückgabewert:
+//   - error: Ein Fehler, falls der Webhook nicht existiert oder beim Laden ein Fehler auftritt - wird an Client gesendet
+func (srv *server) HandleGetWebhookDeliveries(c *fiber.Ctx) error {
+	name := c.Locals("name").(string)
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Ungültige Eingabedaten"})
+	}
+
+	deliveries, err := srv.store.GetWebhookDeliveries(name, id)
+	if errors.Is(err, errWebhookNotFound) {
+		return c.Status(404).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(400).JSON(fiber.Map{"error": "Zustellungen konnten nicht geladen werden"})
+	}
+	return c.Status(200).JSON(fiber.Map{"deliveries": deliveries})
+}
+
+// HandleRedeliverWebhook stellt eine frühere Zustellung erneut zu, der Versand erfolgt im Hintergrund
+//
+// Parameter:
+//   - c: Ein Pointer auf ein Context-Objekt von fiber
+//
+// Rückgabewert:
+//   - error: Ein Fehler, falls die Zustellung nicht existiert - wird an Client gesendet
+//     Bei Erfolg wird die ID der neuen Zustellung an den Client gesendet
+func (srv *server) HandleRedeliverWebhook(c *fiber.Ctx) error {
+	name := c.Locals("name").(string)
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Ungültige Eingabedaten"})
+	}
+	deliveryID, err := strconv.Atoi(c.Params("deliveryId"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Ungültige Eingabedaten"})
+	}
+
+	newID, err := srv.store.RedeliverWebhook(name, id, deliveryID)
+	if errors.Is(err, errDeliveryNotFound) {
+		return c.Status(404).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(400).JSON(fiber.Map{"error": "Zustellung konnte nicht wiederholt werden"})
+	}
+	srv.wakeWebhookDelivery()
+	return c.Status(202).JSON(fiber.Map{"id": newID})
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPublicWebhookIP(t *testing.T) {
+	for address, public := range map[string]bool{
+		"93.184.216.34":    true,
+		"2606:4700::1111":  true,
+		"127.0.0.1":        false,
+		"::1":              false,
+		"10.1.2.3":         false,
+		"172.16.0.1":       false,
+		"192.168.178.1":    false,
+		"169.254.169.254":  false,
+		"100.64.0.1":       false,
+		"0.0.0.0":          false,
+		"fd00::1":          false,
+		"fe80::1":          false,
+		"::ffff:127.0.0.1": false,
+		"224.0.0.1":        false,
+	} {
+		if got := publicWebhookIP(net.ParseIP(address)); got != public {
+			t.Errorf("publicWebhookIP(%s) = %v, erwartet %v", address, got, public)
+		}
+	}
+}
+
+func TestWebhookClientRejectsPrivateAddresses(t *testing.T) {
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer receiver.Close()
+
+	_, err := newWebhookClient(false).Post(receiver.URL, "application/json", nil)
+	if !errors.Is(err, errWebhookAddress) {
+		t.Fatalf("Zustellung an Loopback-Adresse: %v", err)
+	}
+	if err := checkWebhookHost("127.0.0.1"); !errors.Is(err, errWebhookAddress) {
+		t.Fatalf("Prüfung der Loopback-Adresse: %v", err)
+	}
+	resp, err := newWebhookClient(true).Post(receiver.URL, "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+}
+
+func TestDeliverDueWebhooks(t *testing.T) {
+	received := make(chan *http.Request, 10)
+	bodies := make(chan []byte, 10)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- r
+		bodies <- body
+	}))
+	defer receiver.Close()
+
+	store, err := openSQLiteStore(filepath.Join(t.TempDir(), "go-todo.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	srv := newServer(store)
+	addUsers(t, store, "alice")
+	hook, err := store.AddWebhook("alice", receiver.URL, []string{webhookTaskCreated}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	taskID := addTask(t, store, "alice", "Milch kaufen", 0)
+	// der Body enthält den Stand der Änderung, nicht den beim Versand
+	if _, err := store.UpdateTask("alice", task{ID: taskID, Title: "Brot kaufen", Owner: "alice"}); err != nil {
+		t.Fatal(err)
+	}
+
+	srv.deliverDueWebhooks(newWebhookClient(true))
+
+	var r *http.Request
+	select {
+	case r = <-received:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Keine Zustellung empfangen")
+	}
+	body := <-bodies
+	if r.Header.Get("X-Go-Todo-Event") != webhookTaskCreated || r.Header.Get("X-Go-Todo-Signature") != signWebhookPayload(hook.Secret, body) {
+		t.Fatalf("Header der Zustellung: %v", r.Header)
+	}
+	var payload webhookPayload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		t.Fatal(err)
+	}
+	if payload.User != "alice" || payload.Task == nil || payload.Task.ID != taskID || payload.Task.Title != "Milch kaufen" {
+		t.Fatalf("Body der Zustellung: %s", body)
+	}
+
+	deliveries, err := store.GetWebhookDeliveries("alice", hook.ID)
+	if err != nil || len(deliveries) != 1 || deliveries[0].Status != deliveryDelivered || string(deliveries[0].Payload) != string(body) {
+		t.Fatalf("Protokoll nach der Zustellung: %+v, %v", deliveries, err)
+	}
+}
+
+func TestWebhookDeliveriesForDueArchiveAndRestore(t *testing.T) {
+	store, err := openSQLiteStore(filepath.Join(t.TempDir(), "go-todo.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	addUsers(t, store, "alice")
+	taskID := addTask(t, store, "alice", "Milch kaufen", 0)
+	hook, err := store.AddWebhook("alice", "https://example.com/hook", []string{webhookTaskUpdated}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	due := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	if err := store.SetTaskDue("alice", taskID, &due); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.ArchiveTask("alice", taskID); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.UnarchiveTask("alice", taskID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.DeleteTask("alice", taskID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.RestoreTask("alice", taskID); err != nil {
+		t.Fatal(err)
+	}
+
+	deliveries, err := store.GetWebhookDeliveries("alice", hook.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deliveries) != 4 {
+		t.Fatalf("%d Zustellungen, erwartet 4: %+v", len(deliveries), deliveries)
+	}
+	for _, delivery := range deliveries {
+		if delivery.Event != webhookTaskUpdated || delivery.Status != deliveryPending {
+			t.Fatalf("Zustellung: %+v", delivery)
+		}
+	}
+}
+
+func TestWebhookDeliveriesForDeletedAccount(t *testing.T) {
+	store, err := openSQLiteStore(filepath.Join(t.TempDir(), "go-todo.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	addUsers(t, store, "admin", "alice", "bob")
+	hook, err := store.AddWebhook("admin", "https://example.com/hook", []string{webhookTaskDeleted}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	shared := addTask(t, store, "alice", "Gemeinsam", 0)
+	if err := store.ShareTask("alice", shared, "bob"); err != nil {
+		t.Fatal(err)
+	}
+	addTask(t, store, "alice", "Privat", 0)
+
+	deletion, err := store.DeleteUser("alice", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deletion.Removed) != 1 || len(deletion.Removed[shared]) != 1 {
+		t.Fatalf("Entfernte Freigaben: %v", deletion.Removed)
+	}
+	// auch die nicht freigegebene Aufgabe löst task.deleted aus
+	deliveries, err := store.GetWebhookDeliveries("admin", hook.ID)
+	if err != nil || len(deliveries) != 2 {
+		t.Fatalf("Zustellungen: %+v, %v", deliveries, err)
+	}
+}